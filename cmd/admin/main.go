@@ -0,0 +1,189 @@
+// Command admin runs one-off maintenance tasks against the StockSaaS database.
+//
+// Usage:
+//
+//	go run ./cmd/admin <command> [flags]
+//
+// Commands:
+//
+//	unlock-login   Clear failed login attempts and lockouts for an email and/or IP
+//	set-role       Change a user's role (use it to create the first admin)
+//	reencrypt-credentials
+//	               Re-encrypt stored broker tokens and TOTP secrets with the active encryption key
+//	unwrap-double-encrypted
+//	               Repair broker tokens that were stored encrypted twice
+//	generate-kek   Write a new key-encryption key file for the local key provider
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/adapter/keyprovider"
+	"github.com/AMANSRI99/StockSaaS/internal/adapter/persistence/postgres"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+	"github.com/AMANSRI99/StockSaaS/internal/common/encryptutil"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	// Runs before loading config: the key provider setup may point at the file it creates
+	if os.Args[1] == "generate-kek" {
+		fs := flag.NewFlagSet("generate-kek", flag.ExitOnError)
+		file := fs.String("file", "", "path of the new key file (must not exist)")
+		fs.Parse(os.Args[2:])
+		if *file == "" {
+			log.Fatal("-file is required")
+		}
+		if err := encryptutil.WriteLocalKEKFile(*file); err != nil {
+			log.Fatalf("Failed to generate key-encryption key: %v", err)
+		}
+		log.Printf("Wrote key-encryption key to %s; set ENCRYPTION_KEY_PROVIDER=local and ENCRYPTION_LOCAL_KEK_FILE", *file)
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	keyring, err := keyprovider.NewKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	db, err := postgres.NewConnection(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch os.Args[1] {
+	case "unlock-login":
+		fs := flag.NewFlagSet("unlock-login", flag.ExitOnError)
+		email := fs.String("email", "", "email address to unlock")
+		ip := fs.String("ip", "", "client IP address to unlock")
+		fs.Parse(os.Args[2:])
+
+		if cfg.LoginProtection.Store != "postgres" {
+			log.Fatalf("unlock-login only works with LOGIN_ATTEMPT_STORE=postgres (in-memory counters live inside the API process)")
+		}
+
+		userSvc := service.NewUserService(
+			postgres.NewPostgresUserRepo(db),
+			postgres.NewPostgresLoginAttemptStore(db),
+			keyring,
+			*cfg,
+		)
+		if err := userSvc.UnlockLogin(ctx, *email, *ip); err != nil {
+			log.Fatalf("Failed to unlock login: %v", err)
+		}
+		log.Printf("Login unlocked (email: '%s', ip: '%s')", *email, *ip)
+
+	case "set-role":
+		fs := flag.NewFlagSet("set-role", flag.ExitOnError)
+		email := fs.String("email", "", "email address of the user")
+		role := fs.String("role", "", "new role: user, support or admin")
+		fs.Parse(os.Args[2:])
+
+		if !model.IsValidRole(*role) {
+			log.Fatalf("Invalid role '%s' (expected user, support or admin)", *role)
+		}
+
+		userRepo := postgres.NewPostgresUserRepo(db)
+		user, err := userRepo.FindByEmail(ctx, *email)
+		if err != nil {
+			log.Fatalf("Failed to find user '%s': %v", *email, err)
+		}
+		if err := userRepo.SetRole(ctx, user.ID, *role); err != nil {
+			log.Fatalf("Failed to set role: %v", err)
+		}
+		// Tokens carry the role claim, so make the user log in again
+		if err := userRepo.RevokeSessions(ctx, user.ID, time.Now().UTC()); err != nil {
+			log.Fatalf("Failed to revoke sessions: %v", err)
+		}
+		log.Printf("User %s (%s) now has role '%s'", user.Email, user.ID, *role)
+
+	case "reencrypt-credentials":
+		fs := flag.NewFlagSet("reencrypt-credentials", flag.ExitOnError)
+		batchSize := fs.Int("batch-size", 100, "rows per batch")
+		fs.Parse(os.Args[2:])
+
+		// Every secret written through the keyring has to move off the old keys before they can go
+		log.Printf("Re-encrypting broker credentials with key '%s'", keyring.ActiveKeyID())
+		brokerRepo := postgres.NewPostgresBrokerRepo(db, keyring, cfg.Encryption.AllowUnboundCredentials)
+		brokerStats, brokerErr := brokerRepo.ReencryptAccessTokens(ctx, *batchSize)
+
+		log.Printf("Re-encrypting TOTP secrets with key '%s'", keyring.ActiveKeyID())
+		userSvc := service.NewUserService(
+			postgres.NewPostgresUserRepo(db),
+			postgres.NewPostgresLoginAttemptStore(db),
+			keyring,
+			*cfg,
+		)
+		totpStats, totpErr := userSvc.ReencryptTOTPSecrets(ctx, *batchSize)
+
+		ok := reportRewrite("Broker credentials", brokerStats, brokerErr)
+		ok = reportRewrite("TOTP secrets", totpStats, totpErr) && ok
+		if !ok {
+			log.Fatalf("Some secrets are still on old keys; keep those keys in ENCRYPTION_KEYS and check the log above")
+		}
+		log.Printf("All secrets are encrypted with key '%s' and bound to their owner; older keys are no longer used", keyring.ActiveKeyID())
+
+	case "unwrap-double-encrypted":
+		fs := flag.NewFlagSet("unwrap-double-encrypted", flag.ExitOnError)
+		batchSize := fs.Int("batch-size", 100, "rows per batch")
+		fs.Parse(os.Args[2:])
+
+		log.Println("Looking for broker tokens that were encrypted twice")
+		brokerRepo := postgres.NewPostgresBrokerRepo(db, keyring, cfg.Encryption.AllowUnboundCredentials)
+		stats, err := brokerRepo.UnwrapDoubleEncryptedTokens(ctx, *batchSize)
+		if !reportRewrite("Broker credentials", stats, err) {
+			log.Fatalf("Some rows could not be repaired; check the log above")
+		}
+
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: admin <command> [flags]
+
+Commands:
+  unlock-login -email <email> [-ip <address>]   Clear failed login attempts and lockouts
+  set-role -email <email> -role <role>          Change a user's role (user, support, admin)
+  reencrypt-credentials [-batch-size <n>]       Re-encrypt broker tokens and TOTP secrets with the active key
+  unwrap-double-encrypted [-batch-size <n>]     Repair broker tokens that were encrypted twice
+  generate-kek -file <path>                     Write a new KEK file for ENCRYPTION_KEY_PROVIDER=local`)
+}
+
+// reportRewrite logs the outcome of a secret rewrite and reports whether every row is done.
+func reportRewrite(what string, stats repository.RewriteStats, err error) bool {
+	if err != nil {
+		log.Printf("%s: stopped after %d rows: %v", what, stats.Scanned, err)
+		return false
+	}
+	log.Printf("%s: %d scanned, %d rewritten, %d changed concurrently, %d failed",
+		what, stats.Scanned, stats.Rewritten, stats.Skipped, stats.Failed)
+	if stats.Failed > 0 {
+		log.Printf("%s: %d rows could not be decrypted and are still on their old key", what, stats.Failed)
+		return false
+	}
+	return true
+}
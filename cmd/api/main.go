@@ -7,11 +7,26 @@ import (
 	kiteAdapter "github.com/AMANSRI99/StockSaaS/internal/adapter/broker/kiteconnect"
 	"github.com/AMANSRI99/StockSaaS/internal/adapter/http/handler"
 	httpMw "github.com/AMANSRI99/StockSaaS/internal/adapter/http/middleware"
+	"github.com/AMANSRI99/StockSaaS/internal/adapter/keyprovider"
+	"github.com/AMANSRI99/StockSaaS/internal/adapter/persistence/memory"
 	"github.com/AMANSRI99/StockSaaS/internal/adapter/persistence/postgres"
+	"github.com/AMANSRI99/StockSaaS/internal/app/charges"
+	"github.com/AMANSRI99/StockSaaS/internal/app/jobqueue"
+	"github.com/AMANSRI99/StockSaaS/internal/app/market"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/scheduler"
 	"github.com/AMANSRI99/StockSaaS/internal/app/service"
 	"github.com/AMANSRI99/StockSaaS/internal/config"
 
+	"context"
+	"database/sql"
+	"errors"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	echoMw "github.com/labstack/echo/v4/middleware"
@@ -34,28 +49,97 @@ func main() {
 		}
 	}()
 
+	keyring, err := keyprovider.NewKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if cfg.Encryption.AllowUnboundCredentials {
+		log.Println("Warning: credentials not bound to their owner are accepted (ENCRYPTION_ALLOW_UNBOUND_CREDENTIALS). " +
+			"Run `admin reencrypt-credentials`, then set it to false; the default changes to false in a later release.")
+	}
+
+	chargesCalc, err := charges.NewCalculator(cfg.Charges.RatesFile)
+	if err != nil {
+		log.Fatalf("Failed to load charges rates: %v", err)
+	}
+
+	marketCalendar, err := market.NewCalendar(cfg.Market.HolidaysFile)
+	if err != nil {
+		log.Fatalf("Failed to load market calendar: %v", err)
+	}
+
 	e := echo.New()
+	// Client IPs feed login brute-force protection, so only trust proxy headers when configured
+	if cfg.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
 	e.Use(echoMw.Logger())
 	e.Use(echoMw.Recover())
 
 	// --- Initialize Repositories ---
 	basketRepo := postgres.NewPostgresBasketRepo(db)
 	userRepo := postgres.NewPostgresUserRepo(db)
-	brokerRepo := postgres.NewPostgresBrokerRepo(db, cfg.EncryptionKey)
+	loginAttemptStore := newLoginAttemptStore(cfg.LoginProtection.Store, db)
+	brokerRepo := postgres.NewPostgresBrokerRepo(db, keyring, cfg.Encryption.AllowUnboundCredentials)
+	apiKeyRepo := postgres.NewPostgresAPIKeyRepo(db)
+	orgRepo := postgres.NewPostgresOrganizationRepo(db)
+	oauthStateRepo := postgres.NewPostgresOAuthStateRepo(db)
+	executionRepo := postgres.NewPostgresExecutionRepo(db)
+	scheduleRepo := postgres.NewPostgresScheduleRepo(db)
+	gttRepo := postgres.NewPostgresGTTRepo(db)
+	instrumentRepo := postgres.NewPostgresInstrumentRepo(db)
+	jobRepo := postgres.NewPostgresJobRepo(db)
 
-	kiteAdpt := kiteAdapter.NewAdapter(cfg.Kite.APIKey)
+	kiteAdpt := kiteAdapter.NewAdapter(cfg.Kite.APIKey, cfg.Kite.RateLimit)
 	// --- Initialize Services ---
-	basketSvc := service.NewBasketService(basketRepo)
-	userSvc := service.NewUserService(userRepo, *cfg)
-	kiteSvc := service.NewKiteService(kiteAdpt, brokerRepo, *cfg)
+	basketSvc := service.NewBasketService(basketRepo, orgRepo)
+	userSvc := service.NewUserService(userRepo, loginAttemptStore, keyring, *cfg)
+	kiteSvc := service.NewKiteService(kiteAdpt, brokerRepo, oauthStateRepo, *cfg)
+	apiKeySvc := service.NewAPIKeyService(apiKeyRepo)
+	adminSvc := service.NewAdminService(userRepo, brokerRepo, instrumentRepo)
+	orgSvc := service.NewOrganizationService(orgRepo, userRepo)
+	brokerSvc := service.NewBrokerService(kiteAdpt, brokerRepo)
+	executionSvc := service.NewExecutionService(executionRepo, basketRepo, orgRepo, brokerRepo, instrumentRepo, brokerSvc, kiteAdpt, chargesCalc, marketCalendar, *cfg)
+	jobSvc := service.NewJobService(jobRepo, basketRepo, orgRepo, brokerRepo, marketCalendar, cfg.Jobs)
+	scheduleSvc := service.NewScheduleService(scheduleRepo, basketRepo, orgRepo, jobSvc, marketCalendar)
+	gttSvc := service.NewGTTService(gttRepo, basketRepo, orgRepo, executionRepo, brokerRepo, kiteAdpt)
+
+	// --- Background Jobs ---
+	// Stopped on SIGINT/SIGTERM, see the shutdown at the end
+	jobsCtx, stopJobs := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopJobs()
+	scheduler.New(
+		scheduler.NewBrokerTokenExpiryJob(brokerRepo, cfg.Kite.TokenSweepInterval),
+		scheduler.NewOAuthStateCleanupJob(oauthStateRepo, time.Hour),
+		scheduler.NewBasketScheduleJob(scheduleSvc, cfg.Schedule.PollInterval),
+		scheduler.NewQueuedExecutionReleaseJob(executionSvc, time.Minute),
+	).Start(jobsCtx)
+	// Workers placing queued basket executions; jobs left by a previous run are picked up too
+	jobQueue := jobqueue.New(jobRepo, cfg.Jobs, jobqueue.BasketHandlers(executionSvc))
+	jobQueue.Start(jobsCtx)
 
 	// --- Initialize Handlers ---
 	basketHandler := handler.NewBasketHandler(basketSvc) // Pass basket service
 	authHandler := handler.NewAuthHandler(userSvc)       // <-- Instantiate Auth Handler
 	kiteHandler := handler.NewKiteHandler(kiteAdpt, kiteSvc, *cfg)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeySvc)
+	adminHandler := handler.NewAdminHandler(adminSvc, userSvc)
+	orgHandler := handler.NewOrganizationHandler(orgSvc)
+	brokerHandler := handler.NewBrokerHandler(brokerSvc)
+	executionHandler := handler.NewExecutionHandler(executionSvc, jobSvc)
+	jobHandler := handler.NewJobHandler(jobSvc)
+	chargesHandler := handler.NewChargesHandler(chargesCalc)
+	scheduleHandler := handler.NewScheduleHandler(scheduleSvc)
+	gttHandler := handler.NewGTTHandler(gttSvc)
+	marketHandler := handler.NewMarketHandler(marketCalendar)
 
 	//Initialising auth middleware
-	authMiddleware := httpMw.NewJWTAuthMiddleware(cfg.JWT.SecretKey)
+	// userSvc rejects disabled accounts and tokens issued before a forced logout
+	authMiddleware := httpMw.NewJWTAuthMiddleware(cfg.JWT.SecretKey, userSvc)
+	// Accepts a JWT or a personal API key; pair with RequireScope per route
+	apiAuthMiddleware := httpMw.NewAuthMiddleware(cfg.JWT.SecretKey, apiKeySvc, userSvc)
 	// --- Routes ---
 	// Group API routes (good practice)
 	apiGroup := e.Group("/api")
@@ -65,9 +149,21 @@ func main() {
 		{
 			authGroup.POST("/signup", authHandler.Signup) // <-- Register Signup Route
 			authGroup.POST("/login", authHandler.Login)
+			authGroup.POST("/login/mfa", authHandler.LoginMFA) // Second step when TOTP is enabled
+
+			// Two-factor management (requires a logged-in user)
+			mfaGroup := authGroup.Group("/mfa", authMiddleware)
+			{
+				mfaGroup.POST("/totp/enroll", authHandler.EnrollTOTP)
+				mfaGroup.POST("/totp/confirm", authHandler.ConfirmTOTP)
+				mfaGroup.POST("/totp/disable", authHandler.DisableTOTP)
+				mfaGroup.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+			}
 		}
 
-		kiteGroup := apiGroup.Group("/kite", authMiddleware) // Group for authenticated kite actions
+		// No group-level auth: the callback is Kite's browser redirect, which carries
+		// no JWT. It identifies the user by the OAuth state instead.
+		kiteGroup := apiGroup.Group("/kite")
 		{
 			// Endpoint to start the connection flow
 			kiteGroup.GET("/connect/initiate", kiteHandler.InitiateKiteConnect, authMiddleware)
@@ -76,14 +172,123 @@ func main() {
 
 		}
 
-		// Basket routes (will add auth middleware later)
-		basketGroup := apiGroup.Group("/baskets", authMiddleware)
+		// Linked broker accounts (connecting goes through /kite/connect)
+		brokerGroup := apiGroup.Group("/brokers", authMiddleware)
+		{
+			brokerGroup.GET("", brokerHandler.ListConnections)
+			brokerGroup.DELETE("/:broker", brokerHandler.Disconnect)
+		}
+		// The linked broker account itself
+		brokerAccountGroup := apiGroup.Group("/broker", authMiddleware)
+		{
+			brokerAccountGroup.GET("/profile", brokerHandler.GetProfile)
+			brokerAccountGroup.GET("/margins", brokerHandler.GetMargins)
+		}
+
+		// Trade charges calculator
+		chargesGroup := apiGroup.Group("/charges", authMiddleware)
+		{
+			chargesGroup.POST("/calculate", chargesHandler.Calculate)
+		}
+
+		// API key management (interactive login only, an API key can't mint other keys)
+		apiKeyGroup := apiGroup.Group("/api-keys", authMiddleware)
+		{
+			apiKeyGroup.POST("", apiKeyHandler.CreateAPIKey)
+			apiKeyGroup.GET("", apiKeyHandler.ListAPIKeys)
+			apiKeyGroup.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+		}
+
+		// Team workspaces (interactive login only). Shared baskets are managed via /baskets.
+		orgGroup := apiGroup.Group("/organizations", authMiddleware)
+		{
+			orgGroup.POST("", orgHandler.CreateOrganization)
+			orgGroup.GET("", orgHandler.ListOrganizations)
+			orgGroup.POST("/invitations/accept", orgHandler.AcceptInvitation)
+			orgGroup.GET("/:id", orgHandler.GetOrganization)
+			orgGroup.DELETE("/:id", orgHandler.DeleteOrganization)
+			orgGroup.GET("/:id/members", orgHandler.ListMembers)
+			orgGroup.PUT("/:id/members/:userId", orgHandler.UpdateMember)
+			orgGroup.DELETE("/:id/members/:userId", orgHandler.RemoveMember)
+			orgGroup.POST("/:id/invitations", orgHandler.InviteMember)
+			orgGroup.GET("/:id/invitations", orgHandler.ListInvitations)
+			orgGroup.DELETE("/:id/invitations/:invitationId", orgHandler.RevokeInvitation)
+		}
+
+		// Admin routes (support can look and log users out, only admins can change accounts)
+		adminOnly := httpMw.RequireRole(model.RoleAdmin)
+		adminGroup := apiGroup.Group("/admin", authMiddleware, httpMw.RequireRole(model.RoleSupport, model.RoleAdmin))
 		{
-			basketGroup.POST("", basketHandler.CreateBasket)
-			basketGroup.GET("", basketHandler.ListBaskets)
-			basketGroup.GET("/:id", basketHandler.GetBasketByID)
-			basketGroup.DELETE("/:id", basketHandler.DeleteBasketByID)
-			basketGroup.PUT("/:id", basketHandler.UpdateBasket)
+			adminGroup.GET("/users", adminHandler.ListUsers)
+			adminGroup.GET("/users/:id", adminHandler.GetUser)
+			adminGroup.GET("/users/:id/brokers", adminHandler.GetBrokerConnections)
+			adminGroup.POST("/users/:id/logout", adminHandler.ForceLogout)
+			adminGroup.POST("/users/:id/disable", adminHandler.DisableUser, adminOnly)
+			adminGroup.POST("/users/:id/enable", adminHandler.EnableUser, adminOnly)
+			adminGroup.PUT("/users/:id/role", adminHandler.SetUserRole, adminOnly)
+			adminGroup.POST("/login-lockouts/unlock", adminHandler.UnlockLogin)
+			adminGroup.GET("/instruments", adminHandler.ListInstruments)
+			adminGroup.PUT("/instruments", adminHandler.UpsertInstruments, adminOnly)
+			adminGroup.GET("/jobs", jobHandler.ListJobs)
+			adminGroup.POST("/jobs/:id/retry", jobHandler.RetryJob, adminOnly)
+		}
+
+		// Basket routes (JWT or API key with the matching scope)
+		canReadBaskets := httpMw.RequireScope(model.ScopeBasketsRead)
+		canWriteBaskets := httpMw.RequireScope(model.ScopeBasketsWrite)
+		canExecuteOrders := httpMw.RequireScope(model.ScopeOrdersExecute)
+		basketGroup := apiGroup.Group("/baskets", apiAuthMiddleware)
+		{
+			basketGroup.POST("", basketHandler.CreateBasket, canWriteBaskets)
+			basketGroup.GET("", basketHandler.ListBaskets, canReadBaskets)
+			basketGroup.GET("/:id", basketHandler.GetBasketByID, canReadBaskets)
+			basketGroup.DELETE("/:id", basketHandler.DeleteBasketByID, canWriteBaskets)
+			basketGroup.PUT("/:id", basketHandler.UpdateBasket, canWriteBaskets)
+
+			// Execution at the broker
+			basketGroup.POST("/:id/margin", executionHandler.CheckMargin, canReadBaskets)
+			basketGroup.POST("/:id/execute", executionHandler.ExecuteBasket, canExecuteOrders)
+			basketGroup.POST("/:id/exit", executionHandler.ExitBasket, canExecuteOrders)
+			basketGroup.POST("/:id/protect", gttHandler.ProtectBasket, canExecuteOrders)
+			basketGroup.GET("/:id/executions", executionHandler.ListBasketExecutions, canReadBaskets)
+		}
+		executionGroup := apiGroup.Group("/executions", apiAuthMiddleware)
+		{
+			executionGroup.GET("/:id", executionHandler.GetExecution, canReadBaskets)
+			executionGroup.GET("/:id/events", executionHandler.ListOrderEvents, canReadBaskets)
+			executionGroup.PUT("/:id/orders/:orderId", executionHandler.ModifyOrder, canExecuteOrders)
+			executionGroup.DELETE("/:id/orders/:orderId", executionHandler.CancelOrder, canExecuteOrders)
+			executionGroup.POST("/:id/cancel", executionHandler.CancelOpenOrders, canExecuteOrders)
+		}
+		// Background jobs: queued executions and exits
+		jobGroup := apiGroup.Group("/jobs", apiAuthMiddleware)
+		{
+			jobGroup.GET("/:id", jobHandler.GetJob, canReadBaskets)
+		}
+
+		// Market hours (public information)
+		apiGroup.GET("/market/status", marketHandler.Status)
+
+		// Recurring executions (SIPs); changing one changes what gets executed later
+		scheduleGroup := apiGroup.Group("/schedules", apiAuthMiddleware)
+		{
+			scheduleGroup.POST("", scheduleHandler.CreateSchedule, canExecuteOrders)
+			scheduleGroup.GET("", scheduleHandler.ListSchedules, canReadBaskets)
+			scheduleGroup.GET("/:id", scheduleHandler.GetSchedule, canReadBaskets)
+			scheduleGroup.PUT("/:id", scheduleHandler.UpdateSchedule, canExecuteOrders)
+			scheduleGroup.DELETE("/:id", scheduleHandler.DeleteSchedule, canExecuteOrders)
+			scheduleGroup.GET("/:id/runs", scheduleHandler.ListRuns, canReadBaskets)
+			scheduleGroup.POST("/:id/runs/:runId/retry", scheduleHandler.RetryRun, canExecuteOrders)
+		}
+
+		// GTT stop-loss and target triggers, held at the broker until they fire
+		gttGroup := apiGroup.Group("/gtts", apiAuthMiddleware)
+		{
+			gttGroup.POST("", gttHandler.CreateGTT, canExecuteOrders)
+			gttGroup.GET("", gttHandler.ListGTTs, canReadBaskets)
+			gttGroup.GET("/:id", gttHandler.GetGTT, canReadBaskets)
+			gttGroup.PUT("/:id", gttHandler.ModifyGTT, canExecuteOrders)
+			gttGroup.DELETE("/:id", gttHandler.DeleteGTT, canExecuteOrders)
 		}
 	}
 
@@ -93,5 +298,36 @@ func main() {
 
 	serverPort := ":" + cfg.ServerPort
 	log.Printf("Starting Echo server on port %s\n", serverPort)
-	e.Logger.Fatal(e.Start(serverPort))
+	go func() {
+		if err := e.Start(serverPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// --- Graceful Shutdown ---
+	// Stop taking requests, let the ones in flight finish, then wait for running jobs: a
+	// worker killed halfway through placing a basket's orders leaves it to be resumed later.
+	<-jobsCtx.Done()
+	stopJobs() // A second signal kills the process
+	log.Println("Shutting down: finishing requests in flight and running jobs")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Jobs.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down the HTTP server: %v", err)
+	}
+	deadline, _ := shutdownCtx.Deadline()
+	if !jobQueue.Wait(time.Until(deadline)) {
+		log.Println("Jobs still running at the shutdown timeout; they will be picked up again by another worker")
+	}
+	log.Println("Shutdown complete")
+}
+
+// newLoginAttemptStore picks the brute-force counter store from config.
+// The in-memory store is per-process, so use Postgres when running more than one instance.
+func newLoginAttemptStore(kind string, db *sql.DB) repository.LoginAttemptStore {
+	if kind == "memory" {
+		log.Println("Using in-memory login attempt store (not shared between instances)")
+		return memory.NewLoginAttemptStore()
+	}
+	return postgres.NewPostgresLoginAttemptStore(db)
 }
@@ -1,21 +1,35 @@
 package kiteconnect
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+
+	"github.com/google/uuid"
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
-// Adapter wraps the Kite Connect client.
+// Adapter wraps the Kite Connect client. Calls are rate limited per API key and
+// transient failures retried (see callLimiter), so they may block until ctx is done.
 type Adapter struct {
-	client *kiteconnect.Client
+	client  *kiteconnect.Client
+	apiKey  string // For per-user clients (the shared client has no access token)
+	limiter *callLimiter
 }
 
 // NewAdapter creates a new Kite Connect client instance.
-func NewAdapter(apiKey string) *Adapter {
+func NewAdapter(apiKey string, limits config.KiteRateLimitConfig) *Adapter {
 	client := kiteconnect.New(apiKey)
 	return &Adapter{
-		client: client,
+		client:  client,
+		apiKey:  apiKey,
+		limiter: limiterFor(apiKey, limits),
 	}
 }
 
@@ -27,16 +41,399 @@ func (a *Adapter) GetLoginURL() string {
 	// We will append the state parameter manually in the handler before redirecting.
 }
 
+// GetLoginURLWithState returns the login URL with a state that Kite passes back to the
+// redirect URL as the "state" query parameter (via redirect_params).
+func (a *Adapter) GetLoginURLWithState(state string) string {
+	return a.client.GetLoginURLWithparams(url.Values{"state": {state}})
+}
+
 // GenerateSession exchanges a request token for an access token and user session details.
 // (This method remains unchanged and matches the example's usage)
-func (a *Adapter) GenerateSession(requestToken, apiSecret string) (kiteconnect.UserSession, error) {
-	userSession, err := a.client.GenerateSession(requestToken, apiSecret)
+func (a *Adapter) GenerateSession(ctx context.Context, requestToken, apiSecret string) (kiteconnect.UserSession, error) {
+	// Request tokens are single use: only retry when Kite refused the call unprocessed
+	var userSession kiteconnect.UserSession
+	err := a.limiter.call(ctx, "generate session", endpointOthers, false, func() (err error) {
+		userSession, err = a.client.GenerateSession(requestToken, apiSecret)
+		return err
+	})
 	if err != nil {
 		return kiteconnect.UserSession{}, fmt.Errorf("kite connect generate session failed: %w", err)
 	}
 	return userSession, nil
 }
 
-// --- We will add other methods later for placing orders, getting profile etc. ---
-// func (a *Adapter) PlaceOrder(...) (...)
-// func (a *Adapter) GetUserProfile(...) (...)
+// userClient returns a client for calls made on behalf of a user. A client per call:
+// setting the token on the shared client would race with other users' requests.
+func (a *Adapter) userClient(accessToken string) *kiteconnect.Client {
+	client := kiteconnect.New(a.apiKey)
+	client.SetAccessToken(accessToken)
+	return client
+}
+
+// GetUserProfile fetches the Kite account's profile.
+func (a *Adapter) GetUserProfile(ctx context.Context, accessToken string) (model.BrokerProfile, error) {
+	var profile kiteconnect.UserProfile
+	err := a.limiter.call(ctx, "get profile", endpointOthers, true, func() (err error) {
+		profile, err = a.userClient(accessToken).GetUserProfile()
+		return err
+	})
+	if err != nil {
+		return model.BrokerProfile{}, fmt.Errorf("kite connect get profile failed: %w", err)
+	}
+	return model.BrokerProfile{
+		Broker:       model.BrokerKite,
+		BrokerUserID: profile.UserID,
+		UserName:     profile.UserName,
+		ShortName:    profile.UserShortName,
+		Email:        profile.Email,
+		Exchanges:    profile.Exchanges,
+		Products:     profile.Products,
+		OrderTypes:   profile.OrderTypes,
+	}, nil
+}
+
+// GetUserMargins fetches funds and margins for the equity and commodity segments.
+func (a *Adapter) GetUserMargins(ctx context.Context, accessToken string) (model.BrokerMargins, error) {
+	var margins kiteconnect.AllMargins
+	err := a.limiter.call(ctx, "get margins", endpointOthers, true, func() (err error) {
+		margins, err = a.userClient(accessToken).GetUserMargins()
+		return err
+	})
+	if err != nil {
+		return model.BrokerMargins{}, fmt.Errorf("kite connect get margins failed: %w", err)
+	}
+	return model.BrokerMargins{
+		Equity:    toSegmentMargins(margins.Equity),
+		Commodity: toSegmentMargins(margins.Commodity),
+	}, nil
+}
+
+func toSegmentMargins(m kiteconnect.Margins) model.SegmentMargins {
+	return model.SegmentMargins{
+		Enabled:        m.Enabled,
+		Net:            m.Net,
+		Cash:           m.Available.Cash,
+		LiveBalance:    m.Available.LiveBalance,
+		OpeningBalance: m.Available.OpeningBalance,
+		Collateral:     m.Available.Collateral,
+		IntradayPayin:  m.Available.IntradayPayin,
+		Utilised:       m.Used.Debits,
+	}
+}
+
+// InvalidateAccessToken logs the user's session out at Kite, so the token can't be used anymore.
+func (a *Adapter) InvalidateAccessToken(ctx context.Context, accessToken string) error {
+	err := a.limiter.call(ctx, "invalidate access token", endpointOthers, true, func() error {
+		_, err := a.userClient(accessToken).InvalidateAccessToken()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("kite connect invalidate access token failed: %w", err)
+	}
+	return nil
+}
+
+// IsOrderError reports whether err is Kite refusing an order or order change itself
+// (e.g. the order is already complete, or a price is outside the circuit limits),
+// as opposed to a session or network problem.
+func IsOrderError(err error) bool {
+	var kiteErr kiteconnect.Error
+	return errors.As(err, &kiteErr) && (kiteErr.ErrorType == kiteconnect.OrderError || kiteErr.ErrorType == kiteconnect.InputError)
+}
+
+// IsTokenError reports whether err is Kite rejecting the access token (expired or invalidated).
+func IsTokenError(err error) bool {
+	var kiteErr kiteconnect.Error
+	return errors.As(err, &kiteErr) && kiteErr.ErrorType == kiteconnect.TokenError
+}
+
+// IsUncertainFailure reports whether a failed call may still have taken effect at Kite:
+// the request or its response was lost, or Kite failed with a server error.
+func IsUncertainFailure(err error) bool {
+	return classifyFailure(err) == failureUncertain
+}
+
+// PlaceOrder places an order tagged with tag (see OrderTag) and returns Kite's order ID.
+// An accepted order can still be rejected later by the exchange or Kite's risk checks.
+// Only calls Kite refused (rate limit) are retried. A failure that may have placed the
+// order anyway (see IsUncertainFailure) is returned as is: the caller finds out from the
+// day's orders, by tag, whether it went through.
+func (a *Adapter) PlaceOrder(ctx context.Context, accessToken string, order model.OrderParams, tag string) (string, error) {
+	params := kiteconnect.OrderParams{
+		Exchange:        order.Exchange,
+		Tradingsymbol:   order.Symbol,
+		Validity:        kiteconnect.ValidityDay,
+		Product:         order.Product,
+		OrderType:       order.OrderType,
+		TransactionType: order.TransactionType,
+		Quantity:        order.Quantity,
+	}
+	if order.Price != nil {
+		params.Price = *order.Price
+	}
+	if order.TriggerPrice != nil {
+		params.TriggerPrice = *order.TriggerPrice
+	}
+	if order.Variety == model.VarietyIceberg {
+		params.IcebergLegs = order.IcebergLegs
+		params.IcebergQty = order.IcebergQuantity
+	}
+	params.Tag = tag
+
+	client := a.userClient(accessToken)
+	var orderID string
+	err := a.limiter.call(ctx, "place order for "+order.Symbol, endpointOrders, false, func() error {
+		resp, err := client.PlaceOrder(order.Variety, params)
+		orderID = resp.OrderID
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("kite connect place order for %s failed: %w", order.Symbol, err)
+	}
+	return orderID, nil
+}
+
+// OrderTag returns the tag identifying our order (or child order) with the given ID at Kite:
+// its first 20 hex digits, as Kite allows up to 20 alphanumeric characters. The tag stays
+// the same across attempts, so an order placed by an attempt that died or never got Kite's
+// response can be found.
+func OrderTag(id uuid.UUID) string {
+	return strings.ReplaceAll(id.String(), "-", "")[:20]
+}
+
+// ModifyOrder changes the quantity and prices of an open order to those in order.
+func (a *Adapter) ModifyOrder(ctx context.Context, accessToken string, brokerOrderID string, order model.OrderParams) error {
+	params := kiteconnect.OrderParams{
+		OrderType: order.OrderType,
+		Quantity:  order.Quantity,
+		Validity:  kiteconnect.ValidityDay,
+	}
+	if order.Price != nil {
+		params.Price = *order.Price
+	}
+	if order.TriggerPrice != nil {
+		params.TriggerPrice = *order.TriggerPrice
+	}
+	// Repeating a modification sets the same values, so it is safe to retry
+	err := a.limiter.call(ctx, "modify order "+brokerOrderID, endpointOrders, true, func() error {
+		_, err := a.userClient(accessToken).ModifyOrder(order.Variety, brokerOrderID, params)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("kite connect modify order %s failed: %w", brokerOrderID, err)
+	}
+	return nil
+}
+
+// GetOrders returns the state of the day's orders. Kite only lists orders of the current
+// trading day.
+func (a *Adapter) GetOrders(ctx context.Context, accessToken string) ([]model.BrokerOrder, error) {
+	var orders kiteconnect.Orders
+	err := a.limiter.call(ctx, "get orders", endpointOthers, true, func() (err error) {
+		orders, err = a.userClient(accessToken).GetOrders()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kite connect get orders failed: %w", err)
+	}
+	result := make([]model.BrokerOrder, 0, len(orders))
+	for _, o := range orders {
+		result = append(result, model.BrokerOrder{
+			OrderID:        o.OrderID,
+			ParentOrderID:  o.ParentOrderID,
+			Status:         o.Status,
+			FilledQuantity: int(o.FilledQuantity),
+			AveragePrice:   o.AveragePrice,
+			Tags:           orderTags(o),
+		})
+	}
+	return result, nil
+}
+
+// orderTags returns the tags of a Kite order.
+func orderTags(o kiteconnect.Order) []string {
+	tags := o.Tags
+	if o.Tag != "" && !slices.Contains(tags, o.Tag) {
+		tags = append(tags, o.Tag)
+	}
+	return tags
+}
+
+// CancelOrder cancels an open order.
+func (a *Adapter) CancelOrder(ctx context.Context, accessToken string, variety string, brokerOrderID string) error {
+	err := a.limiter.call(ctx, "cancel order "+brokerOrderID, endpointOrders, true, func() error {
+		_, err := a.userClient(accessToken).CancelOrder(variety, brokerOrderID, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("kite connect cancel order %s failed: %w", brokerOrderID, err)
+	}
+	return nil
+}
+
+// gttParams converts a GTT to Kite's parameters. OCO legs are stop-loss (lower) then target (upper).
+func gttParams(gtt model.GTT) kiteconnect.GTTParams {
+	params := kiteconnect.GTTParams{
+		Tradingsymbol:   gtt.Symbol,
+		Exchange:        gtt.Exchange,
+		LastPrice:       gtt.LastPrice,
+		TransactionType: gtt.TransactionType,
+		Product:         gtt.Product,
+	}
+	leg := func(l model.GTTLeg) kiteconnect.TriggerParams {
+		return kiteconnect.TriggerParams{TriggerValue: l.TriggerPrice, LimitPrice: l.LimitPrice, Quantity: float64(l.Quantity)}
+	}
+	if gtt.Type == model.GTTTypeOCO {
+		params.Trigger = &kiteconnect.GTTOneCancelsOtherTrigger{Lower: leg(gtt.Legs[0]), Upper: leg(gtt.Legs[1])}
+	} else {
+		params.Trigger = &kiteconnect.GTTSingleLegTrigger{TriggerParams: leg(gtt.Legs[0])}
+	}
+	return params
+}
+
+// PlaceGTT creates a GTT trigger and returns Kite's trigger ID.
+func (a *Adapter) PlaceGTT(ctx context.Context, accessToken string, gtt model.GTT) (int, error) {
+	// GTTs can't be tagged, so a placement that may have gone through isn't repeated
+	var triggerID int
+	err := a.limiter.call(ctx, "place gtt for "+gtt.Symbol, endpointOthers, false, func() error {
+		resp, err := a.userClient(accessToken).PlaceGTT(gttParams(gtt))
+		triggerID = resp.TriggerID
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("kite connect place gtt for %s failed: %w", gtt.Symbol, err)
+	}
+	return triggerID, nil
+}
+
+// ModifyGTT replaces the trigger prices and orders of an active GTT with those of gtt.
+func (a *Adapter) ModifyGTT(ctx context.Context, accessToken string, gtt model.GTT) error {
+	err := a.limiter.call(ctx, fmt.Sprintf("modify gtt %d", gtt.BrokerTriggerID), endpointOthers, true, func() error {
+		_, err := a.userClient(accessToken).ModifyGTT(gtt.BrokerTriggerID, gttParams(gtt))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("kite connect modify gtt %d failed: %w", gtt.BrokerTriggerID, err)
+	}
+	return nil
+}
+
+// DeleteGTT deletes a GTT trigger.
+func (a *Adapter) DeleteGTT(ctx context.Context, accessToken string, brokerTriggerID int) error {
+	err := a.limiter.call(ctx, fmt.Sprintf("delete gtt %d", brokerTriggerID), endpointOthers, true, func() error {
+		_, err := a.userClient(accessToken).DeleteGTT(brokerTriggerID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("kite connect delete gtt %d failed: %w", brokerTriggerID, err)
+	}
+	return nil
+}
+
+// GetGTTStatuses returns the status of the user's GTT triggers by trigger ID.
+// Kite only lists recent triggers, so older ones may be missing.
+func (a *Adapter) GetGTTStatuses(ctx context.Context, accessToken string) (map[int]string, error) {
+	var gtts kiteconnect.GTTs
+	err := a.limiter.call(ctx, "get gtts", endpointOthers, true, func() (err error) {
+		gtts, err = a.userClient(accessToken).GetGTTs()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kite connect get gtts failed: %w", err)
+	}
+	statuses := make(map[int]string, len(gtts))
+	for _, g := range gtts {
+		statuses[g.ID] = g.Status
+	}
+	return statuses, nil
+}
+
+// GetBasketMargins asks Kite how much margin a set of orders needs as a whole
+// (taking existing positions into account). Items are returned in the order of orders.
+func (a *Adapter) GetBasketMargins(ctx context.Context, accessToken string, orders []model.OrderParams) (float64, []model.MarginItem, error) {
+	params := make([]kiteconnect.OrderMarginParam, 0, len(orders))
+	for _, o := range orders {
+		p := kiteconnect.OrderMarginParam{
+			Exchange:        o.Exchange,
+			Tradingsymbol:   o.Symbol,
+			TransactionType: o.TransactionType,
+			Variety:         o.Variety,
+			Product:         o.Product,
+			OrderType:       o.OrderType,
+			Quantity:        float64(o.Quantity),
+		}
+		if o.Price != nil {
+			p.Price = *o.Price
+		}
+		if o.TriggerPrice != nil {
+			p.TriggerPrice = *o.TriggerPrice
+		}
+		params = append(params, p)
+	}
+
+	var margins kiteconnect.BasketMargins
+	err := a.limiter.call(ctx, "get basket margins", endpointOthers, true, func() (err error) {
+		margins, err = a.userClient(accessToken).GetBasketMargins(kiteconnect.GetBasketParams{
+			OrderParams:       params,
+			ConsiderPositions: true,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("kite connect get basket margins failed: %w", err)
+	}
+	if len(margins.Orders) != len(orders) {
+		return 0, nil, fmt.Errorf("kite connect returned margins for %d orders, expected %d", len(margins.Orders), len(orders))
+	}
+
+	items := make([]model.MarginItem, 0, len(orders))
+	for i, o := range orders {
+		item := model.MarginItem{
+			Symbol:          o.Symbol,
+			TransactionType: o.TransactionType,
+			Quantity:        o.Quantity,
+			RequiredMargin:  margins.Orders[i].Total,
+		}
+		if o.Price != nil {
+			item.Price = *o.Price
+		}
+		items = append(items, item)
+	}
+	return margins.Final.Total, items, nil
+}
+
+// GetHoldings returns the sellable delivery quantity per trading symbol: settled
+// shares plus T1 shares (bought on the previous day, not yet settled).
+func (a *Adapter) GetHoldings(ctx context.Context, accessToken string) (map[string]int, error) {
+	var holdings kiteconnect.Holdings
+	err := a.limiter.call(ctx, "get holdings", endpointOthers, true, func() (err error) {
+		holdings, err = a.userClient(accessToken).GetHoldings()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kite connect get holdings failed: %w", err)
+	}
+	quantities := make(map[string]int, len(holdings))
+	for _, h := range holdings {
+		quantities[h.Tradingsymbol] += h.Quantity + h.T1Quantity
+	}
+	return quantities, nil
+}
+
+// GetLTP returns the last traded price per instrument. Instruments are "EXCHANGE:SYMBOL"
+// (e.g. "NSE:INFY"); instruments Kite doesn't know are missing from the result.
+func (a *Adapter) GetLTP(ctx context.Context, accessToken string, instruments []string) (map[string]float64, error) {
+	var quotes kiteconnect.QuoteLTP
+	err := a.limiter.call(ctx, "get ltp", endpointQuotes, true, func() (err error) {
+		quotes, err = a.userClient(accessToken).GetLTP(instruments...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kite connect get ltp failed: %w", err)
+	}
+	prices := make(map[string]float64, len(quotes))
+	for instrument, quote := range quotes {
+		prices[instrument] = quote.LastPrice
+	}
+	return prices, nil
+}
@@ -0,0 +1,140 @@
+package kiteconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"golang.org/x/time/rate"
+)
+
+// endpoint is a group of Kite endpoints sharing a rate limit.
+type endpoint int
+
+const (
+	endpointOrders endpoint = iota // Placing, modifying and cancelling orders
+	endpointQuotes                 // LTP and quotes
+	endpointOthers                 // Everything else
+)
+
+// failureKind classifies a failed call for the retry policy.
+type failureKind int
+
+const (
+	failureFatal     failureKind = iota // Retrying can't help: bad input, rejected order, expired session
+	failureRefused                      // Refused before being processed (rate limited): safe to retry
+	failureUncertain                    // Lost in transit or failed on Kite's side: it may have been processed
+)
+
+// callLimiter budgets and retries the calls made with one API key.
+type callLimiter struct {
+	budgets        map[endpoint][]*rate.Limiter
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*callLimiter{}
+)
+
+// limiterFor returns the limiter of an API key, creating it on first use. Kite counts
+// requests per API key, so every adapter of the key shares it.
+func limiterFor(apiKey string, cfg config.KiteRateLimitConfig) *callLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if l, ok := limiters[apiKey]; ok {
+		return l
+	}
+	perSecond := func(n int) *rate.Limiter { return rate.NewLimiter(rate.Limit(n), n) }
+	l := &callLimiter{
+		budgets: map[endpoint][]*rate.Limiter{
+			endpointOrders: {
+				perSecond(cfg.OrdersPerSecond),
+				rate.NewLimiter(rate.Every(time.Minute/time.Duration(cfg.OrdersPerMinute)), cfg.OrdersPerMinute),
+			},
+			endpointQuotes: {perSecond(cfg.QuotesPerSecond)},
+			endpointOthers: {perSecond(cfg.OthersPerSecond)},
+		},
+		maxRetries:     cfg.MaxRetries,
+		retryBaseDelay: cfg.RetryBaseDelay,
+		retryMaxDelay:  cfg.RetryMaxDelay,
+	}
+	limiters[apiKey] = l
+	return l
+}
+
+// call runs fn within the endpoint's budget, waiting for it if needed, and retries
+// transient failures with exponential backoff and jitter. Refused calls are always retried;
+// uncertain ones only when idempotent, since they may already have taken effect.
+// Waiting stops when ctx is done; a call already sent to Kite is not interrupted.
+func (l *callLimiter) call(ctx context.Context, what string, ep endpoint, idempotent bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := l.wait(ctx, ep); err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		kind := classifyFailure(err)
+		if kind == failureFatal || (kind == failureUncertain && !idempotent) || attempt >= l.maxRetries {
+			return err
+		}
+		delay := l.backoff(attempt)
+		log.Printf("Kite: %s failed (attempt %d of %d), retrying in %s: %v", what, attempt+1, l.maxRetries+1, delay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: gave up retrying: %w (last error: %v)", what, ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// wait blocks until the endpoint's budget allows another request or ctx is done.
+func (l *callLimiter) wait(ctx context.Context, ep endpoint) error {
+	for _, limiter := range l.budgets[ep] {
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("waiting for the rate limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// backoff returns the delay before retry number attempt+1: the base delay doubled per
+// attempt, capped, with "full jitter" so clients retrying together spread out.
+func (l *callLimiter) backoff(attempt int) time.Duration {
+	delay := l.retryMaxDelay
+	if attempt < 16 && l.retryBaseDelay<<attempt < l.retryMaxDelay {
+		delay = l.retryBaseDelay << attempt
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// classifyFailure decides whether a failed Kite call may be retried.
+func classifyFailure(err error) failureKind {
+	var kiteErr kiteconnect.Error
+	if !errors.As(err, &kiteErr) {
+		return failureUncertain
+	}
+	switch {
+	case kiteErr.Code == http.StatusTooManyRequests:
+		return failureRefused
+	case kiteErr.ErrorType == kiteconnect.NetworkError, kiteErr.ErrorType == kiteconnect.DataError:
+		// The request failed in transit, or its response couldn't be read
+		return failureUncertain
+	case kiteErr.Code >= http.StatusInternalServerError:
+		return failureUncertain
+	default:
+		return failureFatal
+	}
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// AdminHandler handles user management endpoints for support staff and admins.
+// Role checks are done by middleware.RequireRole on the routes.
+type AdminHandler struct {
+	adminService service.AdminService
+	userService  service.UserService
+}
+
+// NewAdminHandler creates a new AdminHandler instance.
+func NewAdminHandler(adminSvc service.AdminService, userSvc service.UserService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminSvc,
+		userService:  userSvc,
+	}
+}
+
+// ListUsers handles GET /api/admin/users?q=&role=&disabled=&limit=&offset=
+func (h *AdminHandler) ListUsers(c echo.Context) error {
+	filter := repository.UserSearchFilter{
+		Query: c.QueryParam("q"),
+		Role:  c.QueryParam("role"),
+	}
+
+	if disabledStr := c.QueryParam("disabled"); disabledStr != "" {
+		disabled, err := strconv.ParseBool(disabledStr)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "disabled must be true or false")
+		}
+		filter.Disabled = &disabled
+	}
+	var err error
+	if filter.Limit, err = intQueryParam(c, "limit"); err != nil {
+		return err
+	}
+	if filter.Offset, err = intQueryParam(c, "offset"); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	users, total, err := h.adminService.ListUsers(ctx, filter)
+	if err != nil {
+		log.Printf("Handler: Error from ListUsers service: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Could not list users: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"users": users,
+		"total": total,
+	})
+}
+
+// GetUser handles GET /api/admin/users/:id
+func (h *AdminHandler) GetUser(c echo.Context) error {
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.adminService.GetUser(c.Request().Context(), userID)
+	if err != nil {
+		return mapAdminError(err, userID)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+// DisableUser handles POST /api/admin/users/:id/disable
+func (h *AdminHandler) DisableUser(c echo.Context) error {
+	return h.setDisabled(c, true)
+}
+
+// EnableUser handles POST /api/admin/users/:id/enable
+func (h *AdminHandler) EnableUser(c echo.Context) error {
+	return h.setDisabled(c, false)
+}
+
+func (h *AdminHandler) setDisabled(c echo.Context, disabled bool) error {
+	actorID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.adminService.SetUserDisabled(c.Request().Context(), actorID, userID, disabled); err != nil {
+		return mapAdminError(err, userID)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetUserRole handles PUT /api/admin/users/:id/role
+func (h *AdminHandler) SetUserRole(c echo.Context) error {
+	actorID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	type setRoleRequest struct {
+		Role string `json:"role"`
+	}
+	req := new(setRoleRequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding set role request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	if err := h.adminService.SetUserRole(c.Request().Context(), actorID, userID, req.Role); err != nil {
+		return mapAdminError(err, userID)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForceLogout handles POST /api/admin/users/:id/logout
+func (h *AdminHandler) ForceLogout(c echo.Context) error {
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.adminService.ForceLogout(c.Request().Context(), userID); err != nil {
+		return mapAdminError(err, userID)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetBrokerConnections handles GET /api/admin/users/:id/brokers
+func (h *AdminHandler) GetBrokerConnections(c echo.Context) error {
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	connections, err := h.adminService.GetBrokerConnections(c.Request().Context(), userID)
+	if err != nil {
+		return mapAdminError(err, userID)
+	}
+	return c.JSON(http.StatusOK, connections)
+}
+
+// UnlockLogin handles POST /api/admin/login-lockouts/unlock
+func (h *AdminHandler) UnlockLogin(c echo.Context) error {
+	type unlockRequest struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	req := new(unlockRequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding unlock request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	if err := h.userService.UnlockLogin(c.Request().Context(), req.Email, req.IP); err != nil {
+		log.Printf("Handler: Error from UnlockLogin service: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Could not unlock login: %v", err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListInstruments handles GET /api/admin/instruments?exchange=
+func (h *AdminHandler) ListInstruments(c echo.Context) error {
+	instruments, err := h.adminService.ListInstruments(c.Request().Context(), c.QueryParam("exchange"))
+	if err != nil {
+		log.Printf("Handler: Failed to list instruments: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not list instruments")
+	}
+	return c.JSON(http.StatusOK, instruments)
+}
+
+// UpsertInstruments handles PUT /api/admin/instruments
+// Body: [{exchange, symbol, freezeQuantity}]. Entries not in the body are left as they are.
+func (h *AdminHandler) UpsertInstruments(c echo.Context) error {
+	var instruments []model.Instrument
+	if err := c.Bind(&instruments); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if err := h.adminService.UpsertInstruments(c.Request().Context(), instruments); err != nil {
+		log.Printf("Handler: Failed to update instruments: %v", err)
+		if errors.Is(err, service.ErrInvalidInstrument) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not update instruments")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// mapAdminError converts admin service errors to HTTP errors.
+func mapAdminError(err error, userID uuid.UUID) error {
+	log.Printf("Handler: Admin operation on user %s failed: %v", userID, err)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("User with ID %s not found", userID))
+	case errors.Is(err, service.ErrCannotModifySelf):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Admin operation failed: %v", err))
+	}
+}
+
+// userIDParam parses the :id path parameter as a user ID.
+func userIDParam(c echo.Context) (uuid.UUID, error) {
+	return uuidParam(c, "id", "user")
+}
+
+// intQueryParam parses an optional integer query parameter (0 if absent).
+func intQueryParam(c echo.Context, name string) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number", name))
+	}
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyHandler handles personal API key management endpoints.
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler instance.
+func NewAPIKeyHandler(svc service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: svc,
+	}
+}
+
+// CreateAPIKey handles POST /api/api-keys. The full key is only returned in this response.
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	type createAPIKeyRequest struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`        // e.g. ["baskets:read", "orders:execute"]
+		ExpiresInDays int      `json:"expiresInDays"` // Optional, defaults to 90, max 365
+	}
+
+	req := new(createAPIKeyRequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding create api key request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.ExpiresInDays < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "expiresInDays must be positive")
+	}
+
+	ctx := c.Request().Context()
+	lifetime := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	key, rawKey, err := h.apiKeyService.CreateKey(ctx, userID, req.Name, req.Scopes, lifetime)
+	if err != nil {
+		log.Printf("Handler: Error from CreateKey service for user %s: %v", userID, err)
+		if errors.Is(err, service.ErrInvalidAPIKeyScope) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Could not create API key: %v", err))
+	}
+
+	log.Printf("Handler: Created api key %s for user %s", key.Prefix, userID)
+	return c.JSON(http.StatusCreated, echo.Map{
+		"apiKey": key,
+		"key":    rawKey, // Shown only once, store it safely
+	})
+}
+
+// ListAPIKeys handles GET /api/api-keys.
+func (h *APIKeyHandler) ListAPIKeys(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	keys, err := h.apiKeyService.ListKeys(ctx, userID)
+	if err != nil {
+		log.Printf("Handler: Error from ListKeys service for user %s: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Could not retrieve API keys: %v", err))
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles DELETE /api/api-keys/:id.
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	idStr := c.Param("id")
+	keyID, err := uuid.Parse(idStr)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid API key ID format: %s", idStr))
+	}
+
+	ctx := c.Request().Context()
+	if err := h.apiKeyService.RevokeKey(ctx, userID, keyID); err != nil {
+		log.Printf("Handler: Error from RevokeKey service for key %s: %v", keyID, err)
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("API key with ID %s not found", keyID))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to revoke API key %s: %v", keyID, err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
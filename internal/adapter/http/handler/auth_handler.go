@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	// Use your actual module path
@@ -94,22 +96,214 @@ func (h *AuthHandler) Login(c echo.Context) error {
 	// Call the login service
 	ctx := c.Request().Context()
 	log.Printf("Handler: Calling Login service for email %s", req.Email)
-	token, err := h.userService.Login(ctx, req.Email, req.Password)
+	result, err := h.userService.Login(ctx, req.Email, req.Password, c.RealIP())
 	if err != nil {
 		log.Printf("Handler: Error from Login service for email %s: %v", req.Email, err)
+		// Too many failed attempts: 423 for a locked account, 429 for backoff throttling
+		if blocked := mapLoginBlockedError(c, err); blocked != nil {
+			return blocked
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			return echo.NewHTTPError(http.StatusForbidden, "This account has been disabled")
+		}
 		// Check if the error indicates invalid credentials
 		if strings.Contains(err.Error(), "invalid email or password") { // Check for the generic service error
 			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid email or password") // Return 401
 		}
-		// Check for other specific errors if needed (e.g., account locked)
 
 		// Handle other internal errors (like token generation failure)
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Login failed: %v", err))
 	}
 
+	// Password was correct but a second factor is required
+	if result.MFARequired {
+		log.Printf("Handler: Password verified for email %s, MFA required.", req.Email)
+		return c.JSON(http.StatusOK, echo.Map{
+			"mfaRequired": true,
+			"mfaToken":    result.MFAToken, // Exchange at POST /api/auth/login/mfa
+		})
+	}
+
 	// Return the token on successful login
 	log.Printf("Handler: Login successful for email %s, returning token.", req.Email)
 	return c.JSON(http.StatusOK, echo.Map{
-		"token": token, // Wrap token in a JSON object
+		"token": result.Token, // Wrap token in a JSON object
+	})
+}
+
+// LoginMFA handles the second login step: exchanging an MFA challenge token and a code for an access token.
+func (h *AuthHandler) LoginMFA(c echo.Context) error {
+	type loginMFARequest struct {
+		MFAToken string `json:"mfaToken"`
+		Code     string `json:"code"` // TOTP code or recovery code
+	}
+
+	req := new(loginMFARequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding MFA login request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "mfaToken and code are required")
+	}
+
+	ctx := c.Request().Context()
+	token, err := h.userService.CompleteMFALogin(ctx, req.MFAToken, req.Code, c.RealIP())
+	if err != nil {
+		log.Printf("Handler: Error from CompleteMFALogin service: %v", err)
+		if blocked := mapLoginBlockedError(c, err); blocked != nil {
+			return blocked
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			return echo.NewHTTPError(http.StatusForbidden, "This account has been disabled")
+		}
+		if errors.Is(err, service.ErrInvalidMFAChallenge) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "MFA challenge is invalid or has expired, please log in again")
+		}
+		if errors.Is(err, service.ErrInvalidMFACode) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid two-factor authentication code")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Login failed: %v", err))
+	}
+
+	log.Printf("Handler: MFA login successful, returning token.")
+	return c.JSON(http.StatusOK, echo.Map{
+		"token": token,
+	})
+}
+
+// mapLoginBlockedError converts a *service.LoginBlockedError into a 423/429 response
+// with a Retry-After header. Returns nil for any other error.
+func mapLoginBlockedError(c echo.Context, err error) error {
+	var blocked *service.LoginBlockedError
+	if !errors.As(err, &blocked) {
+		return nil
+	}
+
+	retryAfterSeconds := int(math.Ceil(blocked.RetryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+
+	if errors.Is(err, service.ErrAccountLocked) {
+		return echo.NewHTTPError(http.StatusLocked, fmt.Sprintf("Account is temporarily locked due to too many failed login attempts. Try again in %d seconds.", retryAfterSeconds))
+	}
+	return echo.NewHTTPError(http.StatusTooManyRequests, fmt.Sprintf("Too many failed login attempts. Try again in %d seconds.", retryAfterSeconds))
+}
+
+// mfaCodeRequest is the body used by endpoints that require a current TOTP or recovery code.
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the secret and provisioning URI (for a QR code).
+func (h *AuthHandler) EnrollTOTP(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	enrollment, err := h.userService.BeginTOTPEnrollment(ctx, userID)
+	if err != nil {
+		log.Printf("Handler: Error from BeginTOTPEnrollment service for user %s: %v", userID, err)
+		if errors.Is(err, service.ErrTOTPAlreadyEnabled) {
+			return echo.NewHTTPError(http.StatusConflict, "Two-factor authentication is already enabled")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to start enrollment: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP verifies the first code from the authenticator app and returns recovery codes.
+func (h *AuthHandler) ConfirmTOTP(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	req := new(mfaCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code is required")
+	}
+
+	ctx := c.Request().Context()
+	recoveryCodes, err := h.userService.ConfirmTOTPEnrollment(ctx, userID, req.Code)
+	if err != nil {
+		log.Printf("Handler: Error from ConfirmTOTPEnrollment service for user %s: %v", userID, err)
+		return mapMFAError(err)
+	}
+
+	// Recovery codes are only ever shown here, the server keeps hashes only
+	return c.JSON(http.StatusOK, echo.Map{
+		"totpEnabled":   true,
+		"recoveryCodes": recoveryCodes,
 	})
 }
+
+// DisableTOTP turns off two-factor authentication for the current user.
+func (h *AuthHandler) DisableTOTP(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	req := new(mfaCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code is required")
+	}
+
+	ctx := c.Request().Context()
+	if err := h.userService.DisableTOTP(ctx, userID, req.Code); err != nil {
+		log.Printf("Handler: Error from DisableTOTP service for user %s: %v", userID, err)
+		return mapMFAError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes.
+func (h *AuthHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	req := new(mfaCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code is required")
+	}
+
+	ctx := c.Request().Context()
+	recoveryCodes, err := h.userService.RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		log.Printf("Handler: Error from RegenerateRecoveryCodes service for user %s: %v", userID, err)
+		return mapMFAError(err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// mapMFAError converts MFA service errors to HTTP errors.
+func mapMFAError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid two-factor authentication code")
+	case errors.Is(err, service.ErrTOTPAlreadyEnabled):
+		return echo.NewHTTPError(http.StatusConflict, "Two-factor authentication is already enabled")
+	case errors.Is(err, service.ErrTOTPNotEnrolled):
+		return echo.NewHTTPError(http.StatusBadRequest, "Two-factor authentication is not set up")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Two-factor authentication request failed: %v", err))
+	}
+}
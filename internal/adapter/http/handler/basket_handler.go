@@ -54,8 +54,9 @@ func (h *BasketHandler) CreateBasket(c echo.Context) error {
 
 	// DTO (Data Transfer Object) for the request binding
 	type createBasketRequest struct {
-		Name   string        `json:"name"`
-		Stocks []model.Stock `json:"stocks"` // Keep using model.Stock for input for now
+		Name           string        `json:"name"`
+		Stocks         []model.Stock `json:"stocks"`         // Keep using model.Stock for input for now
+		OrganizationID *uuid.UUID    `json:"organizationId"` // Optional, shares the basket with an organization
 	}
 
 	req := new(createBasketRequest)
@@ -68,9 +69,12 @@ func (h *BasketHandler) CreateBasket(c echo.Context) error {
 	ctx := c.Request().Context()
 	log.Printf("Handler: Calling CreateBasket service for user %s", userID)
 	// Pass userID to service
-	createdBasket, err := h.service.CreateBasket(ctx, req.Name, req.Stocks, userID)
+	createdBasket, err := h.service.CreateBasket(ctx, req.Name, req.Stocks, req.OrganizationID, userID)
 	if err != nil {
 		log.Printf("Handler: Error calling CreateBasket service: %v", err)
+		if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+			return httpErr
+		}
 		// Map service errors to HTTP errors (could be more sophisticated)
 		// For now, assume most service errors are internal server errors or bad requests if validation fails
 		// We might need specific error types from the service later.
@@ -83,6 +87,7 @@ func (h *BasketHandler) CreateBasket(c echo.Context) error {
 }
 
 // ListBaskets handles GET requests - delegates to the service.
+// Lists personal and organization baskets, or only one organization's with ?organizationId=.
 func (h *BasketHandler) ListBaskets(c echo.Context) error {
 
 	userID, err := getUserIDFromContext(c)
@@ -92,11 +97,23 @@ func (h *BasketHandler) ListBaskets(c echo.Context) error {
 
 	// --- Delegate to the service ---
 	ctx := c.Request().Context()
-	log.Printf("Handler: Calling ListAllBaskets service for user %s", userID)
-
-	allBaskets, err := h.service.ListAllBaskets(ctx, userID)
+	var allBaskets []model.Basket
+	if orgIDStr := c.QueryParam("organizationId"); orgIDStr != "" {
+		orgID, err := uuid.Parse(orgIDStr)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid organization ID format: %s", orgIDStr))
+		}
+		log.Printf("Handler: Calling ListOrganizationBaskets service for user %s, organization %s", userID, orgID)
+		allBaskets, err = h.service.ListOrganizationBaskets(ctx, orgID, userID)
+	} else {
+		log.Printf("Handler: Calling ListAllBaskets service for user %s", userID)
+		allBaskets, err = h.service.ListAllBaskets(ctx, userID)
+	}
 	if err != nil {
 		log.Printf("Handler: Error calling ListAllBaskets service: %v", err)
+		if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+			return httpErr
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Could not retrieve baskets: %v", err))
 	}
 
@@ -166,6 +183,9 @@ func (h *BasketHandler) DeleteBasketByID(c echo.Context) error {
 		if errors.Is(err, repository.ErrBasketNotFound) {
 			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Basket with ID %s not found", basketID))
 		}
+		if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+			return httpErr
+		}
 		// Handle other potential errors
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to delete basket %s: %v", basketID, err))
 	}
@@ -222,6 +242,9 @@ func (h *BasketHandler) UpdateBasket(c echo.Context) error {
 		if errors.Is(err, repository.ErrBasketNotFound) {
 			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Basket with ID %s not found", basketID))
 		}
+		if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+			return httpErr
+		}
 		// Check for potential validation errors from service (though basic ones handled above)
 		// if errors.Is(err, service.ErrValidation) { return echo.NewHTTPError(http.StatusBadRequest, err.Error()) }
 
@@ -234,6 +257,18 @@ func (h *BasketHandler) UpdateBasket(c echo.Context) error {
 	return c.JSON(http.StatusOK, updatedBasket) // Return the updated basket details
 }
 
+// mapOrganizationAccessError maps organization membership errors to HTTP errors (nil if err is another error).
+func mapOrganizationAccessError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrOrganizationNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Organization not found")
+	case errors.Is(err, service.ErrOrgPermissionDenied):
+		return echo.NewHTTPError(http.StatusForbidden, "Your permission in this organization doesn't allow this action")
+	default:
+		return nil
+	}
+}
+
 // Define validateCreateRequest, validateUpdateRequest helpers if needed
 type createBasketRequest struct {
 	Name   string        `json:"name"`
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// BrokerHandler handles the user's linked broker accounts.
+// Linking itself goes through the Kite OAuth flow (KiteHandler).
+type BrokerHandler struct {
+	brokerService service.BrokerService
+}
+
+// NewBrokerHandler creates a new BrokerHandler instance.
+func NewBrokerHandler(svc service.BrokerService) *BrokerHandler {
+	return &BrokerHandler{
+		brokerService: svc,
+	}
+}
+
+// ListConnections handles GET /api/brokers
+func (h *BrokerHandler) ListConnections(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	connections, err := h.brokerService.ListConnections(c.Request().Context(), userID)
+	if err != nil {
+		log.Printf("Handler: Error from ListConnections service for user %s: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not retrieve broker connections")
+	}
+	return c.JSON(http.StatusOK, connections)
+}
+
+// Disconnect handles DELETE /api/brokers/:broker
+func (h *BrokerHandler) Disconnect(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	broker := c.Param("broker")
+
+	if err := h.brokerService.Disconnect(c.Request().Context(), userID, broker); err != nil {
+		log.Printf("Handler: Error from Disconnect service for user %s: %v", userID, err)
+		switch {
+		case errors.Is(err, service.ErrUnsupportedBroker):
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, repository.ErrBrokerCredentialsNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("No %s account is connected", broker))
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, "Could not disconnect broker")
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetProfile handles GET /api/broker/profile
+func (h *BrokerHandler) GetProfile(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	profile, err := h.brokerService.GetProfile(c.Request().Context(), userID)
+	if err != nil {
+		return mapBrokerError(err, userID, "profile")
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+// GetMargins handles GET /api/broker/margins?refresh=true
+func (h *BrokerHandler) GetMargins(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	refresh := c.QueryParam("refresh") == "true"
+
+	margins, err := h.brokerService.GetMargins(c.Request().Context(), userID, refresh)
+	if err != nil {
+		return mapBrokerError(err, userID, "margins")
+	}
+	return c.JSON(http.StatusOK, margins)
+}
+
+// mapBrokerError converts errors from calls to the user's broker into HTTP errors.
+func mapBrokerError(err error, userID uuid.UUID, what string) error {
+	log.Printf("Handler: Broker %s request for user %s failed: %v", what, userID, err)
+	if httpErr := mapBrokerReauthError(err); httpErr != nil {
+		return httpErr
+	}
+	return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Could not retrieve %s from the broker", what))
+}
+
+// mapBrokerReauthError turns a service.BrokerReauthRequiredError into a 428 response the UI
+// can act on (send the user through the broker login again). Returns nil for other errors.
+func mapBrokerReauthError(err error) error {
+	var reauthErr *service.BrokerReauthRequiredError
+	if !errors.As(err, &reauthErr) {
+		return nil
+	}
+	return echo.NewHTTPError(http.StatusPreconditionRequired, echo.Map{
+		"error":      "broker_reauth_required",
+		"broker":     reauthErr.Broker,
+		"reason":     reauthErr.Reason,
+		"message":    fmt.Sprintf("Please reconnect your %s account", reauthErr.Broker),
+		"connectUrl": "/api/kite/connect/initiate",
+	})
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/charges"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxChargesTrades caps how many trades one calculate request can contain.
+const maxChargesTrades = 500
+
+// ChargesHandler exposes the trade charges calculator.
+type ChargesHandler struct {
+	calculator *charges.Calculator
+}
+
+// NewChargesHandler creates a new ChargesHandler instance.
+func NewChargesHandler(calc *charges.Calculator) *ChargesHandler {
+	return &ChargesHandler{
+		calculator: calc,
+	}
+}
+
+// Calculate handles POST /api/charges/calculate
+// Computes brokerage, STT, exchange charges, SEBI fees, GST and stamp duty per trade,
+// with the rates in force on each trade's date.
+func (h *ChargesHandler) Calculate(c echo.Context) error {
+	type tradeRequest struct {
+		Segment         string  `json:"segment"`
+		Exchange        string  `json:"exchange"`
+		TransactionType string  `json:"transactionType"`
+		Quantity        int     `json:"quantity"`
+		Price           float64 `json:"price"`
+		TradeDate       string  `json:"tradeDate"` // YYYY-MM-DD, optional (today)
+	}
+	type calculateRequest struct {
+		Trades []tradeRequest `json:"trades"`
+	}
+	type calculateResponse struct {
+		Trades []charges.Result `json:"trades"`
+		Total  float64          `json:"total"`
+	}
+
+	req := new(calculateRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if len(req.Trades) == 0 || len(req.Trades) > maxChargesTrades {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Between 1 and %d trades are required", maxChargesTrades))
+	}
+
+	resp := calculateResponse{Trades: make([]charges.Result, 0, len(req.Trades))}
+	for i, t := range req.Trades {
+		trade := charges.Trade{
+			Segment:         t.Segment,
+			Exchange:        t.Exchange,
+			TransactionType: t.TransactionType,
+			Quantity:        t.Quantity,
+			Price:           t.Price,
+		}
+		if t.TradeDate != "" {
+			date, err := time.Parse("2006-01-02", t.TradeDate)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid trade date for trade #%d: expected YYYY-MM-DD", i+1))
+			}
+			// Noon UTC is the same calendar day in IST
+			trade.TradeDate = date.Add(12 * time.Hour)
+		}
+
+		result, err := h.calculator.Calculate(trade)
+		if err != nil {
+			if errors.Is(err, charges.ErrInvalidTrade) || errors.Is(err, charges.ErrNoRatesForDate) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Trade #%d: %v", i+1, err))
+			}
+			log.Printf("Handler: Failed to calculate charges for trade #%d: %v", i+1, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Could not calculate charges")
+		}
+		resp.Trades = append(resp.Trades, result)
+		resp.Total += result.Charges.Total
+	}
+	resp.Total = math.Round(resp.Total*100) / 100 // Drop float noise from summing
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExecutionHandler handles placing a basket's orders at the broker and the resulting executions.
+type ExecutionHandler struct {
+	executionService service.ExecutionService
+	jobService       service.JobService
+}
+
+// NewExecutionHandler creates a new ExecutionHandler instance.
+func NewExecutionHandler(svc service.ExecutionService, jobSvc service.JobService) *ExecutionHandler {
+	return &ExecutionHandler{
+		executionService: svc,
+		jobService:       jobSvc,
+	}
+}
+
+// CheckMargin handles POST /api/baskets/:id/margin
+// The body is optional and takes the same options as executing the basket.
+func (h *ExecutionHandler) CheckMargin(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	basketID, err := uuidParam(c, "id", "basket")
+	if err != nil {
+		return err
+	}
+	opts := new(model.ExecutionOptions)
+	if err := c.Bind(opts); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	log.Printf("Handler: Calling CheckMargin service for user %s, basket %s", userID, basketID)
+	check, err := h.executionService.CheckMargin(c.Request().Context(), basketID, userID, *opts)
+	if err != nil {
+		return mapExecutionError(err, "check margin for", basketID.String())
+	}
+	return c.JSON(http.StatusOK, check)
+}
+
+// ExecuteBasket handles POST /api/baskets/:id/execute
+// The orders are placed by a background worker: the response is 202 with the queued job,
+// whose status is at /api/jobs/:id. With ?preview=true nothing is placed: the response is
+// the itemized plan with estimated prices, charges and total cost.
+func (h *ExecutionHandler) ExecuteBasket(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	basketID, err := uuidParam(c, "id", "basket")
+	if err != nil {
+		return err
+	}
+	opts := new(model.ExecutionOptions)
+	if err := c.Bind(opts); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	if c.QueryParam("preview") == "true" {
+		log.Printf("Handler: Calling Preview service for user %s, basket %s", userID, basketID)
+		preview, err := h.executionService.Preview(c.Request().Context(), basketID, userID, *opts)
+		if err != nil {
+			return mapExecutionError(err, "preview", basketID.String())
+		}
+		return c.JSON(http.StatusOK, preview)
+	}
+
+	log.Printf("Handler: Calling EnqueueExecute service for user %s, basket %s", userID, basketID)
+	job, err := h.jobService.EnqueueExecute(c.Request().Context(), basketID, userID, *opts)
+	if err != nil {
+		return mapExecutionError(err, "queue execution of", basketID.String())
+	}
+	return acceptedJob(c, job)
+}
+
+// ExitBasket handles POST /api/baskets/:id/exit
+// Sells the basket's holdings: all of them, or a percentage. Queued and previewed like ExecuteBasket.
+func (h *ExecutionHandler) ExitBasket(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	basketID, err := uuidParam(c, "id", "basket")
+	if err != nil {
+		return err
+	}
+	opts := new(model.ExitOptions)
+	if err := c.Bind(opts); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	if c.QueryParam("preview") == "true" {
+		log.Printf("Handler: Calling PreviewExit service for user %s, basket %s", userID, basketID)
+		preview, err := h.executionService.PreviewExit(c.Request().Context(), basketID, userID, *opts)
+		if err != nil {
+			return mapExecutionError(err, "preview exit of", basketID.String())
+		}
+		return c.JSON(http.StatusOK, preview)
+	}
+
+	log.Printf("Handler: Calling EnqueueExit service for user %s, basket %s (%.2f%%)", userID, basketID, opts.Percentage)
+	job, err := h.jobService.EnqueueExit(c.Request().Context(), basketID, userID, *opts)
+	if err != nil {
+		return mapExecutionError(err, "queue exit of", basketID.String())
+	}
+	return acceptedJob(c, job)
+}
+
+// acceptedJob responds 202 with a queued job and where to follow it.
+func acceptedJob(c echo.Context, job *model.Job) error {
+	c.Response().Header().Set(echo.HeaderLocation, "/api/jobs/"+job.ID.String())
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// ListBasketExecutions handles GET /api/baskets/:id/executions
+func (h *ExecutionHandler) ListBasketExecutions(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	basketID, err := uuidParam(c, "id", "basket")
+	if err != nil {
+		return err
+	}
+
+	executions, err := h.executionService.ListBasketExecutions(c.Request().Context(), basketID, userID)
+	if err != nil {
+		log.Printf("Handler: Error from ListBasketExecutions service for basket %s: %v", basketID, err)
+		if errors.Is(err, repository.ErrBasketNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Basket with ID %s not found", basketID))
+		}
+		if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not retrieve executions")
+	}
+	return c.JSON(http.StatusOK, executions)
+}
+
+// GetExecution handles GET /api/executions/:id
+// ?refresh=true first fetches the orders' fills from the broker (own executions only).
+func (h *ExecutionHandler) GetExecution(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	executionID, err := uuidParam(c, "id", "execution")
+	if err != nil {
+		return err
+	}
+
+	if c.QueryParam("refresh") == "true" {
+		log.Printf("Handler: Calling RefreshFills service for user %s, execution %s", userID, executionID)
+		execution, err := h.executionService.RefreshFills(c.Request().Context(), executionID, userID)
+		if err != nil {
+			return mapOrderChangeError(err, "refresh fills of execution", executionID.String())
+		}
+		return c.JSON(http.StatusOK, execution)
+	}
+
+	execution, err := h.executionService.GetExecution(c.Request().Context(), executionID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrExecutionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Execution with ID %s not found", executionID))
+		}
+		log.Printf("Handler: Error from GetExecution service for ID %s: %v", executionID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not retrieve execution")
+	}
+	return c.JSON(http.StatusOK, execution)
+}
+
+// mapExecutionError converts errors from basket execution into HTTP errors.
+func mapExecutionError(err error, action, basketID string) error {
+	log.Printf("Handler: Failed to %s basket %s: %v", action, basketID, err)
+
+	var marginErr *service.InsufficientMarginError
+	if errors.As(err, &marginErr) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, echo.Map{
+			"error":       "insufficient_margin",
+			"message":     fmt.Sprintf("Insufficient funds: %.2f required, %.2f available", marginErr.Check.RequiredMargin, marginErr.Check.AvailableMargin),
+			"marginCheck": marginErr.Check,
+		})
+	}
+	var closedErr *service.MarketClosedError
+	if errors.As(err, &closedErr) {
+		body := echo.Map{
+			"error":   "market_closed",
+			"message": "The market is closed, orders can't be placed now. Set amo to place after-market orders",
+			"session": closedErr.Session,
+		}
+		if !closedErr.NextOpen.IsZero() {
+			body["nextOpen"] = closedErr.NextOpen
+		}
+		return echo.NewHTTPError(http.StatusConflict, body)
+	}
+	if httpErr := mapBrokerReauthError(err); httpErr != nil {
+		return httpErr
+	}
+	if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+		return httpErr
+	}
+	switch {
+	case errors.Is(err, repository.ErrBasketNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Basket with ID %s not found", basketID))
+	case errors.Is(err, service.ErrEmptyBasket), errors.Is(err, service.ErrInvalidExecutionOptions):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrNothingToExit):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Could not %s basket", action))
+	}
+}
+
+// ModifyOrder handles PUT /api/executions/:id/orders/:orderId
+// Body: any of quantity, price, triggerPrice, plus an optional expectedVersion.
+func (h *ExecutionHandler) ModifyOrder(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	executionID, err := uuidParam(c, "id", "execution")
+	if err != nil {
+		return err
+	}
+	orderID, err := uuidParam(c, "orderId", "order")
+	if err != nil {
+		return err
+	}
+	change := new(model.OrderModification)
+	if err := c.Bind(change); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	log.Printf("Handler: Calling ModifyOrder service for user %s, execution %s, order %s", userID, executionID, orderID)
+	order, err := h.executionService.ModifyOrder(c.Request().Context(), executionID, orderID, userID, *change)
+	if err != nil {
+		return mapOrderChangeError(err, "modify", orderID.String())
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder handles DELETE /api/executions/:id/orders/:orderId?expectedVersion=
+func (h *ExecutionHandler) CancelOrder(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	executionID, err := uuidParam(c, "id", "execution")
+	if err != nil {
+		return err
+	}
+	orderID, err := uuidParam(c, "orderId", "order")
+	if err != nil {
+		return err
+	}
+	var expectedVersion *int
+	if v := c.QueryParam("expectedVersion"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid expectedVersion: %s", v))
+		}
+		expectedVersion = &version
+	}
+
+	log.Printf("Handler: Calling CancelOrder service for user %s, execution %s, order %s", userID, executionID, orderID)
+	order, err := h.executionService.CancelOrder(c.Request().Context(), executionID, orderID, userID, expectedVersion)
+	if err != nil {
+		return mapOrderChangeError(err, "cancel", orderID.String())
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// CancelOpenOrders handles POST /api/executions/:id/cancel
+// Cancels every open order of the execution; the response lists the outcome per order.
+func (h *ExecutionHandler) CancelOpenOrders(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	executionID, err := uuidParam(c, "id", "execution")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Handler: Calling CancelOpenOrders service for user %s, execution %s", userID, executionID)
+	results, err := h.executionService.CancelOpenOrders(c.Request().Context(), executionID, userID)
+	if err != nil {
+		return mapOrderChangeError(err, "cancel the orders of", executionID.String())
+	}
+	return c.JSON(http.StatusOK, results)
+}
+
+// ListOrderEvents handles GET /api/executions/:id/events
+func (h *ExecutionHandler) ListOrderEvents(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	executionID, err := uuidParam(c, "id", "execution")
+	if err != nil {
+		return err
+	}
+
+	events, err := h.executionService.ListOrderEvents(c.Request().Context(), executionID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrExecutionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Execution with ID %s not found", executionID))
+		}
+		log.Printf("Handler: Error from ListOrderEvents service for execution %s: %v", executionID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not retrieve order events")
+	}
+	return c.JSON(http.StatusOK, events)
+}
+
+// mapOrderChangeError converts errors from modifying or cancelling orders into HTTP errors.
+func mapOrderChangeError(err error, action, id string) error {
+	log.Printf("Handler: Failed to %s %s: %v", action, id, err)
+	if httpErr := mapBrokerReauthError(err); httpErr != nil {
+		return httpErr
+	}
+	switch {
+	case errors.Is(err, repository.ErrExecutionNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Execution not found")
+	case errors.Is(err, repository.ErrExecutionOrderNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Order not found in this execution")
+	case errors.Is(err, service.ErrExecutionOwnerOnly):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrOrderNotOpen):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrExecutionOrderConflict):
+		return echo.NewHTTPError(http.StatusConflict, "The order was changed in the meantime; reload it and try again")
+	case errors.Is(err, service.ErrInvalidOrderModification):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrBrokerRejectedChange):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Could not %s %s", action, id))
+	}
+}
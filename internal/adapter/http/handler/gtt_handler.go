@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// GTTHandler handles GTT (Good Till Triggered) stop-loss and target triggers.
+type GTTHandler struct {
+	gttService service.GTTService
+}
+
+// NewGTTHandler creates a new GTTHandler instance.
+func NewGTTHandler(svc service.GTTService) *GTTHandler {
+	return &GTTHandler{
+		gttService: svc,
+	}
+}
+
+// modifyGTTRequest is the body of changing a trigger.
+type modifyGTTRequest struct {
+	Legs []model.GTTLeg `json:"legs"`
+}
+
+// CreateGTT handles POST /api/gtts
+// For a basket item (basketId + symbol) or an executed order (executionId + executionOrderId).
+func (h *GTTHandler) CreateGTT(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	req := new(model.GTTRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	log.Printf("Handler: Calling CreateGTT service for user %s (%s %s)", userID, req.Type, req.Symbol)
+	gtt, err := h.gttService.CreateGTT(c.Request().Context(), userID, *req)
+	if err != nil {
+		return mapGTTError(err, "create gtt trigger")
+	}
+	return c.JSON(http.StatusCreated, gtt)
+}
+
+// ListGTTs handles GET /api/gtts
+// ?basketId= limits to one basket; ?refresh=true first syncs statuses from the broker.
+func (h *GTTHandler) ListGTTs(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	var basketID *uuid.UUID
+	if raw := c.QueryParam("basketId"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid basket ID format")
+		}
+		basketID = &id
+	}
+
+	gtts, err := h.gttService.ListGTTs(c.Request().Context(), userID, basketID, c.QueryParam("refresh") == "true")
+	if err != nil {
+		return mapGTTError(err, "list gtt triggers")
+	}
+	return c.JSON(http.StatusOK, gtts)
+}
+
+// GetGTT handles GET /api/gtts/:id
+func (h *GTTHandler) GetGTT(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	gttID, err := uuidParam(c, "id", "gtt")
+	if err != nil {
+		return err
+	}
+	gtt, err := h.gttService.GetGTT(c.Request().Context(), gttID, userID)
+	if err != nil {
+		return mapGTTError(err, "get gtt trigger")
+	}
+	return c.JSON(http.StatusOK, gtt)
+}
+
+// ModifyGTT handles PUT /api/gtts/:id
+// Replaces the legs (trigger and limit prices, quantities) of an active trigger.
+func (h *GTTHandler) ModifyGTT(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	gttID, err := uuidParam(c, "id", "gtt")
+	if err != nil {
+		return err
+	}
+	req := new(modifyGTTRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	log.Printf("Handler: Calling ModifyGTT service for user %s, gtt %s", userID, gttID)
+	gtt, err := h.gttService.ModifyGTT(c.Request().Context(), gttID, userID, req.Legs)
+	if err != nil {
+		return mapGTTError(err, "modify gtt trigger")
+	}
+	return c.JSON(http.StatusOK, gtt)
+}
+
+// DeleteGTT handles DELETE /api/gtts/:id
+// The trigger is kept with status deleted, and returned.
+func (h *GTTHandler) DeleteGTT(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	gttID, err := uuidParam(c, "id", "gtt")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Handler: Calling DeleteGTT service for user %s, gtt %s", userID, gttID)
+	gtt, err := h.gttService.DeleteGTT(c.Request().Context(), gttID, userID)
+	if err != nil {
+		return mapGTTError(err, "delete gtt trigger")
+	}
+	return c.JSON(http.StatusOK, gtt)
+}
+
+// ProtectBasket handles POST /api/baskets/:id/protect
+// Sets an OCO stop-loss and target on each held basket stock; the response reports each stock.
+func (h *GTTHandler) ProtectBasket(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	basketID, err := uuidParam(c, "id", "basket")
+	if err != nil {
+		return err
+	}
+	opts := new(model.ProtectOptions)
+	if err := c.Bind(opts); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	log.Printf("Handler: Calling ProtectBasket service for user %s, basket %s", userID, basketID)
+	results, err := h.gttService.ProtectBasket(c.Request().Context(), basketID, userID, *opts)
+	if err != nil {
+		return mapGTTError(err, "protect basket")
+	}
+	return c.JSON(http.StatusOK, results)
+}
+
+// mapGTTError maps GTT service errors to HTTP errors.
+func mapGTTError(err error, action string) error {
+	log.Printf("Handler: Failed to %s: %v", action, err)
+	if httpErr := mapBrokerReauthError(err); httpErr != nil {
+		return httpErr
+	}
+	if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+		return httpErr
+	}
+	switch {
+	case errors.Is(err, repository.ErrGTTNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "GTT trigger not found")
+	case errors.Is(err, repository.ErrBasketNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Basket not found")
+	case errors.Is(err, repository.ErrExecutionNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Execution not found")
+	case errors.Is(err, repository.ErrExecutionOrderNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Order not found in this execution")
+	case errors.Is(err, service.ErrInvalidGTT):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrGTTNotActive), errors.Is(err, service.ErrNothingToExit):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrBrokerRejectedGTT):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Could not %s", action))
+	}
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JobHandler reports on background jobs, such as queued basket executions.
+type JobHandler struct {
+	jobService service.JobService
+}
+
+// NewJobHandler creates a new JobHandler instance.
+func NewJobHandler(svc service.JobService) *JobHandler {
+	return &JobHandler{
+		jobService: svc,
+	}
+}
+
+// GetJob handles GET /api/jobs/:id
+// A finished basket job's result has the execution ID, see GET /api/executions/:id.
+func (h *JobHandler) GetJob(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	jobID, err := uuidParam(c, "id", "job")
+	if err != nil {
+		return err
+	}
+
+	job, err := h.jobService.GetJob(c.Request().Context(), jobID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrJobNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Job with ID %s not found", jobID))
+		}
+		log.Printf("Handler: Error from GetJob service for ID %s: %v", jobID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not retrieve job")
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// ListJobs handles GET /api/admin/jobs?status=&limit=
+// ?status=dead lists the dead letters: jobs that failed every attempt.
+func (h *JobHandler) ListJobs(c echo.Context) error {
+	limit, err := intQueryParam(c, "limit")
+	if err != nil {
+		return err
+	}
+
+	jobs, err := h.jobService.ListJobs(c.Request().Context(), c.QueryParam("status"), limit)
+	if err != nil {
+		log.Printf("Handler: Error from ListJobs service: %v", err)
+		if errors.Is(err, service.ErrInvalidJobFilter) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not list jobs")
+	}
+	return c.JSON(http.StatusOK, jobs)
+}
+
+// RetryJob handles POST /api/admin/jobs/:id/retry
+// Queues a failed or dead job again. Basket jobs don't place orders twice: an execution
+// recorded by an earlier attempt is kept, or finished if that attempt was interrupted.
+func (h *JobHandler) RetryJob(c echo.Context) error {
+	jobID, err := uuidParam(c, "id", "job")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Handler: Calling RetryJob service for job %s", jobID)
+	job, err := h.jobService.RetryJob(c.Request().Context(), jobID)
+	if err != nil {
+		log.Printf("Handler: Error from RetryJob service for ID %s: %v", jobID, err)
+		switch {
+		case errors.Is(err, repository.ErrJobNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Job with ID %s not found", jobID))
+		case errors.Is(err, repository.ErrJobNotRetryable):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, "Could not retry job")
+		}
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
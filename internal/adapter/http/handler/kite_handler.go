@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -16,7 +18,10 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-// KiteHandler dependencies change: remove oauthStateRepo, add config
+// stateCookieName is the cookie holding the OAuth state in cookie mode.
+const stateCookieName = "kite_oauth_state"
+
+// KiteHandler handles the Kite Connect OAuth flow.
 type KiteHandler struct {
 	kiteAdapter *kiteadapter.Adapter
 	kiteService service.KiteService
@@ -35,21 +40,34 @@ func NewKiteHandler(ka *kiteadapter.Adapter, ks service.KiteService, cfg config.
 	}
 }
 
-// InitiateKiteConnect starts the OAuth flow using a cookie for state.
+// InitiateKiteConnect starts the OAuth flow. Depending on KITE_OAUTH_STATE_MODE the state
+// travels in a cookie or is stored server-side and round-trips through Kite's redirect_params.
 func (h *KiteHandler) InitiateKiteConnect(c echo.Context) error {
 	userID, err := getUserIDFromContext(c)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Handler: Initiating Kite Connect flow for user %s", userID)
+	log.Printf("Handler: Initiating Kite Connect flow for user %s (state mode: %s)", userID, h.cfg.Kite.OAuthStateMode)
+
+	if h.cfg.Kite.OAuthStateMode == "table" {
+		// Single-use state in oauth_states; works without cookies (plain HTTP, mobile webviews)
+		state, err := h.kiteService.CreateOAuthState(c.Request().Context(), userID)
+		if err != nil {
+			log.Printf("Handler: Failed to create OAuth state for user %s: %v", userID, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to initiate connection (state gen)")
+		}
+		loginURL := h.kiteAdapter.GetLoginURLWithState(state)
+		log.Printf("Handler: Redirecting user %s to Kite Login URL with server-side state", userID)
+		return c.Redirect(http.StatusTemporaryRedirect, loginURL)
+	}
 
 	// 1. Generate short-lived JWT state token containing userID
 	// Use a short expiry, e.g., 5 or 10 minutes
 	stateTokenExpiry := 10 * time.Minute
 	// Reusing GenerateToken - assuming it takes expiry duration.
-	// We don't need email here, just userID (subject).
-	stateToken, err := jwtutil.GenerateToken(userID, "", h.cfg.JWT.SecretKey, stateTokenExpiry)
+	// We don't need email or role here, just userID (subject).
+	stateToken, err := jwtutil.GenerateToken(userID, "", "", h.cfg.JWT.SecretKey, stateTokenExpiry)
 	if err != nil {
 		log.Printf("Handler: Failed to generate state JWT for user %s: %v", userID, err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to initiate connection (state jwt gen)")
@@ -57,14 +75,14 @@ func (h *KiteHandler) InitiateKiteConnect(c echo.Context) error {
 
 	// 2. Set the state JWT as a secure cookie
 	stateCookie := new(http.Cookie)
-	stateCookie.Name = "kite_oauth_state" // Consistent cookie name
+	stateCookie.Name = stateCookieName
 	stateCookie.Value = stateToken
 	//stateCookie.Expires = time.Now().Add(stateTokenExpiry)
-	stateCookie.MaxAge = 600                    // MaxAge is an alternative to Expires
-	stateCookie.Path = "/"                      // Or restrict path if needed e.g., "/api/kite/connect"
-	stateCookie.HttpOnly = true                 // Crucial: Prevent JS access
-	stateCookie.Secure = true                  // Crucial: Send only over HTTPS (requires HTTPS setup/ngrok locally)
-	stateCookie.SameSite = http.SameSiteLaxMode // Recommended for OAuth callbacks
+	stateCookie.MaxAge = 600                          // MaxAge is an alternative to Expires
+	stateCookie.Path = "/"                            // Or restrict path if needed e.g., "/api/kite/connect"
+	stateCookie.HttpOnly = true                       // Crucial: Prevent JS access
+	stateCookie.Secure = h.cfg.Kite.StateCookieSecure // Send only over HTTPS (KITE_STATE_COOKIE_SECURE=false for local HTTP)
+	stateCookie.SameSite = http.SameSiteLaxMode       // Recommended for OAuth callbacks
 
 	c.SetCookie(stateCookie)
 	log.Printf("Handler: Set state cookie for user %s", userID)
@@ -76,75 +94,101 @@ func (h *KiteHandler) InitiateKiteConnect(c echo.Context) error {
 	return c.Redirect(http.StatusTemporaryRedirect, loginURL)
 }
 
-// HandleKiteCallback receives redirect, verifies state cookie, exchanges token, saves credentials.
+// HandleKiteCallback receives redirect, verifies the state, exchanges token, saves credentials.
 func (h *KiteHandler) HandleKiteCallback(c echo.Context) error {
-	log.Printf("Handler: Received Kite callback request URL: %s", c.Request().URL.String())
+	log.Printf("Handler: Received Kite callback request URL: %s", c.Request().URL.Path)
 
 	frontendSuccessURL := "/?kite_connected=success"
 	frontendErrorURLBase := "/?kite_error="
-	stateCookieName := "kite_oauth_state" // Use consistent name
 
 	redirectWithError := func(errorCode string, logMsg string, logArgs ...interface{}) error {
 		log.Printf("Handler Error: "+logMsg, logArgs...)
 		// Clear the state cookie on error too
-		clearCookie := &http.Cookie{Name: stateCookieName, MaxAge: -1, Path: "/"}
-		c.SetCookie(clearCookie)
+		h.clearStateCookie(c)
 		errorURL := frontendErrorURLBase + errorCode
 		return c.Redirect(http.StatusTemporaryRedirect, errorURL)
 	}
 
-	// 1. Extract query parameters (status, request_token - state is no longer expected here)
+	// 1. Extract query parameters (status, request_token, and state in table mode)
 	status := c.QueryParam("status")
 	requestToken := c.QueryParam("request_token")
 
 	if status != "success" || requestToken == "" {
 		errMsg := c.QueryParam("message")
-		return redirectWithError("callback_failed", "Kite callback indicated failure or missing request token. Status: '%s', Error: '%s', RequestToken: '%s'", status, errMsg, requestToken)
+		return redirectWithError("callback_failed", "Kite callback indicated failure or missing request token. Status: '%s', Error: '%s'", status, errMsg)
+	}
+
+	// 2. Work out which user started the flow
+	ctx := c.Request().Context()
+	var userID uuid.UUID
+	if h.cfg.Kite.OAuthStateMode == "table" {
+		// Consuming deletes the state, so a replayed callback is rejected here
+		var err error
+		userID, err = h.kiteService.ConsumeOAuthState(ctx, c.QueryParam("state"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidOAuthState) {
+				return redirectWithError("invalid_state", "Invalid, expired or replayed OAuth state")
+			}
+			return redirectWithError("internal_error", "Failed to check OAuth state: %v", err)
+		}
+		log.Printf("Handler: OAuth state consumed for user %s", userID)
+	} else {
+		// The cookie is cleared after use; a replayed request token is also rejected by Kite,
+		// which only exchanges each request token once.
+		var errCode string
+		var err error
+		userID, errCode, err = h.userFromStateCookie(c)
+		if err != nil {
+			return redirectWithError(errCode, "%v", err)
+		}
+	}
+
+	// 3. Call the service to complete authentication for the user who started the flow
+	err := h.kiteService.CompleteAuthentication(ctx, userID, requestToken)
+	if err != nil {
+		return redirectWithError("token_exchange_failed", "Error completing Kite authentication for user %s: %v", userID, err)
 	}
 
-	// 2. Read and validate the state cookie
+	// 4. Redirect user to frontend success page
+	log.Printf("Handler: Kite connection successful for user %s. Redirecting to success page: %s", userID, frontendSuccessURL)
+	return c.Redirect(http.StatusTemporaryRedirect, frontendSuccessURL)
+}
+
+// userFromStateCookie validates the state JWT cookie and clears it.
+// On failure it returns the error code for the frontend redirect.
+func (h *KiteHandler) userFromStateCookie(c echo.Context) (uuid.UUID, string, error) {
 	stateCookie, err := c.Cookie(stateCookieName)
 	if err != nil {
 		// If cookie is missing (http.ErrNoCookie or other error)
-		return redirectWithError("missing_state_cookie", "State cookie '%s' not found or failed to read: %v", stateCookieName, err)
+		return uuid.Nil, "missing_state_cookie", fmt.Errorf("state cookie '%s' not found or failed to read: %w", stateCookieName, err)
 	}
 
-	// 3. Validate the state JWT from the cookie
+	// Validate the state JWT from the cookie. Covers expired tokens, invalid signatures etc.
 	claims, err := jwtutil.ValidateToken(stateCookie.Value, h.cfg.JWT.SecretKey)
 	if err != nil {
-		// Covers expired tokens, invalid signatures etc.
-		return redirectWithError("invalid_state", "Invalid or expired state cookie: %v", err)
+		return uuid.Nil, "invalid_state", fmt.Errorf("invalid or expired state cookie: %w", err)
 	}
 
-	// 4. Extract UserID from validated claims
-	userIDStr := claims.UserID // Or claims.Subject
-	userID, err := uuid.Parse(userIDStr)
+	userID, err := uuid.Parse(claims.UserID)
 	if err != nil {
-		return redirectWithError("internal_error", "Failed to parse user ID from state cookie claims ('%s'): %v", userIDStr, err)
+		return uuid.Nil, "internal_error", fmt.Errorf("failed to parse user ID from state cookie claims ('%s'): %w", claims.UserID, err)
 	}
 	log.Printf("Handler: State cookie validated successfully for user %s", userID)
 
-	// 5. Clear the state cookie immediately after validation prevent reuse
-	clearCookie := &http.Cookie{
+	// Clear the state cookie immediately after validation to prevent reuse
+	h.clearStateCookie(c)
+	return userID, "", nil
+}
+
+// clearStateCookie tells the browser to delete the state cookie.
+func (h *KiteHandler) clearStateCookie(c echo.Context) {
+	c.SetCookie(&http.Cookie{
 		Name:     stateCookieName,
 		Value:    "",
 		MaxAge:   -1,  // Tell browser to delete immediately
 		Path:     "/", // Use the same path as when setting
 		HttpOnly: true,
-		Secure:   true, // Match original settings
+		Secure:   h.cfg.Kite.StateCookieSecure, // Match original settings
 		SameSite: http.SameSiteLaxMode,
-	}
-	c.SetCookie(clearCookie)
-	log.Printf("Handler: Cleared state cookie for user %s", userID)
-
-	// 6. Call the service to complete authentication, passing userID from cookie
-	ctx := c.Request().Context()
-	err = h.kiteService.CompleteAuthentication(ctx, userID, requestToken)
-	if err != nil {
-		return redirectWithError("token_exchange_failed", "Error completing Kite authentication for user %s: %v", userID, err)
-	}
-
-	// 7. Redirect user to frontend success page
-	log.Printf("Handler: Kite connection successful for user %s. Redirecting to success page: %s", userID, frontendSuccessURL)
-	return c.Redirect(http.StatusTemporaryRedirect, frontendSuccessURL)
+	})
 }
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/market"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MarketHandler exposes the market calendar.
+type MarketHandler struct {
+	calendar *market.Calendar
+}
+
+// NewMarketHandler creates a new MarketHandler instance.
+func NewMarketHandler(cal *market.Calendar) *MarketHandler {
+	return &MarketHandler{
+		calendar: cal,
+	}
+}
+
+// Status handles GET /api/market/status
+// Reports the current session and when the market next opens, so clients can tell users
+// why an execution would be refused.
+func (h *MarketHandler) Status(c echo.Context) error {
+	type statusResponse struct {
+		Session        string     `json:"session"`
+		IsOpen         bool       `json:"isOpen"`
+		NextOpen       *time.Time `json:"nextOpen,omitempty"`
+		NextTradingDay string     `json:"nextTradingDay"` // YYYY-MM-DD
+		Now            time.Time  `json:"now"`
+	}
+
+	now := time.Now().In(market.IST)
+	resp := statusResponse{
+		Session:        h.calendar.SessionAt(now),
+		IsOpen:         h.calendar.IsOpen(now),
+		NextTradingDay: h.calendar.NextTradingDay(now).Format("2006-01-02"),
+		Now:            now,
+	}
+	if next := h.calendar.NextOpen(now); !next.IsZero() {
+		resp.NextOpen = &next
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// OrganizationHandler handles team workspace endpoints.
+type OrganizationHandler struct {
+	orgService service.OrganizationService
+}
+
+// NewOrganizationHandler creates a new OrganizationHandler instance.
+func NewOrganizationHandler(svc service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService: svc,
+	}
+}
+
+// CreateOrganization handles POST /api/organizations
+func (h *OrganizationHandler) CreateOrganization(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	type createOrganizationRequest struct {
+		Name string `json:"name"`
+	}
+	req := new(createOrganizationRequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding create organization request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	org, err := h.orgService.CreateOrganization(c.Request().Context(), req.Name, userID)
+	if err != nil {
+		log.Printf("Handler: Error from CreateOrganization service for user %s: %v", userID, err)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Could not create organization: %v", err))
+	}
+	return c.JSON(http.StatusCreated, org)
+}
+
+// ListOrganizations handles GET /api/organizations
+func (h *OrganizationHandler) ListOrganizations(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	orgs, err := h.orgService.ListOrganizations(c.Request().Context(), userID)
+	if err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.JSON(http.StatusOK, orgs)
+}
+
+// GetOrganization handles GET /api/organizations/:id
+func (h *OrganizationHandler) GetOrganization(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+
+	org, err := h.orgService.GetOrganization(c.Request().Context(), orgID, userID)
+	if err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.JSON(http.StatusOK, org)
+}
+
+// DeleteOrganization handles DELETE /api/organizations/:id
+func (h *OrganizationHandler) DeleteOrganization(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.orgService.DeleteOrganization(c.Request().Context(), orgID, userID); err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListMembers handles GET /api/organizations/:id/members
+func (h *OrganizationHandler) ListMembers(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+
+	members, err := h.orgService.ListMembers(c.Request().Context(), orgID, userID)
+	if err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.JSON(http.StatusOK, members)
+}
+
+// UpdateMember handles PUT /api/organizations/:id/members/:userId
+func (h *OrganizationHandler) UpdateMember(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+	memberID, err := uuidParam(c, "userId", "user")
+	if err != nil {
+		return err
+	}
+
+	type updateMemberRequest struct {
+		Permission string `json:"permission"` // viewer, editor, executor or owner
+	}
+	req := new(updateMemberRequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding update member request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	if err := h.orgService.UpdateMemberPermission(c.Request().Context(), orgID, memberID, req.Permission, userID); err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RemoveMember handles DELETE /api/organizations/:id/members/:userId (use your own ID to leave)
+func (h *OrganizationHandler) RemoveMember(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+	memberID, err := uuidParam(c, "userId", "user")
+	if err != nil {
+		return err
+	}
+
+	if err := h.orgService.RemoveMember(c.Request().Context(), orgID, memberID, userID); err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// InviteMember handles POST /api/organizations/:id/invitations.
+// The invitation token is only returned in this response; share it with the invitee.
+func (h *OrganizationHandler) InviteMember(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+
+	type inviteRequest struct {
+		Email      string `json:"email"`
+		Permission string `json:"permission"` // Defaults to viewer
+	}
+	req := new(inviteRequest)
+	if err := c.Bind(req); err != nil {
+		log.Printf("Handler: Error binding invite request: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.Permission == "" {
+		req.Permission = model.OrgPermissionViewer
+	}
+
+	inv, token, err := h.orgService.InviteMember(c.Request().Context(), orgID, req.Email, req.Permission, userID)
+	if err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.JSON(http.StatusCreated, echo.Map{
+		"invitation": inv,
+		"token":      token, // Shown only once
+	})
+}
+
+// ListInvitations handles GET /api/organizations/:id/invitations
+func (h *OrganizationHandler) ListInvitations(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+
+	invitations, err := h.orgService.ListInvitations(c.Request().Context(), orgID, userID)
+	if err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation handles DELETE /api/organizations/:id/invitations/:invitationId
+func (h *OrganizationHandler) RevokeInvitation(c echo.Context) error {
+	userID, orgID, err := organizationRequestIDs(c)
+	if err != nil {
+		return err
+	}
+	invitationID, err := uuidParam(c, "invitationId", "invitation")
+	if err != nil {
+		return err
+	}
+
+	if err := h.orgService.RevokeInvitation(c.Request().Context(), orgID, invitationID, userID); err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AcceptInvitation handles POST /api/organizations/invitations/accept
+func (h *OrganizationHandler) AcceptInvitation(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	type acceptRequest struct {
+		Token string `json:"token"`
+	}
+	req := new(acceptRequest)
+	if err := c.Bind(req); err != nil || req.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invitation token is required")
+	}
+
+	member, err := h.orgService.AcceptInvitation(c.Request().Context(), req.Token, userID)
+	if err != nil {
+		return mapOrganizationError(err)
+	}
+	return c.JSON(http.StatusOK, member)
+}
+
+// mapOrganizationError converts organization service errors to HTTP errors.
+func mapOrganizationError(err error) error {
+	log.Printf("Handler: Organization operation failed: %v", err)
+	if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+		return httpErr
+	}
+	switch {
+	case errors.Is(err, repository.ErrOrgMemberNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Member not found")
+	case errors.Is(err, repository.ErrInvitationNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Invitation not found, expired or already used")
+	case errors.Is(err, repository.ErrOrgMemberExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvitationEmailMismatch):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrLastOrgOwner), errors.Is(err, service.ErrInvalidOrgPermission):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Organization operation failed: %v", err))
+	}
+}
+
+// organizationRequestIDs returns the acting user and the :id organization parameter.
+func organizationRequestIDs(c echo.Context) (uuid.UUID, uuid.UUID, error) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	orgID, err := uuidParam(c, "id", "organization")
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return userID, orgID, nil
+}
+
+// uuidParam parses a path parameter as a UUID; what names it in the error message.
+func uuidParam(c echo.Context, name, what string) (uuid.UUID, error) {
+	idStr := c.Param(name)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid %s ID format: %s", what, idStr))
+	}
+	return id, nil
+}
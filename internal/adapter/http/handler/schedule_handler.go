@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ScheduleHandler handles recurring basket executions (SIPs) and their runs.
+type ScheduleHandler struct {
+	scheduleService service.ScheduleService
+}
+
+// NewScheduleHandler creates a new ScheduleHandler instance.
+func NewScheduleHandler(svc service.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: svc,
+	}
+}
+
+// scheduleRequest is the body of creating or updating a schedule.
+type scheduleRequest struct {
+	BasketID    uuid.UUID              `json:"basketId"` // Create only
+	Frequency   string                 `json:"frequency"`
+	DayOfMonth  *int                   `json:"dayOfMonth"`
+	DayOfWeek   *int                   `json:"dayOfWeek"`
+	TimeOfDay   string                 `json:"timeOfDay"`
+	Options     model.ExecutionOptions `json:"options"`
+	Enabled     *bool                  `json:"enabled"` // Default true
+	RetryMissed bool                   `json:"retryMissed"`
+}
+
+func (r *scheduleRequest) toSchedule() model.Schedule {
+	return model.Schedule{
+		BasketID:    r.BasketID,
+		Frequency:   r.Frequency,
+		DayOfMonth:  r.DayOfMonth,
+		DayOfWeek:   r.DayOfWeek,
+		TimeOfDay:   r.TimeOfDay,
+		Options:     r.Options,
+		Enabled:     r.Enabled == nil || *r.Enabled,
+		RetryMissed: r.RetryMissed,
+	}
+}
+
+// CreateSchedule handles POST /api/schedules
+func (h *ScheduleHandler) CreateSchedule(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	req := new(scheduleRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+	if req.BasketID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "basketId is required")
+	}
+
+	log.Printf("Handler: Calling CreateSchedule service for user %s, basket %s", userID, req.BasketID)
+	schedule, err := h.scheduleService.CreateSchedule(c.Request().Context(), userID, req.toSchedule())
+	if err != nil {
+		return mapScheduleError(err, "create schedule")
+	}
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules handles GET /api/schedules
+func (h *ScheduleHandler) ListSchedules(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	schedules, err := h.scheduleService.ListSchedules(c.Request().Context(), userID)
+	if err != nil {
+		return mapScheduleError(err, "list schedules")
+	}
+	return c.JSON(http.StatusOK, schedules)
+}
+
+// GetSchedule handles GET /api/schedules/:id
+func (h *ScheduleHandler) GetSchedule(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	scheduleID, err := uuidParam(c, "id", "schedule")
+	if err != nil {
+		return err
+	}
+	schedule, err := h.scheduleService.GetSchedule(c.Request().Context(), scheduleID, userID)
+	if err != nil {
+		return mapScheduleError(err, "get schedule")
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule handles PUT /api/schedules/:id
+// Replaces the timing, options and flags; the basket can't be changed.
+func (h *ScheduleHandler) UpdateSchedule(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	scheduleID, err := uuidParam(c, "id", "schedule")
+	if err != nil {
+		return err
+	}
+	req := new(scheduleRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+	}
+
+	log.Printf("Handler: Calling UpdateSchedule service for user %s, schedule %s", userID, scheduleID)
+	schedule, err := h.scheduleService.UpdateSchedule(c.Request().Context(), scheduleID, userID, req.toSchedule())
+	if err != nil {
+		return mapScheduleError(err, "update schedule")
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule handles DELETE /api/schedules/:id
+func (h *ScheduleHandler) DeleteSchedule(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	scheduleID, err := uuidParam(c, "id", "schedule")
+	if err != nil {
+		return err
+	}
+	if err := h.scheduleService.DeleteSchedule(c.Request().Context(), scheduleID, userID); err != nil {
+		return mapScheduleError(err, "delete schedule")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListRuns handles GET /api/schedules/:id/runs
+// ?status=missed lists the runs that didn't happen.
+func (h *ScheduleHandler) ListRuns(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	scheduleID, err := uuidParam(c, "id", "schedule")
+	if err != nil {
+		return err
+	}
+	runs, err := h.scheduleService.ListRuns(c.Request().Context(), scheduleID, userID, c.QueryParam("status"))
+	if err != nil {
+		return mapScheduleError(err, "list schedule runs")
+	}
+	return c.JSON(http.StatusOK, runs)
+}
+
+// RetryRun handles POST /api/schedules/:id/runs/:runId/retry
+// Queues a missed or failed run's execution now; the response is the run with its job, or
+// with why it couldn't be queued. The run's status follows the job (see ListRuns).
+func (h *ScheduleHandler) RetryRun(c echo.Context) error {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		return err
+	}
+	scheduleID, err := uuidParam(c, "id", "schedule")
+	if err != nil {
+		return err
+	}
+	runID, err := uuidParam(c, "runId", "run")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Handler: Calling RetryRun service for user %s, schedule %s, run %s", userID, scheduleID, runID)
+	run, err := h.scheduleService.RetryRun(c.Request().Context(), scheduleID, runID, userID)
+	if err != nil {
+		return mapScheduleError(err, "retry schedule run")
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// mapScheduleError maps schedule service errors to HTTP errors.
+func mapScheduleError(err error, action string) error {
+	log.Printf("Handler: Failed to %s: %v", action, err)
+	if httpErr := mapOrganizationAccessError(err); httpErr != nil {
+		return httpErr
+	}
+	switch {
+	case errors.Is(err, repository.ErrScheduleNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+	case errors.Is(err, repository.ErrScheduleRunNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Schedule run not found")
+	case errors.Is(err, repository.ErrBasketNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Basket not found")
+	case errors.Is(err, service.ErrInvalidSchedule), errors.Is(err, service.ErrInvalidExecutionOptions), errors.Is(err, service.ErrEmptyBasket):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrRunNotRetryable), errors.Is(err, service.ErrMarketClosedNow):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Could not %s", action))
+	}
+}
@@ -1,12 +1,16 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	// Use your actual module path
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
 	"github.com/AMANSRI99/StockSaaS/internal/common/jwtutil" // Import our JWT helpers
 
 	"github.com/golang-jwt/jwt/v5" // Need for error checking
@@ -19,59 +23,228 @@ type ContextKey string
 
 const UserIDContextKey ContextKey = "user_id"
 
+// AuthMethodContextKey stores how the request was authenticated (AuthMethodJWT or AuthMethodAPIKey).
+const AuthMethodContextKey ContextKey = "auth_method"
+
+// APIKeyContextKey stores the *model.APIKey used to authenticate, if any.
+const APIKeyContextKey ContextKey = "api_key"
+
+// RoleContextKey stores the user's role from the JWT (empty for API key requests).
+const RoleContextKey ContextKey = "role"
+
+// SessionValidator decides whether an authenticated user may still use the API,
+// e.g. the account wasn't disabled and sessions weren't revoked after the token was issued.
+// service.UserService satisfies it.
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error
+}
+
+// Authentication methods stored under AuthMethodContextKey.
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
 // NewJWTAuthMiddleware creates an Echo middleware function for JWT authentication.
 // It takes the JWT secret key as a dependency.
-func NewJWTAuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
+// Use it for routes that must only be reachable by an interactive login (e.g. managing API keys).
+func NewJWTAuthMiddleware(jwtSecret string, sessions SessionValidator) echo.MiddlewareFunc {
 	// Return the actual middleware handler
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		// This inner function is the actual handler executed by Echo
 		return func(c echo.Context) error {
-			// 1. Get the Authorization header
-			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader == "" {
-				log.Println("Auth Middleware: Missing Authorization header")
-				return echo.NewHTTPError(http.StatusUnauthorized, "Missing authorization header")
+			tokenString, err := bearerCredential(c)
+			if err != nil {
+				return err
 			}
 
-			// 2. Check if it's a Bearer token
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				log.Printf("Auth Middleware: Malformed Authorization header: %s", authHeader)
-				return echo.NewHTTPError(http.StatusUnauthorized, "Malformed authorization header (expecting 'Bearer <token>')")
+			userID, claims, err := authenticateJWT(tokenString, jwtSecret)
+			if err != nil {
+				return err
+			}
+			if err := checkSession(c, sessions, userID, claims.IssuedAt.Time); err != nil {
+				return err
 			}
-			tokenString := parts[1]
 
-			// 3. Validate the token using our helper
-			claims, err := jwtutil.ValidateToken(tokenString, jwtSecret)
-			if err != nil {
-				log.Printf("Auth Middleware: Token validation failed: %v", err)
-				// Check for specific errors like expiration
-				if errors.Is(err, jwt.ErrTokenExpired) || strings.Contains(err.Error(), "token has expired") {
-					return echo.NewHTTPError(http.StatusUnauthorized, "Token has expired")
+			// Store UserID in context for downstream handlers/services
+			log.Printf("Auth Middleware: User %s authenticated successfully.", userID)
+			c.Set(string(UserIDContextKey), userID) // Use typed key
+			c.Set(string(AuthMethodContextKey), AuthMethodJWT)
+			c.Set(string(RoleContextKey), claims.Role)
+
+			// Call the next handler in the chain
+			return next(c)
+		}
+	}
+}
+
+// NewAuthMiddleware accepts either a Bearer JWT or a personal API key.
+// API keys can be sent as "Authorization: Bearer ssk_..." or in the X-API-Key header.
+// Combine with RequireScope to restrict what API keys may do on a route.
+func NewAuthMiddleware(jwtSecret string, apiKeys service.APIKeyService, sessions SessionValidator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			credential := c.Request().Header.Get("X-API-Key")
+			if credential == "" {
+				var err error
+				credential, err = bearerCredential(c)
+				if err != nil {
+					return err
 				}
-				// Other validation errors
-				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
 			}
 
-			// 4. Token is valid, extract UserID from claims
-			// We stored UserID in the Subject ("sub") or our custom "user_id" claim
-			userIDStr := claims.UserID // Assuming UserID field exists in CustomClaims
-			if userIDStr == "" {
-				userIDStr = claims.Subject // Fallback to Subject if UserID claim wasn't set
+			// API key path
+			if service.IsAPIKey(credential) {
+				key, err := apiKeys.Authenticate(c.Request().Context(), credential)
+				if err != nil {
+					log.Printf("Auth Middleware: API key authentication failed: %v", err)
+					if errors.Is(err, service.ErrInvalidAPIKey) {
+						return echo.NewHTTPError(http.StatusUnauthorized, "Invalid, revoked or expired API key")
+					}
+					return echo.NewHTTPError(http.StatusInternalServerError, "Could not verify API key")
+				}
+				// Keys of a disabled account stop working too. Forced logout only ends
+				// interactive sessions, so the key's creation time is used as "issued at".
+				if err := checkSession(c, sessions, key.UserID, key.CreatedAt); err != nil {
+					return err
+				}
+
+				log.Printf("Auth Middleware: User %s authenticated with API key %s.", key.UserID, key.Prefix)
+				c.Set(string(UserIDContextKey), key.UserID)
+				c.Set(string(AuthMethodContextKey), AuthMethodAPIKey)
+				c.Set(string(APIKeyContextKey), key)
+				return next(c)
 			}
 
-			userID, err := uuid.Parse(userIDStr)
+			// JWT path
+			userID, claims, err := authenticateJWT(credential, jwtSecret)
 			if err != nil {
-				log.Printf("Auth Middleware: Failed to parse user ID from token claims ('%s'): %v", userIDStr, err)
-				return echo.NewHTTPError(http.StatusInternalServerError, "Invalid user identifier in token") // Should not happen if generated correctly
+				return err
+			}
+			if err := checkSession(c, sessions, userID, claims.IssuedAt.Time); err != nil {
+				return err
 			}
 
-			// 5. Store UserID in context for downstream handlers/services
 			log.Printf("Auth Middleware: User %s authenticated successfully.", userID)
-			c.Set(string(UserIDContextKey), userID) // Use typed key
+			c.Set(string(UserIDContextKey), userID)
+			c.Set(string(AuthMethodContextKey), AuthMethodJWT)
+			c.Set(string(RoleContextKey), claims.Role)
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects API key requests whose key wasn't granted scope.
+// Interactive (JWT) sessions have full access and pass through.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Get(string(AuthMethodContextKey)) != AuthMethodAPIKey {
+				return next(c)
+			}
 
-			// 6. Call the next handler in the chain
+			key, ok := c.Get(string(APIKeyContextKey)).(*model.APIKey)
+			if !ok {
+				log.Printf("Auth Middleware: API key missing from context")
+				return echo.NewHTTPError(http.StatusInternalServerError, "Could not identify API key from context")
+			}
+			if !key.HasScope(scope) {
+				log.Printf("Auth Middleware: API key %s lacks scope %s", key.Prefix, scope)
+				return echo.NewHTTPError(http.StatusForbidden, "API key is missing the required scope: "+scope)
+			}
 			return next(c)
 		}
 	}
 }
+
+// RequireRole only lets requests through whose JWT carries one of the given roles.
+// API key requests have no role and are always rejected.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get(string(RoleContextKey)).(string)
+			for _, allowed := range roles {
+				if role != "" && role == allowed {
+					return next(c)
+				}
+			}
+			log.Printf("Auth Middleware: Role '%s' not allowed for %s %s", role, c.Request().Method, c.Path())
+			return echo.NewHTTPError(http.StatusForbidden, "You don't have permission to access this resource")
+		}
+	}
+}
+
+// checkSession asks the SessionValidator whether the user may continue.
+func checkSession(c echo.Context, sessions SessionValidator, userID uuid.UUID, issuedAt time.Time) error {
+	err := sessions.ValidateSession(c.Request().Context(), userID, issuedAt)
+	if err == nil {
+		return nil
+	}
+	log.Printf("Auth Middleware: Session check failed for user %s: %v", userID, err)
+	switch {
+	case errors.Is(err, service.ErrAccountDisabled):
+		return echo.NewHTTPError(http.StatusForbidden, "This account has been disabled")
+	case errors.Is(err, service.ErrSessionRevoked):
+		return echo.NewHTTPError(http.StatusUnauthorized, "Session has been revoked, please log in again")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not verify session")
+	}
+}
+
+// bearerCredential extracts the credential from an "Authorization: Bearer <credential>" header.
+func bearerCredential(c echo.Context) (string, error) {
+	// 1. Get the Authorization header
+	authHeader := c.Request().Header.Get("Authorization")
+	if authHeader == "" {
+		log.Println("Auth Middleware: Missing Authorization header")
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "Missing authorization header")
+	}
+
+	// 2. Check if it's a Bearer token
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		log.Printf("Auth Middleware: Malformed Authorization header")
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "Malformed authorization header (expecting 'Bearer <token>')")
+	}
+	return parts[1], nil
+}
+
+// authenticateJWT validates an access token and returns the user ID it was issued for and its claims.
+// Returned errors are ready-to-use *echo.HTTPError values.
+func authenticateJWT(tokenString string, jwtSecret string) (uuid.UUID, *jwtutil.CustomClaims, error) {
+	// 3. Validate the token using our helper
+	claims, err := jwtutil.ValidateToken(tokenString, jwtSecret)
+	if err != nil {
+		log.Printf("Auth Middleware: Token validation failed: %v", err)
+		// Check for specific errors like expiration
+		if errors.Is(err, jwt.ErrTokenExpired) || strings.Contains(err.Error(), "token has expired") {
+			return uuid.Nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "Token has expired")
+		}
+		// Other validation errors
+		return uuid.Nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
+	}
+
+	// Special-purpose tokens (e.g. MFA challenge tokens) are not access tokens
+	if claims.Purpose != "" {
+		log.Printf("Auth Middleware: Rejected token with purpose '%s'", claims.Purpose)
+		return uuid.Nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
+	}
+
+	// 4. Token is valid, extract UserID from claims
+	// We stored UserID in the Subject ("sub") or our custom "user_id" claim
+	userIDStr := claims.UserID // Assuming UserID field exists in CustomClaims
+	if userIDStr == "" {
+		userIDStr = claims.Subject // Fallback to Subject if UserID claim wasn't set
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		log.Printf("Auth Middleware: Failed to parse user ID from token claims ('%s'): %v", userIDStr, err)
+		return uuid.Nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Invalid user identifier in token") // Should not happen if generated correctly
+	}
+	if claims.IssuedAt == nil {
+		// All our tokens set iat; without it the session checks can't work
+		return uuid.Nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
+	}
+	return userID, claims, nil
+}
@@ -0,0 +1,173 @@
+package keyprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are the static or temporary credentials used to sign KMS requests.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional
+}
+
+// AWSKMSProvider wraps data keys with an AWS KMS key via the KMS JSON API.
+// Requests are signed with Signature Version 4, so no SDK is needed.
+type AWSKMSProvider struct {
+	keyID    string
+	region   string
+	kmsKeyID string
+	creds    AWSCredentials
+	endpoint string
+	client   *http.Client
+}
+
+// NewAWSKMSProvider creates a provider for kmsKeyID (key ID, ARN or alias) in region.
+func NewAWSKMSProvider(keyID, region, kmsKeyID string, creds AWSCredentials, client *http.Client) *AWSKMSProvider {
+	return &AWSKMSProvider{
+		keyID:    keyID,
+		region:   region,
+		kmsKeyID: kmsKeyID,
+		creds:    creds,
+		endpoint: fmt.Sprintf("https://kms.%s.amazonaws.com/", region),
+		client:   client,
+	}
+}
+
+// KeyID implements encryptutil.KeyProvider.
+func (p *AWSKMSProvider) KeyID() string {
+	return p.keyID
+}
+
+// WrapKey implements encryptutil.KeyProvider. The wrapped key is the KMS ciphertext blob.
+func (p *AWSKMSProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var resp struct {
+		CiphertextBlob []byte // Base64 in JSON, decoded by encoding/json
+	}
+	body := map[string]any{"KeyId": p.kmsKeyID, "Plaintext": dataKey}
+	if err := p.call(ctx, "TrentService.Encrypt", body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.CiphertextBlob) == 0 {
+		return nil, fmt.Errorf("kms returned no ciphertext")
+	}
+	return resp.CiphertextBlob, nil
+}
+
+// UnwrapKey implements encryptutil.KeyProvider.
+func (p *AWSKMSProvider) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte
+	}
+	// Passing KeyId makes KMS refuse blobs from any other key
+	body := map[string]any{"KeyId": p.kmsKeyID, "CiphertextBlob": wrappedKey}
+	if err := p.call(ctx, "TrentService.Decrypt", body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// call sends a signed KMS API request and decodes the JSON response into out.
+func (p *AWSKMSProvider) call(ctx context.Context, target string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode kms request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create kms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	p.sign(req, payload, time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms %s failed: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read kms response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kms %s returned %d: %s", target, resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode kms response: %w", err)
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers for the kms service to req.
+func (p *AWSKMSProvider) sign(req *http.Request, payload []byte, now time.Time) {
+	signV4(req, payload, p.creds, p.region, "kms", now)
+}
+
+// signV4 adds AWS Signature Version 4 headers for service in region to a request for
+// the root path without a query string (all the KMS API needs).
+func signV4(req *http.Request, payload []byte, creds AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Canonical headers: lowercase names, sorted, including host
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"", // No query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
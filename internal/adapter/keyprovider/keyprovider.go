@@ -0,0 +1,44 @@
+// Package keyprovider implements encryptutil.KeyProvider for external key management
+// services and builds the application's keyring from configuration.
+package keyprovider
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AMANSRI99/StockSaaS/internal/common/encryptutil"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+)
+
+// New creates the key provider described by cfg.
+func New(cfg config.KeyProviderConfig) (encryptutil.KeyProvider, error) {
+	client := &http.Client{Timeout: cfg.Timeout}
+	switch cfg.Type {
+	case "local":
+		return encryptutil.LoadLocalKeyProvider(cfg.KeyID, cfg.LocalKEKFile)
+	case "vault":
+		return NewVaultTransitProvider(cfg.KeyID, cfg.VaultAddr, cfg.VaultToken, cfg.VaultTransitMount, cfg.VaultTransitKey, client), nil
+	case "awskms":
+		creds := AWSCredentials{
+			AccessKeyID:     cfg.AWSAccessKeyID,
+			SecretAccessKey: cfg.AWSSecretAccessKey,
+			SessionToken:    cfg.AWSSessionToken,
+		}
+		return NewAWSKMSProvider(cfg.KeyID, cfg.AWSRegion, cfg.AWSKMSKeyID, creds, client), nil
+	default:
+		return nil, fmt.Errorf("unknown key provider '%s'", cfg.Type)
+	}
+}
+
+// NewKeyring builds the keyring from the encryption config, including its key provider if one is set.
+func NewKeyring(cfg config.EncryptionConfig) (*encryptutil.Keyring, error) {
+	var providers []encryptutil.KeyProvider
+	if cfg.Provider.Type != "" {
+		provider, err := New(cfg.Provider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up %s key provider: %w", cfg.Provider.Type, err)
+		}
+		providers = append(providers, provider)
+	}
+	return encryptutil.NewKeyring(cfg.Keys, cfg.ActiveKeyID, cfg.LegacyKey, providers...)
+}
@@ -0,0 +1,109 @@
+package keyprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// VaultTransitProvider wraps data keys with a HashiCorp Vault transit key.
+// The KEK never leaves Vault; the token needs encrypt and decrypt on the key.
+type VaultTransitProvider struct {
+	keyID   string
+	addr    string
+	token   string
+	mount   string
+	keyName string
+	client  *http.Client
+}
+
+// NewVaultTransitProvider creates a provider for the transit key keyName mounted at mount.
+func NewVaultTransitProvider(keyID, addr, token, mount, keyName string, client *http.Client) *VaultTransitProvider {
+	return &VaultTransitProvider{
+		keyID:   keyID,
+		addr:    addr,
+		token:   token,
+		mount:   mount,
+		keyName: keyName,
+		client:  client,
+	}
+}
+
+// KeyID implements encryptutil.KeyProvider.
+func (p *VaultTransitProvider) KeyID() string {
+	return p.keyID
+}
+
+// WrapKey implements encryptutil.KeyProvider. The wrapped key is Vault's "vault:v<n>:..." ciphertext.
+func (p *VaultTransitProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := p.call(ctx, "encrypt", body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Ciphertext == "" {
+		return nil, fmt.Errorf("vault returned no ciphertext")
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// UnwrapKey implements encryptutil.KeyProvider.
+func (p *VaultTransitProvider) UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	body := map[string]string{"ciphertext": string(wrappedKey)}
+	if err := p.call(ctx, "decrypt", body, &resp); err != nil {
+		return nil, err
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("vault returned invalid plaintext: %w", err)
+	}
+	return dataKey, nil
+}
+
+// call POSTs body to the transit encrypt/decrypt endpoint and decodes the JSON response into out.
+func (p *VaultTransitProvider) call(ctx context.Context, operation string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode vault request: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", p.addr, p.mount, operation, url.PathEscape(p.keyName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault transit %s failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Vault error bodies look like {"errors": ["..."]} and never contain key material
+		return fmt.Errorf("vault transit %s returned %d: %s", operation, resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+)
+
+// maxTrackedKeys bounds memory use. When exceeded, entries that are neither
+// locked nor recently failed are dropped.
+const maxTrackedKeys = 100000
+
+// LoginAttemptStore is an in-memory implementation of repository.LoginAttemptStore.
+// Counters are per-process and lost on restart, so it is meant for local development
+// and single-instance deployments. Use the Postgres store when running several instances.
+type LoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+	window   time.Duration // Last window seen in RecordFailure, used when pruning
+}
+
+// NewLoginAttemptStore creates a new in-memory login attempt store.
+func NewLoginAttemptStore() repository.LoginAttemptStore {
+	return &LoginAttemptStore{
+		attempts: make(map[string]model.LoginAttempt),
+	}
+}
+
+// Get implements repository.LoginAttemptStore.Get
+func (s *LoginAttemptStore) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return &model.LoginAttempt{Key: key}, nil
+	}
+	return &attempt, nil
+}
+
+// RecordFailure implements repository.LoginAttemptStore.RecordFailure
+func (s *LoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.window = window
+	if len(s.attempts) >= maxTrackedKeys {
+		s.pruneLocked(now)
+	}
+
+	attempt, ok := s.attempts[key]
+	if !ok || attempt.LastFailedAt.Before(now.Add(-window)) {
+		attempt.Key = key
+		attempt.FailedCount = 0
+	}
+	attempt.FailedCount++
+	attempt.LastFailedAt = now
+	s.attempts[key] = attempt
+
+	return &attempt, nil
+}
+
+// LockUntil implements repository.LoginAttemptStore.LockUntil
+func (s *LoginAttemptStore) LockUntil(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = until
+	s.attempts[key] = attempt
+	return nil
+}
+
+// Reset implements repository.LoginAttemptStore.Reset
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// pruneLocked drops entries that no longer affect login decisions. Caller must hold s.mu.
+func (s *LoginAttemptStore) pruneLocked(now time.Time) {
+	for key, attempt := range s.attempts {
+		if attempt.LockedUntil.Before(now) && attempt.LastFailedAt.Before(now.Add(-s.window)) {
+			delete(s.attempts, key)
+		}
+	}
+}
@@ -50,3 +50,9 @@ func NewConnection(cfg config.DBConfig) (*sql.DB, error) {
 	log.Println("Database connection established successfully!")
 	return db, nil
 }
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows, so one scan helper
+// can serve single-row and multi-row queries.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// PostgresAPIKeyRepo implements repository.APIKeyRepository using PostgreSQL.
+type PostgresAPIKeyRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresAPIKeyRepo creates a new API key repository instance.
+func NewPostgresAPIKeyRepo(db *sql.DB) repository.APIKeyRepository {
+	return &PostgresAPIKeyRepo{db: db}
+}
+
+// Save implements repository.APIKeyRepository.Save
+func (r *PostgresAPIKeyRepo) Save(ctx context.Context, key *model.APIKey) error {
+	query := `
+        INSERT INTO api_keys (id, user_id, name, prefix, secret_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.SecretHash,
+		strings.Join(key.Scopes, ","),
+		key.ExpiresAt,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save api key for user %s: %w", key.UserID, err)
+	}
+	return nil
+}
+
+// FindByPrefix implements repository.APIKeyRepository.FindByPrefix
+func (r *PostgresAPIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	query := `
+        SELECT id, user_id, name, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+        FROM api_keys
+        WHERE prefix = $1
+    `
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, prefix))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to find api key by prefix %s: %w", prefix, err)
+	}
+	return key, nil
+}
+
+// FindAllByUser implements repository.APIKeyRepository.FindAllByUser
+func (r *PostgresAPIKeyRepo) FindAllByUser(ctx context.Context, userID uuid.UUID) ([]model.APIKey, error) {
+	query := `
+        SELECT id, user_id, name, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY created_at DESC
+    `
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key row: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api key rows: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke implements repository.APIKeyRepository.Revoke
+func (r *PostgresAPIKeyRepo) Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key %s for user %s: %w", id, userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected for api key %s: %w", id, err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// UpdateLastUsed implements repository.APIKeyRepository.UpdateLastUsed
+func (r *PostgresAPIKeyRepo) UpdateLastUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id, usedAt); err != nil {
+		return fmt.Errorf("failed to update last used time for api key %s: %w", id, err)
+	}
+	return nil
+}
+
+// scanAPIKey scans an api_keys row in the column order used by the queries above.
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var key model.APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.SecretHash,
+		&scopes,
+		&key.ExpiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = []string{}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
@@ -24,6 +24,29 @@ func NewPostgresBasketRepo(db *sql.DB) repository.BasketRepository {
 	return &PostgresBasketRepo{db: db}
 }
 
+// basketAccessCondition returns the WHERE condition for baskets accessible to the user
+// bound at parameter $n: their personal baskets and baskets of organizations they belong to.
+func basketAccessCondition(n int) string {
+	return fmt.Sprintf(`((organization_id IS NULL AND user_id = $%[1]d)
+            OR organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = $%[1]d))`, n)
+}
+
+// nullableUUID converts an optional ID to a value database/sql can store.
+func nullableUUID(id *uuid.UUID) uuid.NullUUID {
+	if id == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *id, Valid: true}
+}
+
+// uuidPtr converts a scanned nullable ID back to an optional ID.
+func uuidPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
 // Save inserts a new basket and its items within a transaction.
 func (r *PostgresBasketRepo) Save(ctx context.Context, basket *model.Basket, userID uuid.UUID) error {
 	// Start a transaction
@@ -42,8 +65,8 @@ func (r *PostgresBasketRepo) Save(ctx context.Context, basket *model.Basket, use
 	}() // Note the final () to call the deferred function
 
 	// 1. Insert into baskets table
-	basketQuery := `INSERT INTO baskets (id, user_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
-	_, err = tx.ExecContext(ctx, basketQuery, basket.ID, userID, basket.Name, basket.CreatedAt, basket.CreatedAt)
+	basketQuery := `INSERT INTO baskets (id, user_id, organization_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, basketQuery, basket.ID, userID, nullableUUID(basket.OrganizationID), basket.Name, basket.CreatedAt, basket.CreatedAt)
 	if err != nil {
 		// Check for potential unique constraint violation or other errors
 		return fmt.Errorf("failed to insert basket: %w", err)
@@ -68,11 +91,25 @@ func (r *PostgresBasketRepo) Save(ctx context.Context, basket *model.Basket, use
 	return nil // Success
 }
 
-// FindAll retrieves all baskets and their associated items.
-// NOTE: This uses a simple N+1 query approach. Optimize later if needed.
+// FindAll retrieves all baskets accessible to the user and their associated items.
 func (r *PostgresBasketRepo) FindAll(ctx context.Context, userID uuid.UUID) ([]model.Basket, error) {
-	queryBaskets := `SELECT id, name, created_at, updated_at FROM baskets WHERE user_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, queryBaskets, userID)
+	queryBaskets := `SELECT id, name, organization_id, created_at, updated_at FROM baskets
+        WHERE ` + basketAccessCondition(1) + ` ORDER BY created_at DESC`
+	return r.findBaskets(ctx, queryBaskets, userID)
+}
+
+// FindAllByOrganization retrieves the baskets of an organization the user is a member of.
+func (r *PostgresBasketRepo) FindAllByOrganization(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) ([]model.Basket, error) {
+	queryBaskets := `SELECT id, name, organization_id, created_at, updated_at FROM baskets
+        WHERE organization_id = $1 AND ` + basketAccessCondition(2) + ` ORDER BY created_at DESC`
+	return r.findBaskets(ctx, queryBaskets, orgID, userID)
+}
+
+// findBaskets runs a basket query selecting (id, name, organization_id, created_at, updated_at)
+// and loads the items of every basket found.
+// NOTE: This uses a simple N+1 query approach. Optimize later if needed.
+func (r *PostgresBasketRepo) findBaskets(ctx context.Context, queryBaskets string, args ...any) ([]model.Basket, error) {
+	rows, err := r.db.QueryContext(ctx, queryBaskets, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query baskets: %w", err)
 	}
@@ -83,9 +120,11 @@ func (r *PostgresBasketRepo) FindAll(ctx context.Context, userID uuid.UUID) ([]m
 
 	for rows.Next() {
 		var b model.Basket
-		if err := rows.Scan(&b.ID, &b.Name, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		var orgID uuid.NullUUID
+		if err := rows.Scan(&b.ID, &b.Name, &orgID, &b.CreatedAt, &b.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan basket row: %w", err)
 		}
+		b.OrganizationID = uuidPtr(orgID)
 		b.Stocks = []model.Stock{} // Initialize empty slice
 		basketsMap[b.ID] = &b
 		basketOrder = append(basketOrder, b.ID)
@@ -139,17 +178,19 @@ func (r *PostgresBasketRepo) FindAll(ctx context.Context, userID uuid.UUID) ([]m
 // FindByID retrieves a single basket and its items.
 // NOTE: Also uses N+1 approach for items.
 func (r *PostgresBasketRepo) FindByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*model.Basket, error) {
-	queryBasket := `SELECT id, name, created_at, updated_at FROM baskets WHERE id = $1 AND user_id = $2`
+	queryBasket := `SELECT id, name, organization_id, created_at, updated_at FROM baskets WHERE id = $1 AND ` + basketAccessCondition(2)
 	row := r.db.QueryRowContext(ctx, queryBasket, id, userID)
 
 	var b model.Basket
-	err := row.Scan(&b.ID, &b.Name, &b.CreatedAt, &b.UpdatedAt)
+	var orgID uuid.NullUUID
+	err := row.Scan(&b.ID, &b.Name, &orgID, &b.CreatedAt, &b.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, repository.ErrBasketNotFound // Use the custom error
 		}
 		return nil, fmt.Errorf("failed to query/scan basket %s for user %s: %w", id, userID, err)
 	}
+	b.OrganizationID = uuidPtr(orgID)
 
 	// Fetch items for this basket
 	queryItems := `SELECT symbol, quantity FROM basket_items WHERE basket_id = $1`
@@ -177,7 +218,7 @@ func (r *PostgresBasketRepo) FindByID(ctx context.Context, id uuid.UUID, userID
 // DeleteByID removes a basket from the database by its ID.
 // It returns ErrBasketNotFound if no rows are affected.
 func (r *PostgresBasketRepo) DeleteByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
-	query := `DELETE FROM baskets WHERE id = $1 AND user_id = $2`
+	query := `DELETE FROM baskets WHERE id = $1 AND ` + basketAccessCondition(2)
 
 	result, err := r.db.ExecContext(ctx, query, id, userID)
 	if err != nil {
@@ -239,7 +280,7 @@ func (r *PostgresBasketRepo) Update(ctx context.Context, basket *model.Basket, u
 
 	// 1. Update the baskets table (name and updated_at via trigger)
 	// Note: We rely on the DB trigger to update `updated_at`.
-	updateBasketQuery := `UPDATE baskets SET name = $1 WHERE id = $2 AND user_id = $3`
+	updateBasketQuery := `UPDATE baskets SET name = $1 WHERE id = $2 AND ` + basketAccessCondition(3)
 	result, err := tx.ExecContext(ctx, updateBasketQuery, basket.Name, basket.ID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update basket %s for user %s: %w", basket.ID, userID, err)
@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	// Use your actual module path
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
 	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
 	"github.com/AMANSRI99/StockSaaS/internal/common/encryptutil" // Import your encrypt util
 
@@ -14,27 +17,39 @@ import (
 )
 
 // PostgresBrokerRepo implements repository.BrokerRepository.
+//
+// Tokens are encrypted with the row's user ID and broker as associated data, so a
+// ciphertext copied into another user's row fails to decrypt.
 type PostgresBrokerRepo struct {
-	db            *sql.DB
-	encryptionKey []byte // Key for encrypting/decrypting tokens
+	db      *sql.DB
+	keyring *encryptutil.Keyring // Keys for encrypting/decrypting tokens
+	// allowUnbound accepts tokens stored before they were bound to their row
+	// (and upgrades them on read). Turn off once all rows are re-encrypted.
+	allowUnbound bool
 }
 
 // NewPostgresBrokerRepo creates a new broker repository instance.
-func NewPostgresBrokerRepo(db *sql.DB, encryptionKey []byte) repository.BrokerRepository {
-	if len(encryptionKey) != 32 {
+func NewPostgresBrokerRepo(db *sql.DB, keyring *encryptutil.Keyring, allowUnbound bool) repository.BrokerRepository {
+	if keyring == nil {
 		// Or return an error? Panicking is harsh but indicates severe config issue.
-		panic("Encryption key must be 32 bytes for PostgresBrokerRepo")
+		panic("Encryption keyring is required for PostgresBrokerRepo")
 	}
 	return &PostgresBrokerRepo{
-		db:            db,
-		encryptionKey: encryptionKey,
+		db:           db,
+		keyring:      keyring,
+		allowUnbound: allowUnbound,
 	}
 }
 
+// credentialAD is the associated data binding a token ciphertext to its row.
+func credentialAD(userID uuid.UUID, broker string) []byte {
+	return []byte("user_broker_credentials:" + userID.String() + ":" + broker)
+}
+
 // SaveOrUpdateKiteCredentials implements repository.BrokerRepository.SaveOrUpdateKiteCredentials
-func (r *PostgresBrokerRepo) SaveOrUpdateKiteCredentials(ctx context.Context, userID uuid.UUID, accessToken []byte, publicToken string, kiteUserID string) error {
+func (r *PostgresBrokerRepo) SaveOrUpdateKiteCredentials(ctx context.Context, userID uuid.UUID, accessToken []byte, publicToken string, kiteUserID string, expiresAt time.Time) error {
 	// 1. Encrypt the access token
-	encryptedAccessToken, err := encryptutil.Encrypt(accessToken, r.encryptionKey)
+	encryptedAccessToken, err := r.keyring.Encrypt(ctx, accessToken, credentialAD(userID, "kite"))
 	if err != nil {
 		return fmt.Errorf("failed to encrypt access token for user %s: %w", userID, err)
 	}
@@ -42,13 +57,16 @@ func (r *PostgresBrokerRepo) SaveOrUpdateKiteCredentials(ctx context.Context, us
 	// 2. Use INSERT ON CONFLICT (UPSERT)
 	query := `
         INSERT INTO user_broker_credentials
-            (user_id, broker, kite_user_id, public_token, access_token_encrypted, created_at, updated_at)
+            (user_id, broker, kite_user_id, public_token, access_token_encrypted, token_issued_at, expires_at, status, created_at, updated_at)
         VALUES
-            ($1, $2, $3, $4, $5, NOW(), NOW())
+            ($1, $2, $3, $4, $5, NOW(), $6, 'active', NOW(), NOW())
         ON CONFLICT (user_id, broker) DO UPDATE SET
             kite_user_id = EXCLUDED.kite_user_id,
             public_token = EXCLUDED.public_token,
             access_token_encrypted = EXCLUDED.access_token_encrypted,
+            token_issued_at = EXCLUDED.token_issued_at,
+            expires_at = EXCLUDED.expires_at,
+            status = 'active',
             updated_at = NOW()
     `
 
@@ -58,6 +76,7 @@ func (r *PostgresBrokerRepo) SaveOrUpdateKiteCredentials(ctx context.Context, us
 		kiteUserID,
 		publicToken,
 		encryptedAccessToken, // Store the encrypted bytes
+		expiresAt,
 	)
 
 	if err != nil {
@@ -70,12 +89,14 @@ func (r *PostgresBrokerRepo) SaveOrUpdateKiteCredentials(ctx context.Context, us
 // GetKiteAccessToken implements repository.BrokerRepository.GetKiteAccessToken
 func (r *PostgresBrokerRepo) GetKiteAccessToken(ctx context.Context, userID uuid.UUID) ([]byte, error) {
 	query := `
-        SELECT access_token_encrypted
+        SELECT access_token_encrypted, status, expires_at
         FROM user_broker_credentials
         WHERE user_id = $1 AND broker = 'kite'
     `
 	var encryptedToken []byte
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(&encryptedToken)
+	var status string
+	var expiresAt time.Time
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&encryptedToken, &status, &expiresAt)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -84,18 +105,251 @@ func (r *PostgresBrokerRepo) GetKiteAccessToken(ctx context.Context, userID uuid
 		return nil, fmt.Errorf("failed to query kite access token for user %s: %w", userID, err)
 	}
 
+	// Don't hand out tokens the broker will reject (the scheduler may not have flagged it yet)
+	if status != model.BrokerStatusActive || !time.Now().Before(expiresAt) {
+		return nil, repository.ErrBrokerTokenExpired
+	}
+
 	if len(encryptedToken) == 0 {
 		// Should not happen if row exists, but good practice
 		return nil, fmt.Errorf("retrieved empty encrypted token for user %s", userID)
 	}
 
 	// Decrypt the token
-	decryptedToken, err := encryptutil.Decrypt(encryptedToken, r.encryptionKey)
+	ad := credentialAD(userID, "kite")
+	decryptedToken, err := r.keyring.Decrypt(ctx, encryptedToken, ad)
 	if err != nil {
 		// Log the decryption error but maybe return a generic error to caller?
 		// Or return ErrBrokerCredentialsNotFound if decryption fails implies data corruption?
 		return nil, fmt.Errorf("failed to decrypt access token for user %s: %w", userID, err)
 	}
 
+	// Rows written before tokens were bound to their owner decrypt without associated data
+	if !r.keyring.IsBound(encryptedToken) {
+		if !r.allowUnbound {
+			return nil, fmt.Errorf("access token for user %s is not bound to its row and unbound tokens are disabled", userID)
+		}
+		r.upgradeUnboundToken(ctx, userID, "kite", encryptedToken, decryptedToken, ad)
+	}
+
 	return decryptedToken, nil
 }
+
+// upgradeUnboundToken rewrites a legacy token with associated data. Failures are only
+// logged: the caller already has the token, and the next read (or the re-encryption
+// command) will try again.
+func (r *PostgresBrokerRepo) upgradeUnboundToken(ctx context.Context, userID uuid.UUID, broker string, oldCiphertext, token, ad []byte) {
+	bound, err := r.keyring.Encrypt(ctx, token, ad)
+	if err != nil {
+		log.Printf("Warning: failed to re-encrypt access token for user %s: %v", userID, err)
+		return
+	}
+	query := `
+        UPDATE user_broker_credentials
+        SET access_token_encrypted = $4
+        WHERE user_id = $1 AND broker = $2 AND access_token_encrypted = $3
+    `
+	if _, err := r.db.ExecContext(ctx, query, userID, broker, oldCiphertext, bound); err != nil {
+		log.Printf("Warning: failed to upgrade access token encryption for user %s: %v", userID, err)
+		return
+	}
+	log.Printf("Upgraded access token encryption for user %s (%s)", userID, broker)
+}
+
+// ListConnections implements repository.BrokerRepository.ListConnections
+func (r *PostgresBrokerRepo) ListConnections(ctx context.Context, userID uuid.UUID) ([]model.BrokerConnection, error) {
+	// Deliberately never selects token columns
+	query := `
+        SELECT broker, COALESCE(kite_user_id, ''), created_at, updated_at, token_issued_at, expires_at, status
+        FROM user_broker_credentials
+        WHERE user_id = $1
+        ORDER BY broker
+    `
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query broker connections for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	connections := []model.BrokerConnection{}
+	for rows.Next() {
+		var conn model.BrokerConnection
+		if err := rows.Scan(&conn.Broker, &conn.BrokerUserID, &conn.ConnectedAt, &conn.UpdatedAt, &conn.TokenIssuedAt, &conn.TokenExpiresAt, &conn.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan broker connection row: %w", err)
+		}
+		conn.TokenValid = conn.Status == model.BrokerStatusActive && now.Before(conn.TokenExpiresAt)
+		connections = append(connections, conn)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating broker connection rows: %w", err)
+	}
+	return connections, nil
+}
+
+// MarkTokenExpired implements repository.BrokerRepository.MarkTokenExpired
+func (r *PostgresBrokerRepo) MarkTokenExpired(ctx context.Context, userID uuid.UUID, broker string) error {
+	query := `UPDATE user_broker_credentials SET status = 'expired' WHERE user_id = $1 AND broker = $2`
+	result, err := r.db.ExecContext(ctx, query, userID, broker)
+	if err != nil {
+		return fmt.Errorf("failed to mark %s token expired for user %s: %w", broker, userID, err)
+	}
+	return expectRowAffected(result, repository.ErrBrokerCredentialsNotFound)
+}
+
+// ExpireStaleTokens implements repository.BrokerRepository.ExpireStaleTokens
+func (r *PostgresBrokerRepo) ExpireStaleTokens(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+        UPDATE user_broker_credentials
+        SET status = 'expired'
+        WHERE status = 'active' AND expires_at <= $1
+    `
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire stale broker tokens: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// DeleteCredentials implements repository.BrokerRepository.DeleteCredentials
+func (r *PostgresBrokerRepo) DeleteCredentials(ctx context.Context, userID uuid.UUID, broker string) error {
+	query := `DELETE FROM user_broker_credentials WHERE user_id = $1 AND broker = $2`
+	result, err := r.db.ExecContext(ctx, query, userID, broker)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s credentials for user %s: %w", broker, userID, err)
+	}
+	return expectRowAffected(result, repository.ErrBrokerCredentialsNotFound)
+}
+
+// ReencryptAccessTokens implements repository.BrokerRepository.ReencryptAccessTokens
+func (r *PostgresBrokerRepo) ReencryptAccessTokens(ctx context.Context, batchSize int) (repository.RewriteStats, error) {
+	return r.rewriteAccessTokens(ctx, batchSize, func(ciphertext, ad []byte) ([]byte, bool, error) {
+		// Also upgrades rows that aren't bound to their owner yet
+		if !r.keyring.NeedsReencryption(ciphertext) && r.keyring.IsBound(ciphertext) {
+			return nil, false, nil
+		}
+		plaintext, err := r.keyring.Decrypt(ctx, ciphertext, ad)
+		if err != nil {
+			return nil, false, err
+		}
+		return plaintext, true, nil
+	})
+}
+
+// UnwrapDoubleEncryptedTokens implements repository.BrokerRepository.UnwrapDoubleEncryptedTokens
+func (r *PostgresBrokerRepo) UnwrapDoubleEncryptedTokens(ctx context.Context, batchSize int) (repository.RewriteStats, error) {
+	return r.rewriteAccessTokens(ctx, batchSize, func(ciphertext, ad []byte) ([]byte, bool, error) {
+		inner, err := r.keyring.Decrypt(ctx, ciphertext, ad)
+		if err != nil {
+			return nil, false, err
+		}
+		// A real access token is plain text; if the decrypted value is itself a
+		// ciphertext our keys can authenticate, the row was encrypted twice.
+		// The inner layer came from the service and never had associated data.
+		token, err := r.keyring.Decrypt(ctx, inner, nil)
+		if err != nil {
+			return nil, false, nil
+		}
+		return token, true, nil
+	})
+}
+
+// rewriteAccessTokens walks all credential rows in batches. For every row, decide gets the
+// ciphertext and the row's associated data, and returns the plaintext token to store again
+// (encrypted once with the active key, bound to the row) and whether the row needs
+// rewriting; a decide error counts the row as failed and moves on.
+func (r *PostgresBrokerRepo) rewriteAccessTokens(ctx context.Context, batchSize int, decide func(ciphertext, ad []byte) ([]byte, bool, error)) (repository.RewriteStats, error) {
+	var stats repository.RewriteStats
+	if batchSize <= 0 {
+		return stats, fmt.Errorf("batch size must be positive")
+	}
+
+	// Keyset pagination over the primary key, so every batch is a short query
+	// and rows inserted meanwhile (already written correctly) don't matter.
+	selectQuery := `
+        SELECT id, user_id, broker, access_token_encrypted
+        FROM user_broker_credentials
+        WHERE id > $1
+        ORDER BY id
+        LIMIT $2
+    `
+	// Only overwrite the exact ciphertext we read: if the user reconnected in the
+	// meantime, the new token is already stored correctly.
+	updateQuery := `
+        UPDATE user_broker_credentials
+        SET access_token_encrypted = $3
+        WHERE id = $1 AND access_token_encrypted = $2
+    `
+
+	lastID := uuid.Nil
+	for {
+		rows, err := r.db.QueryContext(ctx, selectQuery, lastID, batchSize)
+		if err != nil {
+			return stats, fmt.Errorf("failed to query broker credentials after %s: %w", lastID, err)
+		}
+
+		type credentialRow struct {
+			id         uuid.UUID
+			userID     uuid.UUID
+			broker     string
+			ciphertext []byte
+		}
+		batch := make([]credentialRow, 0, batchSize)
+		for rows.Next() {
+			var row credentialRow
+			if err := rows.Scan(&row.id, &row.userID, &row.broker, &row.ciphertext); err != nil {
+				rows.Close()
+				return stats, fmt.Errorf("failed to scan broker credential row: %w", err)
+			}
+			batch = append(batch, row)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("error iterating broker credential rows: %w", err)
+		}
+		rows.Close()
+
+		if len(batch) == 0 {
+			return stats, nil
+		}
+
+		for _, row := range batch {
+			stats.Scanned++
+			lastID = row.id
+
+			ad := credentialAD(row.userID, row.broker)
+			plaintext, rewrite, err := decide(row.ciphertext, ad)
+			if err != nil {
+				log.Printf("Credential rewrite: Failed to decrypt broker credential %s: %v", row.id, err)
+				stats.Failed++
+				continue
+			}
+			if !rewrite {
+				continue
+			}
+			encrypted, err := r.keyring.Encrypt(ctx, plaintext, ad)
+			if err != nil {
+				return stats, fmt.Errorf("failed to encrypt broker credential %s: %w", row.id, err)
+			}
+
+			result, err := r.db.ExecContext(ctx, updateQuery, row.id, row.ciphertext, encrypted)
+			if err != nil {
+				return stats, fmt.Errorf("failed to update broker credential %s: %w", row.id, err)
+			}
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				stats.Skipped++
+				continue
+			}
+			stats.Rewritten++
+		}
+		log.Printf("Credential rewrite: %d scanned, %d rewritten so far", stats.Scanned, stats.Rewritten)
+
+		if len(batch) < batchSize {
+			return stats, nil
+		}
+	}
+}
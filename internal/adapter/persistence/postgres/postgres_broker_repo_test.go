@@ -0,0 +1,458 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/common/encryptutil"
+
+	"github.com/google/uuid"
+)
+
+// The tests run the repository against a fake database/sql driver holding the
+// user_broker_credentials table in memory. It understands exactly the statements
+// PostgresBrokerRepo sends, so the repository code runs unchanged.
+
+type fakeCredential struct {
+	id        string
+	userID    string
+	broker    string
+	token     []byte
+	status    string
+	expiresAt time.Time
+}
+
+type fakeCredentialDB struct {
+	mu   sync.Mutex
+	rows []*fakeCredential
+}
+
+func (db *fakeCredentialDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+func (db *fakeCredentialDB) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("use sql.OpenDB") }
+
+type fakeConn struct {
+	db *fakeCredentialDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "INSERT INTO user_broker_credentials"):
+		userID, broker, token, expiresAt := args[0].Value.(string), args[1].Value.(string), args[4].Value.([]byte), args[5].Value.(time.Time)
+		if row := db.find(userID, broker); row != nil {
+			row.token, row.status, row.expiresAt = token, "active", expiresAt
+		} else {
+			db.rows = append(db.rows, &fakeCredential{
+				id: uuid.NewString(), userID: userID, broker: broker, token: token, status: "active", expiresAt: expiresAt,
+			})
+		}
+		return driver.RowsAffected(1), nil
+
+	case strings.Contains(query, "SET access_token_encrypted = $4"): // Upgrade of an unbound token
+		row := db.find(args[0].Value.(string), args[1].Value.(string))
+		return db.swap(row, args[2].Value.([]byte), args[3].Value.([]byte)), nil
+
+	case strings.Contains(query, "SET access_token_encrypted = $3"): // Bulk rewrite
+		var row *fakeCredential
+		for _, r := range db.rows {
+			if r.id == args[0].Value.(string) {
+				row = r
+			}
+		}
+		return db.swap(row, args[1].Value.([]byte), args[2].Value.([]byte)), nil
+	}
+	return nil, fmt.Errorf("fake db: unexpected exec: %s", query)
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "SELECT access_token_encrypted, status, expires_at"):
+		rows := &fakeRows{columns: []string{"access_token_encrypted", "status", "expires_at"}}
+		if row := db.find(args[0].Value.(string), "kite"); row != nil {
+			rows.values = append(rows.values, []driver.Value{row.token, row.status, row.expiresAt})
+		}
+		return rows, nil
+
+	case strings.Contains(query, "SELECT id, user_id, broker, access_token_encrypted"):
+		afterID, limit := args[0].Value.(string), int(args[1].Value.(int64))
+		sorted := append([]*fakeCredential(nil), db.rows...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+		rows := &fakeRows{columns: []string{"id", "user_id", "broker", "access_token_encrypted"}}
+		for _, row := range sorted {
+			if row.id > afterID && len(rows.values) < limit {
+				rows.values = append(rows.values, []driver.Value{row.id, row.userID, row.broker, row.token})
+			}
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("fake db: unexpected query: %s", query)
+}
+
+func (db *fakeCredentialDB) find(userID, broker string) *fakeCredential {
+	for _, row := range db.rows {
+		if row.userID == userID && row.broker == broker {
+			return row
+		}
+	}
+	return nil
+}
+
+// swap replaces a row's token if it still is old, like the repository's conditional updates.
+func (db *fakeCredentialDB) swap(row *fakeCredential, old, new []byte) driver.Result {
+	if row == nil || !bytes.Equal(row.token, old) {
+		return driver.RowsAffected(0)
+	}
+	row.token = new
+	return driver.RowsAffected(1)
+}
+
+// insert stores a row as-is, e.g. as written by an older version of the code.
+func (db *fakeCredentialDB) insert(userID uuid.UUID, token []byte) {
+	db.rows = append(db.rows, &fakeCredential{
+		id: uuid.NewString(), userID: userID.String(), broker: "kite", token: token,
+		status: "active", expiresAt: time.Now().Add(time.Hour),
+	})
+}
+
+func (db *fakeCredentialDB) storedToken(t *testing.T, userID uuid.UUID) []byte {
+	t.Helper()
+	row := db.find(userID.String(), "kite")
+	if row == nil {
+		t.Fatalf("no stored credentials for user %s", userID)
+	}
+	return row.token
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func newTestBrokerRepo(t *testing.T, keyring *encryptutil.Keyring, allowUnbound bool) (*PostgresBrokerRepo, *fakeCredentialDB) {
+	t.Helper()
+	fake := &fakeCredentialDB{}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return NewPostgresBrokerRepo(db, keyring, allowUnbound).(*PostgresBrokerRepo), fake
+}
+
+func TestBrokerRepoTokenRoundTrip(t *testing.T) {
+	kek, err := encryptutil.NewLocalKeyProvider("kek-1", testKey(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKeyring, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerKeyring, err := encryptutil.NewKeyring(nil, "kek-1", nil, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *encryptutil.Keyring
+	}{
+		{"raw key", rawKeyring},
+		{"key provider", providerKeyring},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, fake := newTestBrokerRepo(t, tt.keyring, false)
+			userID := uuid.New()
+			token := []byte("kite-access-token-123")
+
+			if err := repo.SaveOrUpdateKiteCredentials(ctx, userID, token, "public", "AB1234", time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			stored := fake.storedToken(t, userID)
+			if bytes.Contains(stored, token) {
+				t.Fatalf("token stored in plaintext")
+			}
+			if !tt.keyring.IsBound(stored) {
+				t.Fatalf("stored token is not bound to its row")
+			}
+
+			got, err := repo.GetKiteAccessToken(ctx, userID)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if !bytes.Equal(got, token) {
+				t.Fatalf("got %q, want %q", got, token)
+			}
+		})
+	}
+}
+
+func TestBrokerRepoRejectsTokenCopiedFromAnotherUser(t *testing.T) {
+	ctx := context.Background()
+	keyring, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, fake := newTestBrokerRepo(t, keyring, true)
+	alice, mallory := uuid.New(), uuid.New()
+	if err := repo.SaveOrUpdateKiteCredentials(ctx, alice, []byte("alice-token"), "", "", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	fake.insert(mallory, fake.storedToken(t, alice))
+
+	if _, err := repo.GetKiteAccessToken(ctx, mallory); err == nil {
+		t.Fatal("a token copied into another user's row decrypted")
+	}
+}
+
+func TestBrokerRepoUpgradesUnboundToken(t *testing.T) {
+	ctx := context.Background()
+	keyring, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbound, err := keyring.Encrypt(ctx, []byte("old-token"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		repo, fake := newTestBrokerRepo(t, keyring, true)
+		userID := uuid.New()
+		fake.insert(userID, unbound)
+
+		got, err := repo.GetKiteAccessToken(ctx, userID)
+		if err != nil || string(got) != "old-token" {
+			t.Fatalf("got %q, %v", got, err)
+		}
+		if !keyring.IsBound(fake.storedToken(t, userID)) {
+			t.Fatal("unbound token was not upgraded on read")
+		}
+	})
+	t.Run("refused", func(t *testing.T) {
+		repo, fake := newTestBrokerRepo(t, keyring, false)
+		userID := uuid.New()
+		fake.insert(userID, unbound)
+
+		if _, err := repo.GetKiteAccessToken(ctx, userID); err == nil {
+			t.Fatal("unbound token accepted with unbound tokens disabled")
+		}
+	})
+}
+
+func TestBrokerRepoUnwrapsDoubleEncryptedTokenOnce(t *testing.T) {
+	ctx := context.Background()
+	keyring, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, fake := newTestBrokerRepo(t, keyring, false)
+
+	// What the service used to do before handing the token to the repository
+	doubled, single := uuid.New(), uuid.New()
+	inner, err := keyring.Encrypt(ctx, []byte("doubled-token"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveOrUpdateKiteCredentials(ctx, doubled, inner, "", "", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveOrUpdateKiteCredentials(ctx, single, []byte("single-token"), "", "", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	singleBefore := fake.storedToken(t, single)
+
+	stats, err := repo.UnwrapDoubleEncryptedTokens(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Scanned != 2 || stats.Rewritten != 1 || stats.Failed != 0 {
+		t.Fatalf("first run: %+v, want 2 scanned, 1 rewritten", stats)
+	}
+	if !bytes.Equal(fake.storedToken(t, single), singleBefore) {
+		t.Fatal("a token encrypted once was rewritten")
+	}
+	for user, want := range map[uuid.UUID]string{doubled: "doubled-token", single: "single-token"} {
+		got, err := repo.GetKiteAccessToken(ctx, user)
+		if err != nil || string(got) != want {
+			t.Fatalf("got %q, %v; want %q", got, err, want)
+		}
+	}
+
+	// Unwrapped exactly once: a second run finds nothing to do
+	repairedBefore := fake.storedToken(t, doubled)
+	stats, err = repo.UnwrapDoubleEncryptedTokens(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rewritten != 0 {
+		t.Fatalf("second run rewrote %d rows, want 0", stats.Rewritten)
+	}
+	if !bytes.Equal(fake.storedToken(t, doubled), repairedBefore) {
+		t.Fatal("repaired token was rewritten again")
+	}
+}
+
+func TestBrokerRepoReencryptsWithActiveKey(t *testing.T) {
+	ctx := context.Background()
+	oldRing, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRing, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRepo, fake := newTestBrokerRepo(t, oldRing, false)
+	userID := uuid.New()
+	if err := oldRepo.SaveOrUpdateKiteCredentials(ctx, userID, []byte("rotated-token"), "", "", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	newRepo := NewPostgresBrokerRepo(sql.OpenDB(fake), newRing, false).(*PostgresBrokerRepo)
+	stats, err := newRepo.ReencryptAccessTokens(ctx, 10)
+	if err != nil || stats.Rewritten != 1 {
+		t.Fatalf("re-encrypt: %+v, %v", stats, err)
+	}
+	if newRing.NeedsReencryption(fake.storedToken(t, userID)) {
+		t.Fatal("token is still on the old key")
+	}
+
+	// The old key can go
+	onlyNew, err := encryptutil.NewKeyring(map[string][]byte{"k2": testKey(2)}, "k2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewPostgresBrokerRepo(sql.OpenDB(fake), onlyNew, false).GetKiteAccessToken(ctx, userID)
+	if err != nil || string(got) != "rotated-token" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+// TestBrokerRepoPostgres runs the repository's SQL against a real database, which
+// the fake driver can't vouch for. Point TEST_DATABASE_URL at a scratch database
+// with the migrations applied; the test is skipped when it is unset.
+func TestBrokerRepoPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	userID := uuid.New()
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, email, password_hash) VALUES ($1, $2, 'not-a-hash')`,
+		userID, userID.String()+"@example.com")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() { db.ExecContext(context.Background(), `DELETE FROM users WHERE id = $1`, userID) })
+	storedToken := func() []byte {
+		t.Helper()
+		var token []byte
+		err := db.QueryRowContext(ctx, `SELECT access_token_encrypted FROM user_broker_credentials WHERE user_id = $1`, userID).Scan(&token)
+		if err != nil {
+			t.Fatalf("read stored token: %v", err)
+		}
+		return token
+	}
+
+	oldRing, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewPostgresBrokerRepo(db, oldRing, false)
+
+	// Saving twice runs both the insert and the ON CONFLICT update
+	for _, token := range []string{"first-token", "second-token"} {
+		if err := repo.SaveOrUpdateKiteCredentials(ctx, userID, []byte(token), "public", "AB1234", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+		if !oldRing.IsBound(storedToken()) {
+			t.Fatal("stored token is not bound to its row")
+		}
+		got, err := repo.GetKiteAccessToken(ctx, userID)
+		if err != nil || string(got) != token {
+			t.Fatalf("got %q, %v; want %q", got, err, token)
+		}
+	}
+	connections, err := repo.ListConnections(ctx, userID)
+	if err != nil || len(connections) != 1 || connections[0].BrokerUserID != "AB1234" {
+		t.Fatalf("connections: %+v, %v", connections, err)
+	}
+
+	// A double-encrypted token is repaired. Other rows in the database may not
+	// decrypt with the test key, so only this user's row is checked.
+	inner, err := oldRing.Encrypt(ctx, []byte("doubled-token"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveOrUpdateKiteCredentials(ctx, userID, inner, "public", "AB1234", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.UnwrapDoubleEncryptedTokens(ctx, 100); err != nil {
+		t.Fatalf("unwrap: %v", err)
+	}
+	got, err := repo.GetKiteAccessToken(ctx, userID)
+	if err != nil || string(got) != "doubled-token" {
+		t.Fatalf("after unwrap got %q, %v", got, err)
+	}
+
+	// Re-encryption moves the token to the active key
+	newRing, err := encryptutil.NewKeyring(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPostgresBrokerRepo(db, newRing, false).ReencryptAccessTokens(ctx, 100); err != nil {
+		t.Fatalf("re-encrypt: %v", err)
+	}
+	if newRing.NeedsReencryption(storedToken()) {
+		t.Fatal("token is still on the old key")
+	}
+}
@@ -0,0 +1,490 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// PostgresExecutionRepo implements repository.ExecutionRepository using the
+// basket_executions and execution_orders tables.
+type PostgresExecutionRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresExecutionRepo creates a new execution repository instance.
+func NewPostgresExecutionRepo(db *sql.DB) repository.ExecutionRepository {
+	return &PostgresExecutionRepo{db: db}
+}
+
+const executionColumns = `id, basket_id, user_id, transaction_type, status, margin_check, created_at, updated_at`
+
+const executionOrderColumns = `id, execution_id, symbol, exchange, transaction_type, order_type, product, variety,
+        quantity, price, trigger_price, status, broker_order_id, error_message, version,
+        iceberg_legs, iceberg_quantity, filled_quantity, average_price, created_at, updated_at`
+
+const orderSliceColumns = `id, order_id, seq, quantity, status, broker_order_id, error_message, filled_quantity,
+        average_price, created_at, updated_at`
+
+const orderEventColumns = `id, execution_id, order_id, user_id, action, outcome, before_state, after_state, error_message, created_at`
+
+// Create implements repository.ExecutionRepository.Create
+func (r *PostgresExecutionRepo) Create(ctx context.Context, execution *model.Execution) (err error) {
+	marginCheck, err := marshalMarginCheck(execution.MarginCheck)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	execQuery := `INSERT INTO basket_executions (` + executionColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.ExecContext(ctx, execQuery,
+		execution.ID, nullableUUID(execution.BasketID), execution.UserID, execution.TransactionType,
+		execution.Status, marginCheck, execution.CreatedAt, execution.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert execution: %w", err)
+	}
+
+	orderQuery := `INSERT INTO execution_orders (` + executionOrderColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`
+	stmt, err := tx.PrepareContext(ctx, orderQuery)
+	if err != nil {
+		return fmt.Errorf("failed to prepare order insert statement: %w", err)
+	}
+	defer stmt.Close()
+	sliceQuery := `INSERT INTO execution_order_slices (` + orderSliceColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	sliceStmt, err := tx.PrepareContext(ctx, sliceQuery)
+	if err != nil {
+		return fmt.Errorf("failed to prepare slice insert statement: %w", err)
+	}
+	defer sliceStmt.Close()
+
+	for _, o := range execution.Orders {
+		_, err = stmt.ExecContext(ctx,
+			o.ID, o.ExecutionID, o.Symbol, o.Exchange, o.TransactionType, o.OrderType, o.Product, o.Variety,
+			o.Quantity, o.Price, o.TriggerPrice, o.Status, o.BrokerOrderID, o.ErrorMessage, o.Version,
+			nullableInt(o.IcebergLegs), nullableInt(o.IcebergQuantity), o.FilledQuantity, o.AveragePrice, o.CreatedAt, o.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert order for %s: %w", o.Symbol, err)
+		}
+		for _, sl := range o.Slices {
+			_, err = sliceStmt.ExecContext(ctx,
+				sl.ID, sl.OrderID, sl.Seq, sl.Quantity, sl.Status, sl.BrokerOrderID, sl.ErrorMessage,
+				sl.FilledQuantity, sl.AveragePrice, sl.CreatedAt, sl.UpdatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to insert child order #%d for %s: %w", sl.Seq, o.Symbol, err)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UpdateOrder implements repository.ExecutionRepository.UpdateOrder
+func (r *PostgresExecutionRepo) UpdateOrder(ctx context.Context, order *model.ExecutionOrder) error {
+	query := `
+        UPDATE execution_orders SET status = $1, broker_order_id = $2, error_message = $3, version = version + 1
+        WHERE id = $4
+        RETURNING version
+    `
+	err := r.db.QueryRowContext(ctx, query, order.Status, order.BrokerOrderID, order.ErrorMessage, order.ID).Scan(&order.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrExecutionOrderNotFound
+		}
+		return fmt.Errorf("failed to update execution order %s: %w", order.ID, err)
+	}
+	return nil
+}
+
+// UpdateSlice implements repository.ExecutionRepository.UpdateSlice
+func (r *PostgresExecutionRepo) UpdateSlice(ctx context.Context, slice *model.OrderSlice) error {
+	query := `
+        UPDATE execution_order_slices
+        SET status = $1, broker_order_id = $2, error_message = $3, filled_quantity = $4, average_price = $5
+        WHERE id = $6
+    `
+	result, err := r.db.ExecContext(ctx, query,
+		slice.Status, slice.BrokerOrderID, slice.ErrorMessage, slice.FilledQuantity, slice.AveragePrice, slice.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update child order %s: %w", slice.ID, err)
+	}
+	return expectRowAffected(result, repository.ErrExecutionOrderNotFound)
+}
+
+// UpdateFills implements repository.ExecutionRepository.UpdateFills
+func (r *PostgresExecutionRepo) UpdateFills(ctx context.Context, order *model.ExecutionOrder) error {
+	query := `UPDATE execution_orders SET filled_quantity = $1, average_price = $2 WHERE id = $3`
+	result, err := r.db.ExecContext(ctx, query, order.FilledQuantity, order.AveragePrice, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update fills of execution order %s: %w", order.ID, err)
+	}
+	return expectRowAffected(result, repository.ErrExecutionOrderNotFound)
+}
+
+// UpdateOpenOrder implements repository.ExecutionRepository.UpdateOpenOrder
+func (r *PostgresExecutionRepo) UpdateOpenOrder(ctx context.Context, order *model.ExecutionOrder, expectedVersion int) error {
+	query := `
+        UPDATE execution_orders
+        SET status = $1, quantity = $2, price = $3, trigger_price = $4, version = version + 1
+        WHERE id = $5 AND version = $6 AND status = 'placed'
+        RETURNING version
+    `
+	err := r.db.QueryRowContext(ctx, query,
+		order.Status, order.Quantity, order.Price, order.TriggerPrice, order.ID, expectedVersion).Scan(&order.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrExecutionOrderConflict
+		}
+		return fmt.Errorf("failed to update execution order %s: %w", order.ID, err)
+	}
+	return nil
+}
+
+// AddOrderEvent implements repository.ExecutionRepository.AddOrderEvent
+func (r *PostgresExecutionRepo) AddOrderEvent(ctx context.Context, event *model.OrderEvent) error {
+	before, err := json.Marshal(event.Before)
+	if err != nil {
+		return fmt.Errorf("failed to encode order event state: %w", err)
+	}
+	var after []byte
+	if event.After != nil {
+		if after, err = json.Marshal(event.After); err != nil {
+			return fmt.Errorf("failed to encode order event state: %w", err)
+		}
+	}
+
+	query := `INSERT INTO execution_order_events (` + orderEventColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = r.db.ExecContext(ctx, query,
+		event.ID, event.ExecutionID, event.OrderID, event.UserID, event.Action, event.Outcome,
+		before, after, event.ErrorMessage, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert order event for order %s: %w", event.OrderID, err)
+	}
+	return nil
+}
+
+// ListOrderEvents implements repository.ExecutionRepository.ListOrderEvents
+func (r *PostgresExecutionRepo) ListOrderEvents(ctx context.Context, executionID uuid.UUID) ([]model.OrderEvent, error) {
+	query := `SELECT ` + orderEventColumns + ` FROM execution_order_events WHERE execution_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, executionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order events of execution %s: %w", executionID, err)
+	}
+	defer rows.Close()
+
+	events := []model.OrderEvent{}
+	for rows.Next() {
+		var e model.OrderEvent
+		var userID uuid.NullUUID
+		var before, after []byte
+		var errorMessage sql.NullString
+		err := rows.Scan(&e.ID, &e.ExecutionID, &e.OrderID, &userID, &e.Action, &e.Outcome, &before, &after, &errorMessage, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order event row: %w", err)
+		}
+		e.UserID = userID.UUID // Nil once the user is deleted
+		if err := json.Unmarshal(before, &e.Before); err != nil {
+			return nil, fmt.Errorf("failed to decode order event %s: %w", e.ID, err)
+		}
+		if after != nil {
+			e.After = &model.OrderSnapshot{}
+			if err := json.Unmarshal(after, e.After); err != nil {
+				return nil, fmt.Errorf("failed to decode order event %s: %w", e.ID, err)
+			}
+		}
+		if errorMessage.Valid {
+			e.ErrorMessage = &errorMessage.String
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order event rows: %w", err)
+	}
+	return events, nil
+}
+
+// UpdateStatus implements repository.ExecutionRepository.UpdateStatus
+func (r *PostgresExecutionRepo) UpdateStatus(ctx context.Context, executionID uuid.UUID, status string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE basket_executions SET status = $1 WHERE id = $2`, status, executionID)
+	if err != nil {
+		return fmt.Errorf("failed to update status of execution %s: %w", executionID, err)
+	}
+	return expectRowAffected(result, repository.ErrExecutionNotFound)
+}
+
+// FindByID implements repository.ExecutionRepository.FindByID
+func (r *PostgresExecutionRepo) FindByID(ctx context.Context, executionID uuid.UUID) (*model.Execution, error) {
+	query := `SELECT ` + executionColumns + ` FROM basket_executions WHERE id = $1`
+	execution, err := scanExecution(r.db.QueryRowContext(ctx, query, executionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrExecutionNotFound
+		}
+		return nil, fmt.Errorf("failed to query execution %s: %w", executionID, err)
+	}
+
+	ordersQuery := `SELECT ` + executionOrderColumns + ` FROM execution_orders WHERE execution_id = $1 ORDER BY created_at, symbol`
+	rows, err := r.db.QueryContext(ctx, ordersQuery, executionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders of execution %s: %w", executionID, err)
+	}
+	defer rows.Close()
+
+	execution.Orders = []model.ExecutionOrder{}
+	for rows.Next() {
+		order, err := scanExecutionOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order of execution %s: %w", executionID, err)
+		}
+		execution.Orders = append(execution.Orders, *order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders of execution %s: %w", executionID, err)
+	}
+	if err := r.loadSlices(ctx, execution); err != nil {
+		return nil, err
+	}
+	return execution, nil
+}
+
+// loadSlices attaches the child orders of an execution's split orders.
+func (r *PostgresExecutionRepo) loadSlices(ctx context.Context, execution *model.Execution) error {
+	query := `
+        SELECT ` + orderSliceColumns + ` FROM execution_order_slices
+        WHERE order_id IN (SELECT id FROM execution_orders WHERE execution_id = $1)
+        ORDER BY order_id, seq
+    `
+	rows, err := r.db.QueryContext(ctx, query, execution.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query child orders of execution %s: %w", execution.ID, err)
+	}
+	defer rows.Close()
+
+	byOrder := map[uuid.UUID][]model.OrderSlice{}
+	for rows.Next() {
+		slice, err := scanOrderSlice(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan child order of execution %s: %w", execution.ID, err)
+		}
+		byOrder[slice.OrderID] = append(byOrder[slice.OrderID], *slice)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating child orders of execution %s: %w", execution.ID, err)
+	}
+	for i := range execution.Orders {
+		order := &execution.Orders[i]
+		order.Slices = byOrder[order.ID]
+		for _, slice := range order.Slices {
+			order.SliceQuantities = append(order.SliceQuantities, slice.Quantity)
+		}
+	}
+	return nil
+}
+
+// ListByBasket implements repository.ExecutionRepository.ListByBasket
+func (r *PostgresExecutionRepo) ListByBasket(ctx context.Context, basketID uuid.UUID) ([]model.Execution, error) {
+	query := `SELECT ` + executionColumns + ` FROM basket_executions WHERE basket_id = $1 ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, basketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query executions of basket %s: %w", basketID, err)
+	}
+	defer rows.Close()
+
+	executions := []model.Execution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan execution row: %w", err)
+		}
+		executions = append(executions, *execution)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating execution rows: %w", err)
+	}
+	return executions, nil
+}
+
+// ReleaseQueued implements repository.ExecutionRepository.ReleaseQueued
+func (r *PostgresExecutionRepo) ReleaseQueued(ctx context.Context, openedAt time.Time) (int64, error) {
+	query := `UPDATE basket_executions SET status = 'completed' WHERE status = 'queued_for_open' AND created_at < $1`
+	result, err := r.db.ExecContext(ctx, query, openedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release queued executions: %w", err)
+	}
+	released, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return released, nil
+}
+
+// NetPlacedQuantities implements repository.ExecutionRepository.NetPlacedQuantities
+func (r *PostgresExecutionRepo) NetPlacedQuantities(ctx context.Context, basketID uuid.UUID, userID uuid.UUID) (map[string]int, error) {
+	query := `
+        WITH placed AS (
+            -- A split order counts with the quantity of its child orders that were placed
+            SELECT o.symbol, o.transaction_type, COALESCE(
+                (SELECT SUM(s.quantity) FROM execution_order_slices s WHERE s.order_id = o.id AND s.status = 'placed'),
+                o.quantity) AS quantity
+            FROM execution_orders o
+            JOIN basket_executions e ON e.id = o.execution_id
+            WHERE e.basket_id = $1 AND e.user_id = $2 AND o.status = 'placed'
+        )
+        SELECT symbol, SUM(CASE WHEN transaction_type = 'BUY' THEN quantity ELSE -quantity END)
+        FROM placed
+        GROUP BY symbol
+    `
+	rows, err := r.db.QueryContext(ctx, query, basketID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query net quantities of basket %s: %w", basketID, err)
+	}
+	defer rows.Close()
+
+	quantities := map[string]int{}
+	for rows.Next() {
+		var symbol string
+		var quantity int
+		if err := rows.Scan(&symbol, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan net quantity row: %w", err)
+		}
+		quantities[symbol] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating net quantity rows: %w", err)
+	}
+	return quantities, nil
+}
+
+// marshalMarginCheck encodes a margin check for the JSONB column (nil stays NULL).
+func marshalMarginCheck(check *model.MarginCheck) ([]byte, error) {
+	if check == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(check)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode margin check: %w", err)
+	}
+	return data, nil
+}
+
+// scanExecution scans a basket_executions row in executionColumns order.
+func scanExecution(row rowScanner) (*model.Execution, error) {
+	var e model.Execution
+	var basketID uuid.NullUUID
+	var marginCheck []byte
+	err := row.Scan(&e.ID, &basketID, &e.UserID, &e.TransactionType, &e.Status, &marginCheck, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.BasketID = uuidPtr(basketID)
+	if marginCheck != nil {
+		e.MarginCheck = &model.MarginCheck{}
+		if err := json.Unmarshal(marginCheck, e.MarginCheck); err != nil {
+			return nil, fmt.Errorf("failed to decode margin check of execution %s: %w", e.ID, err)
+		}
+	}
+	return &e, nil
+}
+
+// scanExecutionOrder scans an execution_orders row in executionOrderColumns order.
+func scanExecutionOrder(row rowScanner) (*model.ExecutionOrder, error) {
+	var o model.ExecutionOrder
+	var price, triggerPrice, averagePrice sql.NullFloat64
+	var brokerOrderID, errorMessage sql.NullString
+	var icebergLegs, icebergQuantity sql.NullInt64
+	err := row.Scan(
+		&o.ID,
+		&o.ExecutionID,
+		&o.Symbol,
+		&o.Exchange,
+		&o.TransactionType,
+		&o.OrderType,
+		&o.Product,
+		&o.Variety,
+		&o.Quantity,
+		&price,
+		&triggerPrice,
+		&o.Status,
+		&brokerOrderID,
+		&errorMessage,
+		&o.Version,
+		&icebergLegs,
+		&icebergQuantity,
+		&o.FilledQuantity,
+		&averagePrice,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if price.Valid {
+		o.Price = &price.Float64
+	}
+	if triggerPrice.Valid {
+		o.TriggerPrice = &triggerPrice.Float64
+	}
+	if brokerOrderID.Valid {
+		o.BrokerOrderID = &brokerOrderID.String
+	}
+	if errorMessage.Valid {
+		o.ErrorMessage = &errorMessage.String
+	}
+	o.IcebergLegs = int(icebergLegs.Int64)
+	o.IcebergQuantity = int(icebergQuantity.Int64)
+	if averagePrice.Valid {
+		o.AveragePrice = &averagePrice.Float64
+	}
+	return &o, nil
+}
+
+// scanOrderSlice scans an execution_order_slices row in orderSliceColumns order.
+func scanOrderSlice(row rowScanner) (*model.OrderSlice, error) {
+	var sl model.OrderSlice
+	var brokerOrderID, errorMessage sql.NullString
+	var averagePrice sql.NullFloat64
+	err := row.Scan(&sl.ID, &sl.OrderID, &sl.Seq, &sl.Quantity, &sl.Status, &brokerOrderID, &errorMessage,
+		&sl.FilledQuantity, &averagePrice, &sl.CreatedAt, &sl.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if brokerOrderID.Valid {
+		sl.BrokerOrderID = &brokerOrderID.String
+	}
+	if errorMessage.Valid {
+		sl.ErrorMessage = &errorMessage.String
+	}
+	if averagePrice.Valid {
+		sl.AveragePrice = &averagePrice.Float64
+	}
+	return &sl, nil
+}
+
+// nullableInt stores 0 as NULL, for optional integer columns.
+func nullableInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
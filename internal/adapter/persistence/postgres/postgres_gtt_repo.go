@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// PostgresGTTRepo implements repository.GTTRepository using the gtt_triggers table.
+type PostgresGTTRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresGTTRepo creates a new GTT repository instance.
+func NewPostgresGTTRepo(db *sql.DB) repository.GTTRepository {
+	return &PostgresGTTRepo{db: db}
+}
+
+const gttColumns = `id, user_id, basket_id, execution_order_id, broker_trigger_id, type, symbol, exchange,
+        transaction_type, product, last_price, legs, status, created_at, updated_at`
+
+// Create implements repository.GTTRepository.Create
+func (r *PostgresGTTRepo) Create(ctx context.Context, gtt *model.GTT) error {
+	legs, err := json.Marshal(gtt.Legs)
+	if err != nil {
+		return fmt.Errorf("failed to encode gtt legs: %w", err)
+	}
+	query := `INSERT INTO gtt_triggers (` + gttColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err = r.db.ExecContext(ctx, query,
+		gtt.ID, gtt.UserID, nullableUUID(gtt.BasketID), nullableUUID(gtt.ExecutionOrderID), gtt.BrokerTriggerID,
+		gtt.Type, gtt.Symbol, gtt.Exchange, gtt.TransactionType, gtt.Product, gtt.LastPrice, legs, gtt.Status,
+		gtt.CreatedAt, gtt.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert gtt trigger %d: %w", gtt.BrokerTriggerID, err)
+	}
+	return nil
+}
+
+// FindByID implements repository.GTTRepository.FindByID
+func (r *PostgresGTTRepo) FindByID(ctx context.Context, gttID uuid.UUID, userID uuid.UUID) (*model.GTT, error) {
+	query := `SELECT ` + gttColumns + ` FROM gtt_triggers WHERE id = $1 AND user_id = $2`
+	gtt, err := scanGTT(r.db.QueryRowContext(ctx, query, gttID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrGTTNotFound
+		}
+		return nil, fmt.Errorf("failed to query gtt trigger %s: %w", gttID, err)
+	}
+	return gtt, nil
+}
+
+// ListByUser implements repository.GTTRepository.ListByUser
+func (r *PostgresGTTRepo) ListByUser(ctx context.Context, userID uuid.UUID, basketID *uuid.UUID) ([]model.GTT, error) {
+	query := `SELECT ` + gttColumns + ` FROM gtt_triggers
+        WHERE user_id = $1 AND ($2::uuid IS NULL OR basket_id = $2)
+        ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID, nullableUUID(basketID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gtt triggers of user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	gtts := []model.GTT{}
+	for rows.Next() {
+		gtt, err := scanGTT(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan gtt trigger row: %w", err)
+		}
+		gtts = append(gtts, *gtt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating gtt trigger rows: %w", err)
+	}
+	return gtts, nil
+}
+
+// Update implements repository.GTTRepository.Update
+func (r *PostgresGTTRepo) Update(ctx context.Context, gtt *model.GTT) error {
+	legs, err := json.Marshal(gtt.Legs)
+	if err != nil {
+		return fmt.Errorf("failed to encode gtt legs: %w", err)
+	}
+	query := `UPDATE gtt_triggers SET last_price = $1, legs = $2, status = $3 WHERE id = $4 AND user_id = $5`
+	result, err := r.db.ExecContext(ctx, query, gtt.LastPrice, legs, gtt.Status, gtt.ID, gtt.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update gtt trigger %s: %w", gtt.ID, err)
+	}
+	return expectRowAffected(result, repository.ErrGTTNotFound)
+}
+
+// scanGTT scans a gtt_triggers row in gttColumns order.
+func scanGTT(row rowScanner) (*model.GTT, error) {
+	var g model.GTT
+	var basketID, executionOrderID uuid.NullUUID
+	var legs []byte
+	err := row.Scan(
+		&g.ID,
+		&g.UserID,
+		&basketID,
+		&executionOrderID,
+		&g.BrokerTriggerID,
+		&g.Type,
+		&g.Symbol,
+		&g.Exchange,
+		&g.TransactionType,
+		&g.Product,
+		&g.LastPrice,
+		&legs,
+		&g.Status,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	g.BasketID = uuidPtr(basketID)
+	g.ExecutionOrderID = uuidPtr(executionOrderID)
+	if err := json.Unmarshal(legs, &g.Legs); err != nil {
+		return nil, fmt.Errorf("failed to decode legs of gtt trigger %s: %w", g.ID, err)
+	}
+	return &g, nil
+}
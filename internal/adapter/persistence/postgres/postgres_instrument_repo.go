@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+)
+
+// PostgresInstrumentRepo implements repository.InstrumentRepository using the instruments table.
+type PostgresInstrumentRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresInstrumentRepo creates a new instrument repository instance.
+func NewPostgresInstrumentRepo(db *sql.DB) repository.InstrumentRepository {
+	return &PostgresInstrumentRepo{db: db}
+}
+
+// Upsert implements repository.InstrumentRepository.Upsert
+func (r *PostgresInstrumentRepo) Upsert(ctx context.Context, instruments []model.Instrument) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	query := `
+        INSERT INTO instruments (exchange, symbol, freeze_quantity) VALUES ($1, $2, $3)
+        ON CONFLICT (exchange, symbol) DO UPDATE SET freeze_quantity = EXCLUDED.freeze_quantity
+    `
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare instrument upsert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, in := range instruments {
+		if _, err = stmt.ExecContext(ctx, in.Exchange, in.Symbol, in.FreezeQuantity); err != nil {
+			return fmt.Errorf("failed to upsert instrument %s:%s: %w", in.Exchange, in.Symbol, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// List implements repository.InstrumentRepository.List
+func (r *PostgresInstrumentRepo) List(ctx context.Context, exchange string) ([]model.Instrument, error) {
+	query := `SELECT exchange, symbol, freeze_quantity, updated_at FROM instruments WHERE exchange = $1 ORDER BY symbol`
+	rows, err := r.db.QueryContext(ctx, query, exchange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query instruments of %s: %w", exchange, err)
+	}
+	defer rows.Close()
+
+	instruments := []model.Instrument{}
+	for rows.Next() {
+		var in model.Instrument
+		if err := rows.Scan(&in.Exchange, &in.Symbol, &in.FreezeQuantity, &in.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan instrument row: %w", err)
+		}
+		instruments = append(instruments, in)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating instrument rows: %w", err)
+	}
+	return instruments, nil
+}
+
+// FreezeQuantities implements repository.InstrumentRepository.FreezeQuantities
+func (r *PostgresInstrumentRepo) FreezeQuantities(ctx context.Context, exchange string, symbols []string) (map[string]int, error) {
+	query := `SELECT symbol, freeze_quantity FROM instruments WHERE exchange = $1 AND symbol = ANY($2)`
+	rows, err := r.db.QueryContext(ctx, query, exchange, symbols)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query freeze quantities: %w", err)
+	}
+	defer rows.Close()
+
+	quantities := make(map[string]int, len(symbols))
+	for rows.Next() {
+		var symbol string
+		var quantity int
+		if err := rows.Scan(&symbol, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan freeze quantity row: %w", err)
+		}
+		quantities[symbol] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating freeze quantity rows: %w", err)
+	}
+	return quantities, nil
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// PostgresJobRepo implements repository.JobRepository using the jobs table.
+type PostgresJobRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresJobRepo creates a new job repository instance.
+func NewPostgresJobRepo(db *sql.DB) repository.JobRepository {
+	return &PostgresJobRepo{db: db}
+}
+
+const jobColumns = `id, type, user_id, payload, status, attempts, max_attempts, run_at, locked_by, locked_until,
+        result, last_error, created_at, updated_at, finished_at`
+
+// Create implements repository.JobRepository.Create
+func (r *PostgresJobRepo) Create(ctx context.Context, job *model.Job) error {
+	query := `INSERT INTO jobs (` + jobColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := r.db.ExecContext(ctx, query,
+		job.ID, job.Type, job.UserID, []byte(job.Payload), job.Status, job.Attempts, job.MaxAttempts, job.RunAt,
+		job.LockedBy, job.LockedUntil, nullableJSON(job.Result), job.LastError, job.CreatedAt, job.UpdatedAt,
+		job.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert job: %w", err)
+	}
+	return nil
+}
+
+// FindByID implements repository.JobRepository.FindByID
+func (r *PostgresJobRepo) FindByID(ctx context.Context, jobID uuid.UUID, userID uuid.UUID) (*model.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1 AND user_id = $2`
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, jobID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to query job %s: %w", jobID, err)
+	}
+	return job, nil
+}
+
+// List implements repository.JobRepository.List
+func (r *PostgresJobRepo) List(ctx context.Context, status string, limit int) ([]model.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+        WHERE ($1 = '' OR status = $1)
+        ORDER BY created_at DESC
+        LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []model.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job rows: %w", err)
+	}
+	return jobs, nil
+}
+
+// Claim implements repository.JobRepository.Claim
+// SKIP LOCKED lets workers of every instance claim at the same time without waiting on
+// (or taking) each other's rows.
+func (r *PostgresJobRepo) Claim(ctx context.Context, worker string, visibility time.Duration) (*model.Job, error) {
+	query := `
+        UPDATE jobs
+        SET status = 'running', attempts = attempts + 1, locked_by = $1,
+            locked_until = NOW() + make_interval(secs => $2)
+        WHERE id = (
+            SELECT id FROM jobs
+            WHERE (status = 'queued' AND run_at <= NOW())
+               OR (status = 'running' AND locked_until < NOW())
+            ORDER BY run_at
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING ` + jobColumns
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, worker, visibility.Seconds()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // Nothing to do
+		}
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// ExtendLock implements repository.JobRepository.ExtendLock
+func (r *PostgresJobRepo) ExtendLock(ctx context.Context, jobID uuid.UUID, worker string, visibility time.Duration) error {
+	query := `
+        UPDATE jobs SET locked_until = NOW() + make_interval(secs => $1)
+        WHERE id = $2 AND status = 'running' AND locked_by = $3
+    `
+	result, err := r.db.ExecContext(ctx, query, visibility.Seconds(), jobID, worker)
+	if err != nil {
+		return fmt.Errorf("failed to extend lock of job %s: %w", jobID, err)
+	}
+	return expectRowAffected(result, repository.ErrJobLockLost)
+}
+
+// Finish implements repository.JobRepository.Finish
+// The attempt count is part of the condition: a worker that lost the job and got it
+// back (same worker name) must not finish the newer attempt.
+func (r *PostgresJobRepo) Finish(ctx context.Context, job *model.Job, worker string) error {
+	query := `
+        UPDATE jobs
+        SET status = $1, run_at = $2, result = $3, last_error = $4, finished_at = $5,
+            locked_by = NULL, locked_until = NULL
+        WHERE id = $6 AND status = 'running' AND locked_by = $7 AND attempts = $8
+    `
+	result, err := r.db.ExecContext(ctx, query,
+		job.Status, job.RunAt, nullableJSON(job.Result), job.LastError, job.FinishedAt, job.ID, worker, job.Attempts)
+	if err != nil {
+		return fmt.Errorf("failed to finish job %s: %w", job.ID, err)
+	}
+	return expectRowAffected(result, repository.ErrJobLockLost)
+}
+
+// Requeue implements repository.JobRepository.Requeue
+func (r *PostgresJobRepo) Requeue(ctx context.Context, jobID uuid.UUID) (*model.Job, error) {
+	query := `
+        UPDATE jobs
+        SET status = 'queued', attempts = 0, run_at = NOW(), result = NULL, finished_at = NULL
+        WHERE id = $1 AND status IN ('failed', 'dead')
+        RETURNING ` + jobColumns
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, jobID))
+	if err == nil {
+		return job, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to requeue job %s: %w", jobID, err)
+	}
+
+	// Tell a missing job from one that isn't failed or dead
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM jobs WHERE id = $1)`, jobID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check job %s: %w", jobID, err)
+	}
+	if !exists {
+		return nil, repository.ErrJobNotFound
+	}
+	return nil, repository.ErrJobNotRetryable
+}
+
+// nullableJSON converts an optional JSON document to a nullable JSONB parameter.
+func nullableJSON(doc []byte) any {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
+
+// scanJob scans a jobs row in jobColumns order.
+func scanJob(row rowScanner) (*model.Job, error) {
+	var job model.Job
+	var payload, result []byte
+	var lockedBy, lastError sql.NullString
+	var lockedUntil, finishedAt sql.NullTime
+	err := row.Scan(
+		&job.ID,
+		&job.Type,
+		&job.UserID,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&lockedBy,
+		&lockedUntil,
+		&result,
+		&lastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	job.Result = result
+	if lockedBy.Valid {
+		job.LockedBy = &lockedBy.String
+	}
+	if lockedUntil.Valid {
+		job.LockedUntil = &lockedUntil.Time
+	}
+	if lastError.Valid {
+		job.LastError = &lastError.String
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
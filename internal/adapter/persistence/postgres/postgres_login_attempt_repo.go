@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+)
+
+// PostgresLoginAttemptStore implements repository.LoginAttemptStore using PostgreSQL.
+// Unlike the in-memory store, counters are shared by all API instances and survive restarts.
+type PostgresLoginAttemptStore struct {
+	db *sql.DB
+}
+
+// NewPostgresLoginAttemptStore creates a new login attempt store instance.
+func NewPostgresLoginAttemptStore(db *sql.DB) repository.LoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db}
+}
+
+// Get implements repository.LoginAttemptStore.Get
+func (r *PostgresLoginAttemptStore) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	query := `
+        SELECT key, failed_count, last_failed_at, locked_until
+        FROM login_attempts
+        WHERE key = $1
+    `
+	attempt, err := scanLoginAttempt(r.db.QueryRowContext(ctx, query, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &model.LoginAttempt{Key: key}, nil // No failures recorded
+		}
+		return nil, fmt.Errorf("failed to query login attempts for %s: %w", key, err)
+	}
+	return attempt, nil
+}
+
+// RecordFailure implements repository.LoginAttemptStore.RecordFailure
+func (r *PostgresLoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	// Single UPSERT so concurrent failures for the same key are all counted
+	query := `
+        INSERT INTO login_attempts (key, failed_count, last_failed_at)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE SET
+            failed_count = CASE
+                WHEN login_attempts.last_failed_at < $3 THEN 1
+                ELSE login_attempts.failed_count + 1
+            END,
+            last_failed_at = EXCLUDED.last_failed_at
+        RETURNING key, failed_count, last_failed_at, locked_until
+    `
+	attempt, err := scanLoginAttempt(r.db.QueryRowContext(ctx, query, key, now, now.Add(-window)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure for %s: %w", key, err)
+	}
+	return attempt, nil
+}
+
+// LockUntil implements repository.LoginAttemptStore.LockUntil
+func (r *PostgresLoginAttemptStore) LockUntil(ctx context.Context, key string, until time.Time) error {
+	query := `
+        INSERT INTO login_attempts (key, failed_count, last_failed_at, locked_until)
+        VALUES ($1, 0, NOW(), $2)
+        ON CONFLICT (key) DO UPDATE SET locked_until = EXCLUDED.locked_until
+    `
+	if _, err := r.db.ExecContext(ctx, query, key, until); err != nil {
+		return fmt.Errorf("failed to lock login key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Reset implements repository.LoginAttemptStore.Reset
+func (r *PostgresLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to reset login attempts for %s: %w", key, err)
+	}
+	return nil
+}
+
+// scanLoginAttempt scans a login_attempts row (key, failed_count, last_failed_at, locked_until).
+func scanLoginAttempt(row rowScanner) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&attempt.Key, &attempt.FailedCount, &attempt.LastFailedAt, &lockedUntil); err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = lockedUntil.Time
+	}
+	return &attempt, nil
+}
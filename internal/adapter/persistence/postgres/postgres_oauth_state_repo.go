@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// PostgresOAuthStateRepo implements repository.OAuthStateRepository using the oauth_states table.
+// The state_token column holds the SHA-256 hash of the state, never the state itself.
+type PostgresOAuthStateRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresOAuthStateRepo creates a new OAuth state repository instance.
+func NewPostgresOAuthStateRepo(db *sql.DB) repository.OAuthStateRepository {
+	return &PostgresOAuthStateRepo{db: db}
+}
+
+// Create implements repository.OAuthStateRepository.Create
+func (r *PostgresOAuthStateRepo) Create(ctx context.Context, stateHash string, userID uuid.UUID, expiresAt time.Time) error {
+	query := `INSERT INTO oauth_states (state_token, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := r.db.ExecContext(ctx, query, stateHash, userID, expiresAt); err != nil {
+		return fmt.Errorf("failed to store oauth state for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// Consume implements repository.OAuthStateRepository.Consume
+func (r *PostgresOAuthStateRepo) Consume(ctx context.Context, stateHash string) (uuid.UUID, error) {
+	// A single DELETE ... RETURNING: two concurrent callbacks can't both get the row
+	query := `
+        DELETE FROM oauth_states
+        WHERE state_token = $1 AND expires_at > NOW()
+        RETURNING user_id
+    `
+	var userID uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, stateHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, repository.ErrOAuthStateNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to consume oauth state: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteExpired implements repository.OAuthStateRepository.DeleteExpired
+func (r *PostgresOAuthStateRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM oauth_states WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired oauth states: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
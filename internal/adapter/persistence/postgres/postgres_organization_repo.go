@@ -0,0 +1,331 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// invitationColumns is the column list read by scanInvitation, keep the two in sync.
+const invitationColumns = `id, organization_id, email, permission, invited_by, token_hash, expires_at, accepted_at, created_at`
+
+// PostgresOrganizationRepo implements repository.OrganizationRepository using PostgreSQL.
+type PostgresOrganizationRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresOrganizationRepo creates a new organization repository instance.
+func NewPostgresOrganizationRepo(db *sql.DB) repository.OrganizationRepository {
+	return &PostgresOrganizationRepo{db: db}
+}
+
+// Create implements repository.OrganizationRepository.Create
+func (r *PostgresOrganizationRepo) Create(ctx context.Context, org *model.Organization, ownerID uuid.UUID) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	orgQuery := `INSERT INTO organizations (id, name, created_by, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	if _, err = tx.ExecContext(ctx, orgQuery, org.ID, org.Name, org.CreatedBy, org.CreatedAt, org.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to insert organization: %w", err)
+	}
+
+	memberQuery := `INSERT INTO organization_members (organization_id, user_id, permission, joined_at) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.ExecContext(ctx, memberQuery, org.ID, ownerID, model.OrgPermissionOwner, org.CreatedAt); err != nil {
+		return fmt.Errorf("failed to add owner to organization %s: %w", org.ID, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// FindByID implements repository.OrganizationRepository.FindByID
+func (r *PostgresOrganizationRepo) FindByID(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	query := `SELECT id, name, created_by, created_at, updated_at FROM organizations WHERE id = $1`
+
+	var org model.Organization
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&org.ID, &org.Name, &org.CreatedBy, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("failed to find organization %s: %w", id, err)
+	}
+	return &org, nil
+}
+
+// FindAllByUser implements repository.OrganizationRepository.FindAllByUser
+func (r *PostgresOrganizationRepo) FindAllByUser(ctx context.Context, userID uuid.UUID) ([]model.Organization, error) {
+	query := `
+        SELECT o.id, o.name, o.created_by, m.permission, o.created_at, o.updated_at
+        FROM organizations o
+        JOIN organization_members m ON m.organization_id = o.id
+        WHERE m.user_id = $1
+        ORDER BY o.name
+    `
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query organizations for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	orgs := []model.Organization{}
+	for rows.Next() {
+		var org model.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedBy, &org.Permission, &org.CreatedAt, &org.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization row: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating organization rows: %w", err)
+	}
+	return orgs, nil
+}
+
+// Delete implements repository.OrganizationRepository.Delete
+func (r *PostgresOrganizationRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM organizations WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization %s: %w", id, err)
+	}
+	return expectRowAffected(result, repository.ErrOrganizationNotFound)
+}
+
+// GetMember implements repository.OrganizationRepository.GetMember
+func (r *PostgresOrganizationRepo) GetMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*model.OrganizationMember, error) {
+	query := `
+        SELECT m.organization_id, m.user_id, u.email, m.permission, m.joined_at
+        FROM organization_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.organization_id = $1 AND m.user_id = $2
+    `
+	var member model.OrganizationMember
+	err := r.db.QueryRowContext(ctx, query, orgID, userID).Scan(
+		&member.OrganizationID, &member.UserID, &member.Email, &member.Permission, &member.JoinedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrOrgMemberNotFound
+		}
+		return nil, fmt.Errorf("failed to find member %s of organization %s: %w", userID, orgID, err)
+	}
+	return &member, nil
+}
+
+// ListMembers implements repository.OrganizationRepository.ListMembers
+func (r *PostgresOrganizationRepo) ListMembers(ctx context.Context, orgID uuid.UUID) ([]model.OrganizationMember, error) {
+	query := `
+        SELECT m.organization_id, m.user_id, u.email, m.permission, m.joined_at
+        FROM organization_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.organization_id = $1
+        ORDER BY m.joined_at
+    `
+	rows, err := r.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query members of organization %s: %w", orgID, err)
+	}
+	defer rows.Close()
+
+	members := []model.OrganizationMember{}
+	for rows.Next() {
+		var member model.OrganizationMember
+		if err := rows.Scan(&member.OrganizationID, &member.UserID, &member.Email, &member.Permission, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan member row: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating member rows: %w", err)
+	}
+	return members, nil
+}
+
+// UpdateMemberPermission implements repository.OrganizationRepository.UpdateMemberPermission
+func (r *PostgresOrganizationRepo) UpdateMemberPermission(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, permission string) error {
+	query := `UPDATE organization_members SET permission = $3 WHERE organization_id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, orgID, userID, permission)
+	if err != nil {
+		return fmt.Errorf("failed to update member %s of organization %s: %w", userID, orgID, err)
+	}
+	return expectRowAffected(result, repository.ErrOrgMemberNotFound)
+}
+
+// RemoveMember implements repository.OrganizationRepository.RemoveMember
+func (r *PostgresOrganizationRepo) RemoveMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error {
+	query := `DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove member %s from organization %s: %w", userID, orgID, err)
+	}
+	return expectRowAffected(result, repository.ErrOrgMemberNotFound)
+}
+
+// CreateInvitation implements repository.OrganizationRepository.CreateInvitation
+func (r *PostgresOrganizationRepo) CreateInvitation(ctx context.Context, inv *model.OrganizationInvitation) error {
+	query := `
+        INSERT INTO organization_invitations (id, organization_id, email, permission, invited_by, token_hash, expires_at, created_at)
+        VALUES ($1, $2, LOWER($3), $4, $5, $6, $7, $8)
+    `
+	_, err := r.db.ExecContext(ctx, query,
+		inv.ID,
+		inv.OrganizationID,
+		inv.Email,
+		inv.Permission,
+		inv.InvitedBy,
+		inv.TokenHash,
+		inv.ExpiresAt,
+		inv.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save invitation for organization %s: %w", inv.OrganizationID, err)
+	}
+	return nil
+}
+
+// ListPendingInvitations implements repository.OrganizationRepository.ListPendingInvitations
+func (r *PostgresOrganizationRepo) ListPendingInvitations(ctx context.Context, orgID uuid.UUID) ([]model.OrganizationInvitation, error) {
+	query := `SELECT ` + invitationColumns + `
+        FROM organization_invitations
+        WHERE organization_id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+        ORDER BY created_at DESC
+    `
+	rows, err := r.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitations of organization %s: %w", orgID, err)
+	}
+	defer rows.Close()
+
+	invitations := []model.OrganizationInvitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation row: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating invitation rows: %w", err)
+	}
+	return invitations, nil
+}
+
+// FindInvitationByTokenHash implements repository.OrganizationRepository.FindInvitationByTokenHash
+func (r *PostgresOrganizationRepo) FindInvitationByTokenHash(ctx context.Context, tokenHash string) (*model.OrganizationInvitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM organization_invitations WHERE token_hash = $1`
+	inv, err := scanInvitation(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrInvitationNotFound
+		}
+		return nil, fmt.Errorf("failed to find invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// AcceptInvitation implements repository.OrganizationRepository.AcceptInvitation
+func (r *PostgresOrganizationRepo) AcceptInvitation(ctx context.Context, invitationID uuid.UUID, member *model.OrganizationMember) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	// The accepted_at condition makes concurrent accepts of the same invitation safe
+	result, err := tx.ExecContext(ctx,
+		`UPDATE organization_invitations SET accepted_at = $2 WHERE id = $1 AND accepted_at IS NULL`,
+		invitationID, member.JoinedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation %s: %w", invitationID, err)
+	}
+	if err = expectRowAffected(result, repository.ErrInvitationNotFound); err != nil {
+		return err
+	}
+
+	memberQuery := `INSERT INTO organization_members (organization_id, user_id, permission, joined_at) VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, memberQuery, member.OrganizationID, member.UserID, member.Permission, member.JoinedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolationCode {
+			return repository.ErrOrgMemberExists
+		}
+		return fmt.Errorf("failed to add member %s to organization %s: %w", member.UserID, member.OrganizationID, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteInvitation implements repository.OrganizationRepository.DeleteInvitation
+func (r *PostgresOrganizationRepo) DeleteInvitation(ctx context.Context, orgID uuid.UUID, invitationID uuid.UUID) error {
+	query := `DELETE FROM organization_invitations WHERE id = $1 AND organization_id = $2`
+	result, err := r.db.ExecContext(ctx, query, invitationID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation %s: %w", invitationID, err)
+	}
+	return expectRowAffected(result, repository.ErrInvitationNotFound)
+}
+
+// scanInvitation scans an organization_invitations row selected with invitationColumns.
+func scanInvitation(row rowScanner) (*model.OrganizationInvitation, error) {
+	var inv model.OrganizationInvitation
+	var acceptedAt sql.NullTime
+	err := row.Scan(
+		&inv.ID,
+		&inv.OrganizationID,
+		&inv.Email,
+		&inv.Permission,
+		&inv.InvitedBy,
+		&inv.TokenHash,
+		&inv.ExpiresAt,
+		&acceptedAt,
+		&inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		inv.AcceptedAt = &acceptedAt.Time
+	}
+	return &inv, nil
+}
+
+// expectRowAffected maps an UPDATE/DELETE that touched no rows to notFound.
+func expectRowAffected(result sql.Result, notFound error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return notFound
+	}
+	return nil
+}
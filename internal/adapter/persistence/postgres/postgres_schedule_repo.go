@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// PostgresScheduleRepo implements repository.ScheduleRepository using the
+// basket_schedules and schedule_runs tables.
+type PostgresScheduleRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresScheduleRepo creates a new schedule repository instance.
+func NewPostgresScheduleRepo(db *sql.DB) repository.ScheduleRepository {
+	return &PostgresScheduleRepo{db: db}
+}
+
+const scheduleColumns = `id, basket_id, user_id, frequency, day_of_month, day_of_week, time_of_day, options,
+        enabled, retry_missed, next_run_at, last_run_at, created_at, updated_at`
+
+const scheduleRunColumns = `id, schedule_id, scheduled_for, status, job_id, execution_id, error_message, attempts, created_at, updated_at`
+
+// Create implements repository.ScheduleRepository.Create
+func (r *PostgresScheduleRepo) Create(ctx context.Context, schedule *model.Schedule) error {
+	options, err := json.Marshal(schedule.Options)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule options: %w", err)
+	}
+	query := `INSERT INTO basket_schedules (` + scheduleColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	_, err = r.db.ExecContext(ctx, query,
+		schedule.ID, schedule.BasketID, schedule.UserID, schedule.Frequency, schedule.DayOfMonth, schedule.DayOfWeek,
+		schedule.TimeOfDay, options, schedule.Enabled, schedule.RetryMissed, schedule.NextRunAt, schedule.LastRunAt,
+		schedule.CreatedAt, schedule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert schedule: %w", err)
+	}
+	return nil
+}
+
+// FindByID implements repository.ScheduleRepository.FindByID
+func (r *PostgresScheduleRepo) FindByID(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) (*model.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM basket_schedules WHERE id = $1 AND user_id = $2`
+	schedule, err := scanSchedule(r.db.QueryRowContext(ctx, query, scheduleID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrScheduleNotFound
+		}
+		return nil, fmt.Errorf("failed to query schedule %s: %w", scheduleID, err)
+	}
+	return schedule, nil
+}
+
+// ListByUser implements repository.ScheduleRepository.ListByUser
+func (r *PostgresScheduleRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]model.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM basket_schedules WHERE user_id = $1 ORDER BY created_at`
+	return r.querySchedules(ctx, query, userID)
+}
+
+// Update implements repository.ScheduleRepository.Update
+func (r *PostgresScheduleRepo) Update(ctx context.Context, schedule *model.Schedule) error {
+	options, err := json.Marshal(schedule.Options)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule options: %w", err)
+	}
+	query := `
+        UPDATE basket_schedules
+        SET frequency = $1, day_of_month = $2, day_of_week = $3, time_of_day = $4, options = $5,
+            enabled = $6, retry_missed = $7, next_run_at = $8
+        WHERE id = $9 AND user_id = $10
+    `
+	result, err := r.db.ExecContext(ctx, query,
+		schedule.Frequency, schedule.DayOfMonth, schedule.DayOfWeek, schedule.TimeOfDay, options,
+		schedule.Enabled, schedule.RetryMissed, schedule.NextRunAt, schedule.ID, schedule.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule %s: %w", schedule.ID, err)
+	}
+	return expectRowAffected(result, repository.ErrScheduleNotFound)
+}
+
+// Delete implements repository.ScheduleRepository.Delete
+func (r *PostgresScheduleRepo) Delete(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM basket_schedules WHERE id = $1 AND user_id = $2`, scheduleID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule %s: %w", scheduleID, err)
+	}
+	return expectRowAffected(result, repository.ErrScheduleNotFound)
+}
+
+// ListDue implements repository.ScheduleRepository.ListDue
+func (r *PostgresScheduleRepo) ListDue(ctx context.Context, now time.Time) ([]model.Schedule, error) {
+	query := `SELECT ` + scheduleColumns + ` FROM basket_schedules WHERE enabled AND next_run_at <= $1 ORDER BY next_run_at`
+	return r.querySchedules(ctx, query, now)
+}
+
+// ClaimRun implements repository.ScheduleRepository.ClaimRun
+func (r *PostgresScheduleRepo) ClaimRun(ctx context.Context, scheduleID uuid.UUID, dueAt time.Time, nextRunAt *time.Time) (bool, error) {
+	query := `
+        UPDATE basket_schedules SET next_run_at = $1, last_run_at = NOW()
+        WHERE id = $2 AND enabled AND next_run_at = $3
+    `
+	result, err := r.db.ExecContext(ctx, query, nextRunAt, scheduleID, dueAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim run of schedule %s: %w", scheduleID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// CreateRun implements repository.ScheduleRepository.CreateRun
+func (r *PostgresScheduleRepo) CreateRun(ctx context.Context, run *model.ScheduleRun) error {
+	query := `INSERT INTO schedule_runs (` + scheduleRunColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := r.db.ExecContext(ctx, query,
+		run.ID, run.ScheduleID, run.ScheduledFor, run.Status, nullableUUID(run.JobID), nullableUUID(run.ExecutionID), run.ErrorMessage,
+		run.Attempts, run.CreatedAt, run.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert run of schedule %s: %w", run.ScheduleID, err)
+	}
+	return nil
+}
+
+// UpdateRun implements repository.ScheduleRepository.UpdateRun
+func (r *PostgresScheduleRepo) UpdateRun(ctx context.Context, run *model.ScheduleRun) error {
+	query := `UPDATE schedule_runs SET status = $1, job_id = $2, execution_id = $3, error_message = $4, attempts = $5 WHERE id = $6`
+	result, err := r.db.ExecContext(ctx, query, run.Status, nullableUUID(run.JobID), nullableUUID(run.ExecutionID), run.ErrorMessage, run.Attempts, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule run %s: %w", run.ID, err)
+	}
+	return expectRowAffected(result, repository.ErrScheduleRunNotFound)
+}
+
+// ClaimRetry implements repository.ScheduleRepository.ClaimRetry
+func (r *PostgresScheduleRepo) ClaimRetry(ctx context.Context, runID uuid.UUID) (bool, error) {
+	query := `
+        UPDATE schedule_runs SET status = 'running', attempts = attempts + 1
+        WHERE id = $1 AND status IN ('missed', 'failed')
+    `
+	result, err := r.db.ExecContext(ctx, query, runID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim retry of schedule run %s: %w", runID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// FindRun implements repository.ScheduleRepository.FindRun
+func (r *PostgresScheduleRepo) FindRun(ctx context.Context, scheduleID uuid.UUID, runID uuid.UUID) (*model.ScheduleRun, error) {
+	query := `SELECT ` + scheduleRunColumns + ` FROM schedule_runs WHERE id = $1 AND schedule_id = $2`
+	run, err := scanScheduleRun(r.db.QueryRowContext(ctx, query, runID, scheduleID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrScheduleRunNotFound
+		}
+		return nil, fmt.Errorf("failed to query schedule run %s: %w", runID, err)
+	}
+	return run, nil
+}
+
+// ListRuns implements repository.ScheduleRepository.ListRuns
+func (r *PostgresScheduleRepo) ListRuns(ctx context.Context, scheduleID uuid.UUID, status string) ([]model.ScheduleRun, error) {
+	query := `SELECT ` + scheduleRunColumns + ` FROM schedule_runs
+        WHERE schedule_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY scheduled_for DESC`
+	rows, err := r.db.QueryContext(ctx, query, scheduleID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs of schedule %s: %w", scheduleID, err)
+	}
+	defer rows.Close()
+
+	runs := []model.ScheduleRun{}
+	for rows.Next() {
+		run, err := scanScheduleRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan schedule run row: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schedule run rows: %w", err)
+	}
+	return runs, nil
+}
+
+// querySchedules runs a query selecting scheduleColumns.
+func (r *PostgresScheduleRepo) querySchedules(ctx context.Context, query string, args ...any) ([]model.Schedule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []model.Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan schedule row: %w", err)
+		}
+		schedules = append(schedules, *schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schedule rows: %w", err)
+	}
+	return schedules, nil
+}
+
+// scanSchedule scans a basket_schedules row in scheduleColumns order.
+func scanSchedule(row rowScanner) (*model.Schedule, error) {
+	var s model.Schedule
+	var dayOfMonth, dayOfWeek sql.NullInt32
+	var options []byte
+	var nextRunAt, lastRunAt sql.NullTime
+	err := row.Scan(
+		&s.ID,
+		&s.BasketID,
+		&s.UserID,
+		&s.Frequency,
+		&dayOfMonth,
+		&dayOfWeek,
+		&s.TimeOfDay,
+		&options,
+		&s.Enabled,
+		&s.RetryMissed,
+		&nextRunAt,
+		&lastRunAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if dayOfMonth.Valid {
+		day := int(dayOfMonth.Int32)
+		s.DayOfMonth = &day
+	}
+	if dayOfWeek.Valid {
+		day := int(dayOfWeek.Int32)
+		s.DayOfWeek = &day
+	}
+	if err := json.Unmarshal(options, &s.Options); err != nil {
+		return nil, fmt.Errorf("failed to decode options of schedule %s: %w", s.ID, err)
+	}
+	if nextRunAt.Valid {
+		s.NextRunAt = &nextRunAt.Time
+	}
+	if lastRunAt.Valid {
+		s.LastRunAt = &lastRunAt.Time
+	}
+	return &s, nil
+}
+
+// scanScheduleRun scans a schedule_runs row in scheduleRunColumns order.
+func scanScheduleRun(row rowScanner) (*model.ScheduleRun, error) {
+	var run model.ScheduleRun
+	var jobID, executionID uuid.NullUUID
+	var errorMessage sql.NullString
+	err := row.Scan(&run.ID, &run.ScheduleID, &run.ScheduledFor, &run.Status, &jobID, &executionID, &errorMessage,
+		&run.Attempts, &run.CreatedAt, &run.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.JobID = uuidPtr(jobID)
+	run.ExecutionID = uuidPtr(executionID)
+	if errorMessage.Valid {
+		run.ErrorMessage = &errorMessage.String
+	}
+	return &run, nil
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"strings" // For case-insensitive email comparison if needed elsewhere
+	"time"
 
 	// Use your actual module path
 	"github.com/AMANSRI99/StockSaaS/internal/app/model"
@@ -19,6 +21,10 @@ const (
 	pgUniqueViolationCode = "23505" // Postgres error code for unique constraint violation
 )
 
+// userColumns is the column list read by scanUser, keep the two in sync.
+const userColumns = `id, email, password_hash, role, disabled_at, sessions_revoked_at,
+            totp_enabled, totp_secret_encrypted, totp_last_used_step, created_at, updated_at`
+
 // PostgresUserRepo is a PostgreSQL implementation of UserRepository.
 type PostgresUserRepo struct {
 	db *sql.DB
@@ -32,13 +38,14 @@ func NewPostgresUserRepo(db *sql.DB) repository.UserRepository {
 // Save implements repository.UserRepository.Save
 func (r *PostgresUserRepo) Save(ctx context.Context, user *model.User) error {
 	query := `
-        INSERT INTO users (id, email, password_hash, created_at, updated_at)
-        VALUES ($1, LOWER($2), $3, $4, $5)
+        INSERT INTO users (id, email, password_hash, role, created_at, updated_at)
+        VALUES ($1, LOWER($2), $3, $4, $5, $6)
     `
 	_, err := r.db.ExecContext(ctx, query,
 		user.ID,
 		user.Email, // Store lowercase email for consistency with index/lookup
 		user.PasswordHash,
+		user.Role,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -64,20 +71,13 @@ func (r *PostgresUserRepo) Save(ctx context.Context, user *model.User) error {
 // FindByEmail implements repository.UserRepository.FindByEmail
 func (r *PostgresUserRepo) FindByEmail(ctx context.Context, email string) (*model.User, error) {
 	query := `
-        SELECT id, email, password_hash, created_at, updated_at
+        SELECT ` + userColumns + `
         FROM users
         WHERE LOWER(email) = LOWER($1)
     `
 	row := r.db.QueryRowContext(ctx, query, email)
 
-	var user model.User
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(row)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -87,34 +87,367 @@ func (r *PostgresUserRepo) FindByEmail(ctx context.Context, email string) (*mode
 		return nil, fmt.Errorf("failed to find user by email %s: %w", email, err)
 	}
 
-	return &user, nil // Success
+	return user, nil // Success
 }
 
 // FindByID implements repository.UserRepository.FindByID
 func (r *PostgresUserRepo) FindByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	query := `
-        SELECT id, email, password_hash, created_at, updated_at
+        SELECT ` + userColumns + `
         FROM users
         WHERE id = $1
     `
 	row := r.db.QueryRowContext(ctx, query, id)
 
+	user, err := scanUser(row)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrUserNotFound // Use the custom error
+		}
+		// Wrap other scan/query errors
+		return nil, fmt.Errorf("failed to find user by ID %s: %w", id, err)
+	}
+
+	return user, nil // Success
+}
+
+// SetTOTPSecret implements repository.UserRepository.SetTOTPSecret
+func (r *PostgresUserRepo) SetTOTPSecret(ctx context.Context, userID uuid.UUID, encryptedSecret []byte) error {
+	query := `
+        UPDATE users
+        SET totp_secret_encrypted = $2, totp_enabled = FALSE, totp_confirmed_at = NULL
+        WHERE id = $1
+    `
+	result, err := r.db.ExecContext(ctx, query, userID, encryptedSecret)
+	if err != nil {
+		return fmt.Errorf("failed to store totp secret for user %s: %w", userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected for user %s: %w", userID, err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrUserNotFound
+	}
+	return nil
+}
+
+// EnableTOTP implements repository.UserRepository.EnableTOTP
+func (r *PostgresUserRepo) EnableTOTP(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	query := `
+        UPDATE users
+        SET totp_enabled = TRUE, totp_confirmed_at = NOW()
+        WHERE id = $1 AND totp_secret_encrypted IS NOT NULL
+    `
+	result, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp for user %s: %w", userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected for user %s: %w", userID, err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrUserNotFound
+	}
+
+	if err = replaceRecoveryCodesTx(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP implements repository.UserRepository.DisableTOTP
+func (r *PostgresUserRepo) DisableTOTP(ctx context.Context, userID uuid.UUID) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	query := `
+        UPDATE users
+        SET totp_secret_encrypted = NULL, totp_enabled = FALSE, totp_confirmed_at = NULL
+        WHERE id = $1
+    `
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to disable totp for user %s: %w", userID, err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes for user %s: %w", userID, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes implements repository.UserRepository.ReplaceRecoveryCodes
+func (r *PostgresUserRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Error rolling back transaction: %v", rbErr)
+			}
+		}
+	}()
+
+	if err = replaceRecoveryCodesTx(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodesTx deletes old recovery codes and inserts the new hashes inside tx.
+func replaceRecoveryCodesTx(ctx context.Context, tx *sql.Tx, userID uuid.UUID, recoveryCodeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete old recovery codes for user %s: %w", userID, err)
+	}
+	insertQuery := `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, insertQuery, userID, hash); err != nil {
+			return fmt.Errorf("failed to insert recovery code for user %s: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode implements repository.UserRepository.ConsumeRecoveryCode
+func (r *PostgresUserRepo) ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	// Single UPDATE so two concurrent logins can't both use the same code
+	query := `
+        UPDATE user_recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+    `
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code for user %s: %w", userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected for user %s: %w", userID, err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// ListTOTPSecrets implements repository.UserRepository.ListTOTPSecrets
+func (r *PostgresUserRepo) ListTOTPSecrets(ctx context.Context, afterID uuid.UUID, limit int) ([]repository.EncryptedTOTPSecret, error) {
+	query := `
+        SELECT id, totp_secret_encrypted
+        FROM users
+        WHERE id > $1 AND totp_secret_encrypted IS NOT NULL
+        ORDER BY id
+        LIMIT $2
+    `
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query totp secrets after %s: %w", afterID, err)
+	}
+	defer rows.Close()
+
+	secrets := []repository.EncryptedTOTPSecret{}
+	for rows.Next() {
+		var secret repository.EncryptedTOTPSecret
+		if err := rows.Scan(&secret.UserID, &secret.Ciphertext); err != nil {
+			return nil, fmt.Errorf("failed to scan totp secret row: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating totp secret rows: %w", err)
+	}
+	return secrets, nil
+}
+
+// ReplaceTOTPSecret implements repository.UserRepository.ReplaceTOTPSecret
+func (r *PostgresUserRepo) ReplaceTOTPSecret(ctx context.Context, userID uuid.UUID, oldCiphertext, newCiphertext []byte) (bool, error) {
+	query := `
+        UPDATE users
+        SET totp_secret_encrypted = $3
+        WHERE id = $1 AND totp_secret_encrypted = $2
+    `
+	result, err := r.db.ExecContext(ctx, query, userID, oldCiphertext, newCiphertext)
+	if err != nil {
+		return false, fmt.Errorf("failed to replace totp secret for user %s: %w", userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected for user %s: %w", userID, err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// ConsumeTOTPStep implements repository.UserRepository.ConsumeTOTPStep
+func (r *PostgresUserRepo) ConsumeTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `
+        UPDATE users
+        SET totp_last_used_step = $2
+        WHERE id = $1 AND totp_last_used_step < $2
+    `
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record totp step for user %s: %w", userID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected for user %s: %w", userID, err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrTOTPStepAlreadyConsumed
+	}
+	return nil
+}
+
+// Search implements repository.UserRepository.Search
+func (r *PostgresUserRepo) Search(ctx context.Context, filter repository.UserSearchFilter) ([]model.User, int, error) {
+	// Build the WHERE clause from the optional filters
+	conditions := []string{"TRUE"}
+	args := []any{}
+	if filter.Query != "" {
+		args = append(args, "%"+strings.ToLower(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf("(LOWER(email) LIKE $%d OR id::text = $%d)", len(args), len(args)+1))
+		args = append(args, filter.Query)
+	}
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			conditions = append(conditions, "disabled_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "disabled_at IS NULL")
+		}
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM users WHERE ` + where
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM users
+        WHERE %s
+        ORDER BY created_at DESC
+        LIMIT $%d OFFSET $%d
+    `, userColumns, where, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, *user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating user rows: %w", err)
+	}
+	return users, total, nil
+}
+
+// SetRole implements repository.UserRepository.SetRole
+func (r *PostgresUserRepo) SetRole(ctx context.Context, id uuid.UUID, role string) error {
+	return r.execUserUpdate(ctx, id, `UPDATE users SET role = $2 WHERE id = $1`, role)
+}
+
+// SetDisabled implements repository.UserRepository.SetDisabled
+func (r *PostgresUserRepo) SetDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	return r.execUserUpdate(ctx, id, `UPDATE users SET disabled_at = $2 WHERE id = $1`, disabledAt)
+}
+
+// RevokeSessions implements repository.UserRepository.RevokeSessions
+func (r *PostgresUserRepo) RevokeSessions(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	return r.execUserUpdate(ctx, id, `UPDATE users SET sessions_revoked_at = $2 WHERE id = $1`, revokedAt)
+}
+
+// execUserUpdate runs a single-row UPDATE keyed by user ID ($1) and maps 0 rows to ErrUserNotFound.
+func (r *PostgresUserRepo) execUserUpdate(ctx context.Context, id uuid.UUID, query string, value any) error {
+	result, err := r.db.ExecContext(ctx, query, id, value)
+	if err != nil {
+		return fmt.Errorf("failed to update user %s: %w", id, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected for user %s: %w", id, err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrUserNotFound
+	}
+	return nil
+}
+
+// scanUser scans a users row selected with userColumns.
+func scanUser(row rowScanner) (*model.User, error) {
 	var user model.User
+	var disabledAt, sessionsRevokedAt sql.NullTime
 	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
+		&disabledAt,
+		&sessionsRevokedAt,
+		&user.TOTPEnabled,
+		&user.TOTPSecretEncrypted,
+		&user.TOTPLastUsedStep,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
-
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, repository.ErrUserNotFound // Use the custom error
-		}
-		// Wrap other scan/query errors
-		return nil, fmt.Errorf("failed to find user by ID %s: %w", id, err)
+		return nil, err
 	}
-
-	return &user, nil // Success
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	if sessionsRevokedAt.Valid {
+		user.SessionsRevokedAt = &sessionsRevokedAt.Time
+	}
+	return &user, nil
 }
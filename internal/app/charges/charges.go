@@ -0,0 +1,165 @@
+// Package charges computes the statutory and broker charges of Indian equity trades:
+// brokerage, STT, exchange transaction charges, SEBI fees, GST and stamp duty.
+// Rates are versioned by effective date (see rates.json), so past trades are
+// costed with the rates in force on their trade date.
+package charges
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+)
+
+// Segments.
+const (
+	SegmentEquityDelivery = "equity_delivery"
+	SegmentEquityIntraday = "equity_intraday"
+	SegmentEquityFutures  = "equity_futures"
+	SegmentEquityOptions  = "equity_options"
+)
+
+// Segments lists every supported segment.
+var Segments = []string{SegmentEquityDelivery, SegmentEquityIntraday, SegmentEquityFutures, SegmentEquityOptions}
+
+// Errors returned by Calculate.
+var (
+	ErrInvalidTrade   = errors.New("invalid trade")
+	ErrNoRatesForDate = errors.New("no charges rates for trade date")
+)
+
+// istZone is Indian Standard Time: rate changes take effect on IST dates.
+var istZone = time.FixedZone("IST", 5*60*60+30*60)
+
+// Trade is one order (or fill) to compute charges for.
+type Trade struct {
+	Segment         string    `json:"segment"`
+	Exchange        string    `json:"exchange"`        // NSE or BSE
+	TransactionType string    `json:"transactionType"` // BUY or SELL
+	Quantity        int       `json:"quantity"`
+	Price           float64   `json:"price"`     // Per unit; the premium for options
+	TradeDate       time.Time `json:"tradeDate"` // Zero means today
+}
+
+// Result is the charges of a trade and the rates version they were computed with.
+type Result struct {
+	Charges     model.OrderCharges `json:"charges"`
+	Turnover    float64            `json:"turnover"`
+	RateVersion string             `json:"rateVersion"`
+}
+
+// Calculator computes charges from a versioned rates file.
+type Calculator struct {
+	rates *RateFile
+}
+
+// NewCalculator creates a calculator with rates from path, or the embedded rates if path is empty.
+func NewCalculator(path string) (*Calculator, error) {
+	rates, err := LoadRates(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Calculator{rates: rates}, nil
+}
+
+// SegmentForProduct maps an equity order's product to its segment (CNC is delivery, MIS intraday).
+func SegmentForProduct(product string) (string, error) {
+	switch product {
+	case model.ProductCNC:
+		return SegmentEquityDelivery, nil
+	case model.ProductMIS:
+		return SegmentEquityIntraday, nil
+	default:
+		return "", fmt.Errorf("%w: no charges segment for product '%s'", ErrInvalidTrade, product)
+	}
+}
+
+// Calculate returns the charges of a single trade.
+//
+// Every component is rounded to the paisa, except STT which is rounded to the rupee
+// as on contract notes. GST applies to brokerage, exchange and SEBI charges.
+func (c *Calculator) Calculate(trade Trade) (Result, error) {
+	// 1. Validate and pick the rates in force on the trade date
+	if trade.Quantity <= 0 || trade.Price <= 0 {
+		return Result{}, fmt.Errorf("%w: quantity and price must be positive", ErrInvalidTrade)
+	}
+	isBuy := trade.TransactionType == model.TransactionBuy
+	if !isBuy && trade.TransactionType != model.TransactionSell {
+		return Result{}, fmt.Errorf("%w: transaction type must be %s or %s", ErrInvalidTrade, model.TransactionBuy, model.TransactionSell)
+	}
+	tradeDate := trade.TradeDate
+	if tradeDate.IsZero() {
+		tradeDate = time.Now()
+	}
+	version := c.rates.versionAt(tradeDate.In(istZone))
+	if version == nil {
+		return Result{}, fmt.Errorf("%w: %s", ErrNoRatesForDate, tradeDate.In(istZone).Format("2006-01-02"))
+	}
+	rates, ok := version.Segments[trade.Segment]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: unknown segment '%s'", ErrInvalidTrade, trade.Segment)
+	}
+	exchangePercent, ok := rates.ExchangePercent[trade.Exchange]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: no %s rates for exchange '%s'", ErrInvalidTrade, trade.Segment, trade.Exchange)
+	}
+
+	// 2. Each component
+	turnover := float64(trade.Quantity) * trade.Price
+	var charges model.OrderCharges
+
+	switch {
+	case rates.Brokerage.Flat > 0:
+		charges.Brokerage = rates.Brokerage.Flat
+	default:
+		charges.Brokerage = turnover * rates.Brokerage.Percent / 100
+		if rates.Brokerage.Max > 0 {
+			charges.Brokerage = math.Min(charges.Brokerage, rates.Brokerage.Max)
+		}
+	}
+	charges.Brokerage = roundPaise(charges.Brokerage)
+
+	sttPercent := rates.STTSellPercent
+	if isBuy {
+		sttPercent = rates.STTBuyPercent
+	}
+	charges.STT = math.Round(turnover * sttPercent / 100)
+
+	charges.ExchangeTransaction = roundPaise(turnover * exchangePercent / 100)
+	charges.SEBIFees = roundPaise(turnover * version.SEBIPerCrore / 1e7)
+	if isBuy {
+		charges.StampDuty = roundPaise(turnover * rates.StampBuyPercent / 100)
+	}
+	charges.GST = roundPaise((charges.Brokerage + charges.ExchangeTransaction + charges.SEBIFees) * version.GSTPercent / 100)
+
+	// 3. Total
+	charges.Total = roundPaise(charges.Brokerage + charges.STT + charges.ExchangeTransaction +
+		charges.SEBIFees + charges.GST + charges.StampDuty)
+
+	return Result{Charges: charges, Turnover: roundPaise(turnover), RateVersion: version.Version}, nil
+}
+
+// Add returns the combined charges of two trades, e.g. the child orders of a sliced order.
+// The rates version is other's.
+func (r Result) Add(other Result) Result {
+	return Result{
+		Charges: model.OrderCharges{
+			Brokerage:           roundPaise(r.Charges.Brokerage + other.Charges.Brokerage),
+			STT:                 roundPaise(r.Charges.STT + other.Charges.STT),
+			ExchangeTransaction: roundPaise(r.Charges.ExchangeTransaction + other.Charges.ExchangeTransaction),
+			SEBIFees:            roundPaise(r.Charges.SEBIFees + other.Charges.SEBIFees),
+			GST:                 roundPaise(r.Charges.GST + other.Charges.GST),
+			StampDuty:           roundPaise(r.Charges.StampDuty + other.Charges.StampDuty),
+			Total:               roundPaise(r.Charges.Total + other.Charges.Total),
+		},
+		Turnover:    roundPaise(r.Turnover + other.Turnover),
+		RateVersion: other.RateVersion,
+	}
+}
+
+// roundPaise rounds an INR amount to two decimals.
+func roundPaise(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,243 @@
+package charges
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+)
+
+// Trade dates either side of the 2024-10-01 rates change (exchange true-to-label charges,
+// Finance Act 2024 STT on derivatives).
+var (
+	beforeOct2024 = time.Date(2024, 9, 30, 10, 0, 0, 0, istZone)
+	afterOct2024  = time.Date(2024, 11, 15, 10, 0, 0, 0, istZone)
+)
+
+// TestCalculate works through contract-note examples with the published rates of rates.json.
+// Each component is worked out by hand in the comments.
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name        string
+		trade       Trade
+		want        model.OrderCharges
+		wantVersion string
+	}{
+		{
+			// Turnover 1,00,000: STT 0.1% = 100; NSE 0.00297% = 2.97; SEBI ₹10/crore = 0.10;
+			// stamp 0.015% = 15; GST 18% of (0 + 2.97 + 0.10) = 0.5526
+			name:        "delivery NSE buy",
+			trade:       Trade{Segment: SegmentEquityDelivery, Exchange: "NSE", TransactionType: model.TransactionBuy, Quantity: 100, Price: 1000, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 0, STT: 100, ExchangeTransaction: 2.97, SEBIFees: 0.10, GST: 0.55, StampDuty: 15, Total: 118.62},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Old NSE rate 0.00322% = 3.22; no stamp duty on the sell side;
+			// GST 18% of (3.22 + 0.10) = 0.5976
+			name:        "delivery NSE sell before the rates change",
+			trade:       Trade{Segment: SegmentEquityDelivery, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 100, Price: 1000, TradeDate: beforeOct2024},
+			want:        model.OrderCharges{Brokerage: 0, STT: 100, ExchangeTransaction: 3.22, SEBIFees: 0.10, GST: 0.60, StampDuty: 0, Total: 103.92},
+			wantVersion: "2023-04-01",
+		},
+		{
+			// BSE 0.00375% = 3.75; GST 18% of (3.75 + 0.10) = 0.693
+			name:        "delivery BSE buy",
+			trade:       Trade{Segment: SegmentEquityDelivery, Exchange: "BSE", TransactionType: model.TransactionBuy, Quantity: 100, Price: 1000, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 0, STT: 100, ExchangeTransaction: 3.75, SEBIFees: 0.10, GST: 0.69, StampDuty: 15, Total: 119.54},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Turnover 5,00,000: brokerage 0.03% = 150, capped at 20; no STT on intraday buys;
+			// NSE 14.85; SEBI 0.50; stamp 0.003% = 15; GST 18% of (20 + 14.85 + 0.50) = 6.363
+			name:        "intraday NSE buy hits the brokerage cap",
+			trade:       Trade{Segment: SegmentEquityIntraday, Exchange: "NSE", TransactionType: model.TransactionBuy, Quantity: 1000, Price: 500, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 0, ExchangeTransaction: 14.85, SEBIFees: 0.50, GST: 6.36, StampDuty: 15, Total: 56.71},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Turnover 2,500: brokerage 0.03% = 0.75, under the cap; STT 0.025% = 0.625,
+			// rounded up to ₹1; BSE 0.09375; SEBI 0.0025; GST 18% of (0.75 + 0.09 + 0) = 0.1512
+			name:        "intraday BSE sell under the brokerage cap, STT rounded up",
+			trade:       Trade{Segment: SegmentEquityIntraday, Exchange: "BSE", TransactionType: model.TransactionSell, Quantity: 10, Price: 250, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 0.75, STT: 1, ExchangeTransaction: 0.09, SEBIFees: 0, GST: 0.15, StampDuty: 0, Total: 1.99},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Turnover 1,600: STT 0.025% = 0.40, rounded down to ₹0; brokerage 0.48;
+			// NSE 0.04752; GST 18% of (0.48 + 0.05 + 0) = 0.0954
+			name:        "intraday NSE sell, STT rounded down",
+			trade:       Trade{Segment: SegmentEquityIntraday, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 1000, Price: 1.6, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 0.48, STT: 0, ExchangeTransaction: 0.05, SEBIFees: 0, GST: 0.10, StampDuty: 0, Total: 0.63},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Turnover 10,00,000: brokerage capped at 20; STT 0.02% = 200; NSE 0.00173% = 17.30;
+			// SEBI 1; GST 18% of (20 + 17.30 + 1) = 6.894
+			name:        "futures NSE sell",
+			trade:       Trade{Segment: SegmentEquityFutures, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 50, Price: 20000, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 200, ExchangeTransaction: 17.30, SEBIFees: 1, GST: 6.89, StampDuty: 0, Total: 245.19},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Old rates: STT 0.0125% = 125; NSE 0.0019% = 19; GST 18% of (20 + 19 + 1) = 7.20
+			name:        "futures NSE sell before the rates change",
+			trade:       Trade{Segment: SegmentEquityFutures, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 50, Price: 20000, TradeDate: beforeOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 125, ExchangeTransaction: 19, SEBIFees: 1, GST: 7.20, StampDuty: 0, Total: 172.20},
+			wantVersion: "2023-04-01",
+		},
+		{
+			// No STT on futures buys; stamp 0.002% = 20
+			name:        "futures NSE buy",
+			trade:       Trade{Segment: SegmentEquityFutures, Exchange: "NSE", TransactionType: model.TransactionBuy, Quantity: 50, Price: 20000, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 0, ExchangeTransaction: 17.30, SEBIFees: 1, GST: 6.89, StampDuty: 20, Total: 65.19},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Premium turnover 20,000: flat brokerage 20; STT 0.1% = 20; NSE 0.03503% = 7.006;
+			// SEBI 0.02; GST 18% of (20 + 7.01 + 0.02) = 4.8654
+			name:        "options NSE sell",
+			trade:       Trade{Segment: SegmentEquityOptions, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 100, Price: 200, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 20, ExchangeTransaction: 7.01, SEBIFees: 0.02, GST: 4.87, StampDuty: 0, Total: 51.90},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// Old rates: STT 0.0625% = 12.50, rounded half up to ₹13; NSE 0.053% = 10.60;
+			// GST 18% of (20 + 10.60 + 0.02) = 5.5116
+			name:        "options NSE sell before the rates change",
+			trade:       Trade{Segment: SegmentEquityOptions, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 100, Price: 200, TradeDate: beforeOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 13, ExchangeTransaction: 10.60, SEBIFees: 0.02, GST: 5.51, StampDuty: 0, Total: 49.13},
+			wantVersion: "2023-04-01",
+		},
+		{
+			// BSE 0.0325% = 6.50; stamp 0.003% = 0.60; GST 18% of (20 + 6.50 + 0.02) = 4.7736
+			name:        "options BSE buy",
+			trade:       Trade{Segment: SegmentEquityOptions, Exchange: "BSE", TransactionType: model.TransactionBuy, Quantity: 100, Price: 200, TradeDate: afterOct2024},
+			want:        model.OrderCharges{Brokerage: 20, STT: 0, ExchangeTransaction: 6.50, SEBIFees: 0.02, GST: 4.77, StampDuty: 0.60, Total: 31.89},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// 20:00 UTC on 30 September is already 1 October in India: the new rates apply
+			name:        "rates change on the IST date",
+			trade:       Trade{Segment: SegmentEquityDelivery, Exchange: "NSE", TransactionType: model.TransactionBuy, Quantity: 100, Price: 1000, TradeDate: time.Date(2024, 9, 30, 20, 0, 0, 0, time.UTC)},
+			want:        model.OrderCharges{Brokerage: 0, STT: 100, ExchangeTransaction: 2.97, SEBIFees: 0.10, GST: 0.55, StampDuty: 15, Total: 118.62},
+			wantVersion: "2024-10-01",
+		},
+		{
+			// The last minute of 30 September IST still uses the old rates
+			name:        "last minute before the rates change",
+			trade:       Trade{Segment: SegmentEquityDelivery, Exchange: "NSE", TransactionType: model.TransactionSell, Quantity: 100, Price: 1000, TradeDate: time.Date(2024, 9, 30, 23, 59, 0, 0, istZone)},
+			want:        model.OrderCharges{Brokerage: 0, STT: 100, ExchangeTransaction: 3.22, SEBIFees: 0.10, GST: 0.60, StampDuty: 0, Total: 103.92},
+			wantVersion: "2023-04-01",
+		},
+	}
+
+	calc, err := NewCalculator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := calc.Calculate(tt.trade)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RateVersion != tt.wantVersion {
+				t.Errorf("RateVersion = %s, want %s", got.RateVersion, tt.wantVersion)
+			}
+			wantTurnover := float64(tt.trade.Quantity) * tt.trade.Price
+			for _, c := range []struct {
+				component string
+				got, want float64
+			}{
+				{"turnover", got.Turnover, wantTurnover},
+				{"brokerage", got.Charges.Brokerage, tt.want.Brokerage},
+				{"STT", got.Charges.STT, tt.want.STT},
+				{"exchange transaction", got.Charges.ExchangeTransaction, tt.want.ExchangeTransaction},
+				{"SEBI fees", got.Charges.SEBIFees, tt.want.SEBIFees},
+				{"GST", got.Charges.GST, tt.want.GST},
+				{"stamp duty", got.Charges.StampDuty, tt.want.StampDuty},
+				{"total", got.Charges.Total, tt.want.Total},
+			} {
+				if !samePaise(c.got, c.want) {
+					t.Errorf("%s = %.4f, want %.2f", c.component, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateRejectsInvalidTrades(t *testing.T) {
+	calc, err := NewCalculator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := Trade{Segment: SegmentEquityDelivery, Exchange: "NSE", TransactionType: model.TransactionBuy, Quantity: 1, Price: 100, TradeDate: afterOct2024}
+
+	tests := []struct {
+		name    string
+		modify  func(*Trade)
+		wantErr error
+	}{
+		{"zero quantity", func(tr *Trade) { tr.Quantity = 0 }, ErrInvalidTrade},
+		{"negative price", func(tr *Trade) { tr.Price = -1 }, ErrInvalidTrade},
+		{"unknown transaction type", func(tr *Trade) { tr.TransactionType = "HOLD" }, ErrInvalidTrade},
+		{"unknown segment", func(tr *Trade) { tr.Segment = "commodity" }, ErrInvalidTrade},
+		{"unknown exchange", func(tr *Trade) { tr.Exchange = "MCX" }, ErrInvalidTrade},
+		{"before the first rates", func(tr *Trade) { tr.TradeDate = time.Date(2023, 3, 31, 12, 0, 0, 0, istZone) }, ErrNoRatesForDate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trade := valid
+			tt.modify(&trade)
+			if _, err := calc.Calculate(trade); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Calculate error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// samePaise reports whether two INR amounts agree to the paisa.
+func samePaise(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+func TestResultAddSlices(t *testing.T) {
+	calc, err := NewCalculator("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3,600 shares above a 1,800 freeze quantity go out as two intraday orders of 1,800:
+	// each pays the ₹20 brokerage cap, so the sliced order pays ₹40, not ₹20.
+	slice := Trade{Segment: SegmentEquityIntraday, Exchange: "NSE", TransactionType: model.TransactionBuy, Quantity: 1800, Price: 500, TradeDate: afterOct2024}
+	whole := slice
+	whole.Quantity = 3600
+
+	one, err := calc.Calculate(slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsliced, err := calc.Calculate(whole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sliced Result
+	sliced = sliced.Add(one).Add(one)
+
+	if !samePaise(sliced.Charges.Brokerage, 40) {
+		t.Errorf("brokerage of two slices = %.2f, want 40", sliced.Charges.Brokerage)
+	}
+	if !samePaise(unsliced.Charges.Brokerage, 20) {
+		t.Errorf("brokerage of one order = %.2f, want 20", unsliced.Charges.Brokerage)
+	}
+	if !samePaise(sliced.Turnover, unsliced.Turnover) {
+		t.Errorf("turnover = %.2f, want %.2f", sliced.Turnover, unsliced.Turnover)
+	}
+	if !samePaise(sliced.Charges.Total, 2*one.Charges.Total) {
+		t.Errorf("total = %.2f, want %.2f", sliced.Charges.Total, 2*one.Charges.Total)
+	}
+	if sliced.RateVersion != "2024-10-01" {
+		t.Errorf("RateVersion = %s", sliced.RateVersion)
+	}
+}
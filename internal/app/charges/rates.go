@@ -0,0 +1,109 @@
+package charges
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// defaultRates is the rate history shipped with the binary.
+//
+//go:embed rates.json
+var defaultRates []byte
+
+// RateFile is the versioned rates configuration: one entry per change in any rate.
+// A version applies to trades from its EffectiveFrom date (IST) until the next one.
+type RateFile struct {
+	Versions []RateVersion `json:"versions"`
+}
+
+// RateVersion holds every rate in force from EffectiveFrom.
+type RateVersion struct {
+	Version       string                  `json:"version"`
+	EffectiveFrom string                  `json:"effectiveFrom"` // YYYY-MM-DD
+	Note          string                  `json:"note"`          // What changed, for humans
+	GSTPercent    float64                 `json:"gstPercent"`    // On brokerage, exchange and SEBI charges
+	SEBIPerCrore  float64                 `json:"sebiPerCrore"`  // SEBI turnover fee in INR per crore of turnover
+	Segments      map[string]SegmentRates `json:"segments"`      // Keyed by Segment
+
+	effectiveFrom time.Time
+}
+
+// SegmentRates are the rates of one segment. Percentages are of turnover.
+type SegmentRates struct {
+	Brokerage       BrokerageRate      `json:"brokerage"`
+	STTBuyPercent   float64            `json:"sttBuyPercent"`
+	STTSellPercent  float64            `json:"sttSellPercent"`
+	ExchangePercent map[string]float64 `json:"exchangePercent"` // Transaction charges per exchange
+	StampBuyPercent float64            `json:"stampBuyPercent"` // Stamp duty is only charged to the buyer
+}
+
+// BrokerageRate is a flat fee per order, or a percentage of turnover capped at Max (0 = no cap).
+type BrokerageRate struct {
+	Percent float64 `json:"percent"`
+	Max     float64 `json:"max"`
+	Flat    float64 `json:"flat"`
+}
+
+// LoadRates reads a rates file, or the embedded rates if path is empty.
+func LoadRates(path string) (*RateFile, error) {
+	data := defaultRates
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read charges rates file: %w", err)
+		}
+	}
+	var rates RateFile
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse charges rates: %w", err)
+	}
+	if err := rates.validate(); err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+// validate checks every version is complete and sorts them by effective date.
+func (f *RateFile) validate() error {
+	if len(f.Versions) == 0 {
+		return fmt.Errorf("charges rates: no versions")
+	}
+	for i := range f.Versions {
+		v := &f.Versions[i]
+		from, err := time.ParseInLocation("2006-01-02", v.EffectiveFrom, istZone)
+		if err != nil {
+			return fmt.Errorf("charges rates version '%s': invalid effectiveFrom: %w", v.Version, err)
+		}
+		v.effectiveFrom = from
+		for _, segment := range Segments {
+			rates, ok := v.Segments[segment]
+			if !ok {
+				return fmt.Errorf("charges rates version '%s': missing segment '%s'", v.Version, segment)
+			}
+			if rates.Brokerage.Percent < 0 || rates.Brokerage.Max < 0 || rates.Brokerage.Flat < 0 ||
+				rates.STTBuyPercent < 0 || rates.STTSellPercent < 0 || rates.StampBuyPercent < 0 {
+				return fmt.Errorf("charges rates version '%s': negative rate in segment '%s'", v.Version, segment)
+			}
+		}
+	}
+	sort.Slice(f.Versions, func(i, j int) bool {
+		return f.Versions[i].effectiveFrom.Before(f.Versions[j].effectiveFrom)
+	})
+	return nil
+}
+
+// versionAt returns the version in force on the given date, or nil if it predates all of them.
+func (f *RateFile) versionAt(date time.Time) *RateVersion {
+	var found *RateVersion
+	for i := range f.Versions {
+		if date.Before(f.Versions[i].effectiveFrom) {
+			break
+		}
+		found = &f.Versions[i]
+	}
+	return found
+}
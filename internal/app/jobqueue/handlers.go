@@ -0,0 +1,71 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+)
+
+// BasketHandlers returns the handlers of basket execute and exit jobs. The execution ID
+// comes with the job, so a job run again continues the execution of the earlier attempt
+// instead of placing its orders twice (see ExecutionService.ExecuteWithID).
+func BasketHandlers(executionService service.ExecutionService) map[string]Handler {
+	return map[string]Handler{
+		model.JobTypeBasketExecute: func(ctx context.Context, job *model.Job) (any, error) {
+			return runBasketJob(job, func(p model.BasketJobPayload) (*model.Execution, error) {
+				return executionService.ExecuteWithID(ctx, p.ExecutionID, p.BasketID, job.UserID, p.Options)
+			})
+		},
+		model.JobTypeBasketExit: func(ctx context.Context, job *model.Job) (any, error) {
+			return runBasketJob(job, func(p model.BasketJobPayload) (*model.Execution, error) {
+				if p.Exit == nil {
+					return nil, Permanent(errors.New("exit job without exit options"))
+				}
+				return executionService.ExitWithID(ctx, p.ExecutionID, p.BasketID, job.UserID, *p.Exit)
+			})
+		},
+	}
+}
+
+// runBasketJob decodes a basket job's payload and runs it.
+func runBasketJob(job *model.Job, run func(model.BasketJobPayload) (*model.Execution, error)) (any, error) {
+	var payload model.BasketJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	execution, err := run(payload)
+	if err != nil {
+		if executionRefused(err) {
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+	return model.BasketJobResult{ExecutionID: execution.ID, Status: execution.Status}, nil
+}
+
+// executionRefused reports whether an execution error is one a retry can't fix: the basket
+// is gone or off limits, the options are wrong, funds are short, the market is closed or
+// the broker session expired. Anything else (database, broker outage) is retried.
+func executionRefused(err error) bool {
+	var marginErr *service.InsufficientMarginError
+	var closedErr *service.MarketClosedError
+	switch {
+	case errors.As(err, &marginErr), errors.As(err, &closedErr):
+		return true
+	case errors.Is(err, service.ErrBrokerReauthRequired),
+		errors.Is(err, repository.ErrBasketNotFound),
+		errors.Is(err, repository.ErrOrganizationNotFound),
+		errors.Is(err, service.ErrOrgPermissionDenied),
+		errors.Is(err, service.ErrEmptyBasket),
+		errors.Is(err, service.ErrInvalidExecutionOptions),
+		errors.Is(err, service.ErrNothingToExit):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,213 @@
+// Package jobqueue runs background jobs stored in Postgres with a pool of workers inside
+// the API process. Jobs survive restarts: a job whose worker died is picked up again once
+// its visibility timeout runs out, on this instance or another.
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+)
+
+// Handler runs a job and returns its result, stored as JSON. Jobs may run more than once
+// (a retry, or a worker that died mid-job), so handlers must be idempotent.
+// Errors wrapped with Permanent fail the job at once; others are retried.
+type Handler func(ctx context.Context, job *model.Job) (any, error)
+
+// permanentError is an error retrying the job can't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error as final: the job fails without being retried.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Queue hands stored jobs to their handlers.
+type Queue struct {
+	repo     repository.JobRepository
+	handlers map[string]Handler
+	cfg      config.JobQueueConfig
+	name     string // Identifies this process in worker names
+	workers  sync.WaitGroup
+}
+
+// New creates a queue running jobs with the handler registered for their type.
+func New(repo repository.JobRepository, cfg config.JobQueueConfig, handlers map[string]Handler) *Queue {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &Queue{
+		repo:     repo,
+		handlers: handlers,
+		cfg:      cfg,
+		name:     fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Start launches the workers. It returns immediately; cancel ctx to stop them and Wait for
+// them to exit. A job running at that point finishes first, since stopping halfway through
+// placing orders would leave them unaccounted for.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 1; i <= q.cfg.Workers; i++ {
+		q.workers.Add(1)
+		go func(worker string) {
+			defer q.workers.Done()
+			q.work(ctx, worker)
+		}(fmt.Sprintf("%s-%d", q.name, i))
+	}
+}
+
+// Wait blocks until every worker has stopped after ctx was cancelled, or timeout runs out.
+// It reports whether they all stopped; jobs still running are picked up again by another
+// worker once their visibility timeout runs out.
+func (q *Queue) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// work claims and runs jobs until ctx is cancelled, polling while there are none.
+func (q *Queue) work(ctx context.Context, worker string) {
+	log.Printf("JobQueue: Starting worker %s", worker)
+	for {
+		job, err := q.repo.Claim(ctx, worker, q.cfg.VisibilityTimeout)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("JobQueue: Worker %s failed to claim a job: %v", worker, err)
+		}
+		if job != nil {
+			q.run(ctx, worker, job)
+			continue // There may be more waiting
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("JobQueue: Stopping worker %s", worker)
+			return
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+// run runs one claimed job and records the outcome.
+func (q *Queue) run(ctx context.Context, worker string, job *model.Job) {
+	// The job outlives a shutdown of the queue, see Start
+	jobCtx := context.WithoutCancel(ctx)
+	log.Printf("JobQueue: Worker %s running %s job %s (attempt %d of %d)", worker, job.Type, job.ID, job.Attempts, job.MaxAttempts)
+
+	// 1. Jobs that can't run
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		q.finish(jobCtx, worker, job, nil, Permanent(fmt.Errorf("no handler for job type '%s'", job.Type)))
+		return
+	}
+	if job.Attempts > job.MaxAttempts {
+		// Reclaimed after its worker stopped responding on the last attempt
+		q.finish(jobCtx, worker, job, nil, fmt.Errorf("worker stopped responding during attempt %d", job.MaxAttempts))
+		return
+	}
+
+	// 2. Run it, keeping it hidden from other workers while it runs
+	stopHeartbeat := q.heartbeat(jobCtx, worker, job)
+	result, err := handler(jobCtx, job)
+	stopHeartbeat()
+	q.finish(jobCtx, worker, job, result, err)
+}
+
+// heartbeat extends the job's visibility timeout every third of it until stopped.
+func (q *Queue) heartbeat(ctx context.Context, worker string, job *model.Job) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.cfg.VisibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.repo.ExtendLock(ctx, job.ID, worker, q.cfg.VisibilityTimeout); err != nil {
+					log.Printf("JobQueue: Failed to extend lock of job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// finish records how an attempt ended: succeeded, failed for good, queued for a retry
+// with backoff, or dead once out of attempts.
+func (q *Queue) finish(ctx context.Context, worker string, job *model.Job, result any, runErr error) {
+	now := time.Now().UTC()
+	var permanent *permanentError
+	switch {
+	case runErr == nil:
+		data, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("JobQueue: Failed to encode result of job %s: %v", job.ID, err)
+		}
+		job.Status = model.JobStatusSucceeded
+		job.Result = data
+		job.LastError = nil
+		job.FinishedAt = &now
+	case errors.As(runErr, &permanent):
+		job.Status = model.JobStatusFailed
+		job.FinishedAt = &now
+	case job.Attempts >= job.MaxAttempts:
+		job.Status = model.JobStatusDead
+		job.FinishedAt = &now
+	default:
+		job.Status = model.JobStatusQueued
+		job.RunAt = now.Add(q.retryDelay(job.Attempts))
+	}
+	if runErr != nil {
+		msg := runErr.Error()
+		job.LastError = &msg
+	}
+
+	if err := q.repo.Finish(ctx, job, worker); err != nil {
+		log.Printf("JobQueue: Failed to record outcome '%s' of job %s: %v", job.Status, job.ID, err)
+		return
+	}
+	switch job.Status {
+	case model.JobStatusSucceeded:
+		log.Printf("JobQueue: Job %s succeeded", job.ID)
+	case model.JobStatusQueued:
+		log.Printf("JobQueue: Job %s failed (attempt %d of %d), retrying at %s: %v",
+			job.ID, job.Attempts, job.MaxAttempts, job.RunAt.Format(time.RFC3339), runErr)
+	case model.JobStatusDead:
+		log.Printf("JobQueue: Job %s failed all %d attempts, moved to dead letters: %v", job.ID, job.MaxAttempts, runErr)
+	default:
+		log.Printf("JobQueue: Job %s failed: %v", job.ID, runErr)
+	}
+}
+
+// retryDelay returns the wait after failed attempt number attempt: the base delay doubled
+// per earlier attempt, capped.
+func (q *Queue) retryDelay(attempt int) time.Duration {
+	delay := q.cfg.RetryMaxDelay
+	if attempt <= 16 && q.cfg.RetryBaseDelay<<(attempt-1) < q.cfg.RetryMaxDelay {
+		delay = q.cfg.RetryBaseDelay << (attempt - 1)
+	}
+	return delay
+}
@@ -0,0 +1,200 @@
+// Package market knows when the Indian equity market trades: exchange holidays and
+// session timings, all in IST. NSE and BSE share their equity holidays and timings,
+// so one calendar serves both.
+package market
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// IST is Indian Standard Time, the exchanges' time zone (no daylight saving).
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+// Sessions of a trading day.
+const (
+	SessionClosed    = "closed"
+	SessionPreOpen   = "pre_open"   // Order entry and call auction; orders are matched at 09:15
+	SessionNormal    = "normal"     // Continuous trading
+	SessionPostClose = "post_close" // Trades at the closing price only
+	SessionMuhurat   = "muhurat"    // Special one-hour session on Diwali, normally a holiday
+)
+
+// Session timings of a regular trading day, as minutes after midnight IST.
+const (
+	PreOpenMinute      = 9 * 60     // 09:00
+	RegularOpenMinute  = 9*60 + 15  // 09:15
+	RegularCloseMinute = 15*60 + 30 // 15:30
+	PostCloseMinute    = 15*60 + 40 // 15:40
+	PostCloseEndMinute = 16 * 60    // 16:00
+)
+
+// defaultHolidays is the holiday list shipped with the binary.
+//
+//go:embed holidays.json
+var defaultHolidays []byte
+
+// HolidayFile lists the exchange trading holidays and special sessions.
+type HolidayFile struct {
+	Source          string           `json:"source"` // Where the list comes from, for humans
+	Holidays        []Holiday        `json:"holidays"`
+	SpecialSessions []SpecialSession `json:"specialSessions"`
+}
+
+// Holiday is a weekday the exchanges are closed.
+type Holiday struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Name string `json:"name"`
+}
+
+// SpecialSession is trading on a day that is otherwise closed, such as muhurat trading.
+type SpecialSession struct {
+	Date  string `json:"date"` // YYYY-MM-DD
+	Name  string `json:"name"`
+	Open  string `json:"open"`  // HH:MM IST
+	Close string `json:"close"` // HH:MM IST
+
+	openMinute, closeMinute int
+}
+
+// window is a session of a given day, [open, close).
+type window struct {
+	session     string
+	open, close time.Time
+}
+
+// Calendar answers trading-hours questions from a holiday file.
+type Calendar struct {
+	holidays map[string]string         // YYYY-MM-DD -> name
+	special  map[string]SpecialSession // YYYY-MM-DD -> session
+}
+
+// NewCalendar creates a calendar from a holiday file, or the embedded NSE list if path is empty.
+func NewCalendar(path string) (*Calendar, error) {
+	data := defaultHolidays
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read market holidays file: %w", err)
+		}
+	}
+	var file HolidayFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse market holidays: %w", err)
+	}
+
+	cal := &Calendar{
+		holidays: make(map[string]string, len(file.Holidays)),
+		special:  make(map[string]SpecialSession, len(file.SpecialSessions)),
+	}
+	for _, h := range file.Holidays {
+		if _, err := time.ParseInLocation("2006-01-02", h.Date, IST); err != nil {
+			return nil, fmt.Errorf("market holiday '%s': invalid date: %w", h.Name, err)
+		}
+		cal.holidays[h.Date] = h.Name
+	}
+	for _, s := range file.SpecialSessions {
+		if _, err := time.ParseInLocation("2006-01-02", s.Date, IST); err != nil {
+			return nil, fmt.Errorf("special session '%s': invalid date: %w", s.Name, err)
+		}
+		open, errOpen := time.Parse("15:04", s.Open)
+		closing, errClose := time.Parse("15:04", s.Close)
+		if errOpen != nil || errClose != nil || !closing.After(open) {
+			return nil, fmt.Errorf("special session '%s' on %s: open and close must be HH:MM, open first", s.Name, s.Date)
+		}
+		s.openMinute = open.Hour()*60 + open.Minute()
+		s.closeMinute = closing.Hour()*60 + closing.Minute()
+		cal.special[s.Date] = s
+	}
+	return cal, nil
+}
+
+// IsTradingDay reports whether t's IST date is a regular trading day: a weekday that isn't a holiday.
+// Days with only a special session (muhurat) are not.
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+	day := t.In(IST)
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.holidays[day.Format("2006-01-02")]
+	return !holiday
+}
+
+// NextTradingDay returns the first trading day strictly after t's IST date, at the same time of day.
+func (c *Calendar) NextTradingDay(t time.Time) time.Time {
+	day := t.In(IST).AddDate(0, 0, 1)
+	for !c.IsTradingDay(day) {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// SessionAt returns the session in progress at t, or SessionClosed.
+func (c *Calendar) SessionAt(t time.Time) string {
+	for _, w := range c.windows(t) {
+		if !t.Before(w.open) && t.Before(w.close) {
+			return w.session
+		}
+	}
+	return SessionClosed
+}
+
+// IsOpen reports whether orders trade continuously at t: the normal session or a muhurat session.
+func (c *Calendar) IsOpen(t time.Time) bool {
+	session := c.SessionAt(t)
+	return session == SessionNormal || session == SessionMuhurat
+}
+
+// SessionStart returns when the session in progress at t started, or the zero time when closed.
+func (c *Calendar) SessionStart(t time.Time) time.Time {
+	for _, w := range c.windows(t) {
+		if !t.Before(w.open) && t.Before(w.close) {
+			return w.open
+		}
+	}
+	return time.Time{}
+}
+
+// NextOpen returns t if the market is open at t, otherwise when it next opens
+// (the start of the next normal or muhurat session).
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	day := t
+	// A year without a single session means a broken holiday file; don't loop forever
+	for i := 0; i < 366; i++ {
+		for _, w := range c.windows(day) {
+			if w.session != SessionNormal && w.session != SessionMuhurat {
+				continue
+			}
+			if !t.Before(w.open) && t.Before(w.close) {
+				return t
+			}
+			if w.open.After(t) {
+				return w.open
+			}
+		}
+		day = day.In(IST).AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// windows returns the sessions of t's IST date in time order.
+func (c *Calendar) windows(t time.Time) []window {
+	local := t.In(IST)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, IST)
+	at := func(minute int) time.Time { return midnight.Add(time.Duration(minute) * time.Minute) }
+
+	if special, ok := c.special[local.Format("2006-01-02")]; ok {
+		return []window{{session: SessionMuhurat, open: at(special.openMinute), close: at(special.closeMinute)}}
+	}
+	if !c.IsTradingDay(local) {
+		return nil
+	}
+	return []window{
+		{session: SessionPreOpen, open: at(PreOpenMinute), close: at(RegularOpenMinute)},
+		{session: SessionNormal, open: at(RegularOpenMinute), close: at(RegularCloseMinute)},
+		{session: SessionPostClose, open: at(PostCloseMinute), close: at(PostCloseEndMinute)},
+	}
+}
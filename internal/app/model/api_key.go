@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes that can be granted to a personal API key.
+const (
+	ScopeBasketsRead   = "baskets:read"
+	ScopeBasketsWrite  = "baskets:write"
+	ScopeOrdersExecute = "orders:execute"
+)
+
+// APIKeyScopes lists every valid API key scope.
+var APIKeyScopes = []string{ScopeBasketsRead, ScopeBasketsWrite, ScopeOrdersExecute}
+
+// APIKey is a user-generated credential for programmatic access (CI jobs, notebooks).
+// Only a hash of the secret is stored; the full key is shown once at creation.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Visible, non-secret part of the key (e.g. "ssk_1a2b3c4d") to tell keys apart
+	SecretHash string     `json:"-"`      // SHA-256 of the full key, never sent in responses
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the key can still be used at time now.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
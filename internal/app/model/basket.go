@@ -13,6 +13,9 @@ type Basket struct {
 	Stocks    []Stock   `json:"stocks"`    // List of stocks in the basket
 	CreatedAt time.Time `json:"createdAt"` // Keep track of creation time
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	// OrganizationID is set for baskets shared with an organization (nil for personal baskets)
+	OrganizationID *uuid.UUID `json:"organizationId,omitempty"`
 }
 
 // Add a helper function maybe? (optional)
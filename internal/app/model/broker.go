@@ -0,0 +1,72 @@
+package model
+
+import "time"
+
+// BrokerKite identifies Zerodha Kite Connect credentials.
+const BrokerKite = "kite"
+
+// Broker credential statuses.
+const (
+	BrokerStatusActive  = "active"
+	BrokerStatusExpired = "expired" // Rejected by the broker or past its expiry; the user has to reconnect
+)
+
+// istZone is Indian Standard Time (no DST), used for the broker's daily token cutoff.
+var istZone = time.FixedZone("IST", 5*60*60+30*60)
+
+// kiteTokenCutoffHour is when Kite invalidates all access tokens every morning (IST).
+const kiteTokenCutoffHour = 6
+
+// BrokerConnection describes a linked broker account without exposing any tokens.
+type BrokerConnection struct {
+	Broker         string    `json:"broker"`         // e.g. "kite"
+	BrokerUserID   string    `json:"brokerUserId"`   // The user ID at the broker (Kite's user_id)
+	ConnectedAt    time.Time `json:"connectedAt"`    // When the account was first linked
+	UpdatedAt      time.Time `json:"updatedAt"`      // When the credentials were last refreshed
+	TokenIssuedAt  time.Time `json:"tokenIssuedAt"`  // When the current access token was obtained
+	TokenExpiresAt time.Time `json:"tokenExpiresAt"` // When the broker stops accepting it
+	Status         string    `json:"status"`         // active or expired
+	TokenValid     bool      `json:"tokenValid"`     // False once expired; the user has to reconnect
+}
+
+// BrokerProfile is the linked broker account's profile.
+type BrokerProfile struct {
+	Broker       string   `json:"broker"`
+	BrokerUserID string   `json:"brokerUserId"`
+	UserName     string   `json:"userName"`
+	ShortName    string   `json:"shortName"`
+	Email        string   `json:"email"`
+	Exchanges    []string `json:"exchanges"`  // Exchanges the account is enabled for
+	Products     []string `json:"products"`   // e.g. CNC, MIS, NRML
+	OrderTypes   []string `json:"orderTypes"` // e.g. MARKET, LIMIT
+}
+
+// BrokerMargins holds the funds available at the broker, per segment.
+type BrokerMargins struct {
+	Equity    SegmentMargins `json:"equity"`
+	Commodity SegmentMargins `json:"commodity"`
+	FetchedAt time.Time      `json:"fetchedAt"` // Responses may be cached briefly
+}
+
+// SegmentMargins are the funds of one segment (amounts in INR).
+type SegmentMargins struct {
+	Enabled        bool    `json:"enabled"`
+	Net            float64 `json:"net"`         // Available to trade: available minus utilised
+	Cash           float64 `json:"cash"`        // Cash balance at the start of the day
+	LiveBalance    float64 `json:"liveBalance"` // Cash after today's trades and payins
+	OpeningBalance float64 `json:"openingBalance"`
+	Collateral     float64 `json:"collateral"`    // Margin from pledged holdings
+	IntradayPayin  float64 `json:"intradayPayin"` // Funds added today
+	Utilised       float64 `json:"utilised"`      // Total margin used (debits)
+}
+
+// KiteTokenExpiry returns when a Kite access token issued at issuedAt expires:
+// the next daily cutoff (6 AM IST) after it was issued.
+func KiteTokenExpiry(issuedAt time.Time) time.Time {
+	local := issuedAt.In(istZone)
+	cutoff := time.Date(local.Year(), local.Month(), local.Day(), kiteTokenCutoffHour, 0, 0, 0, istZone)
+	if !local.Before(cutoff) {
+		cutoff = cutoff.AddDate(0, 0, 1)
+	}
+	return cutoff.UTC()
+}
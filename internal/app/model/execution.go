@@ -0,0 +1,258 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Order parameters understood by the broker (Kite's values).
+const (
+	TransactionBuy  = "BUY"
+	TransactionSell = "SELL"
+
+	OrderTypeMarket = "MARKET"
+	OrderTypeLimit  = "LIMIT"
+	OrderTypeSL     = "SL"   // Stop-loss limit: a limit order once the trigger price is hit
+	OrderTypeSLM    = "SL-M" // Stop-loss market: a market order once the trigger price is hit
+
+	ProductCNC = "CNC" // Delivery
+	ProductMIS = "MIS" // Intraday
+
+	VarietyRegular = "regular"
+	VarietyAMO     = "amo"     // After-market order: queued at the broker, sent to the exchange at the next open
+	VarietyIceberg = "iceberg" // Split by Kite into legs sent one after another, each below the freeze quantity
+
+	MaxIcebergLegs = 10 // Kite's limit on the legs of an iceberg order
+
+	ExchangeNSE = "NSE"
+)
+
+// Execution statuses.
+const (
+	ExecutionStatusPlacing         = "placing"          // Orders are being sent to the broker
+	ExecutionStatusCompleted       = "completed"        // Every order was accepted by the broker
+	ExecutionStatusPartiallyFailed = "partially_failed" // Some orders were accepted, some failed
+	ExecutionStatusFailed          = "failed"           // No order was accepted
+	ExecutionStatusQueuedForOpen   = "queued_for_open"  // Every order was accepted as an AMO, waiting for the market to open
+)
+
+// Statuses of a single order of an execution.
+const (
+	OrderStatusPending   = "pending"   // Not sent to the broker yet
+	OrderStatusPlaced    = "placed"    // Accepted by the broker (not necessarily filled)
+	OrderStatusFailed    = "failed"    // Rejected by the broker or not sent
+	OrderStatusCancelled = "cancelled" // Cancelled through us after being placed
+)
+
+// Actions recorded in the order audit trail.
+const (
+	OrderEventModify = "modify"
+	OrderEventCancel = "cancel"
+)
+
+// Outcomes of an audited order action.
+const (
+	OrderEventSucceeded = "succeeded"
+	OrderEventFailed    = "failed"   // The broker refused the change
+	OrderEventConflict  = "conflict" // The broker applied it but the order had changed here meanwhile
+)
+
+// Margin check sources.
+const (
+	MarginSourceBroker   = "broker"   // Kite's basket margins API
+	MarginSourceEstimate = "estimate" // Local estimate from last traded prices (delivery only)
+)
+
+// ExecutionOptions are the user's choices for how a basket is executed.
+type ExecutionOptions struct {
+	OrderType     string             `json:"orderType"`     // MARKET (default), LIMIT, SL or SL-M
+	Product       string             `json:"product"`       // CNC (default) or MIS
+	Prices        map[string]float64 `json:"prices"`        // Limit price per symbol, required for LIMIT and SL orders
+	TriggerPrices map[string]float64 `json:"triggerPrices"` // Trigger price per symbol, required for SL and SL-M orders
+	AMO           bool               `json:"amo"`           // Outside market hours, place after-market orders instead of refusing
+	Iceberg       bool               `json:"iceberg"`       // Send orders above the freeze quantity as Kite iceberg orders instead of separate child orders
+}
+
+// Sources for the quantity an exit sells.
+const (
+	ExitSourceExecutions = "executions" // What this basket's executions bought (net of exits), capped at the holdings
+	ExitSourceHoldings   = "holdings"   // The whole holding of each basket stock at the broker
+)
+
+// ExitOptions are the user's choices for exiting (selling) a basket.
+type ExitOptions struct {
+	ExecutionOptions
+	Percentage float64 `json:"percentage"` // Share of the held quantity to sell, above 0 and up to 100 (default 100)
+	Source     string  `json:"source"`     // executions (default) or holdings
+}
+
+// OrderParams is one order we send (or would send) to the broker.
+type OrderParams struct {
+	Symbol          string   `json:"symbol"`
+	Exchange        string   `json:"exchange"`
+	TransactionType string   `json:"transactionType"` // BUY or SELL
+	OrderType       string   `json:"orderType"`       // MARKET or LIMIT
+	Product         string   `json:"product"`         // CNC or MIS
+	Variety         string   `json:"variety"`         // regular, amo or iceberg
+	Quantity        int      `json:"quantity"`
+	Price           *float64 `json:"price,omitempty"`           // Limit price (nil for MARKET and SL-M)
+	TriggerPrice    *float64 `json:"triggerPrice,omitempty"`    // For SL and SL-M orders
+	IcebergLegs     int      `json:"icebergLegs,omitempty"`     // Iceberg orders: number of legs
+	IcebergQuantity int      `json:"icebergQuantity,omitempty"` // Iceberg orders: quantity per leg
+	SliceQuantities []int    `json:"sliceQuantities,omitempty"` // Above the freeze quantity: the child orders it is split into
+}
+
+// Execution is one run of a basket: the orders placed for it and their outcome.
+type Execution struct {
+	ID              uuid.UUID        `json:"id"`
+	BasketID        *uuid.UUID       `json:"basketId,omitempty"` // Nil once the basket is deleted
+	UserID          uuid.UUID        `json:"userId"`             // Who executed it
+	TransactionType string           `json:"transactionType"`    // BUY or SELL
+	Status          string           `json:"status"`
+	MarginCheck     *MarginCheck     `json:"marginCheck,omitempty"` // The pre-trade check it ran with
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+	Orders          []ExecutionOrder `json:"orders,omitempty"`
+}
+
+// ExecutionOrder is a single order of an execution.
+type ExecutionOrder struct {
+	ID            uuid.UUID `json:"id"`
+	ExecutionID   uuid.UUID `json:"executionId"`
+	OrderParams             // What was sent to the broker
+	Status        string    `json:"status"`
+	BrokerOrderID *string   `json:"brokerOrderId,omitempty"` // Kite's order_id once placed
+	ErrorMessage  *string   `json:"errorMessage,omitempty"`  // Why it failed
+	Version       int       `json:"version"`                 // Bumped on every change, for optimistic concurrency checks
+	// Fills as last fetched from the broker, summed over the child orders of a sliced order
+	FilledQuantity int          `json:"filledQuantity"`
+	AveragePrice   *float64     `json:"averagePrice,omitempty"`
+	Slices         []OrderSlice `json:"slices,omitempty"` // Child orders, when the quantity exceeded the freeze quantity
+	CreatedAt      time.Time    `json:"createdAt"`
+	UpdatedAt      time.Time    `json:"updatedAt"`
+}
+
+// OrderSlice is one child order of an execution order that was split to stay within the
+// exchange's freeze quantity. It has the order's parameters except the quantity.
+type OrderSlice struct {
+	ID             uuid.UUID `json:"id"`
+	OrderID        uuid.UUID `json:"orderId"`
+	Seq            int       `json:"seq"` // 1-based, in placement order
+	Quantity       int       `json:"quantity"`
+	Status         string    `json:"status"` // Like the order's: pending, placed, failed or cancelled
+	BrokerOrderID  *string   `json:"brokerOrderId,omitempty"`
+	ErrorMessage   *string   `json:"errorMessage,omitempty"`
+	FilledQuantity int       `json:"filledQuantity"`
+	AveragePrice   *float64  `json:"averagePrice,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// BrokerOrder is the state of an order at the broker.
+type BrokerOrder struct {
+	OrderID        string
+	ParentOrderID  string // Iceberg legs after the first point to the first one
+	Status         string
+	FilledQuantity int
+	AveragePrice   float64
+	Tags           []string // Ours identify the order placed for an execution order or child order
+}
+
+// MarginCheck compares what a basket needs with the funds available at the broker (amounts in INR).
+type MarginCheck struct {
+	RequiredMargin  float64      `json:"requiredMargin"`
+	AvailableMargin float64      `json:"availableMargin"` // Net equity funds
+	Shortfall       float64      `json:"shortfall"`       // 0 when sufficient
+	Sufficient      bool         `json:"sufficient"`
+	Source          string       `json:"source"` // broker or estimate
+	Items           []MarginItem `json:"items"`
+	CheckedAt       time.Time    `json:"checkedAt"`
+}
+
+// MarginItem is the margin one order of the basket needs.
+type MarginItem struct {
+	Symbol          string  `json:"symbol"`
+	TransactionType string  `json:"transactionType"`
+	Quantity        int     `json:"quantity"`
+	Price           float64 `json:"price,omitempty"` // Price the estimate used (limit price or last traded price)
+	RequiredMargin  float64 `json:"requiredMargin"`
+}
+
+// OrderCharges are the costs of a trade on top of its value (amounts in INR).
+type OrderCharges struct {
+	Brokerage           float64 `json:"brokerage"`
+	STT                 float64 `json:"stt"` // Securities transaction tax
+	ExchangeTransaction float64 `json:"exchangeTransaction"`
+	SEBIFees            float64 `json:"sebiFees"`
+	GST                 float64 `json:"gst"`
+	StampDuty           float64 `json:"stampDuty"`
+	Total               float64 `json:"total"`
+}
+
+// ExecutionPreview is what executing a basket would send to the broker, without placing anything.
+type ExecutionPreview struct {
+	BasketID           uuid.UUID      `json:"basketId"`
+	TransactionType    string         `json:"transactionType"`
+	Orders             []OrderPreview `json:"orders"`
+	MarginCheck        *MarginCheck   `json:"marginCheck"`
+	WouldBlock         bool           `json:"wouldBlock"`                   // Executing now would be refused (margin policy)
+	TotalValue         float64        `json:"totalValue"`                   // Sum of the orders' estimated values
+	TotalCharges       float64        `json:"totalCharges"`                 // Sum of the orders' estimated charges
+	TotalCost          float64        `json:"totalCost"`                    // Buys: value plus charges. Sells: charges only
+	ChargesRateVersion string         `json:"chargesRateVersion,omitempty"` // Rates version the charges were computed with
+	Warnings           []string       `json:"warnings"`                     // e.g. charges that couldn't be estimated
+	GeneratedAt        time.Time      `json:"generatedAt"`
+}
+
+// OrderPreview is one order of an ExecutionPreview.
+type OrderPreview struct {
+	OrderParams
+	Instrument     string        `json:"instrument"`        // e.g. "NSE:INFY"
+	EstimatedPrice float64       `json:"estimatedPrice"`    // Limit price, or last traded price for market orders
+	EstimatedValue float64       `json:"estimatedValue"`    // Price × quantity
+	Charges        *OrderCharges `json:"charges,omitempty"` // Nil if they couldn't be estimated
+}
+
+// OrderModification is a change to an open order. Nil fields are left as they are.
+type OrderModification struct {
+	Quantity        *int     `json:"quantity"`
+	Price           *float64 `json:"price"`
+	TriggerPrice    *float64 `json:"triggerPrice"`
+	ExpectedVersion *int     `json:"expectedVersion"` // Optional: refuse if the order changed since the client read it
+}
+
+// OrderSnapshot is the state of an order before or after an audited action.
+type OrderSnapshot struct {
+	Status       string   `json:"status"`
+	Quantity     int      `json:"quantity"`
+	Price        *float64 `json:"price,omitempty"`
+	TriggerPrice *float64 `json:"triggerPrice,omitempty"`
+}
+
+// OrderEvent is an entry in an execution's audit trail: one attempt to change one of its orders.
+type OrderEvent struct {
+	ID           uuid.UUID      `json:"id"`
+	ExecutionID  uuid.UUID      `json:"executionId"`
+	OrderID      uuid.UUID      `json:"orderId"`
+	UserID       uuid.UUID      `json:"userId"` // Who made the change
+	Action       string         `json:"action"` // modify or cancel
+	Outcome      string         `json:"outcome"`
+	Before       OrderSnapshot  `json:"before"`
+	After        *OrderSnapshot `json:"after,omitempty"` // Requested state (nil for cancel)
+	ErrorMessage *string        `json:"errorMessage,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// OrderActionResult is the outcome for one order of a bulk action (e.g. cancel all open orders).
+type OrderActionResult struct {
+	OrderID uuid.UUID `json:"orderId"`
+	Symbol  string    `json:"symbol"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Snapshot returns the order's current state for the audit trail.
+func (o *ExecutionOrder) Snapshot() OrderSnapshot {
+	return OrderSnapshot{Status: o.Status, Quantity: o.Quantity, Price: o.Price, TriggerPrice: o.TriggerPrice}
+}
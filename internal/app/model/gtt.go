@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GTT (Good Till Triggered) trigger types (Kite's values).
+const (
+	GTTTypeSingle = "single"  // One trigger price
+	GTTTypeOCO    = "two-leg" // One cancels other: a stop-loss below and a target above the price
+)
+
+// GTT statuses. Active triggers are tracked by the broker; the others are final.
+const (
+	GTTStatusActive    = "active"
+	GTTStatusTriggered = "triggered"
+	GTTStatusDisabled  = "disabled"
+	GTTStatusExpired   = "expired"
+	GTTStatusCancelled = "cancelled"
+	GTTStatusRejected  = "rejected"
+	GTTStatusDeleted   = "deleted"
+)
+
+// GTTLeg is a trigger price and the limit order placed when it is hit.
+type GTTLeg struct {
+	TriggerPrice float64 `json:"triggerPrice"`
+	LimitPrice   float64 `json:"limitPrice"`
+	Quantity     int     `json:"quantity"`
+}
+
+// GTT is a trigger stored at the broker, valid across days (a year at Kite) until hit or deleted.
+type GTT struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           uuid.UUID  `json:"userId"`
+	BasketID         *uuid.UUID `json:"basketId,omitempty"`
+	ExecutionOrderID *uuid.UUID `json:"executionOrderId,omitempty"` // The executed order it protects, if any
+	BrokerTriggerID  int        `json:"brokerTriggerId"`
+	Type             string     `json:"type"`
+	Symbol           string     `json:"symbol"`
+	Exchange         string     `json:"exchange"`
+	TransactionType  string     `json:"transactionType"`
+	Product          string     `json:"product"`
+	LastPrice        float64    `json:"lastPrice"` // Price when the trigger was last set
+	Legs             []GTTLeg   `json:"legs"`      // OCO: stop-loss first, then target
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// GTTRequest creates a trigger for a basket item or for an executed order.
+// For an executed order, the symbol, exchange, product and quantity default to the order's.
+type GTTRequest struct {
+	Type             string     `json:"type"`
+	BasketID         *uuid.UUID `json:"basketId"`
+	ExecutionID      *uuid.UUID `json:"executionId"`
+	ExecutionOrderID *uuid.UUID `json:"executionOrderId"`
+	Symbol           string     `json:"symbol"`
+	Exchange         string     `json:"exchange"`        // NSE (default)
+	TransactionType  string     `json:"transactionType"` // SELL (default)
+	Product          string     `json:"product"`         // CNC (default)
+	Legs             []GTTLeg   `json:"legs"`
+}
+
+// ProtectOptions sets a stop-loss and a target on every holding of a basket.
+type ProtectOptions struct {
+	StopLossPercent    float64 `json:"stopLossPercent"`    // Below the last price
+	TargetPercent      float64 `json:"targetPercent"`      // Above the last price
+	LimitBufferPercent float64 `json:"limitBufferPercent"` // Stop-loss limit below its trigger so it fills in a falling market (default 0.5)
+	Source             string  `json:"source"`             // Quantities like an exit: executions (default) or holdings
+}
+
+// ProtectResult is the outcome of protecting one basket stock.
+type ProtectResult struct {
+	Symbol  string `json:"symbol"`
+	Success bool   `json:"success"`
+	GTT     *GTT   `json:"gtt,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
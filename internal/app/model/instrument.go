@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Instrument is an entry of the instrument master: trading limits of one tradable symbol.
+type Instrument struct {
+	Exchange       string    `json:"exchange"`
+	Symbol         string    `json:"symbol"`
+	FreezeQuantity int       `json:"freezeQuantity"` // Largest quantity the exchange accepts in one order
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of background jobs.
+const (
+	JobTypeBasketExecute = "basket.execute"
+	JobTypeBasketExit    = "basket.exit"
+)
+
+// Statuses of a background job.
+const (
+	JobStatusQueued    = "queued"    // Waiting for a worker, possibly until a retry is due
+	JobStatusRunning   = "running"   // Claimed by a worker
+	JobStatusSucceeded = "succeeded" // Done; see the result
+	JobStatusFailed    = "failed"    // Refused with an error retrying can't fix (e.g. insufficient margin)
+	JobStatusDead      = "dead"      // Failed every attempt; kept for an admin to inspect and retry
+)
+
+// Job is a unit of background work, stored so it survives restarts.
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	UserID      uuid.UUID       `json:"userId"` // Who asked for it
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"` // Not started before; the next retry when queued after a failure
+	LockedBy    *string         `json:"-"`
+	LockedUntil *time.Time      `json:"-"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	LastError   *string         `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// BasketJobPayload is the payload of basket execute and exit jobs. The execution ID is
+// chosen when the job is queued, so a retried job finds the execution of an earlier
+// attempt and continues it instead of placing the orders twice.
+type BasketJobPayload struct {
+	BasketID    uuid.UUID        `json:"basketId"`
+	ExecutionID uuid.UUID        `json:"executionId"`
+	Options     ExecutionOptions `json:"options,omitempty"` // Execute jobs
+	Exit        *ExitOptions     `json:"exit,omitempty"`    // Exit jobs
+}
+
+// BasketJobResult is the result of a finished basket execute or exit job.
+type BasketJobResult struct {
+	ExecutionID uuid.UUID `json:"executionId"`
+	Status      string    `json:"status"` // The execution's status when the job finished
+}
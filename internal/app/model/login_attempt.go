@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// LoginAttempt tracks failed login attempts for a single key.
+// A key is either an email address ("email:<address>") or a client IP ("ip:<address>").
+type LoginAttempt struct {
+	Key          string
+	FailedCount  int       // Failures within the current tracking window
+	LastFailedAt time.Time // Time of the most recent failure
+	LockedUntil  time.Time // Zero if not locked; logins for this key are refused until then
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization member permissions, from least to most privileged.
+// Each permission includes everything the previous ones allow:
+// viewers can see baskets, editors can change them, executors can also
+// place orders with them, and owners manage members and invitations.
+const (
+	OrgPermissionViewer   = "viewer"
+	OrgPermissionEditor   = "editor"
+	OrgPermissionExecutor = "executor"
+	OrgPermissionOwner    = "owner"
+)
+
+var orgPermissionRank = map[string]int{
+	OrgPermissionViewer:   1,
+	OrgPermissionEditor:   2,
+	OrgPermissionExecutor: 3,
+	OrgPermissionOwner:    4,
+}
+
+// IsValidOrgPermission reports whether permission is one of the known permissions.
+func IsValidOrgPermission(permission string) bool {
+	_, ok := orgPermissionRank[permission]
+	return ok
+}
+
+// OrgPermissionAllows reports whether a member with permission may do
+// something that requires the required permission.
+func OrgPermissionAllows(permission, required string) bool {
+	return orgPermissionRank[permission] >= orgPermissionRank[required] && IsValidOrgPermission(permission)
+}
+
+// Organization is a team workspace whose members share baskets.
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy uuid.UUID `json:"createdBy"`
+	// Permission is the requesting user's permission (only set when listing a user's organizations).
+	Permission string    `json:"permission,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// OrganizationMember links a user to an organization with a permission.
+type OrganizationMember struct {
+	OrganizationID uuid.UUID `json:"organizationId"`
+	UserID         uuid.UUID `json:"userId"`
+	Email          string    `json:"email"` // Filled in when listing members
+	Permission     string    `json:"permission"`
+	JoinedAt       time.Time `json:"joinedAt"`
+}
+
+// OrganizationInvitation invites an email address to join an organization.
+// Only the SHA-256 hash of the invitation token is stored.
+type OrganizationInvitation struct {
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID uuid.UUID  `json:"organizationId"`
+	Email          string     `json:"email"`
+	Permission     string     `json:"permission"`
+	InvitedBy      uuid.UUID  `json:"invitedBy"`
+	TokenHash      string     `json:"-"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How often a schedule runs.
+const (
+	ScheduleMonthly = "monthly"
+	ScheduleWeekly  = "weekly"
+)
+
+// Statuses of a schedule run.
+const (
+	ScheduleRunRunning   = "running"   // The execution is queued or being placed (see the run's job)
+	ScheduleRunSucceeded = "succeeded" // An execution was recorded (its orders may still have failed individually)
+	ScheduleRunFailed    = "failed"    // The execution was refused, e.g. insufficient margin
+	ScheduleRunMissed    = "missed"    // Not run at its time: server down or broker session expired
+)
+
+// Schedule executes a basket on a recurring date (a systematic investment plan).
+// Dates that aren't trading days roll forward to the next trading day.
+type Schedule struct {
+	ID          uuid.UUID        `json:"id"`
+	BasketID    uuid.UUID        `json:"basketId"`
+	UserID      uuid.UUID        `json:"userId"` // Whose broker account the orders go to
+	Frequency   string           `json:"frequency"`
+	DayOfMonth  *int             `json:"dayOfMonth,omitempty"` // Monthly: 1-31, short months use their last day
+	DayOfWeek   *int             `json:"dayOfWeek,omitempty"`  // Weekly: 1 (Monday) to 5 (Friday)
+	TimeOfDay   string           `json:"timeOfDay"`            // HH:MM IST, within market hours
+	Options     ExecutionOptions `json:"options"`
+	Enabled     bool             `json:"enabled"`
+	RetryMissed bool             `json:"retryMissed"` // Run late the same session instead of recording a miss
+	NextRunAt   *time.Time       `json:"nextRunAt,omitempty"`
+	LastRunAt   *time.Time       `json:"lastRunAt,omitempty"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+}
+
+// ScheduleRun is one occurrence of a schedule.
+type ScheduleRun struct {
+	ID           uuid.UUID  `json:"id"`
+	ScheduleID   uuid.UUID  `json:"scheduleId"`
+	ScheduledFor time.Time  `json:"scheduledFor"`
+	Status       string     `json:"status"`
+	JobID        *uuid.UUID `json:"jobId,omitempty"`       // The job executing the basket
+	ExecutionID  *uuid.UUID `json:"executionId,omitempty"` // Set when the job is queued, before the execution exists
+	ErrorMessage *string    `json:"errorMessage,omitempty"`
+	Attempts     int        `json:"attempts"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
@@ -6,11 +6,34 @@ import (
 	"github.com/google/uuid"
 )
 
+// User roles. Support staff can look up users; admins can additionally disable accounts.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleSupport || role == RoleAdmin
+}
+
 // User represents a registered user in the system.
 type User struct {
 	ID           uuid.UUID `json:"id"`
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"` // "-" prevents this from ever being sent in JSON responses
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	Role         string    `json:"role"`
+	// DisabledAt is set when an admin disables the account; disabled users can't log in or use tokens.
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	// SessionsRevokedAt invalidates every token issued before it (forced logout).
+	SessionsRevokedAt *time.Time `json:"-"`
+	TOTPEnabled       bool       `json:"totpEnabled"`
+	// TOTPSecretEncrypted holds the encrypted TOTP secret. It is set during enrollment
+	// and only becomes active once TOTPEnabled is true (after the user confirms a code).
+	TOTPSecretEncrypted []byte `json:"-"`
+	// TOTPLastUsedStep is the time step of the last accepted code, used to reject replays.
+	TOTPLastUsedStep int64     `json:"-"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
 }
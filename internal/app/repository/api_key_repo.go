@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrAPIKeyNotFound is returned when an API key does not exist (or belongs to another user).
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKeyRepository defines the interface for API key data operations.
+type APIKeyRepository interface {
+	// Save creates a new API key record.
+	Save(ctx context.Context, key *model.APIKey) error
+
+	// FindByPrefix retrieves a key by its visible prefix (including revoked/expired keys).
+	// Returns ErrAPIKeyNotFound if no key has that prefix.
+	FindByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+
+	// FindAllByUser lists all keys of a user, newest first.
+	FindAllByUser(ctx context.Context, userID uuid.UUID) ([]model.APIKey, error)
+
+	// Revoke marks a key of the user as revoked.
+	// Returns ErrAPIKeyNotFound if the key doesn't exist, belongs to someone else or is already revoked.
+	Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+
+	// UpdateLastUsed records when a key was last used to authenticate.
+	UpdateLastUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+}
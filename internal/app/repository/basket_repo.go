@@ -15,14 +15,23 @@ var ErrBasketNotFound = errors.New("basket not found")
 
 // BasketRepository defines the interface for basket data operations.
 // Any struct that implements these methods satisfies the interface.
+//
+// The userID parameter is the acting user. A basket is accessible to a user if it is
+// their personal basket, or if it belongs to an organization they are a member of.
+// Inaccessible baskets behave as if they didn't exist (ErrBasketNotFound).
+// Checking the member's permission level is up to the service.
 type BasketRepository interface {
 	// Save creates a new basket or updates an existing one.
 	// For simplicity now, we'll assume it only creates.
+	// userID is recorded as the creator; basket.OrganizationID decides who can access it.
 	Save(ctx context.Context, basket *model.Basket, userID uuid.UUID) error
 
-	// FindAll retrieves all baskets.
+	// FindAll retrieves all baskets accessible to the user (personal and organization baskets).
 	FindAll(ctx context.Context, userID uuid.UUID) ([]model.Basket, error)
 
+	// FindAllByOrganization retrieves the baskets of one organization the user is a member of.
+	FindAllByOrganization(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) ([]model.Basket, error)
+
 	// FindByID retrieves a single basket by its ID.
 	FindByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*model.Basket, error)
 
@@ -3,6 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
 
 	"github.com/google/uuid"
 )
@@ -10,13 +13,48 @@ import (
 // ErrBrokerCredentialsNotFound indicates credentials for a user/broker combo were not found.
 var ErrBrokerCredentialsNotFound = errors.New("broker credentials not found for user")
 
+// ErrBrokerTokenExpired indicates the stored access token is past its expiry or was rejected by the broker.
+var ErrBrokerTokenExpired = errors.New("broker access token has expired")
+
+// RewriteStats summarises a bulk rewrite of stored tokens (see ReencryptAccessTokens).
+type RewriteStats struct {
+	Scanned   int // Rows looked at
+	Rewritten int // Rows updated
+	Skipped   int // Rows changed concurrently (already written correctly by then)
+	Failed    int // Rows that couldn't be decrypted
+}
+
 // BrokerRepository defines the interface for storing/retrieving broker credentials.
 type BrokerRepository interface {
-	// SaveOrUpdateKiteCredentials saves or updates Kite credentials for a user.
+	// SaveOrUpdateKiteCredentials saves or updates Kite credentials for a user and marks them active.
 	// accessToken should be the raw, unencrypted token. Encryption happens internally.
-	SaveOrUpdateKiteCredentials(ctx context.Context, userID uuid.UUID, accessToken []byte, publicToken string, kiteUserID string) error
+	SaveOrUpdateKiteCredentials(ctx context.Context, userID uuid.UUID, accessToken []byte, publicToken string, kiteUserID string, expiresAt time.Time) error
 
 	// GetKiteAccessToken retrieves the raw, decrypted access token for a user.
-	// Returns ErrBrokerCredentialsNotFound if not found.
+	// Returns ErrBrokerCredentialsNotFound if not found, ErrBrokerTokenExpired if the token has expired.
 	GetKiteAccessToken(ctx context.Context, userID uuid.UUID) ([]byte, error)
-}
\ No newline at end of file
+
+	// MarkTokenExpired flags the user's credentials for a broker as expired
+	// (e.g. after the broker rejected the token).
+	MarkTokenExpired(ctx context.Context, userID uuid.UUID, broker string) error
+
+	// ExpireStaleTokens flags every active token whose expiry is at or before now.
+	// Returns the number of credentials flagged.
+	ExpireStaleTokens(ctx context.Context, now time.Time) (int64, error)
+
+	// ListConnections returns the user's linked broker accounts without any token material.
+	ListConnections(ctx context.Context, userID uuid.UUID) ([]model.BrokerConnection, error)
+
+	// DeleteCredentials removes the user's credentials for a broker.
+	// Returns ErrBrokerCredentialsNotFound if there were none.
+	DeleteCredentials(ctx context.Context, userID uuid.UUID, broker string) error
+
+	// ReencryptAccessTokens rewrites every stored token that isn't encrypted with the
+	// active key (or isn't bound to its row yet), batchSize rows at a time.
+	// Safe to run while the API is serving traffic.
+	ReencryptAccessTokens(ctx context.Context, batchSize int) (RewriteStats, error)
+
+	// UnwrapDoubleEncryptedTokens repairs rows whose token was encrypted twice
+	// (once by the service, once by the repository) by storing it encrypted once.
+	UnwrapDoubleEncryptedTokens(ctx context.Context, batchSize int) (RewriteStats, error)
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrExecutionNotFound is returned when an execution doesn't exist.
+var ErrExecutionNotFound = errors.New("execution not found")
+
+// ErrExecutionOrderNotFound is returned when an order of an execution doesn't exist.
+var ErrExecutionOrderNotFound = errors.New("execution order not found")
+
+// ErrExecutionOrderConflict is returned when an order changed since the version an update was based on.
+var ErrExecutionOrderConflict = errors.New("execution order was changed concurrently")
+
+// ExecutionRepository stores basket executions and their orders.
+// Access control is up to the caller (executions follow their basket).
+type ExecutionRepository interface {
+	// Create stores an execution together with its orders and their child orders.
+	Create(ctx context.Context, execution *model.Execution) error
+
+	// UpdateOrder saves an order's status, broker order ID and error message, and bumps its version.
+	UpdateOrder(ctx context.Context, order *model.ExecutionOrder) error
+
+	// UpdateSlice saves a child order's status, broker order ID, error message and fills.
+	UpdateSlice(ctx context.Context, slice *model.OrderSlice) error
+
+	// UpdateFills saves an order's filled quantity and average price. Fills aren't changes
+	// made through us, so the version is left alone.
+	UpdateFills(ctx context.Context, order *model.ExecutionOrder) error
+
+	// UpdateOpenOrder saves an open order's status, quantity and prices if it is still at
+	// expectedVersion and placed, and sets order.Version to the new version.
+	// Returns ErrExecutionOrderConflict otherwise.
+	UpdateOpenOrder(ctx context.Context, order *model.ExecutionOrder, expectedVersion int) error
+
+	// AddOrderEvent appends an entry to the order audit trail.
+	AddOrderEvent(ctx context.Context, event *model.OrderEvent) error
+
+	// ListOrderEvents returns an execution's audit trail, oldest first.
+	ListOrderEvents(ctx context.Context, executionID uuid.UUID) ([]model.OrderEvent, error)
+
+	// UpdateStatus sets an execution's status.
+	UpdateStatus(ctx context.Context, executionID uuid.UUID, status string) error
+
+	// FindByID returns an execution with its orders and their child orders.
+	FindByID(ctx context.Context, executionID uuid.UUID) (*model.Execution, error)
+
+	// ListByBasket returns a basket's executions, newest first, without their orders.
+	ListByBasket(ctx context.Context, basketID uuid.UUID) ([]model.Execution, error)
+
+	// ReleaseQueued marks executions queued for open that were created before openedAt as
+	// completed, and returns how many it updated.
+	ReleaseQueued(ctx context.Context, openedAt time.Time) (int64, error)
+
+	// NetPlacedQuantities sums, per symbol, the quantity of the user's placed orders for a
+	// basket: buys minus sells. Failed and cancelled orders don't count, nor do the child
+	// orders of a split order that weren't placed.
+	NetPlacedQuantities(ctx context.Context, basketID uuid.UUID, userID uuid.UUID) (map[string]int, error)
+}
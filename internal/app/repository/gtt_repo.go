@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrGTTNotFound is returned when a GTT trigger doesn't exist or belongs to another user.
+var ErrGTTNotFound = errors.New("gtt trigger not found")
+
+// GTTRepository stores the GTT triggers placed at the broker.
+type GTTRepository interface {
+	// Create stores a trigger the broker accepted.
+	Create(ctx context.Context, gtt *model.GTT) error
+
+	// FindByID returns a trigger of the user.
+	FindByID(ctx context.Context, gttID uuid.UUID, userID uuid.UUID) (*model.GTT, error)
+
+	// ListByUser returns the user's triggers, newest first, optionally only those of a basket.
+	ListByUser(ctx context.Context, userID uuid.UUID, basketID *uuid.UUID) ([]model.GTT, error)
+
+	// Update saves a trigger's last price, legs and status.
+	Update(ctx context.Context, gtt *model.GTT) error
+}
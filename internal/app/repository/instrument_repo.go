@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+)
+
+// InstrumentRepository stores the instrument master.
+type InstrumentRepository interface {
+	// Upsert adds or replaces instruments (matched by exchange and symbol).
+	Upsert(ctx context.Context, instruments []model.Instrument) error
+
+	// List returns an exchange's instruments ordered by symbol.
+	List(ctx context.Context, exchange string) ([]model.Instrument, error)
+
+	// FreezeQuantities returns the freeze quantity of each of the symbols on the exchange.
+	// Symbols not in the master are missing from the result.
+	FreezeQuantities(ctx context.Context, exchange string, symbols []string) (map[string]int, error)
+}
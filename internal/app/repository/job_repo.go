@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrJobNotFound is returned when a job doesn't exist or belongs to another user.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobLockLost is returned when a worker updates a job it no longer holds: its
+// visibility timeout ran out and another worker claimed the job.
+var ErrJobLockLost = errors.New("job is no longer held by this worker")
+
+// ErrJobNotRetryable is returned when requeuing a job that isn't failed or dead.
+var ErrJobNotRetryable = errors.New("only failed or dead jobs can be retried")
+
+// JobRepository stores background jobs and hands them out to workers.
+type JobRepository interface {
+	// Create stores a new queued job.
+	Create(ctx context.Context, job *model.Job) error
+
+	// FindByID returns a job of the user.
+	FindByID(ctx context.Context, jobID uuid.UUID, userID uuid.UUID) (*model.Job, error)
+
+	// List returns jobs of every user, newest first, optionally only those with status.
+	List(ctx context.Context, status string, limit int) ([]model.Job, error)
+
+	// Claim takes the next job that is due, or running past its visibility timeout, skipping
+	// jobs other workers are claiming. It marks it running for worker until now+visibility
+	// and counts the attempt. It returns nil when there is no job to run.
+	Claim(ctx context.Context, worker string, visibility time.Duration) (*model.Job, error)
+
+	// ExtendLock pushes a running job's visibility timeout to now+visibility.
+	ExtendLock(ctx context.Context, jobID uuid.UUID, worker string, visibility time.Duration) error
+
+	// Finish records the end of an attempt: status succeeded, failed or dead with result or
+	// lastError, or queued again until runAt. It returns ErrJobLockLost unless worker still
+	// holds the job.
+	Finish(ctx context.Context, job *model.Job, worker string) error
+
+	// Requeue queues a failed or dead job again with a fresh set of attempts.
+	Requeue(ctx context.Context, jobID uuid.UUID) (*model.Job, error)
+}
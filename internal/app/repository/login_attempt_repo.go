@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+)
+
+// LoginAttemptStore persists failed login counters used for brute-force protection.
+// Implementations must make RecordFailure atomic, since parallel login requests
+// for the same key are exactly what an attacker produces.
+type LoginAttemptStore interface {
+	// Get returns the current state for key.
+	// Returns a zero-value attempt (FailedCount 0) if the key has no recorded failures.
+	Get(ctx context.Context, key string) (*model.LoginAttempt, error)
+
+	// RecordFailure increments the failure counter for key and returns the updated state.
+	// If the previous failure is older than now-window, the counter restarts at 1.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*model.LoginAttempt, error)
+
+	// LockUntil blocks logins for key until the given time.
+	LockUntil(ctx context.Context, key string, until time.Time) error
+
+	// Reset clears all failures and any lock for key.
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrOAuthStateNotFound is returned when a state doesn't exist, has expired or was already used.
+var ErrOAuthStateNotFound = errors.New("oauth state not found")
+
+// OAuthStateRepository stores server-side state for broker OAuth flows.
+// States are single-use: Consume deletes the row it returns.
+type OAuthStateRepository interface {
+	// Create stores a state (by its hash) for the user that started the flow.
+	Create(ctx context.Context, stateHash string, userID uuid.UUID, expiresAt time.Time) error
+
+	// Consume atomically deletes an unexpired state and returns the user it belongs to.
+	// Returns ErrOAuthStateNotFound if it doesn't exist, has expired or was consumed already.
+	Consume(ctx context.Context, stateHash string) (uuid.UUID, error)
+
+	// DeleteExpired removes states that expired at or before now and returns how many.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by OrganizationRepository implementations.
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrgMemberNotFound    = errors.New("organization member not found")
+	ErrOrgMemberExists      = errors.New("user is already a member of the organization")
+	ErrInvitationNotFound   = errors.New("invitation not found or already used")
+)
+
+// OrganizationRepository defines the interface for organization, membership and invitation data.
+type OrganizationRepository interface {
+	// Create stores a new organization and adds ownerID as its first owner, in a single transaction.
+	Create(ctx context.Context, org *model.Organization, ownerID uuid.UUID) error
+
+	// FindByID retrieves an organization. Returns ErrOrganizationNotFound if it doesn't exist.
+	FindByID(ctx context.Context, id uuid.UUID) (*model.Organization, error)
+
+	// FindAllByUser lists the organizations the user is a member of, with the user's permission set.
+	FindAllByUser(ctx context.Context, userID uuid.UUID) ([]model.Organization, error)
+
+	// Delete removes the organization together with its members, invitations and baskets.
+	Delete(ctx context.Context, id uuid.UUID) error
+
+	// GetMember returns the user's membership. Returns ErrOrgMemberNotFound if not a member.
+	GetMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*model.OrganizationMember, error)
+
+	// ListMembers lists all members of the organization including their email.
+	ListMembers(ctx context.Context, orgID uuid.UUID) ([]model.OrganizationMember, error)
+
+	// UpdateMemberPermission changes a member's permission. Returns ErrOrgMemberNotFound if not a member.
+	UpdateMemberPermission(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, permission string) error
+
+	// RemoveMember removes a member. Returns ErrOrgMemberNotFound if not a member.
+	RemoveMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error
+
+	// CreateInvitation stores a new invitation.
+	CreateInvitation(ctx context.Context, invitation *model.OrganizationInvitation) error
+
+	// ListPendingInvitations lists unaccepted, unexpired invitations of the organization.
+	ListPendingInvitations(ctx context.Context, orgID uuid.UUID) ([]model.OrganizationInvitation, error)
+
+	// FindInvitationByTokenHash retrieves an invitation. Returns ErrInvitationNotFound if none matches.
+	FindInvitationByTokenHash(ctx context.Context, tokenHash string) (*model.OrganizationInvitation, error)
+
+	// AcceptInvitation marks the invitation as accepted and adds the member, in a single transaction.
+	// Returns ErrInvitationNotFound if it was already accepted and ErrOrgMemberExists if the user is already a member.
+	AcceptInvitation(ctx context.Context, invitationID uuid.UUID, member *model.OrganizationMember) error
+
+	// DeleteInvitation removes an invitation. Returns ErrInvitationNotFound if it doesn't exist.
+	DeleteInvitation(ctx context.Context, orgID uuid.UUID, invitationID uuid.UUID) error
+}
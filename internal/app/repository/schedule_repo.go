@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrScheduleNotFound is returned when a schedule doesn't exist or belongs to another user.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ErrScheduleRunNotFound is returned when a run doesn't exist for the schedule.
+var ErrScheduleRunNotFound = errors.New("schedule run not found")
+
+// ScheduleRepository stores basket schedules and their runs.
+type ScheduleRepository interface {
+	// Create stores a new schedule.
+	Create(ctx context.Context, schedule *model.Schedule) error
+
+	// FindByID returns a schedule of the user.
+	FindByID(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) (*model.Schedule, error)
+
+	// ListByUser returns the user's schedules, oldest first.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]model.Schedule, error)
+
+	// Update saves a schedule's timing, options, flags and next run.
+	Update(ctx context.Context, schedule *model.Schedule) error
+
+	// Delete removes a schedule of the user together with its runs.
+	Delete(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) error
+
+	// ListDue returns the enabled schedules whose next run is at or before now, of every user.
+	ListDue(ctx context.Context, now time.Time) ([]model.Schedule, error)
+
+	// ClaimRun moves a schedule's next run from dueAt to nextRunAt. It returns false when
+	// another instance claimed the run first (next_run_at no longer equals dueAt).
+	ClaimRun(ctx context.Context, scheduleID uuid.UUID, dueAt time.Time, nextRunAt *time.Time) (bool, error)
+
+	// CreateRun stores a run.
+	CreateRun(ctx context.Context, run *model.ScheduleRun) error
+
+	// UpdateRun saves a run's status, job, execution, error and attempts.
+	UpdateRun(ctx context.Context, run *model.ScheduleRun) error
+
+	// ClaimRetry marks a missed or failed run as running and counts the attempt.
+	// It returns false when the run isn't missed or failed (e.g. a retry is already running).
+	ClaimRetry(ctx context.Context, runID uuid.UUID) (bool, error)
+
+	// FindRun returns a run of a schedule.
+	FindRun(ctx context.Context, scheduleID uuid.UUID, runID uuid.UUID) (*model.ScheduleRun, error)
+
+	// ListRuns returns a schedule's runs, newest first, optionally only those with status.
+	ListRuns(ctx context.Context, scheduleID uuid.UUID, status string) ([]model.ScheduleRun, error)
+}
@@ -5,16 +5,34 @@ import (
 
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 // Define standard errors for user repository operations
 var (
-	ErrUserNotFound    = errors.New("user not found")
-	ErrUserEmailExists = errors.New("user email already exists")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrUserEmailExists         = errors.New("user email already exists")
+	ErrRecoveryCodeInvalid     = errors.New("recovery code invalid or already used")
+	ErrTOTPStepAlreadyConsumed = errors.New("totp code already used")
 )
 
+// UserSearchFilter narrows down UserRepository.Search. Zero values mean "no filter".
+type UserSearchFilter struct {
+	Query    string // Matches part of the email, or an exact user ID
+	Role     string
+	Disabled *bool
+	Limit    int
+	Offset   int
+}
+
+// EncryptedTOTPSecret is a stored TOTP secret, as listed for re-encryption.
+type EncryptedTOTPSecret struct {
+	UserID     uuid.UUID
+	Ciphertext []byte
+}
+
 // UserRepository defines the interface for user data operations.
 type UserRepository interface {
 	// Save creates a new user record.
@@ -28,4 +46,47 @@ type UserRepository interface {
 	// FindByID retrieves a user by their unique ID.
 	// Returns ErrUserNotFound if no user is found.
 	FindByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+
+	// SetTOTPSecret stores a pending (not yet confirmed) encrypted TOTP secret for the user.
+	// Two-factor authentication stays disabled until EnableTOTP is called.
+	SetTOTPSecret(ctx context.Context, userID uuid.UUID, encryptedSecret []byte) error
+
+	// EnableTOTP marks the stored secret as confirmed and replaces the user's
+	// recovery codes with the given hashes, in a single transaction.
+	EnableTOTP(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error
+
+	// DisableTOTP removes the TOTP secret and all recovery codes for the user.
+	DisableTOTP(ctx context.Context, userID uuid.UUID) error
+
+	// ReplaceRecoveryCodes deletes all existing recovery codes and stores the new hashes.
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error
+
+	// ConsumeRecoveryCode marks an unused recovery code as used.
+	// Returns ErrRecoveryCodeInvalid if no matching unused code exists.
+	ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+
+	// ListTOTPSecrets returns up to limit stored TOTP secrets (pending or enabled) of users
+	// with an ID above afterID, in ID order, for walking all of them in batches.
+	ListTOTPSecrets(ctx context.Context, afterID uuid.UUID, limit int) ([]EncryptedTOTPSecret, error)
+
+	// ReplaceTOTPSecret swaps the user's encrypted TOTP secret for newCiphertext if it is
+	// still oldCiphertext, without touching whether TOTP is enabled. It returns false when
+	// the secret changed in the meantime (re-enrolled or disabled).
+	ReplaceTOTPSecret(ctx context.Context, userID uuid.UUID, oldCiphertext, newCiphertext []byte) (bool, error)
+
+	// ConsumeTOTPStep records the time step of an accepted TOTP code.
+	// Returns ErrTOTPStepAlreadyConsumed if that step (or a later one) was already used.
+	ConsumeTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+
+	// Search lists users matching filter (newest first) and the total number of matches.
+	Search(ctx context.Context, filter UserSearchFilter) ([]model.User, int, error)
+
+	// SetRole changes the user's role. Returns ErrUserNotFound if the user doesn't exist.
+	SetRole(ctx context.Context, id uuid.UUID, role string) error
+
+	// SetDisabled disables (non-nil time) or re-enables (nil) an account.
+	SetDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error
+
+	// RevokeSessions invalidates all tokens issued before revokedAt.
+	RevokeSessions(ctx context.Context, id uuid.UUID, revokedAt time.Time) error
 }
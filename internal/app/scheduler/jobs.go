@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/app/service"
+)
+
+// NewBrokerTokenExpiryJob flags broker tokens past their daily cutoff as expired, so
+// connection status is right even for users who haven't hit the broker since.
+func NewBrokerTokenExpiryJob(brokerRepo repository.BrokerRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "expire-broker-tokens",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			expired, err := brokerRepo.ExpireStaleTokens(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if expired > 0 {
+				log.Printf("Scheduler: Marked %d broker tokens as expired", expired)
+			}
+			return nil
+		},
+	}
+}
+
+// NewOAuthStateCleanupJob deletes OAuth states that expired without a callback.
+func NewOAuthStateCleanupJob(stateRepo repository.OAuthStateRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "cleanup-oauth-states",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			deleted, err := stateRepo.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if deleted > 0 {
+				log.Printf("Scheduler: Deleted %d expired OAuth states", deleted)
+			}
+			return nil
+		},
+	}
+}
+
+// NewBasketScheduleJob executes the basket schedules (SIPs) that are due. Runs are
+// claimed with a conditional update, so every instance can run this job.
+func NewBasketScheduleJob(scheduleService service.ScheduleService, interval time.Duration) Job {
+	return Job{
+		Name:     "run-basket-schedules",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			return scheduleService.RunDue(ctx, time.Now())
+		},
+	}
+}
+
+// NewQueuedExecutionReleaseJob marks executions of after-market orders as completed once the
+// market opens and the broker has sent them to the exchange.
+func NewQueuedExecutionReleaseJob(executionService service.ExecutionService, interval time.Duration) Job {
+	return Job{
+		Name:     "release-queued-executions",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			_, err := executionService.ReleaseQueuedExecutions(ctx, time.Now())
+			return err
+		},
+	}
+}
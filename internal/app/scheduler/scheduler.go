@@ -0,0 +1,59 @@
+// Package scheduler runs periodic background jobs inside the API process.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a task run at a fixed interval. Jobs must be safe to run on every
+// API instance at the same time (use idempotent, conditional updates).
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs until its context is cancelled.
+type Scheduler struct {
+	jobs []Job
+}
+
+// New creates a scheduler for the given jobs.
+func New(jobs ...Job) *Scheduler {
+	return &Scheduler{jobs: jobs}
+}
+
+// Start launches every job in its own goroutine: once right away, then every Interval.
+// It returns immediately; cancel ctx to stop the jobs.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	log.Printf("Scheduler: Starting job '%s' (every %s)", job.Name, job.Interval)
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, job)
+		select {
+		case <-ctx.Done():
+			log.Printf("Scheduler: Stopping job '%s'", job.Name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce runs a job with a timeout of one interval, so a hung run can't pile up.
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	runCtx, cancel := context.WithTimeout(ctx, job.Interval)
+	defer cancel()
+	if err := job.Run(runCtx); err != nil {
+		log.Printf("Scheduler: Job '%s' failed: %v", job.Name, err)
+	}
+}
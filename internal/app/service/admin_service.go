@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrCannotModifySelf prevents admins from disabling or demoting their own account by accident.
+var ErrCannotModifySelf = errors.New("admins cannot perform this action on their own account")
+
+// ErrInvalidInstrument is returned for instrument master entries that can't be stored.
+var ErrInvalidInstrument = errors.New("invalid instrument")
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// --- Interface Definition ---
+
+// AdminService defines user management operations for support staff and admins.
+// Callers are expected to have checked the actor's role (see middleware.RequireRole).
+type AdminService interface {
+	ListUsers(ctx context.Context, filter repository.UserSearchFilter) ([]model.User, int, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (*model.User, error)
+	// SetUserDisabled disables or re-enables an account. Disabling also ends all sessions.
+	SetUserDisabled(ctx context.Context, actorID uuid.UUID, userID uuid.UUID, disabled bool) error
+	// ForceLogout invalidates every token issued to the user so far.
+	ForceLogout(ctx context.Context, userID uuid.UUID) error
+	// SetUserRole changes a user's role and ends their sessions so the new role takes effect.
+	SetUserRole(ctx context.Context, actorID uuid.UUID, userID uuid.UUID, role string) error
+	// GetBrokerConnections lists a user's linked broker accounts (never any tokens).
+	GetBrokerConnections(ctx context.Context, userID uuid.UUID) ([]model.BrokerConnection, error)
+
+	// ListInstruments returns the instrument master of an exchange (NSE if empty).
+	ListInstruments(ctx context.Context, exchange string) ([]model.Instrument, error)
+	// UpsertInstruments adds or replaces instrument master entries, e.g. from the exchange's
+	// quantity freeze list. Either all are stored or none.
+	UpsertInstruments(ctx context.Context, instruments []model.Instrument) error
+}
+
+// --- Implementation ---
+
+type adminService struct {
+	userRepo       repository.UserRepository
+	brokerRepo     repository.BrokerRepository
+	instrumentRepo repository.InstrumentRepository
+}
+
+// NewAdminService creates a new admin service instance.
+func NewAdminService(userRepo repository.UserRepository, brokerRepo repository.BrokerRepository, instrumentRepo repository.InstrumentRepository) AdminService {
+	return &adminService{
+		userRepo:       userRepo,
+		brokerRepo:     brokerRepo,
+		instrumentRepo: instrumentRepo,
+	}
+}
+
+// ListUsers searches users with pagination defaults applied.
+func (s *adminService) ListUsers(ctx context.Context, filter repository.UserSearchFilter) ([]model.User, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if filter.Role != "" && !model.IsValidRole(filter.Role) {
+		return nil, 0, fmt.Errorf("invalid role filter '%s'", filter.Role)
+	}
+
+	users, total, err := s.userRepo.Search(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	return users, total, nil
+}
+
+// GetUser returns a single user.
+func (s *adminService) GetUser(ctx context.Context, userID uuid.UUID) (*model.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to retrieve user %s: %w", userID, err)
+	}
+	return user, nil
+}
+
+// SetUserDisabled disables or re-enables an account.
+func (s *adminService) SetUserDisabled(ctx context.Context, actorID uuid.UUID, userID uuid.UUID, disabled bool) error {
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now().UTC()
+		disabledAt = &now
+	}
+
+	log.Printf("Service: Admin %s setting disabled=%t for user %s", actorID, disabled, userID)
+	if err := s.userRepo.SetDisabled(ctx, userID, disabledAt); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update user %s: %w", userID, err)
+	}
+
+	// The middleware already rejects disabled users, but revoking keeps them
+	// logged out if the account is re-enabled later.
+	if disabled {
+		return s.ForceLogout(ctx, userID)
+	}
+	return nil
+}
+
+// ForceLogout revokes all sessions of the user.
+func (s *adminService) ForceLogout(ctx context.Context, userID uuid.UUID) error {
+	log.Printf("Service: Revoking all sessions for user %s", userID)
+	if err := s.userRepo.RevokeSessions(ctx, userID, time.Now().UTC()); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to revoke sessions for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// SetUserRole changes the role of a user.
+func (s *adminService) SetUserRole(ctx context.Context, actorID uuid.UUID, userID uuid.UUID, role string) error {
+	if !model.IsValidRole(role) {
+		return fmt.Errorf("invalid role '%s'", role)
+	}
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	log.Printf("Service: Setting role '%s' for user %s", role, userID)
+	if err := s.userRepo.SetRole(ctx, userID, role); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to set role for user %s: %w", userID, err)
+	}
+	// Existing tokens still carry the old role claim
+	return s.ForceLogout(ctx, userID)
+}
+
+// GetBrokerConnections lists the user's broker connections.
+func (s *adminService) GetBrokerConnections(ctx context.Context, userID uuid.UUID) ([]model.BrokerConnection, error) {
+	if _, err := s.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	connections, err := s.brokerRepo.ListConnections(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve broker connections for user %s: %w", userID, err)
+	}
+	return connections, nil
+}
+
+// ListInstruments implements AdminService.
+func (s *adminService) ListInstruments(ctx context.Context, exchange string) ([]model.Instrument, error) {
+	if exchange == "" {
+		exchange = model.ExchangeNSE
+	}
+	instruments, err := s.instrumentRepo.List(ctx, exchange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instruments: %w", err)
+	}
+	return instruments, nil
+}
+
+// UpsertInstruments implements AdminService.
+func (s *adminService) UpsertInstruments(ctx context.Context, instruments []model.Instrument) error {
+	if len(instruments) == 0 {
+		return fmt.Errorf("%w: no instruments given", ErrInvalidInstrument)
+	}
+	for i := range instruments {
+		in := &instruments[i]
+		in.Symbol = strings.ToUpper(strings.TrimSpace(in.Symbol))
+		if in.Exchange == "" {
+			in.Exchange = model.ExchangeNSE
+		}
+		if in.Symbol == "" {
+			return fmt.Errorf("%w: entry #%d has no symbol", ErrInvalidInstrument, i+1)
+		}
+		if in.FreezeQuantity <= 0 {
+			return fmt.Errorf("%w: %s needs a positive freeze quantity", ErrInvalidInstrument, in.Symbol)
+		}
+	}
+
+	log.Printf("Service: Updating %d instrument master entries", len(instruments))
+	if err := s.instrumentRepo.Upsert(ctx, instruments); err != nil {
+		return fmt.Errorf("failed to update instruments: %w", err)
+	}
+	return nil
+}
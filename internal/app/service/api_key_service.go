@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the API key service.
+var (
+	ErrInvalidAPIKey      = errors.New("invalid or expired api key")
+	ErrInvalidAPIKeyScope = errors.New("invalid api key scope")
+)
+
+const (
+	// apiKeyPrefix marks our keys so they are easy to recognise (and to find with secret scanners).
+	apiKeyPrefix = "ssk_"
+
+	defaultAPIKeyLifetime = 90 * 24 * time.Hour
+	maxAPIKeyLifetime     = 365 * 24 * time.Hour
+
+	// lastUsedUpdateInterval limits last_used_at writes to one per key per interval,
+	// so a busy CI job doesn't turn every request into a database write.
+	lastUsedUpdateInterval = time.Minute
+)
+
+// --- Interface Definition ---
+
+// APIKeyService defines the interface for personal API key management and authentication.
+type APIKeyService interface {
+	// CreateKey generates a new key. The returned plaintext key is only available here.
+	// A zero lifetime means the default (90 days).
+	CreateKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, lifetime time.Duration) (*model.APIKey, string, error)
+	ListKeys(ctx context.Context, userID uuid.UUID) ([]model.APIKey, error)
+	RevokeKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) error
+
+	// Authenticate validates a presented key and returns it if active.
+	// Returns ErrInvalidAPIKey for unknown, revoked or expired keys.
+	Authenticate(ctx context.Context, rawKey string) (*model.APIKey, error)
+}
+
+// --- Implementation ---
+
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+// NewAPIKeyService creates a new API key service instance.
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{
+		repo: repo,
+	}
+}
+
+// CreateKey validates input, generates the key material and stores the hash.
+func (s *apiKeyService) CreateKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, lifetime time.Duration) (*model.APIKey, string, error) {
+	// 1. Input Validation
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("api key name cannot be empty")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyScope)
+	}
+	for _, scope := range scopes {
+		if !isValidAPIKeyScope(scope) {
+			return nil, "", fmt.Errorf("%w: '%s' (valid scopes: %s)", ErrInvalidAPIKeyScope, scope, strings.Join(model.APIKeyScopes, ", "))
+		}
+	}
+	if lifetime == 0 {
+		lifetime = defaultAPIKeyLifetime
+	}
+	if lifetime < 0 || lifetime > maxAPIKeyLifetime {
+		return nil, "", fmt.Errorf("api key lifetime must be between 1 and 365 days")
+	}
+
+	// 2. Generate key material: ssk_<8 hex prefix>_<43 char secret>
+	prefix, rawKey, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	key := &model.APIKey{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: hashAPIKey(rawKey),
+		Scopes:     dedupeScopes(scopes),
+		ExpiresAt:  now.Add(lifetime),
+		CreatedAt:  now,
+	}
+
+	// 3. Persist
+	log.Printf("Service: Creating api key %s (%s) for user %s", key.ID, key.Prefix, userID)
+	if err := s.repo.Save(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("failed to save api key: %w", err)
+	}
+
+	return key, rawKey, nil
+}
+
+// ListKeys returns all keys of the user (including revoked and expired ones).
+func (s *apiKeyService) ListKeys(ctx context.Context, userID uuid.UUID) ([]model.APIKey, error) {
+	keys, err := s.repo.FindAllByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes one of the user's keys.
+func (s *apiKeyService) RevokeKey(ctx context.Context, userID uuid.UUID, keyID uuid.UUID) error {
+	log.Printf("Service: Revoking api key %s for user %s", keyID, userID)
+	if err := s.repo.Revoke(ctx, keyID, userID); err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to revoke api key %s: %w", keyID, err)
+	}
+	return nil
+}
+
+// Authenticate looks the key up by prefix and compares the hash in constant time.
+func (s *apiKeyService) Authenticate(ctx context.Context, rawKey string) (*model.APIKey, error) {
+	prefix, ok := apiKeyPrefixOf(rawKey)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.FindByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashAPIKey(rawKey))) != 1 {
+		log.Printf("Service: API key secret mismatch for prefix %s", prefix)
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now().UTC()
+	if !key.IsActive(now) {
+		log.Printf("Service: Rejected revoked or expired api key %s", key.Prefix)
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedUpdateInterval {
+		if err := s.repo.UpdateLastUsed(ctx, key.ID, now); err != nil {
+			// Not fatal for the request, just log it
+			log.Printf("Service: Failed to update last used time for api key %s: %v", key.ID, err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
+
+// IsAPIKey reports whether a bearer credential looks like one of our API keys rather than a JWT.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// generateAPIKey returns the visible prefix and the full key.
+func generateAPIKey() (string, string, error) {
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix := apiKeyPrefix + hex.EncodeToString(prefixBytes)
+	rawKey := prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return prefix, rawKey, nil
+}
+
+// apiKeyPrefixOf extracts "ssk_<hex>" from a full key.
+func apiKeyPrefixOf(rawKey string) (string, bool) {
+	if !IsAPIKey(rawKey) {
+		return "", false
+	}
+	idx := strings.Index(rawKey[len(apiKeyPrefix):], "_")
+	if idx <= 0 {
+		return "", false
+	}
+	return rawKey[:len(apiKeyPrefix)+idx], true
+}
+
+// hashAPIKey hashes the full key. Keys carry 256 bits of randomness, so a fast hash is fine.
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func isValidAPIKeyScope(scope string) bool {
+	for _, valid := range model.APIKeyScopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupeScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result
+}
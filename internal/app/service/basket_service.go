@@ -18,9 +18,13 @@ import (
 // --- Interface Definition ---
 
 // BasketService defines the interface for basket business logic operations.
+// Organization baskets require organization membership: viewers can read them,
+// editors (and above) can create, update and delete them.
 type BasketService interface {
-	CreateBasket(ctx context.Context, name string, stocks []model.Stock, userID uuid.UUID) (*model.Basket, error)
+	// CreateBasket creates a personal basket, or an organization basket if organizationID is set.
+	CreateBasket(ctx context.Context, name string, stocks []model.Stock, organizationID *uuid.UUID, userID uuid.UUID) (*model.Basket, error)
 	ListAllBaskets(ctx context.Context, userID uuid.UUID) ([]model.Basket, error)
+	ListOrganizationBaskets(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) ([]model.Basket, error)
 	GetBasketByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*model.Basket, error)
 	DeleteBasketByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
 	UpdateBasket(ctx context.Context, id uuid.UUID, name string, stocks []model.Stock, userID uuid.UUID) (*model.Basket, error)
@@ -31,19 +35,21 @@ type BasketService interface {
 // basketService implements the BasketService interface. Since it's an implementation hence the small b.
 // It's unexported (starts with lowercase 'b') as users should interact via the interface.
 type basketService struct {
-	repo repository.BasketRepository // Dependency on repository interface
+	repo    repository.BasketRepository       // Dependency on repository interface
+	orgRepo repository.OrganizationRepository // For permission checks on organization baskets
 }
 
 // NewBasketService creates a new service instance with its dependencies.
 // It returns the interface type.
-func NewBasketService(repo repository.BasketRepository) BasketService {
+func NewBasketService(repo repository.BasketRepository, orgRepo repository.OrganizationRepository) BasketService {
 	return &basketService{
-		repo: repo,
+		repo:    repo,
+		orgRepo: orgRepo,
 	}
 }
 
 // CreateBasket contains the business logic for creating a new basket.
-func (s *basketService) CreateBasket(ctx context.Context, name string, stocks []model.Stock, userID uuid.UUID) (*model.Basket, error) {
+func (s *basketService) CreateBasket(ctx context.Context, name string, stocks []model.Stock, organizationID *uuid.UUID, userID uuid.UUID) (*model.Basket, error) {
 	// 1. Input Validation (Could be more extensive business rules here)
 	if name == "" {
 		return nil, fmt.Errorf("basket name cannot be empty") // Return specific errors if needed
@@ -57,14 +63,20 @@ func (s *basketService) CreateBasket(ctx context.Context, name string, stocks []
 		}
 		// Add more business rules? e.g., check if stock symbol exists in a master list?
 	}
+	if organizationID != nil {
+		if _, err := requireOrgPermission(ctx, s.orgRepo, *organizationID, userID, model.OrgPermissionEditor); err != nil {
+			return nil, err
+		}
+	}
 
 	// 2. Create the domain model object
 	newBasket := model.Basket{
-		ID:        uuid.New(), // Service is responsible for generating ID
-		Name:      name,
-		Stocks:    stocks,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+		ID:             uuid.New(), // Service is responsible for generating ID
+		Name:           name,
+		Stocks:         stocks,
+		OrganizationID: organizationID,
+		CreatedAt:      time.Now().UTC(),
+		UpdatedAt:      time.Now().UTC(),
 	}
 
 	// 3. Persist using the repository
@@ -101,6 +113,44 @@ func (s *basketService) ListAllBaskets(ctx context.Context, userID uuid.UUID) ([
 	return baskets, nil
 }
 
+// ListOrganizationBaskets retrieves the baskets of an organization the user is a member of.
+func (s *basketService) ListOrganizationBaskets(ctx context.Context, organizationID uuid.UUID, userID uuid.UUID) ([]model.Basket, error) {
+	if _, err := requireOrgPermission(ctx, s.orgRepo, organizationID, userID, model.OrgPermissionViewer); err != nil {
+		return nil, err
+	}
+
+	baskets, err := s.repo.FindAllByOrganization(ctx, organizationID, userID)
+	if err != nil {
+		log.Printf("Service: Error finding baskets of organization %s: %v", organizationID, err)
+		return nil, fmt.Errorf("failed to retrieve baskets: %w", err)
+	}
+	return baskets, nil
+}
+
+// authorizeBasket loads a basket the user can see and, for organization baskets,
+// checks that the user's permission is at least required. Personal baskets are
+// only visible to their owner, who may do anything with them.
+func (s *basketService) authorizeBasket(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, required string) (*model.Basket, error) {
+	return authorizeBasketAccess(ctx, s.repo, s.orgRepo, basketID, userID, required)
+}
+
+// authorizeBasketAccess is authorizeBasket for services other than basketService.
+func authorizeBasketAccess(ctx context.Context, basketRepo repository.BasketRepository, orgRepo repository.OrganizationRepository, basketID uuid.UUID, userID uuid.UUID, required string) (*model.Basket, error) {
+	basket, err := basketRepo.FindByID(ctx, basketID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if basket.OrganizationID != nil {
+		if _, err := requireOrgPermission(ctx, orgRepo, *basket.OrganizationID, userID, required); err != nil {
+			if errors.Is(err, repository.ErrOrganizationNotFound) {
+				return nil, repository.ErrBasketNotFound // Left the organization in the meantime
+			}
+			return nil, err
+		}
+	}
+	return basket, nil
+}
+
 // GetBasketByID retrieves a single basket. (Example for later)
 func (s *basketService) GetBasketByID(ctx context.Context, basketID uuid.UUID, userID uuid.UUID) (*model.Basket, error) {
 	log.Printf("Service: Attempting to find basket by ID %s for user %s", basketID, userID)
@@ -120,10 +170,15 @@ func (s *basketService) GetBasketByID(ctx context.Context, basketID uuid.UUID, u
 func (s *basketService) DeleteBasketByID(ctx context.Context, basketID uuid.UUID, userID uuid.UUID) error {
 	log.Printf("Service: Attempting to delete basket by ID %s", basketID)
 
-	// Optional: You might want to check if it exists first using FindByID,
-	// but the repository DeleteByID check for RowsAffected handles the NotFound case.
+	// Viewers of an organization basket can see it but not delete it.
 	// Depending on requirements, you might add other business logic here
 	// before deletion (e.g., checking if the basket is 'active').
+	if _, err := s.authorizeBasket(ctx, basketID, userID, model.OrgPermissionEditor); err != nil {
+		if errors.Is(err, repository.ErrBasketNotFound) || errors.Is(err, ErrOrgPermissionDenied) {
+			return err
+		}
+		return fmt.Errorf("failed to retrieve basket %s: %w", basketID, err)
+	}
 
 	err := s.repo.DeleteByID(ctx, basketID, userID) // Call the repository method
 	if err != nil {
@@ -156,26 +211,28 @@ func (s *basketService) UpdateBasket(ctx context.Context, basketID uuid.UUID, na
 		}
 	}
 
-	// 2. Optional but recommended: Check if basket exists first using FindByID
-	// This retrieves CreatedAt and confirms existence before complex update.
-	// existingBasket, err := s.repo.FindByID(ctx, basketID, userID)
-	// if err != nil {
-	// 	log.Printf("Service: Basket %s not found for update: %v", basketID, err)
-	// 	// Pass up NotFound or wrap other errors
-	// 	return nil, err // Repo FindByID already wraps non-NotFound errors
-	// }
+	// 2. Check the basket exists and the user may edit it (viewers of organization baskets can't)
+	existingBasket, err := s.authorizeBasket(ctx, basketID, userID, model.OrgPermissionEditor)
+	if err != nil {
+		log.Printf("Service: Basket %s not editable by user %s: %v", basketID, userID, err)
+		if errors.Is(err, repository.ErrBasketNotFound) || errors.Is(err, ErrOrgPermissionDenied) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to retrieve basket %s: %w", basketID, err)
+	}
 
 	// 3. Prepare the updated model object
 	updatedBasket := model.Basket{
-		ID:     basketID, // Use the ID from the path parameter
-		Name:   name,     // Use the new name
-		Stocks: stocks,   // Use the new list of stocks
+		ID:             basketID,                      // Use the ID from the path parameter
+		Name:           name,                          // Use the new name
+		Stocks:         stocks,                        // Use the new list of stocks
+		OrganizationID: existingBasket.OrganizationID, // Ownership doesn't change on update
 		//CreatedAt: existingBasket.CreatedAt, // Preserve original creation time
 		// UpdatedAt will be set by the database trigger via repo.Update
 	}
 
 	// 4. Call the repository to persist changes
-	err := s.repo.Update(ctx, &updatedBasket, userID)
+	err = s.repo.Update(ctx, &updatedBasket, userID)
 	if err != nil {
 		log.Printf("Service: Error updating basket ID %s in repository: %v", basketID, err)
 		// Pass up specific known errors like NotFound (though caught above ideally)
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	kiteadapter "github.com/AMANSRI99/StockSaaS/internal/adapter/broker/kiteconnect"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/common/cacheutil"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnsupportedBroker is returned for broker names we don't integrate with.
+var ErrUnsupportedBroker = errors.New("unsupported broker")
+
+// --- Interface Definition ---
+
+// BrokerService manages a user's linked broker accounts.
+type BrokerService interface {
+	// ListConnections returns the user's linked broker accounts and whether their tokens are still valid.
+	ListConnections(ctx context.Context, userID uuid.UUID) ([]model.BrokerConnection, error)
+	// Disconnect logs the session out at the broker and deletes the stored credentials.
+	Disconnect(ctx context.Context, userID uuid.UUID, broker string) error
+	// GetProfile returns the linked Kite account's profile (cached for a while).
+	// Returns a BrokerReauthRequiredError if there is no usable Kite session.
+	GetProfile(ctx context.Context, userID uuid.UUID) (*model.BrokerProfile, error)
+	// GetMargins returns the Kite account's funds and margins (cached briefly unless refresh is set).
+	// Returns a BrokerReauthRequiredError if there is no usable Kite session.
+	GetMargins(ctx context.Context, userID uuid.UUID, refresh bool) (*model.BrokerMargins, error)
+}
+
+const (
+	brokerProfileCacheTTL = 15 * time.Minute
+	brokerMarginsCacheTTL = 30 * time.Second // Funds change with every trade
+)
+
+// --- Implementation ---
+
+// cachedBrokerData is a cache entry tagged with the token it was fetched with,
+// so reconnecting (possibly a different Kite account) bypasses the cache.
+type cachedBrokerData[T any] struct {
+	tokenHash [sha256.Size]byte
+	value     T
+}
+
+type brokerService struct {
+	kiteAdapter  *kiteadapter.Adapter
+	brokerRepo   repository.BrokerRepository
+	profileCache *cacheutil.TTLCache[uuid.UUID, cachedBrokerData[model.BrokerProfile]]
+	marginsCache *cacheutil.TTLCache[uuid.UUID, cachedBrokerData[model.BrokerMargins]]
+}
+
+// NewBrokerService creates a new BrokerService instance.
+func NewBrokerService(ka *kiteadapter.Adapter, br repository.BrokerRepository) BrokerService {
+	return &brokerService{
+		kiteAdapter:  ka,
+		brokerRepo:   br,
+		profileCache: cacheutil.NewTTLCache[uuid.UUID, cachedBrokerData[model.BrokerProfile]](brokerProfileCacheTTL),
+		marginsCache: cacheutil.NewTTLCache[uuid.UUID, cachedBrokerData[model.BrokerMargins]](brokerMarginsCacheTTL),
+	}
+}
+
+// ListConnections implements BrokerService.
+func (s *brokerService) ListConnections(ctx context.Context, userID uuid.UUID) ([]model.BrokerConnection, error) {
+	connections, err := s.brokerRepo.ListConnections(ctx, userID)
+	if err != nil {
+		log.Printf("Service: Failed to list broker connections for user %s: %v", userID, err)
+		return nil, fmt.Errorf("could not retrieve broker connections: %w", err)
+	}
+	return connections, nil
+}
+
+// Disconnect implements BrokerService.
+func (s *brokerService) Disconnect(ctx context.Context, userID uuid.UUID, broker string) error {
+	if broker != model.BrokerKite {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedBroker, broker)
+	}
+	log.Printf("Service: Disconnecting %s for user %s", broker, userID)
+
+	// 1. Log the session out at Kite. Best effort: the user asked to unlink, so the
+	// row goes either way, and Kite drops every token at the next daily cutoff anyway.
+	accessToken, err := s.brokerRepo.GetKiteAccessToken(ctx, userID)
+	switch {
+	case errors.Is(err, repository.ErrBrokerCredentialsNotFound):
+		return err
+	case errors.Is(err, repository.ErrBrokerTokenExpired):
+		log.Printf("Service: Kite token for user %s already expired, nothing to log out", userID)
+	case err != nil:
+		log.Printf("Service: Could not read Kite token for user %s, deleting credentials without logging out at Kite: %v", userID, err)
+	default:
+		if err := s.kiteAdapter.InvalidateAccessToken(ctx, string(accessToken)); err != nil {
+			if kiteadapter.IsTokenError(err) {
+				log.Printf("Service: Kite token for user %s was already invalid", userID)
+			} else {
+				log.Printf("Service: Warning: failed to invalidate Kite session for user %s: %v", userID, err)
+			}
+		}
+	}
+
+	// 2. Delete the stored credentials
+	if err := s.brokerRepo.DeleteCredentials(ctx, userID, broker); err != nil {
+		if errors.Is(err, repository.ErrBrokerCredentialsNotFound) {
+			return err // Disconnected concurrently
+		}
+		log.Printf("Service: Failed to delete %s credentials for user %s: %v", broker, userID, err)
+		return fmt.Errorf("could not delete broker credentials: %w", err)
+	}
+
+	s.profileCache.Delete(userID)
+	s.marginsCache.Delete(userID)
+	log.Printf("Service: %s disconnected for user %s", broker, userID)
+	return nil
+}
+
+// GetProfile implements BrokerService.
+func (s *brokerService) GetProfile(ctx context.Context, userID uuid.UUID) (*model.BrokerProfile, error) {
+	// Always load the token: it checks the session is still valid and keys the cache
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokenHash := sha256.Sum256([]byte(accessToken))
+	if cached, ok := s.profileCache.Get(userID); ok && cached.tokenHash == tokenHash {
+		return &cached.value, nil
+	}
+
+	log.Printf("Service: Fetching Kite profile for user %s", userID)
+	profile, err := s.kiteAdapter.GetUserProfile(ctx, accessToken)
+	if err != nil {
+		log.Printf("Service: Failed to fetch Kite profile for user %s: %v", userID, err)
+		return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+	s.profileCache.Set(userID, cachedBrokerData[model.BrokerProfile]{tokenHash: tokenHash, value: profile})
+	return &profile, nil
+}
+
+// GetMargins implements BrokerService.
+func (s *brokerService) GetMargins(ctx context.Context, userID uuid.UUID, refresh bool) (*model.BrokerMargins, error) {
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokenHash := sha256.Sum256([]byte(accessToken))
+	if !refresh {
+		if cached, ok := s.marginsCache.Get(userID); ok && cached.tokenHash == tokenHash {
+			return &cached.value, nil
+		}
+	}
+
+	log.Printf("Service: Fetching Kite margins for user %s", userID)
+	margins, err := s.kiteAdapter.GetUserMargins(ctx, accessToken)
+	if err != nil {
+		log.Printf("Service: Failed to fetch Kite margins for user %s: %v", userID, err)
+		return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+	margins.FetchedAt = time.Now().UTC()
+	s.marginsCache.Set(userID, cachedBrokerData[model.BrokerMargins]{tokenHash: tokenHash, value: margins})
+	return &margins, nil
+}
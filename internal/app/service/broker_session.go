@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	kiteadapter "github.com/AMANSRI99/StockSaaS/internal/adapter/broker/kiteconnect"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrBrokerReauthRequired matches (errors.Is) every BrokerReauthRequiredError.
+var ErrBrokerReauthRequired = errors.New("broker re-authentication required")
+
+// Reasons for BrokerReauthRequiredError.
+const (
+	ReauthReasonNotConnected = "not_connected" // No credentials stored
+	ReauthReasonExpired      = "expired"       // Token past its daily expiry or rejected by the broker
+)
+
+// BrokerReauthRequiredError is returned by any service that needs the user's broker session
+// when there is no usable one. The user has to (re)connect the broker account.
+type BrokerReauthRequiredError struct {
+	Broker string
+	Reason string // ReauthReasonNotConnected or ReauthReasonExpired
+}
+
+func (e *BrokerReauthRequiredError) Error() string {
+	return fmt.Sprintf("%s re-authentication required (%s)", e.Broker, e.Reason)
+}
+
+// Is makes errors.Is(err, ErrBrokerReauthRequired) work.
+func (e *BrokerReauthRequiredError) Is(target error) bool {
+	return target == ErrBrokerReauthRequired
+}
+
+// kiteAccessToken loads the user's Kite access token, turning missing or expired
+// credentials into a BrokerReauthRequiredError.
+func kiteAccessToken(ctx context.Context, brokerRepo repository.BrokerRepository, userID uuid.UUID) (string, error) {
+	accessToken, err := brokerRepo.GetKiteAccessToken(ctx, userID)
+	switch {
+	case errors.Is(err, repository.ErrBrokerCredentialsNotFound):
+		return "", &BrokerReauthRequiredError{Broker: model.BrokerKite, Reason: ReauthReasonNotConnected}
+	case errors.Is(err, repository.ErrBrokerTokenExpired):
+		return "", &BrokerReauthRequiredError{Broker: model.BrokerKite, Reason: ReauthReasonExpired}
+	case err != nil:
+		return "", fmt.Errorf("failed to load broker credentials: %w", err)
+	}
+	return string(accessToken), nil
+}
+
+// handleKiteError inspects an error from a Kite call made with the user's token. If Kite
+// rejected the token, the credentials are marked expired and a BrokerReauthRequiredError
+// is returned; other errors are returned unchanged.
+func handleKiteError(ctx context.Context, brokerRepo repository.BrokerRepository, userID uuid.UUID, err error) error {
+	if !kiteadapter.IsTokenError(err) {
+		return err
+	}
+	log.Printf("Service: Kite rejected the access token for user %s, marking it expired", userID)
+	if markErr := brokerRepo.MarkTokenExpired(ctx, userID, model.BrokerKite); markErr != nil && !errors.Is(markErr, repository.ErrBrokerCredentialsNotFound) {
+		log.Printf("Service: Failed to mark Kite token expired for user %s: %v", userID, markErr)
+	}
+	return &BrokerReauthRequiredError{Broker: model.BrokerKite, Reason: ReauthReasonExpired}
+}
@@ -0,0 +1,1434 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	kiteadapter "github.com/AMANSRI99/StockSaaS/internal/adapter/broker/kiteconnect"
+	"github.com/AMANSRI99/StockSaaS/internal/app/charges"
+	"github.com/AMANSRI99/StockSaaS/internal/app/market"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the execution service.
+var (
+	ErrEmptyBasket              = errors.New("basket has no stocks to execute")
+	ErrInvalidExecutionOptions  = errors.New("invalid execution options")
+	ErrInvalidOrderModification = errors.New("invalid order modification")
+	ErrExecutionOwnerOnly       = errors.New("only the user who ran the execution can change its orders")
+	ErrOrderNotOpen             = errors.New("order is not open")
+	ErrBrokerRejectedChange     = errors.New("broker refused the order change")
+	ErrNothingToExit            = errors.New("no holdings of the basket's stocks to sell")
+	// ErrPlacementUnresolved is returned when placing orders failed in a way that may have
+	// placed them anyway. They stay pending and the execution keeps placing, so running
+	// the execution again (ExecuteWithID) finds out and finishes it.
+	ErrPlacementUnresolved = errors.New("orders may or may not have reached the broker")
+)
+
+// errSessionExpired is recorded on orders left unsent after Kite rejected the access token.
+var errSessionExpired = errors.New("not sent: broker session expired")
+
+// InsufficientMarginError is returned by Execute when the margin check fails and the
+// margin policy is "block". No order has been placed.
+type InsufficientMarginError struct {
+	Check *model.MarginCheck
+}
+
+func (e *InsufficientMarginError) Error() string {
+	return fmt.Sprintf("insufficient margin: %.2f required, %.2f available", e.Check.RequiredMargin, e.Check.AvailableMargin)
+}
+
+// MarketClosedError is returned by Execute and Exit outside market hours: regular orders
+// would be rejected by the exchange. No order has been placed.
+type MarketClosedError struct {
+	Session  string    // The session in progress (market.SessionClosed, SessionPreOpen...)
+	NextOpen time.Time // When orders can be placed again; zero if unknown
+}
+
+func (e *MarketClosedError) Error() string {
+	if e.NextOpen.IsZero() {
+		return "market is closed"
+	}
+	return fmt.Sprintf("market is closed, it opens at %s", e.NextOpen.In(market.IST).Format("2006-01-02 15:04 MST"))
+}
+
+// --- Interface Definition ---
+
+// ExecutionService places a basket's orders at the user's broker.
+// Baskets the user can't see are reported as repository.ErrBasketNotFound, missing
+// broker sessions as a BrokerReauthRequiredError.
+type ExecutionService interface {
+	// CheckMargin compares the margin the basket needs with the funds available at the broker.
+	CheckMargin(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.MarginCheck, error)
+	// Execute runs the margin check and places a BUY order for every stock in the basket.
+	// Orders the broker rejects are recorded on the returned execution, not returned as errors.
+	// Outside market hours it places after-market orders if opts.AMO is set, otherwise it
+	// returns a MarketClosedError. If an order's outcome is unknown it returns
+	// ErrPlacementUnresolved, leaving the execution placing; only ExecuteWithID finishes it.
+	Execute(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.Execution, error)
+	// Preview returns what Execute would send to the broker, with estimated prices and charges,
+	// without placing anything.
+	Preview(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.ExecutionPreview, error)
+	// Exit sells the basket: a SELL order per stock for the quantity held (or a percentage of
+	// it), recorded as an execution of the basket like Execute.
+	Exit(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.Execution, error)
+	// ExecuteWithID is Execute with the execution's ID chosen by the caller, for jobs that may
+	// run more than once: if the execution already exists (an earlier attempt got that far) no
+	// order is placed twice. A finished execution is returned as it is; one interrupted while
+	// placing its orders, or whose orders' outcome was unknown, places the rest (or fails them
+	// if that's no longer possible).
+	ExecuteWithID(ctx context.Context, executionID uuid.UUID, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.Execution, error)
+	// ExitWithID is Exit with the execution's ID chosen by the caller, like ExecuteWithID.
+	ExitWithID(ctx context.Context, executionID uuid.UUID, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.Execution, error)
+	// PreviewExit returns what Exit would send to the broker without placing anything.
+	PreviewExit(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.ExecutionPreview, error)
+	// GetExecution returns an execution with its orders.
+	GetExecution(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) (*model.Execution, error)
+	// RefreshFills fetches the fills of an execution's orders from the broker, records them
+	// and returns the execution. An order split into child orders gets their total filled
+	// quantity and volume-weighted average price. Only the user who ran the execution can
+	// (the orders are in their broker account); Kite only reports the current day's orders.
+	RefreshFills(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) (*model.Execution, error)
+	// ListBasketExecutions returns a basket's executions, newest first.
+	ListBasketExecutions(ctx context.Context, basketID uuid.UUID, userID uuid.UUID) ([]model.Execution, error)
+
+	// ModifyOrder changes the quantity, limit price or trigger price of an open order.
+	// Only the user who ran the execution can change its orders (they are in their broker account).
+	ModifyOrder(ctx context.Context, executionID uuid.UUID, orderID uuid.UUID, userID uuid.UUID, change model.OrderModification) (*model.ExecutionOrder, error)
+	// CancelOrder cancels an open order. expectedVersion is optional.
+	CancelOrder(ctx context.Context, executionID uuid.UUID, orderID uuid.UUID, userID uuid.UUID, expectedVersion *int) (*model.ExecutionOrder, error)
+	// CancelOpenOrders cancels every open order of an execution and reports the outcome per order.
+	CancelOpenOrders(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) ([]model.OrderActionResult, error)
+	// ListOrderEvents returns the audit trail of changes to an execution's orders.
+	ListOrderEvents(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) ([]model.OrderEvent, error)
+
+	// ReleaseQueuedExecutions marks executions queued for open as completed once the market
+	// has opened after them. Called by the scheduler; returns how many were released.
+	ReleaseQueuedExecutions(ctx context.Context, now time.Time) (int64, error)
+}
+
+// --- Implementation ---
+
+type executionService struct {
+	executionRepo  repository.ExecutionRepository
+	basketRepo     repository.BasketRepository
+	orgRepo        repository.OrganizationRepository
+	brokerRepo     repository.BrokerRepository
+	instrumentRepo repository.InstrumentRepository
+	brokerService  BrokerService
+	kiteAdapter    *kiteadapter.Adapter
+	charges        *charges.Calculator
+	calendar       *market.Calendar
+	cfg            config.AppConfig
+}
+
+// NewExecutionService creates a new ExecutionService instance.
+func NewExecutionService(
+	er repository.ExecutionRepository,
+	br repository.BasketRepository,
+	or repository.OrganizationRepository,
+	bkr repository.BrokerRepository,
+	ir repository.InstrumentRepository,
+	bs BrokerService,
+	ka *kiteadapter.Adapter,
+	calc *charges.Calculator,
+	cal *market.Calendar,
+	cfg config.AppConfig,
+) ExecutionService {
+	return &executionService{
+		executionRepo:  er,
+		basketRepo:     br,
+		orgRepo:        or,
+		brokerRepo:     bkr,
+		instrumentRepo: ir,
+		brokerService:  bs,
+		kiteAdapter:    ka,
+		charges:        calc,
+		calendar:       cal,
+		cfg:            cfg,
+	}
+}
+
+// CheckMargin implements ExecutionService.
+func (s *executionService) CheckMargin(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.MarginCheck, error) {
+	// Looking at the numbers places nothing, so any member can do it
+	basket, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, basketID, userID, model.OrgPermissionViewer)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := buildOrderPlan(basket.Stocks, model.TransactionBuy, opts)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.checkMargin(ctx, userID, accessToken, orders)
+}
+
+// executionPlan is everything decided before any order is placed. Execute and Exit place
+// it, Preview and PreviewExit describe it; all build it with prepareExecution, so a preview
+// can't diverge from what executing would do.
+type executionPlan struct {
+	basket          *model.Basket
+	transactionType string
+	variety         string
+	accessToken     string
+	orders          []model.OrderParams
+	marginCheck     *model.MarginCheck
+}
+
+// prepareExecution authorizes the user, builds the basket's orders and runs the pre-trade
+// margin check. With exit set the orders are SELL orders sized from what the user holds.
+// Every order gets the given variety (regular or AMO), and orders above their freeze
+// quantity are split.
+func (s *executionService) prepareExecution(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions, exit *model.ExitOptions, variety string) (*executionPlan, error) {
+	// 1. Authorize and build the orders
+	basket, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, basketID, userID, model.OrgPermissionExecutor)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	transactionType := model.TransactionBuy
+	stocks := basket.Stocks
+	if exit != nil {
+		transactionType = model.TransactionSell
+		if stocks, err = s.exitStocks(ctx, basket, userID, accessToken, *exit); err != nil {
+			return nil, err
+		}
+	}
+	orders, err := buildOrderPlan(stocks, transactionType, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Variety = variety
+	}
+	if err := s.applyFreezeLimits(ctx, orders, opts.Iceberg); err != nil {
+		return nil, err
+	}
+
+	// 2. Pre-trade margin check: placing orders the account can't pay for just
+	// produces a pile of rejections
+	check, err := s.checkMargin(ctx, userID, accessToken, orders)
+	if err != nil {
+		return nil, err
+	}
+	return &executionPlan{
+		basket:          basket,
+		transactionType: transactionType,
+		variety:         variety,
+		accessToken:     accessToken,
+		orders:          orders,
+		marginCheck:     check,
+	}, nil
+}
+
+// exitStocks returns the quantity of each basket stock an exit sells: what the user holds at
+// the broker, limited to what this basket's executions bought unless the source is holdings,
+// scaled by the exit percentage and rounded down. Stocks with nothing to sell are left out.
+func (s *executionService) exitStocks(ctx context.Context, basket *model.Basket, userID uuid.UUID, accessToken string, opts model.ExitOptions) ([]model.Stock, error) {
+	// 1. Validate
+	percentage := opts.Percentage
+	if percentage == 0 {
+		percentage = 100
+	}
+	if percentage < 0 || percentage > 100 {
+		return nil, fmt.Errorf("%w: percentage must be above 0 and at most 100", ErrInvalidExecutionOptions)
+	}
+	source := opts.Source
+	if source == "" {
+		source = model.ExitSourceExecutions
+	}
+	if source != model.ExitSourceExecutions && source != model.ExitSourceHoldings {
+		return nil, fmt.Errorf("%w: source must be %s or %s", ErrInvalidExecutionOptions, model.ExitSourceExecutions, model.ExitSourceHoldings)
+	}
+	if opts.Product != "" && opts.Product != model.ProductCNC {
+		// Intraday positions aren't holdings; they are squared off by the broker
+		return nil, fmt.Errorf("%w: an exit sells delivery holdings, product must be %s", ErrInvalidExecutionOptions, model.ProductCNC)
+	}
+	if len(basket.Stocks) == 0 {
+		return nil, ErrEmptyBasket
+	}
+
+	// 2. What is held
+	held, err := basketHoldings(ctx, s.kiteAdapter, s.executionRepo, s.brokerRepo, basket, userID, accessToken, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Size each sell
+	stocks := make([]model.Stock, 0, len(basket.Stocks))
+	for _, stock := range basket.Stocks {
+		quantity := int(math.Floor(float64(held[stock.Symbol]) * percentage / 100))
+		if quantity <= 0 {
+			continue
+		}
+		stock.Quantity = quantity
+		stocks = append(stocks, stock)
+	}
+	if len(stocks) == 0 {
+		return nil, ErrNothingToExit
+	}
+	return stocks, nil
+}
+
+// basketHoldings returns how much of each basket stock the user holds at the broker, limited
+// to what this basket's executions bought when source is executions. Holdings are always
+// consulted: selling more than is held would be rejected, and shares bought by the basket
+// may have been sold elsewhere since.
+func basketHoldings(
+	ctx context.Context,
+	ka *kiteadapter.Adapter,
+	er repository.ExecutionRepository,
+	bkr repository.BrokerRepository,
+	basket *model.Basket,
+	userID uuid.UUID,
+	accessToken string,
+	source string,
+) (map[string]int, error) {
+	held, err := ka.GetHoldings(ctx, accessToken)
+	if err != nil {
+		log.Printf("Service: Failed to fetch holdings of user %s for basket %s: %v", userID, basket.ID, err)
+		return nil, handleKiteError(ctx, bkr, userID, err)
+	}
+	var bought map[string]int
+	if source == model.ExitSourceExecutions {
+		if bought, err = er.NetPlacedQuantities(ctx, basket.ID, userID); err != nil {
+			log.Printf("Service: Failed to sum executions of basket %s for user %s: %v", basket.ID, userID, err)
+			return nil, fmt.Errorf("could not determine quantities held: %w", err)
+		}
+	}
+
+	quantities := make(map[string]int, len(basket.Stocks))
+	for _, stock := range basket.Stocks {
+		quantity := held[stock.Symbol]
+		if bought != nil && bought[stock.Symbol] < quantity {
+			quantity = bought[stock.Symbol]
+		}
+		if quantity > 0 {
+			quantities[stock.Symbol] = quantity
+		}
+	}
+	return quantities, nil
+}
+
+// applyFreezeLimits splits the orders above their instrument's freeze quantity, which the
+// exchange would reject. Instruments missing from the instrument master aren't split.
+func (s *executionService) applyFreezeLimits(ctx context.Context, orders []model.OrderParams, iceberg bool) error {
+	symbols := make([]string, 0, len(orders))
+	for _, o := range orders {
+		symbols = append(symbols, o.Symbol)
+	}
+	freezeQuantities, err := s.instrumentRepo.FreezeQuantities(ctx, model.ExchangeNSE, symbols)
+	if err != nil {
+		log.Printf("Service: Failed to load freeze quantities: %v", err)
+		return fmt.Errorf("could not load freeze quantities: %w", err)
+	}
+	for i := range orders {
+		sliceOrder(&orders[i], freezeQuantities[orders[i].Symbol], iceberg)
+	}
+	return nil
+}
+
+// sliceOrder splits an order above the freeze quantity: into a Kite iceberg order when asked
+// for and possible (regular orders of at most MaxIcebergLegs legs), otherwise into child
+// orders of the freeze quantity, the last one taking the remainder.
+func sliceOrder(order *model.OrderParams, freezeQuantity int, iceberg bool) {
+	if freezeQuantity <= 0 || order.Quantity <= freezeQuantity {
+		return
+	}
+	parts := (order.Quantity + freezeQuantity - 1) / freezeQuantity
+	if iceberg && order.Variety == model.VarietyRegular && parts <= model.MaxIcebergLegs {
+		order.Variety = model.VarietyIceberg
+		order.IcebergLegs = parts
+		order.IcebergQuantity = (order.Quantity + parts - 1) / parts
+		return
+	}
+	order.SliceQuantities = make([]int, 0, parts)
+	for remaining := order.Quantity; remaining > 0; remaining -= freezeQuantity {
+		order.SliceQuantities = append(order.SliceQuantities, min(remaining, freezeQuantity))
+	}
+}
+
+// marginBlocks reports whether the margin policy refuses to execute after this check.
+func (s *executionService) marginBlocks(check *model.MarginCheck) bool {
+	return !check.Sufficient && s.cfg.Execution.MarginPolicy == "block"
+}
+
+// Execute implements ExecutionService.
+func (s *executionService) Execute(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.Execution, error) {
+	return s.executeOrExit(ctx, uuid.New(), basketID, userID, opts, nil)
+}
+
+// ExecuteWithID implements ExecutionService.
+func (s *executionService) ExecuteWithID(ctx context.Context, executionID uuid.UUID, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.Execution, error) {
+	if existing, err := s.existingExecution(ctx, executionID, userID); existing != nil || err != nil {
+		return existing, err
+	}
+	return s.executeOrExit(ctx, executionID, basketID, userID, opts, nil)
+}
+
+// Exit implements ExecutionService.
+func (s *executionService) Exit(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.Execution, error) {
+	return s.executeOrExit(ctx, uuid.New(), basketID, userID, opts.ExecutionOptions, &opts)
+}
+
+// ExitWithID implements ExecutionService.
+func (s *executionService) ExitWithID(ctx context.Context, executionID uuid.UUID, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.Execution, error) {
+	if existing, err := s.existingExecution(ctx, executionID, userID); existing != nil || err != nil {
+		return existing, err
+	}
+	return s.executeOrExit(ctx, executionID, basketID, userID, opts.ExecutionOptions, &opts)
+}
+
+// executeOrExit prepares and places a basket's BUY orders, or its SELL orders when exit is set.
+func (s *executionService) executeOrExit(ctx context.Context, executionID uuid.UUID, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions, exit *model.ExitOptions) (*model.Execution, error) {
+	variety, err := s.orderVariety(time.Now(), opts)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.prepareExecution(ctx, basketID, userID, opts, exit, variety)
+	if err != nil {
+		return nil, err
+	}
+	return s.execute(ctx, executionID, userID, plan)
+}
+
+// existingExecution returns the user's execution with the given ID, or nil if there is none.
+// An execution still placing its orders was interrupted (its job's worker stopped): it is
+// resumed first, see resumeExecution.
+func (s *executionService) existingExecution(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) (*model.Execution, error) {
+	execution, err := s.executionRepo.FindByID(ctx, executionID)
+	if errors.Is(err, repository.ErrExecutionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if execution.UserID != userID {
+		return nil, fmt.Errorf("execution %s belongs to another user", executionID)
+	}
+	if execution.Status == model.ExecutionStatusPlacing {
+		return s.resumeExecution(ctx, execution)
+	}
+	log.Printf("Service: Execution %s already exists (status '%s'), not placing its orders again", executionID, execution.Status)
+	return execution, nil
+}
+
+// resumeExecution finishes placing an interrupted execution's pending orders. Orders are
+// tagged with their ID (see kiteadapter.OrderTag), so those the interrupted attempt placed
+// without recording are found in the day's orders and recorded instead of placed twice.
+//
+// When the orders can't be placed any more (the trading day is over, the broker session
+// expired) the pending ones are marked failed, so the execution gets a final status.
+// Errors worth retrying later (database, broker outage) are returned.
+func (s *executionService) resumeExecution(ctx context.Context, execution *model.Execution) (*model.Execution, error) {
+	// 1. Orders are day orders: the next day, nothing can be checked or placed any more
+	userID := execution.UserID
+	now := time.Now()
+	if execution.CreatedAt.In(market.IST).Format("2006-01-02") != now.In(market.IST).Format("2006-01-02") {
+		return s.abandonExecution(ctx, execution, "the trading day it was placed on is over")
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if errors.Is(err, ErrBrokerReauthRequired) {
+		return s.abandonExecution(ctx, execution, "the broker session has expired")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. The orders the interrupted attempt got to the broker
+	brokerOrders, err := s.kiteAdapter.GetOrders(ctx, accessToken)
+	if err != nil {
+		log.Printf("Service: Failed to fetch orders of user %s to resume execution %s: %v", userID, execution.ID, err)
+		if err = handleKiteError(ctx, s.brokerRepo, userID, err); errors.Is(err, ErrBrokerReauthRequired) {
+			return s.abandonExecution(ctx, execution, "the broker session has expired")
+		}
+		return nil, err
+	}
+	atBroker := make(map[string]string, len(brokerOrders))
+	for _, bo := range brokerOrders {
+		for _, tag := range bo.Tags {
+			atBroker[tag] = bo.OrderID
+		}
+	}
+
+	// 3. Place the rest
+	log.Printf("Service: Resuming interrupted execution %s for user %s", execution.ID, userID)
+	if err := s.placeOrders(ctx, userID, accessToken, execution, atBroker); err != nil {
+		return nil, err
+	}
+	log.Printf("Service: Execution %s finished with status '%s'", execution.ID, execution.Status)
+	return execution, nil
+}
+
+// abandonExecution marks an interrupted execution's pending orders failed and sets its final status.
+func (s *executionService) abandonExecution(ctx context.Context, execution *model.Execution, reason string) (*model.Execution, error) {
+	log.Printf("Service: Not resuming interrupted execution %s: %s", execution.ID, reason)
+	notPlaced := fmt.Errorf("not placed: the execution was interrupted and %s; check the broker's order book for orders sent before the interruption", reason)
+	if err := s.recordPlacement(ctx, execution, func(model.OrderParams, uuid.UUID) (string, error) {
+		return "", notPlaced
+	}); err != nil {
+		return nil, err
+	}
+	return execution, nil
+}
+
+// checkMarketOpen returns a MarketClosedError unless orders trade continuously at now.
+func (s *executionService) checkMarketOpen(now time.Time) error {
+	if s.calendar.IsOpen(now) {
+		return nil
+	}
+	return &MarketClosedError{Session: s.calendar.SessionAt(now), NextOpen: s.calendar.NextOpen(now)}
+}
+
+// orderVariety picks the variety orders placed at now get: regular while the market is open,
+// AMO outside market hours if the user opted in. Otherwise it returns a MarketClosedError.
+func (s *executionService) orderVariety(now time.Time, opts model.ExecutionOptions) (string, error) {
+	err := s.checkMarketOpen(now)
+	switch {
+	case err == nil:
+		return model.VarietyRegular, nil
+	case opts.AMO:
+		return model.VarietyAMO, nil
+	default:
+		return "", err
+	}
+}
+
+// execute records and places a prepared plan, unless the margin policy blocks it.
+func (s *executionService) execute(ctx context.Context, executionID uuid.UUID, userID uuid.UUID, plan *executionPlan) (*model.Execution, error) {
+	// 1. Apply the margin policy
+	basketID := plan.basket.ID
+	check := plan.marginCheck
+	if s.marginBlocks(check) {
+		log.Printf("Service: Refusing to execute basket %s for user %s: %.2f required, %.2f available",
+			basketID, userID, check.RequiredMargin, check.AvailableMargin)
+		return nil, &InsufficientMarginError{Check: check}
+	}
+	if !check.Sufficient {
+		log.Printf("Service: Warning: executing basket %s for user %s with a margin shortfall of %.2f",
+			basketID, userID, check.Shortfall)
+	}
+
+	// 2. Record the execution before sending anything, so every order we place is accounted for
+	execution := newExecution(executionID, basketID, userID, plan.transactionType, plan.orders)
+	execution.MarginCheck = check
+	if err := s.executionRepo.Create(ctx, execution); err != nil {
+		log.Printf("Service: Failed to create execution for basket %s: %v", basketID, err)
+		return nil, fmt.Errorf("could not record execution: %w", err)
+	}
+
+	// 3. Place the orders
+	log.Printf("Service: Executing basket %s for user %s (execution %s, %d %s orders)",
+		basketID, userID, execution.ID, len(plan.orders), plan.transactionType)
+	if err := s.placeOrders(ctx, userID, plan.accessToken, execution, nil); err != nil {
+		return nil, err
+	}
+	log.Printf("Service: Execution %s finished with status '%s'", execution.ID, execution.Status)
+	return execution, nil
+}
+
+// Preview implements ExecutionService.
+func (s *executionService) Preview(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.ExecutionPreview, error) {
+	plan, err := s.prepareExecution(ctx, basketID, userID, opts, nil, s.previewVariety(opts))
+	if err != nil {
+		return nil, err
+	}
+	return s.preview(ctx, userID, plan)
+}
+
+// PreviewExit implements ExecutionService.
+func (s *executionService) PreviewExit(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.ExecutionPreview, error) {
+	plan, err := s.prepareExecution(ctx, basketID, userID, opts.ExecutionOptions, &opts, s.previewVariety(opts.ExecutionOptions))
+	if err != nil {
+		return nil, err
+	}
+	return s.preview(ctx, userID, plan)
+}
+
+// previewVariety is orderVariety for previews: a closed market is reported as a warning, not an error.
+func (s *executionService) previewVariety(opts model.ExecutionOptions) string {
+	variety, err := s.orderVariety(time.Now(), opts)
+	if err != nil {
+		return model.VarietyRegular
+	}
+	return variety
+}
+
+// preview itemizes a prepared plan with estimated prices and charges.
+func (s *executionService) preview(ctx context.Context, userID uuid.UUID, plan *executionPlan) (*model.ExecutionPreview, error) {
+	// 1. Margin outcome
+	basketID := plan.basket.ID
+	preview := &model.ExecutionPreview{
+		BasketID:        basketID,
+		TransactionType: plan.transactionType,
+		Orders:          make([]model.OrderPreview, 0, len(plan.orders)),
+		MarginCheck:     plan.marginCheck,
+		WouldBlock:      s.marginBlocks(plan.marginCheck),
+		Warnings:        []string{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+	if !plan.marginCheck.Sufficient {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("Insufficient funds: short by %.2f", plan.marginCheck.Shortfall))
+	}
+	if plan.variety == model.VarietyAMO {
+		preview.Warnings = append(preview.Warnings, "The market is closed: orders would be placed as after-market orders and sent to the exchange when it opens")
+	} else if err := s.checkMarketOpen(preview.GeneratedAt); err != nil {
+		preview.Warnings = append(preview.Warnings, "Executing now would be refused: "+err.Error())
+	}
+	if plan.marginCheck.Source == model.MarginSourceEstimate {
+		preview.Warnings = append(preview.Warnings, "Required margin is a local estimate, the broker's margin calculator was unavailable")
+	}
+
+	// 2. Estimated prices
+	prices, err := s.orderPrices(ctx, plan.accessToken, plan.orders)
+	if err != nil {
+		log.Printf("Service: Failed to fetch prices for preview of basket %s: %v", basketID, err)
+		return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+
+	// 3. Itemize with charges. Charges are optional: the rest of the preview is still useful without them
+	for i, order := range plan.orders {
+		item := model.OrderPreview{
+			OrderParams:    order,
+			Instrument:     order.Exchange + ":" + order.Symbol,
+			EstimatedPrice: prices[i],
+			EstimatedValue: prices[i] * float64(order.Quantity),
+		}
+		result, err := s.orderCharges(order, prices[i])
+		if err != nil {
+			log.Printf("Service: Failed to compute charges of %s for preview of basket %s: %v", order.Symbol, basketID, err)
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("Charges of %s could not be estimated", order.Symbol))
+		} else {
+			item.Charges = &result.Charges
+			preview.TotalCharges += result.Charges.Total
+			preview.ChargesRateVersion = result.RateVersion
+		}
+		switch {
+		case len(order.SliceQuantities) > 0:
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s is above the freeze quantity: it would be sent as %d child orders",
+				order.Symbol, len(order.SliceQuantities)))
+		case order.Variety == model.VarietyIceberg:
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s is above the freeze quantity: it would be sent as an iceberg order of %d legs",
+				order.Symbol, order.IcebergLegs))
+		}
+		preview.TotalValue += item.EstimatedValue
+		preview.Orders = append(preview.Orders, item)
+	}
+	preview.TotalCost = preview.TotalCharges
+	if preview.TransactionType == model.TransactionBuy {
+		preview.TotalCost += preview.TotalValue
+	}
+	return preview, nil
+}
+
+// GetExecution implements ExecutionService.
+func (s *executionService) GetExecution(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) (*model.Execution, error) {
+	execution, err := s.executionRepo.FindByID(ctx, executionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeExecution(ctx, execution, userID); err != nil {
+		return nil, err
+	}
+	return execution, nil
+}
+
+// ListBasketExecutions implements ExecutionService.
+func (s *executionService) ListBasketExecutions(ctx context.Context, basketID uuid.UUID, userID uuid.UUID) ([]model.Execution, error) {
+	if _, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, basketID, userID, model.OrgPermissionViewer); err != nil {
+		return nil, err
+	}
+	executions, err := s.executionRepo.ListByBasket(ctx, basketID)
+	if err != nil {
+		log.Printf("Service: Failed to list executions of basket %s: %v", basketID, err)
+		return nil, fmt.Errorf("could not retrieve executions: %w", err)
+	}
+	return executions, nil
+}
+
+// RefreshFills implements ExecutionService.
+func (s *executionService) RefreshFills(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) (*model.Execution, error) {
+	// 1. The user's own execution, and their orders at the broker
+	execution, err := s.loadOwnExecution(ctx, executionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	brokerOrders, err := s.kiteAdapter.GetOrders(ctx, accessToken)
+	if err != nil {
+		log.Printf("Service: Failed to fetch orders of user %s: %v", userID, err)
+		return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+	// Iceberg legs after the first are orders of their own, pointing at the first leg
+	byOrderID := make(map[string][]model.BrokerOrder, len(brokerOrders))
+	for _, bo := range brokerOrders {
+		byOrderID[bo.OrderID] = append(byOrderID[bo.OrderID], bo)
+		if bo.ParentOrderID != "" {
+			byOrderID[bo.ParentOrderID] = append(byOrderID[bo.ParentOrderID], bo)
+		}
+	}
+
+	// 2. Sum the fills of each order, through its child orders if it was split. Orders the
+	// broker no longer lists (previous days) keep their recorded fills.
+	for i := range execution.Orders {
+		order := &execution.Orders[i]
+		var total fillTotal
+		switch {
+		case len(order.Slices) > 0:
+			for j := range order.Slices {
+				slice := &order.Slices[j]
+				if slice.BrokerOrderID != nil {
+					if legs, ok := byOrderID[*slice.BrokerOrderID]; ok {
+						sliceFills := sumFills(legs)
+						slice.FilledQuantity, slice.AveragePrice = sliceFills.quantity, sliceFills.averagePrice()
+						if err := s.executionRepo.UpdateSlice(ctx, slice); err != nil {
+							log.Printf("Service: Failed to record fills of child order %s: %v", slice.ID, err)
+						}
+					}
+				}
+				if slice.AveragePrice != nil {
+					total.add(slice.FilledQuantity, *slice.AveragePrice)
+				}
+			}
+		case order.BrokerOrderID != nil:
+			legs, ok := byOrderID[*order.BrokerOrderID]
+			if !ok {
+				continue
+			}
+			total = sumFills(legs)
+		default:
+			continue
+		}
+		order.FilledQuantity, order.AveragePrice = total.quantity, total.averagePrice()
+		if err := s.executionRepo.UpdateFills(ctx, order); err != nil {
+			log.Printf("Service: Failed to record fills of order %s: %v", order.ID, err)
+		}
+	}
+	return execution, nil
+}
+
+// ModifyOrder implements ExecutionService.
+func (s *executionService) ModifyOrder(ctx context.Context, executionID uuid.UUID, orderID uuid.UUID, userID uuid.UUID, change model.OrderModification) (*model.ExecutionOrder, error) {
+	// 1. Load the order and check it can still be changed
+	execution, order, err := s.loadOpenOrder(ctx, executionID, orderID, userID, change.ExpectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Apply the change to a copy
+	if len(order.Slices) > 0 {
+		return nil, fmt.Errorf("%w: it was split into child orders; cancel it and place it again", ErrInvalidOrderModification)
+	}
+	updated := *order
+	if change.Quantity == nil && change.Price == nil && change.TriggerPrice == nil {
+		return nil, fmt.Errorf("%w: nothing to change", ErrInvalidOrderModification)
+	}
+	if change.Quantity != nil {
+		if *change.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidOrderModification)
+		}
+		updated.Quantity = *change.Quantity
+	}
+	if change.Price != nil {
+		if order.OrderType != model.OrderTypeLimit && order.OrderType != model.OrderTypeSL {
+			return nil, fmt.Errorf("%w: %s orders have no limit price", ErrInvalidOrderModification, order.OrderType)
+		}
+		if *change.Price <= 0 {
+			return nil, fmt.Errorf("%w: price must be positive", ErrInvalidOrderModification)
+		}
+		updated.Price = change.Price
+	}
+	if change.TriggerPrice != nil {
+		if order.OrderType != model.OrderTypeSL && order.OrderType != model.OrderTypeSLM {
+			return nil, fmt.Errorf("%w: %s orders have no trigger price", ErrInvalidOrderModification, order.OrderType)
+		}
+		if *change.TriggerPrice <= 0 {
+			return nil, fmt.Errorf("%w: trigger price must be positive", ErrInvalidOrderModification)
+		}
+		updated.TriggerPrice = change.TriggerPrice
+	}
+
+	// 3. Send it to the broker
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The change may be live at the broker from here on, so record it even if the client goes away
+	ctx = context.WithoutCancel(ctx)
+	log.Printf("Service: Modifying order %s of execution %s for user %s", orderID, executionID, userID)
+	before, after := order.Snapshot(), updated.Snapshot()
+	if err := s.kiteAdapter.ModifyOrder(ctx, accessToken, *order.BrokerOrderID, updated.OrderParams); err != nil {
+		log.Printf("Service: Broker refused to modify order %s: %v", orderID, err)
+		s.recordOrderEvent(ctx, execution.ID, order.ID, userID, model.OrderEventModify, model.OrderEventFailed, before, &after, err)
+		return nil, s.brokerOrderError(ctx, userID, err)
+	}
+
+	// 4. Save it, unless the order changed here while the broker call was in flight
+	err = s.executionRepo.UpdateOpenOrder(ctx, &updated, order.Version)
+	if err != nil {
+		outcome := model.OrderEventFailed
+		if errors.Is(err, repository.ErrExecutionOrderConflict) {
+			outcome = model.OrderEventConflict
+		}
+		log.Printf("Service: Order %s was modified at the broker but not saved: %v", orderID, err)
+		s.recordOrderEvent(ctx, execution.ID, order.ID, userID, model.OrderEventModify, outcome, before, &after, err)
+		return nil, err
+	}
+	s.recordOrderEvent(ctx, execution.ID, order.ID, userID, model.OrderEventModify, model.OrderEventSucceeded, before, &after, nil)
+	return &updated, nil
+}
+
+// CancelOrder implements ExecutionService.
+func (s *executionService) CancelOrder(ctx context.Context, executionID uuid.UUID, orderID uuid.UUID, userID uuid.UUID, expectedVersion *int) (*model.ExecutionOrder, error) {
+	execution, order, err := s.loadOpenOrder(ctx, executionID, orderID, userID, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Service: Cancelling order %s of execution %s for user %s", orderID, executionID, userID)
+	if err := s.cancelOrder(context.WithoutCancel(ctx), execution.ID, order, userID, accessToken); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelOpenOrders implements ExecutionService.
+func (s *executionService) CancelOpenOrders(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) ([]model.OrderActionResult, error) {
+	execution, err := s.loadOwnExecution(ctx, executionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Service: Cancelling open orders of execution %s for user %s", executionID, userID)
+	ctx = context.WithoutCancel(ctx)
+	results := []model.OrderActionResult{}
+	var sessionErr error
+	for i := range execution.Orders {
+		order := &execution.Orders[i]
+		if order.Status != model.OrderStatusPlaced {
+			continue
+		}
+		result := model.OrderActionResult{OrderID: order.ID, Symbol: order.Symbol}
+		if sessionErr != nil {
+			result.Error = sessionErr.Error()
+		} else if err := s.cancelOrder(ctx, execution.ID, order, userID, accessToken); err != nil {
+			if errors.Is(err, ErrBrokerReauthRequired) {
+				sessionErr = err // The remaining cancellations would fail the same way
+			}
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ListOrderEvents implements ExecutionService.
+func (s *executionService) ListOrderEvents(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) ([]model.OrderEvent, error) {
+	if _, err := s.GetExecution(ctx, executionID, userID); err != nil {
+		return nil, err
+	}
+	events, err := s.executionRepo.ListOrderEvents(ctx, executionID)
+	if err != nil {
+		log.Printf("Service: Failed to list order events of execution %s: %v", executionID, err)
+		return nil, fmt.Errorf("could not retrieve order events: %w", err)
+	}
+	return events, nil
+}
+
+// ReleaseQueuedExecutions implements ExecutionService.
+func (s *executionService) ReleaseQueuedExecutions(ctx context.Context, now time.Time) (int64, error) {
+	// AMOs go to the exchange when the session starts; nothing to do while the market is closed
+	opened := s.calendar.SessionStart(now)
+	if opened.IsZero() || !s.calendar.IsOpen(now) {
+		return 0, nil
+	}
+	released, err := s.executionRepo.ReleaseQueued(ctx, opened)
+	if err != nil {
+		return 0, fmt.Errorf("could not release queued executions: %w", err)
+	}
+	if released > 0 {
+		log.Printf("Service: Released %d executions queued for the open at %s", released, opened.Format(time.RFC3339))
+	}
+	return released, nil
+}
+
+// loadOwnExecution returns an execution the user ran themselves (and may therefore change).
+func (s *executionService) loadOwnExecution(ctx context.Context, executionID uuid.UUID, userID uuid.UUID) (*model.Execution, error) {
+	execution, err := s.GetExecution(ctx, executionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if execution.UserID != userID {
+		return nil, ErrExecutionOwnerOnly
+	}
+	return execution, nil
+}
+
+// loadOpenOrder returns one of the user's own orders if it is still open and,
+// when expectedVersion is given, unchanged since the client read it.
+func (s *executionService) loadOpenOrder(ctx context.Context, executionID uuid.UUID, orderID uuid.UUID, userID uuid.UUID, expectedVersion *int) (*model.Execution, *model.ExecutionOrder, error) {
+	execution, err := s.loadOwnExecution(ctx, executionID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var order *model.ExecutionOrder
+	for i := range execution.Orders {
+		if execution.Orders[i].ID == orderID {
+			order = &execution.Orders[i]
+			break
+		}
+	}
+	if order == nil {
+		return nil, nil, repository.ErrExecutionOrderNotFound
+	}
+	if order.Status != model.OrderStatusPlaced || (order.BrokerOrderID == nil && len(order.Slices) == 0) {
+		return nil, nil, fmt.Errorf("%w: it is %s", ErrOrderNotOpen, order.Status)
+	}
+	if expectedVersion != nil && *expectedVersion != order.Version {
+		return nil, nil, repository.ErrExecutionOrderConflict
+	}
+	return execution, order, nil
+}
+
+// cancelOrder cancels an open order at the broker, saves and audits it. On success
+// order is updated in place.
+func (s *executionService) cancelOrder(ctx context.Context, executionID uuid.UUID, order *model.ExecutionOrder, userID uuid.UUID, accessToken string) error {
+	before := order.Snapshot()
+	if err := s.cancelAtBroker(ctx, order, accessToken); err != nil {
+		log.Printf("Service: Broker refused to cancel order %s: %v", order.ID, err)
+		s.recordOrderEvent(ctx, executionID, order.ID, userID, model.OrderEventCancel, model.OrderEventFailed, before, nil, err)
+		return s.brokerOrderError(ctx, userID, err)
+	}
+
+	updated := *order
+	updated.Status = model.OrderStatusCancelled
+	if err := s.executionRepo.UpdateOpenOrder(ctx, &updated, order.Version); err != nil {
+		outcome := model.OrderEventFailed
+		if errors.Is(err, repository.ErrExecutionOrderConflict) {
+			outcome = model.OrderEventConflict
+		}
+		log.Printf("Service: Order %s was cancelled at the broker but not saved: %v", order.ID, err)
+		s.recordOrderEvent(ctx, executionID, order.ID, userID, model.OrderEventCancel, outcome, before, nil, err)
+		return err
+	}
+	s.recordOrderEvent(ctx, executionID, order.ID, userID, model.OrderEventCancel, model.OrderEventSucceeded, before, nil, nil)
+	*order = updated
+	return nil
+}
+
+// cancelAtBroker cancels an order at the broker or, if it was split, each of its placed
+// child orders. Child orders are saved as they are cancelled, so when one fails the others
+// stay cancelled and the order stays placed.
+func (s *executionService) cancelAtBroker(ctx context.Context, order *model.ExecutionOrder, accessToken string) error {
+	if len(order.Slices) == 0 {
+		return s.kiteAdapter.CancelOrder(ctx, accessToken, order.Variety, *order.BrokerOrderID)
+	}
+	for i := range order.Slices {
+		slice := &order.Slices[i]
+		if slice.Status != model.OrderStatusPlaced || slice.BrokerOrderID == nil {
+			continue
+		}
+		if err := s.kiteAdapter.CancelOrder(ctx, accessToken, order.Variety, *slice.BrokerOrderID); err != nil {
+			return fmt.Errorf("child order #%d: %w", slice.Seq, err)
+		}
+		slice.Status = model.OrderStatusCancelled
+		if err := s.executionRepo.UpdateSlice(ctx, slice); err != nil {
+			log.Printf("Service: Child order %s was cancelled at the broker but not saved: %v", slice.ID, err)
+		}
+	}
+	return nil
+}
+
+// recordOrderEvent appends to the audit trail. Failures are logged: the change
+// itself has already happened at the broker.
+func (s *executionService) recordOrderEvent(ctx context.Context, executionID uuid.UUID, orderID uuid.UUID, userID uuid.UUID, action, outcome string, before model.OrderSnapshot, after *model.OrderSnapshot, cause error) {
+	event := &model.OrderEvent{
+		ID:          uuid.New(),
+		ExecutionID: executionID,
+		OrderID:     orderID,
+		UserID:      userID,
+		Action:      action,
+		Outcome:     outcome,
+		Before:      before,
+		After:       after,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if cause != nil {
+		msg := cause.Error()
+		event.ErrorMessage = &msg
+	}
+	if err := s.executionRepo.AddOrderEvent(ctx, event); err != nil {
+		log.Printf("Service: Failed to record %s event for order %s: %v", action, orderID, err)
+	}
+}
+
+// brokerOrderError classifies an error from changing an order at the broker.
+func (s *executionService) brokerOrderError(ctx context.Context, userID uuid.UUID, err error) error {
+	if kiteadapter.IsOrderError(err) {
+		return fmt.Errorf("%w: %v", ErrBrokerRejectedChange, err)
+	}
+	return handleKiteError(ctx, s.brokerRepo, userID, err)
+}
+
+// authorizeExecution checks the user may see an execution: they ran it, or they can see its basket.
+// Others get repository.ErrExecutionNotFound.
+func (s *executionService) authorizeExecution(ctx context.Context, execution *model.Execution, userID uuid.UUID) error {
+	if execution.UserID == userID {
+		return nil
+	}
+	if execution.BasketID == nil {
+		return repository.ErrExecutionNotFound
+	}
+	_, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, *execution.BasketID, userID, model.OrgPermissionViewer)
+	if errors.Is(err, repository.ErrBasketNotFound) || errors.Is(err, repository.ErrOrganizationNotFound) {
+		return repository.ErrExecutionNotFound
+	}
+	return err
+}
+
+// checkMargin asks the broker what the orders need, falling back to a local estimate when
+// the basket margins API fails, and compares it with the account's available funds.
+func (s *executionService) checkMargin(ctx context.Context, userID uuid.UUID, accessToken string, orders []model.OrderParams) (*model.MarginCheck, error) {
+	check := &model.MarginCheck{Source: model.MarginSourceBroker}
+
+	// 1. Required margin
+	required, items, err := s.kiteAdapter.GetBasketMargins(ctx, accessToken, orders)
+	if err != nil {
+		if kiteadapter.IsTokenError(err) {
+			return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+		}
+		log.Printf("Service: Basket margins API failed for user %s, estimating locally: %v", userID, err)
+		required, items, err = s.estimateMargin(ctx, accessToken, orders)
+		if err != nil {
+			log.Printf("Service: Failed to estimate margin for user %s: %v", userID, err)
+			return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+		}
+		check.Source = model.MarginSourceEstimate
+	}
+	check.RequiredMargin = required
+	check.Items = items
+
+	// 2. Available funds, always fresh: the check is about to gate real orders
+	margins, err := s.brokerService.GetMargins(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+	check.AvailableMargin = margins.Equity.Net
+
+	// 3. Compare
+	check.Sufficient = check.AvailableMargin >= check.RequiredMargin
+	if !check.Sufficient {
+		check.Shortfall = check.RequiredMargin - check.AvailableMargin
+	}
+	check.CheckedAt = time.Now().UTC()
+	return check, nil
+}
+
+// estimateMargin estimates the margin of delivery (CNC) orders from prices: buys need their
+// full value, sells of holdings need nothing. Other products need the broker's calculation.
+func (s *executionService) estimateMargin(ctx context.Context, accessToken string, orders []model.OrderParams) (float64, []model.MarginItem, error) {
+	for _, o := range orders {
+		if o.Product != model.ProductCNC {
+			return 0, nil, fmt.Errorf("cannot estimate margin for %s orders", o.Product)
+		}
+	}
+	prices, err := s.orderPrices(ctx, accessToken, orders)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var total float64
+	items := make([]model.MarginItem, 0, len(orders))
+	for i, o := range orders {
+		item := model.MarginItem{
+			Symbol:          o.Symbol,
+			TransactionType: o.TransactionType,
+			Quantity:        o.Quantity,
+			Price:           prices[i],
+		}
+		if o.TransactionType == model.TransactionBuy {
+			item.RequiredMargin = prices[i] * float64(o.Quantity)
+		}
+		total += item.RequiredMargin
+		items = append(items, item)
+	}
+	return total, items, nil
+}
+
+// orderCharges computes the charges of an order filled at price, with today's rates.
+// An order split into child orders pays for each of them: brokerage is capped per order
+// and STT is rounded per contract note line, so the slices' charges are added up.
+func (s *executionService) orderCharges(order model.OrderParams, price float64) (charges.Result, error) {
+	segment, err := charges.SegmentForProduct(order.Product)
+	if err != nil {
+		return charges.Result{}, err
+	}
+	quantities := order.SliceQuantities
+	if len(quantities) == 0 {
+		quantities = []int{order.Quantity}
+	}
+
+	var total charges.Result
+	for _, quantity := range quantities {
+		result, err := s.charges.Calculate(charges.Trade{
+			Segment:         segment,
+			Exchange:        order.Exchange,
+			TransactionType: order.TransactionType,
+			Quantity:        quantity,
+			Price:           price,
+		})
+		if err != nil {
+			return charges.Result{}, err
+		}
+		total = total.Add(result)
+	}
+	return total, nil
+}
+
+// orderPrices returns the expected price of each order: the limit price, the trigger
+// price for SL-M orders, or the last traded price for market orders.
+func (s *executionService) orderPrices(ctx context.Context, accessToken string, orders []model.OrderParams) ([]float64, error) {
+	var instruments []string
+	for _, o := range orders {
+		if o.Price == nil && o.TriggerPrice == nil {
+			instruments = append(instruments, o.Exchange+":"+o.Symbol)
+		}
+	}
+	var ltps map[string]float64
+	if len(instruments) > 0 {
+		var err error
+		if ltps, err = s.kiteAdapter.GetLTP(ctx, accessToken, instruments); err != nil {
+			return nil, err
+		}
+	}
+
+	prices := make([]float64, 0, len(orders))
+	for _, o := range orders {
+		if o.Price != nil {
+			prices = append(prices, *o.Price)
+			continue
+		}
+		if o.TriggerPrice != nil {
+			prices = append(prices, *o.TriggerPrice)
+			continue
+		}
+		ltp, ok := ltps[o.Exchange+":"+o.Symbol]
+		if !ok {
+			return nil, fmt.Errorf("no last traded price for %s:%s", o.Exchange, o.Symbol)
+		}
+		prices = append(prices, ltp)
+	}
+	return prices, nil
+}
+
+// placeOrders sends an execution's pending orders to the broker one by one and records
+// each outcome. Broker rejections are recorded, not returned. atBroker maps the tags of
+// orders already at the broker to their IDs (see resumeExecution); those are recorded as
+// placed instead of being sent again. Orders that may or may not have been placed are
+// left pending, and ErrPlacementUnresolved is returned.
+func (s *executionService) placeOrders(ctx context.Context, userID uuid.UUID, accessToken string, execution *model.Execution, atBroker map[string]string) error {
+	// Orders already at the broker must be recorded even if the client goes away
+	ctx = context.WithoutCancel(ctx)
+
+	var sessionErr error
+	// send places one order or child order
+	send := func(params model.OrderParams, id uuid.UUID) (string, error) {
+		tag := kiteadapter.OrderTag(id)
+		if brokerOrderID, ok := atBroker[tag]; ok {
+			log.Printf("Service: %s order for %s (execution %s) is already at the broker as %s", params.TransactionType, params.Symbol, execution.ID, brokerOrderID)
+			return brokerOrderID, nil
+		}
+		if sessionErr != nil {
+			// Kite rejected the token: the remaining orders would fail the same way
+			return "", errSessionExpired
+		}
+		brokerOrderID, err := s.kiteAdapter.PlaceOrder(ctx, accessToken, params, tag)
+		if err != nil {
+			log.Printf("Service: Failed to place %s order for %s (execution %s): %v", params.TransactionType, params.Symbol, execution.ID, err)
+			if kiteadapter.IsTokenError(err) {
+				sessionErr = handleKiteError(ctx, s.brokerRepo, userID, err)
+			}
+			if kiteadapter.IsUncertainFailure(err) {
+				return "", fmt.Errorf("%w: %v", ErrPlacementUnresolved, err)
+			}
+		}
+		return brokerOrderID, err
+	}
+	return s.recordPlacement(ctx, execution, send)
+}
+
+// recordPlacement runs send for each pending order (or child order) of an execution, records
+// the outcomes and sets the execution's final status from all of its orders. When send
+// returns ErrPlacementUnresolved the order stays pending, and so does the execution.
+func (s *executionService) recordPlacement(ctx context.Context, execution *model.Execution, send func(params model.OrderParams, id uuid.UUID) (string, error)) error {
+	ctx = context.WithoutCancel(ctx)
+
+	placed, partlyPlaced, unresolved := 0, 0, 0
+	for i := range execution.Orders {
+		order := &execution.Orders[i]
+		if order.Status == model.OrderStatusPending {
+			if len(order.Slices) > 0 {
+				s.placeSlices(ctx, order, send)
+			} else if brokerOrderID, err := send(order.OrderParams, order.ID); err != nil {
+				if !errors.Is(err, ErrPlacementUnresolved) {
+					markOrderFailed(order, err.Error())
+				}
+			} else {
+				order.Status = model.OrderStatusPlaced
+				order.BrokerOrderID = &brokerOrderID
+			}
+			if order.Status == model.OrderStatusPending {
+				unresolved++
+				continue
+			}
+			order.UpdatedAt = time.Now().UTC()
+			if err := s.executionRepo.UpdateOrder(ctx, order); err != nil {
+				log.Printf("Service: Failed to record outcome of order %s (execution %s): %v", order.ID, execution.ID, err)
+			}
+		}
+		switch {
+		case order.Status != model.OrderStatusPlaced:
+		case order.ErrorMessage != nil:
+			partlyPlaced++ // Some child orders failed
+		default:
+			placed++
+		}
+	}
+	if unresolved > 0 {
+		// The execution keeps placing; running it again looks for these orders by tag
+		log.Printf("Service: %d orders of execution %s may or may not have reached the broker", unresolved, execution.ID)
+		return fmt.Errorf("execution %s: %d orders: %w", execution.ID, unresolved, ErrPlacementUnresolved)
+	}
+
+	execution.Status = executionStatus(placed, len(execution.Orders))
+	if partlyPlaced > 0 {
+		execution.Status = model.ExecutionStatusPartiallyFailed
+	}
+	if execution.Status == model.ExecutionStatusCompleted && execution.Orders[0].Variety == model.VarietyAMO {
+		execution.Status = model.ExecutionStatusQueuedForOpen
+	}
+	execution.UpdatedAt = time.Now().UTC()
+	if err := s.executionRepo.UpdateStatus(ctx, execution.ID, execution.Status); err != nil {
+		log.Printf("Service: Failed to record status of execution %s: %v", execution.ID, err)
+	}
+	return nil
+}
+
+// placeSlices places the pending child orders of a split order with send. The order is
+// placed if any child order was; failed ones are summarized in its error message. While
+// a child order is unresolved (see recordPlacement), the order stays pending.
+func (s *executionService) placeSlices(ctx context.Context, order *model.ExecutionOrder, send func(model.OrderParams, uuid.UUID) (string, error)) {
+	failed, unresolved := 0, 0
+	var firstErr string
+	for i := range order.Slices {
+		slice := &order.Slices[i]
+		if slice.Status == model.OrderStatusPending {
+			params := order.OrderParams
+			params.Quantity = slice.Quantity
+			params.SliceQuantities = nil
+			brokerOrderID, err := send(params, slice.ID)
+			if errors.Is(err, ErrPlacementUnresolved) {
+				unresolved++
+				continue
+			}
+			if err != nil {
+				reason := err.Error()
+				slice.Status = model.OrderStatusFailed
+				slice.ErrorMessage = &reason
+			} else {
+				slice.Status = model.OrderStatusPlaced
+				slice.BrokerOrderID = &brokerOrderID
+			}
+			slice.UpdatedAt = time.Now().UTC()
+			if err := s.executionRepo.UpdateSlice(ctx, slice); err != nil {
+				log.Printf("Service: Failed to record outcome of child order %s (order %s): %v", slice.ID, order.ID, err)
+			}
+		}
+		if slice.Status == model.OrderStatusFailed {
+			if firstErr == "" && slice.ErrorMessage != nil {
+				firstErr = *slice.ErrorMessage
+			}
+			failed++
+		}
+	}
+
+	switch {
+	case unresolved > 0:
+		// Stays pending until the execution is run again
+	case failed == len(order.Slices):
+		markOrderFailed(order, firstErr)
+	case failed > 0:
+		reason := fmt.Sprintf("%d of %d child orders failed: %s", failed, len(order.Slices), firstErr)
+		order.Status = model.OrderStatusPlaced
+		order.ErrorMessage = &reason
+	default:
+		order.Status = model.OrderStatusPlaced
+	}
+}
+
+// buildOrderPlan turns a basket's stocks into the orders to send, one per stock.
+func buildOrderPlan(stocks []model.Stock, transactionType string, opts model.ExecutionOptions) ([]model.OrderParams, error) {
+	if len(stocks) == 0 {
+		return nil, ErrEmptyBasket
+	}
+
+	orderType := opts.OrderType
+	if orderType == "" {
+		orderType = model.OrderTypeMarket
+	}
+	switch orderType {
+	case model.OrderTypeMarket, model.OrderTypeLimit, model.OrderTypeSL, model.OrderTypeSLM:
+	default:
+		return nil, fmt.Errorf("%w: order type must be %s, %s, %s or %s", ErrInvalidExecutionOptions,
+			model.OrderTypeMarket, model.OrderTypeLimit, model.OrderTypeSL, model.OrderTypeSLM)
+	}
+	product := opts.Product
+	if product == "" {
+		product = model.ProductCNC
+	}
+	if product != model.ProductCNC && product != model.ProductMIS {
+		return nil, fmt.Errorf("%w: product must be %s or %s", ErrInvalidExecutionOptions, model.ProductCNC, model.ProductMIS)
+	}
+
+	orders := make([]model.OrderParams, 0, len(stocks))
+	for _, stock := range stocks {
+		order := model.OrderParams{
+			Symbol:          stock.Symbol,
+			Exchange:        model.ExchangeNSE,
+			TransactionType: transactionType,
+			OrderType:       orderType,
+			Product:         product,
+			Variety:         model.VarietyRegular,
+			Quantity:        stock.Quantity,
+		}
+		if orderType == model.OrderTypeLimit || orderType == model.OrderTypeSL {
+			price, ok := opts.Prices[stock.Symbol]
+			if !ok || price <= 0 {
+				return nil, fmt.Errorf("%w: a positive limit price is required for %s", ErrInvalidExecutionOptions, stock.Symbol)
+			}
+			order.Price = &price
+		}
+		if orderType == model.OrderTypeSL || orderType == model.OrderTypeSLM {
+			trigger, ok := opts.TriggerPrices[stock.Symbol]
+			if !ok || trigger <= 0 {
+				return nil, fmt.Errorf("%w: a positive trigger price is required for %s", ErrInvalidExecutionOptions, stock.Symbol)
+			}
+			order.TriggerPrice = &trigger
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// newExecution creates an execution of a basket with all orders pending.
+func newExecution(executionID uuid.UUID, basketID uuid.UUID, userID uuid.UUID, transactionType string, orders []model.OrderParams) *model.Execution {
+	now := time.Now().UTC()
+	execution := &model.Execution{
+		ID:              executionID,
+		BasketID:        &basketID,
+		UserID:          userID,
+		TransactionType: transactionType,
+		Status:          model.ExecutionStatusPlacing,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Orders:          make([]model.ExecutionOrder, 0, len(orders)),
+	}
+	for _, params := range orders {
+		order := model.ExecutionOrder{
+			ID:          uuid.New(),
+			ExecutionID: execution.ID,
+			OrderParams: params,
+			Status:      model.OrderStatusPending,
+			Version:     1,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		for i, quantity := range params.SliceQuantities {
+			order.Slices = append(order.Slices, model.OrderSlice{
+				ID:        uuid.New(),
+				OrderID:   order.ID,
+				Seq:       i + 1,
+				Quantity:  quantity,
+				Status:    model.OrderStatusPending,
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+		}
+		execution.Orders = append(execution.Orders, order)
+	}
+	return execution
+}
+
+// markOrderFailed sets an order's status to failed with the reason.
+func markOrderFailed(order *model.ExecutionOrder, reason string) {
+	order.Status = model.OrderStatusFailed
+	order.ErrorMessage = &reason
+}
+
+// fillTotal adds up fills into a quantity and a volume-weighted average price.
+type fillTotal struct {
+	quantity int
+	value    float64
+}
+
+func (f *fillTotal) add(quantity int, price float64) {
+	f.quantity += quantity
+	f.value += float64(quantity) * price
+}
+
+// averagePrice returns the volume-weighted average price, or nil if nothing was filled.
+func (f fillTotal) averagePrice() *float64 {
+	if f.quantity == 0 {
+		return nil
+	}
+	price := math.Round(f.value/float64(f.quantity)*100) / 100
+	return &price
+}
+
+// sumFills adds up the fills of a broker order and its iceberg legs.
+func sumFills(orders []model.BrokerOrder) fillTotal {
+	var total fillTotal
+	for _, o := range orders {
+		total.add(o.FilledQuantity, o.AveragePrice)
+	}
+	return total
+}
+
+// executionStatus derives an execution's status from how many of its orders were placed.
+func executionStatus(placed, total int) string {
+	switch {
+	case placed == total:
+		return model.ExecutionStatusCompleted
+	case placed == 0:
+		return model.ExecutionStatusFailed
+	default:
+		return model.ExecutionStatusPartiallyFailed
+	}
+}
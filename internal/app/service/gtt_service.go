@@ -0,0 +1,478 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	kiteadapter "github.com/AMANSRI99/StockSaaS/internal/adapter/broker/kiteconnect"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the GTT service.
+var (
+	ErrInvalidGTT        = errors.New("invalid gtt trigger")
+	ErrGTTNotActive      = errors.New("gtt trigger is no longer active")
+	ErrBrokerRejectedGTT = errors.New("broker refused the gtt trigger")
+)
+
+// defaultLimitBufferPercent is how far below its trigger a protective stop-loss is limited.
+const defaultLimitBufferPercent = 0.5
+
+// --- Interface Definition ---
+
+// GTTService manages GTT (Good Till Triggered) triggers: stop-loss and target exits that
+// persist across days at the broker. Triggers are in the user's own broker account, so
+// only that user sees and changes them.
+type GTTService interface {
+	// CreateGTT places a single or OCO trigger for a basket item or an executed order.
+	CreateGTT(ctx context.Context, userID uuid.UUID, req model.GTTRequest) (*model.GTT, error)
+	// ListGTTs returns the user's triggers, optionally of one basket. With refresh, statuses
+	// are first updated from the broker (e.g. triggered ones).
+	ListGTTs(ctx context.Context, userID uuid.UUID, basketID *uuid.UUID, refresh bool) ([]model.GTT, error)
+	GetGTT(ctx context.Context, gttID uuid.UUID, userID uuid.UUID) (*model.GTT, error)
+	// ModifyGTT replaces the legs of an active trigger.
+	ModifyGTT(ctx context.Context, gttID uuid.UUID, userID uuid.UUID, legs []model.GTTLeg) (*model.GTT, error)
+	// DeleteGTT deletes an active trigger at the broker.
+	DeleteGTT(ctx context.Context, gttID uuid.UUID, userID uuid.UUID) (*model.GTT, error)
+	// ProtectBasket sets an OCO stop-loss and target, a percentage away from the last price,
+	// on every basket stock the user holds. The outcome is reported per stock.
+	ProtectBasket(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ProtectOptions) ([]model.ProtectResult, error)
+}
+
+// --- Implementation ---
+
+type gttService struct {
+	gttRepo       repository.GTTRepository
+	basketRepo    repository.BasketRepository
+	orgRepo       repository.OrganizationRepository
+	executionRepo repository.ExecutionRepository
+	brokerRepo    repository.BrokerRepository
+	kiteAdapter   *kiteadapter.Adapter
+}
+
+// NewGTTService creates a new GTTService instance.
+func NewGTTService(
+	gr repository.GTTRepository,
+	br repository.BasketRepository,
+	or repository.OrganizationRepository,
+	er repository.ExecutionRepository,
+	bkr repository.BrokerRepository,
+	ka *kiteadapter.Adapter,
+) GTTService {
+	return &gttService{
+		gttRepo:       gr,
+		basketRepo:    br,
+		orgRepo:       or,
+		executionRepo: er,
+		brokerRepo:    bkr,
+		kiteAdapter:   ka,
+	}
+}
+
+// CreateGTT implements GTTService.
+func (s *gttService) CreateGTT(ctx context.Context, userID uuid.UUID, req model.GTTRequest) (*model.GTT, error) {
+	// 1. Resolve what the trigger is for
+	gtt, err := s.newGTTFromRequest(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Check the legs against the current price, which Kite also needs
+	if gtt.LastPrice, err = s.lastPrice(ctx, userID, accessToken, gtt.Exchange, gtt.Symbol); err != nil {
+		return nil, err
+	}
+	if err := validateGTTLegs(gtt.Type, gtt.Legs, gtt.LastPrice); err != nil {
+		return nil, err
+	}
+
+	// 3. Place and store
+	if err := s.placeGTT(ctx, userID, accessToken, gtt); err != nil {
+		return nil, err
+	}
+	return gtt, nil
+}
+
+// ListGTTs implements GTTService.
+func (s *gttService) ListGTTs(ctx context.Context, userID uuid.UUID, basketID *uuid.UUID, refresh bool) ([]model.GTT, error) {
+	gtts, err := s.gttRepo.ListByUser(ctx, userID, basketID)
+	if err != nil || !refresh {
+		return gtts, err
+	}
+
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.kiteAdapter.GetGTTStatuses(ctx, accessToken)
+	if err != nil {
+		log.Printf("Service: Failed to fetch gtt triggers of user %s: %v", userID, err)
+		return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+	for i := range gtts {
+		gtt := &gtts[i]
+		status, ok := statuses[gtt.BrokerTriggerID]
+		if !ok || status == gtt.Status || gtt.Status != model.GTTStatusActive {
+			continue
+		}
+		gtt.Status = status
+		if err := s.gttRepo.Update(ctx, gtt); err != nil {
+			log.Printf("Service: Failed to record status '%s' of gtt trigger %s: %v", status, gtt.ID, err)
+		}
+	}
+	return gtts, nil
+}
+
+// GetGTT implements GTTService.
+func (s *gttService) GetGTT(ctx context.Context, gttID uuid.UUID, userID uuid.UUID) (*model.GTT, error) {
+	return s.gttRepo.FindByID(ctx, gttID, userID)
+}
+
+// ModifyGTT implements GTTService.
+func (s *gttService) ModifyGTT(ctx context.Context, gttID uuid.UUID, userID uuid.UUID, legs []model.GTTLeg) (*model.GTT, error) {
+	// 1. Load an active trigger
+	gtt, err := s.gttRepo.FindByID(ctx, gttID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if gtt.Status != model.GTTStatusActive {
+		return nil, ErrGTTNotActive
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Validate the new legs against the current price
+	lastPrice, err := s.lastPrice(ctx, userID, accessToken, gtt.Exchange, gtt.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGTTLegs(gtt.Type, legs, lastPrice); err != nil {
+		return nil, err
+	}
+
+	// 3. Change at the broker, then here
+	changed := *gtt
+	changed.Legs = legs
+	changed.LastPrice = lastPrice
+	if err := s.kiteAdapter.ModifyGTT(ctx, accessToken, changed); err != nil {
+		log.Printf("Service: Failed to modify gtt trigger %d of user %s: %v", gtt.BrokerTriggerID, userID, err)
+		return nil, s.brokerGTTError(ctx, userID, err)
+	}
+	changed.UpdatedAt = time.Now().UTC()
+	if err := s.gttRepo.Update(ctx, &changed); err != nil {
+		log.Printf("Service: Broker modified gtt trigger %d but recording it failed: %v", gtt.BrokerTriggerID, err)
+		return nil, fmt.Errorf("gtt trigger was modified at the broker but could not be recorded: %w", err)
+	}
+	log.Printf("Service: Modified gtt trigger %s (%s) for user %s", gtt.ID, gtt.Symbol, userID)
+	return &changed, nil
+}
+
+// DeleteGTT implements GTTService.
+func (s *gttService) DeleteGTT(ctx context.Context, gttID uuid.UUID, userID uuid.UUID) (*model.GTT, error) {
+	gtt, err := s.gttRepo.FindByID(ctx, gttID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if gtt.Status != model.GTTStatusActive {
+		return nil, ErrGTTNotActive
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.kiteAdapter.DeleteGTT(ctx, accessToken, gtt.BrokerTriggerID); err != nil {
+		log.Printf("Service: Failed to delete gtt trigger %d of user %s: %v", gtt.BrokerTriggerID, userID, err)
+		return nil, s.brokerGTTError(ctx, userID, err)
+	}
+
+	// Kept (as deleted) so the history of what protected a basket stays visible
+	gtt.Status = model.GTTStatusDeleted
+	gtt.UpdatedAt = time.Now().UTC()
+	if err := s.gttRepo.Update(context.WithoutCancel(ctx), gtt); err != nil {
+		log.Printf("Service: Broker deleted gtt trigger %d but recording it failed: %v", gtt.BrokerTriggerID, err)
+	}
+	log.Printf("Service: Deleted gtt trigger %s (%s) for user %s", gtt.ID, gtt.Symbol, userID)
+	return gtt, nil
+}
+
+// ProtectBasket implements GTTService.
+func (s *gttService) ProtectBasket(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ProtectOptions) ([]model.ProtectResult, error) {
+	// 1. Validate
+	if opts.StopLossPercent <= 0 || opts.StopLossPercent >= 100 {
+		return nil, fmt.Errorf("%w: stopLossPercent must be above 0 and below 100", ErrInvalidGTT)
+	}
+	if opts.TargetPercent <= 0 {
+		return nil, fmt.Errorf("%w: targetPercent must be above 0", ErrInvalidGTT)
+	}
+	buffer := opts.LimitBufferPercent
+	if buffer == 0 {
+		buffer = defaultLimitBufferPercent
+	}
+	if buffer < 0 || buffer >= 10 {
+		return nil, fmt.Errorf("%w: limitBufferPercent must be between 0 and 10", ErrInvalidGTT)
+	}
+	source := opts.Source
+	if source == "" {
+		source = model.ExitSourceExecutions
+	}
+	if source != model.ExitSourceExecutions && source != model.ExitSourceHoldings {
+		return nil, fmt.Errorf("%w: source must be %s or %s", ErrInvalidGTT, model.ExitSourceExecutions, model.ExitSourceHoldings)
+	}
+
+	// 2. What is held, and at what price
+	basket, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, basketID, userID, model.OrgPermissionExecutor)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := kiteAccessToken(ctx, s.brokerRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	held, err := basketHoldings(ctx, s.kiteAdapter, s.executionRepo, s.brokerRepo, basket, userID, accessToken, source)
+	if err != nil {
+		return nil, err
+	}
+	if len(held) == 0 {
+		return nil, ErrNothingToExit
+	}
+	instruments := make([]string, 0, len(held))
+	for symbol := range held {
+		instruments = append(instruments, model.ExchangeNSE+":"+symbol)
+	}
+	prices, err := s.kiteAdapter.GetLTP(ctx, accessToken, instruments)
+	if err != nil {
+		log.Printf("Service: Failed to fetch prices to protect basket %s: %v", basketID, err)
+		return nil, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+
+	// 3. One OCO per holding, in basket order
+	log.Printf("Service: Protecting basket %s for user %s: stop-loss %.2f%%, target %.2f%%", basketID, userID, opts.StopLossPercent, opts.TargetPercent)
+	results := make([]model.ProtectResult, 0, len(held))
+	placed := 0
+	var sessionErr error
+	for _, stock := range basket.Stocks {
+		quantity, ok := held[stock.Symbol]
+		if !ok {
+			continue
+		}
+		result := model.ProtectResult{Symbol: stock.Symbol}
+		lastPrice, ok := prices[model.ExchangeNSE+":"+stock.Symbol]
+		switch {
+		case sessionErr != nil:
+			result.Error = "not sent: broker session expired"
+		case !ok:
+			result.Error = "no last traded price"
+		default:
+			stopLoss := roundToTick(lastPrice * (1 - opts.StopLossPercent/100))
+			target := roundToTick(lastPrice * (1 + opts.TargetPercent/100))
+			gtt := &model.GTT{
+				UserID:          userID,
+				BasketID:        &basket.ID,
+				Type:            model.GTTTypeOCO,
+				Symbol:          stock.Symbol,
+				Exchange:        model.ExchangeNSE,
+				TransactionType: model.TransactionSell,
+				Product:         model.ProductCNC,
+				LastPrice:       lastPrice,
+				Legs: []model.GTTLeg{
+					{TriggerPrice: stopLoss, LimitPrice: roundToTick(stopLoss * (1 - buffer/100)), Quantity: quantity},
+					{TriggerPrice: target, LimitPrice: target, Quantity: quantity},
+				},
+			}
+			if err := s.placeGTT(ctx, userID, accessToken, gtt); err != nil {
+				if errors.Is(err, ErrBrokerReauthRequired) {
+					sessionErr = err
+				}
+				result.Error = err.Error()
+			} else {
+				result.Success = true
+				result.GTT = gtt
+				placed++
+			}
+		}
+		results = append(results, result)
+	}
+	if sessionErr != nil && placed == 0 {
+		return nil, sessionErr // Nothing placed: let the client reconnect and try again
+	}
+	return results, nil
+}
+
+// newGTTFromRequest builds an unplaced trigger from a request, checking the user may protect
+// the basket item or executed order it is for.
+func (s *gttService) newGTTFromRequest(ctx context.Context, userID uuid.UUID, req model.GTTRequest) (*model.GTT, error) {
+	gtt := &model.GTT{
+		UserID:          userID,
+		Type:            req.Type,
+		Symbol:          req.Symbol,
+		Exchange:        req.Exchange,
+		TransactionType: req.TransactionType,
+		Product:         req.Product,
+		Legs:            req.Legs,
+	}
+	if gtt.Type != model.GTTTypeSingle && gtt.Type != model.GTTTypeOCO {
+		return nil, fmt.Errorf("%w: type must be %s or %s", ErrInvalidGTT, model.GTTTypeSingle, model.GTTTypeOCO)
+	}
+	defaultQuantity := 0
+
+	switch {
+	case req.ExecutionOrderID != nil:
+		// 1a. An executed order: it must be this user's and at the broker
+		if req.ExecutionID == nil {
+			return nil, fmt.Errorf("%w: executionId is required with executionOrderId", ErrInvalidGTT)
+		}
+		execution, err := s.executionRepo.FindByID(ctx, *req.ExecutionID)
+		if err != nil {
+			return nil, err
+		}
+		if execution.UserID != userID {
+			return nil, repository.ErrExecutionNotFound
+		}
+		var order *model.ExecutionOrder
+		for i := range execution.Orders {
+			if execution.Orders[i].ID == *req.ExecutionOrderID {
+				order = &execution.Orders[i]
+			}
+		}
+		if order == nil {
+			return nil, repository.ErrExecutionOrderNotFound
+		}
+		if order.Status != model.OrderStatusPlaced {
+			return nil, fmt.Errorf("%w: order %s was not placed", ErrInvalidGTT, order.Symbol)
+		}
+		gtt.BasketID = execution.BasketID
+		gtt.ExecutionOrderID = &order.ID
+		gtt.Symbol, gtt.Exchange, gtt.Product = order.Symbol, order.Exchange, order.Product
+		if gtt.TransactionType == "" && order.TransactionType == model.TransactionSell {
+			gtt.TransactionType = model.TransactionBuy // Re-enter after an exit
+		}
+		defaultQuantity = order.Quantity
+
+	case req.BasketID != nil:
+		// 1b. A basket item
+		basket, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, *req.BasketID, userID, model.OrgPermissionExecutor)
+		if err != nil {
+			return nil, err
+		}
+		for _, stock := range basket.Stocks {
+			if stock.Symbol == req.Symbol {
+				defaultQuantity = stock.Quantity
+			}
+		}
+		if defaultQuantity == 0 {
+			return nil, fmt.Errorf("%w: %s is not in the basket", ErrInvalidGTT, req.Symbol)
+		}
+		gtt.BasketID = &basket.ID
+
+	default:
+		return nil, fmt.Errorf("%w: basketId or executionOrderId is required", ErrInvalidGTT)
+	}
+
+	// 2. Defaults
+	if gtt.Exchange == "" {
+		gtt.Exchange = model.ExchangeNSE
+	}
+	if gtt.TransactionType == "" {
+		gtt.TransactionType = model.TransactionSell
+	}
+	if gtt.TransactionType != model.TransactionBuy && gtt.TransactionType != model.TransactionSell {
+		return nil, fmt.Errorf("%w: transactionType must be %s or %s", ErrInvalidGTT, model.TransactionBuy, model.TransactionSell)
+	}
+	if gtt.Product == "" {
+		gtt.Product = model.ProductCNC
+	}
+	for i := range gtt.Legs {
+		if gtt.Legs[i].Quantity == 0 {
+			gtt.Legs[i].Quantity = defaultQuantity
+		}
+	}
+	return gtt, nil
+}
+
+// placeGTT places a trigger at the broker and stores it.
+func (s *gttService) placeGTT(ctx context.Context, userID uuid.UUID, accessToken string, gtt *model.GTT) error {
+	triggerID, err := s.kiteAdapter.PlaceGTT(ctx, accessToken, *gtt)
+	if err != nil {
+		log.Printf("Service: Failed to place gtt trigger for %s (user %s): %v", gtt.Symbol, userID, err)
+		return s.brokerGTTError(ctx, userID, err)
+	}
+
+	now := time.Now().UTC()
+	gtt.ID = uuid.New()
+	gtt.BrokerTriggerID = triggerID
+	gtt.Status = model.GTTStatusActive
+	gtt.CreatedAt = now
+	gtt.UpdatedAt = now
+	// The trigger exists at the broker now, so record it even if the client went away
+	if err := s.gttRepo.Create(context.WithoutCancel(ctx), gtt); err != nil {
+		log.Printf("Service: Broker created gtt trigger %d for %s but recording it failed: %v", triggerID, gtt.Symbol, err)
+		return fmt.Errorf("gtt trigger %d was created at the broker but could not be recorded: %w", triggerID, err)
+	}
+	log.Printf("Service: Placed %s gtt trigger %d for %s (user %s)", gtt.Type, triggerID, gtt.Symbol, userID)
+	return nil
+}
+
+// lastPrice returns an instrument's last traded price.
+func (s *gttService) lastPrice(ctx context.Context, userID uuid.UUID, accessToken, exchange, symbol string) (float64, error) {
+	instrument := exchange + ":" + symbol
+	prices, err := s.kiteAdapter.GetLTP(ctx, accessToken, []string{instrument})
+	if err != nil {
+		log.Printf("Service: Failed to fetch price of %s for user %s: %v", instrument, userID, err)
+		return 0, handleKiteError(ctx, s.brokerRepo, userID, err)
+	}
+	price, ok := prices[instrument]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown instrument %s", ErrInvalidGTT, instrument)
+	}
+	return price, nil
+}
+
+// brokerGTTError maps a failed GTT call: refusals become ErrBrokerRejectedGTT, session
+// problems a BrokerReauthRequiredError.
+func (s *gttService) brokerGTTError(ctx context.Context, userID uuid.UUID, err error) error {
+	if kiteadapter.IsOrderError(err) {
+		return fmt.Errorf("%w: %v", ErrBrokerRejectedGTT, err)
+	}
+	return handleKiteError(ctx, s.brokerRepo, userID, err)
+}
+
+// validateGTTLegs checks a trigger's legs: one for a single trigger; for OCO a stop-loss
+// below and a target above the last price.
+func validateGTTLegs(gttType string, legs []model.GTTLeg, lastPrice float64) error {
+	want := 1
+	if gttType == model.GTTTypeOCO {
+		want = 2
+	}
+	if len(legs) != want {
+		return fmt.Errorf("%w: a %s trigger needs %d legs", ErrInvalidGTT, gttType, want)
+	}
+	for i, leg := range legs {
+		if leg.TriggerPrice <= 0 || leg.LimitPrice <= 0 || leg.Quantity <= 0 {
+			return fmt.Errorf("%w: leg #%d needs a positive trigger price, limit price and quantity", ErrInvalidGTT, i+1)
+		}
+	}
+	switch {
+	case gttType == model.GTTTypeSingle && legs[0].TriggerPrice == lastPrice:
+		return fmt.Errorf("%w: the trigger price must differ from the last price (%.2f)", ErrInvalidGTT, lastPrice)
+	case gttType == model.GTTTypeOCO && !(legs[0].TriggerPrice < lastPrice && lastPrice < legs[1].TriggerPrice):
+		return fmt.Errorf("%w: the stop-loss trigger must be below and the target above the last price (%.2f)", ErrInvalidGTT, lastPrice)
+	}
+	return nil
+}
+
+// roundToTick rounds a price to the NSE equity tick size of 5 paise.
+func roundToTick(price float64) float64 {
+	return math.Round(math.Round(price*20)/20*100) / 100
+}
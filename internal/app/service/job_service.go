@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/market"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidJobFilter is returned for a job listing filter that isn't a job status.
+var ErrInvalidJobFilter = errors.New("invalid job status filter")
+
+const (
+	defaultJobPageSize = 50
+	maxJobPageSize     = 200
+)
+
+// --- Interface Definition ---
+
+// JobService queues basket executions for the background workers and reports on them.
+type JobService interface {
+	// EnqueueExecute queues executing a basket and returns the job. What can be checked up
+	// front is checked here (basket access, broker session, market hours); the rest, such as
+	// the margin check, happens when a worker runs the job and ends up in its status.
+	EnqueueExecute(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.Job, error)
+	// EnqueueExit queues exiting a basket, like EnqueueExecute.
+	EnqueueExit(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.Job, error)
+	// GetJob returns a job the user queued.
+	GetJob(ctx context.Context, jobID uuid.UUID, userID uuid.UUID) (*model.Job, error)
+
+	// ListJobs returns the jobs of every user, newest first, optionally only those with
+	// status (e.g. dead). For support staff and admins.
+	ListJobs(ctx context.Context, status string, limit int) ([]model.Job, error)
+	// RetryJob queues a failed or dead job again with a fresh set of attempts.
+	RetryJob(ctx context.Context, jobID uuid.UUID) (*model.Job, error)
+}
+
+// --- Implementation ---
+
+type jobService struct {
+	jobRepo    repository.JobRepository
+	basketRepo repository.BasketRepository
+	orgRepo    repository.OrganizationRepository
+	brokerRepo repository.BrokerRepository
+	calendar   *market.Calendar
+	cfg        config.JobQueueConfig
+}
+
+// NewJobService creates a new JobService instance.
+func NewJobService(
+	jr repository.JobRepository,
+	br repository.BasketRepository,
+	or repository.OrganizationRepository,
+	bkr repository.BrokerRepository,
+	cal *market.Calendar,
+	cfg config.JobQueueConfig,
+) JobService {
+	return &jobService{
+		jobRepo:    jr,
+		basketRepo: br,
+		orgRepo:    or,
+		brokerRepo: bkr,
+		calendar:   cal,
+		cfg:        cfg,
+	}
+}
+
+// EnqueueExecute implements JobService.
+func (s *jobService) EnqueueExecute(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExecutionOptions) (*model.Job, error) {
+	return s.enqueueBasketJob(ctx, model.JobTypeBasketExecute, userID, opts, model.BasketJobPayload{
+		BasketID: basketID,
+		Options:  opts,
+	})
+}
+
+// EnqueueExit implements JobService.
+func (s *jobService) EnqueueExit(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, opts model.ExitOptions) (*model.Job, error) {
+	return s.enqueueBasketJob(ctx, model.JobTypeBasketExit, userID, opts.ExecutionOptions, model.BasketJobPayload{
+		BasketID: basketID,
+		Exit:     &opts,
+	})
+}
+
+// enqueueBasketJob checks what a basket job needs before it is queued, then queues it.
+func (s *jobService) enqueueBasketJob(ctx context.Context, jobType string, userID uuid.UUID, opts model.ExecutionOptions, payload model.BasketJobPayload) (*model.Job, error) {
+	// 1. Fail fast on what the worker would refuse anyway
+	if _, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, payload.BasketID, userID, model.OrgPermissionExecutor); err != nil {
+		return nil, err
+	}
+	if _, err := kiteAccessToken(ctx, s.brokerRepo, userID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !s.calendar.IsOpen(now) && !opts.AMO {
+		return nil, &MarketClosedError{Session: s.calendar.SessionAt(now), NextOpen: s.calendar.NextOpen(now)}
+	}
+
+	// 2. Queue the job. The execution ID is fixed now, so a retry can't execute twice.
+	payload.ExecutionID = uuid.New()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+	now = now.UTC()
+	job := &model.Job{
+		ID:          uuid.New(),
+		Type:        jobType,
+		UserID:      userID,
+		Payload:     data,
+		Status:      model.JobStatusQueued,
+		MaxAttempts: s.cfg.MaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.jobRepo.Create(ctx, job); err != nil {
+		log.Printf("Service: Failed to queue %s job for basket %s: %v", jobType, payload.BasketID, err)
+		return nil, fmt.Errorf("could not queue job: %w", err)
+	}
+	log.Printf("Service: Queued %s job %s for basket %s, user %s (execution %s)",
+		jobType, job.ID, payload.BasketID, userID, payload.ExecutionID)
+	return job, nil
+}
+
+// GetJob implements JobService.
+func (s *jobService) GetJob(ctx context.Context, jobID uuid.UUID, userID uuid.UUID) (*model.Job, error) {
+	return s.jobRepo.FindByID(ctx, jobID, userID)
+}
+
+// ListJobs implements JobService.
+func (s *jobService) ListJobs(ctx context.Context, status string, limit int) ([]model.Job, error) {
+	switch status {
+	case "", model.JobStatusQueued, model.JobStatusRunning, model.JobStatusSucceeded, model.JobStatusFailed, model.JobStatusDead:
+	default:
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidJobFilter, status)
+	}
+	if limit <= 0 {
+		limit = defaultJobPageSize
+	}
+	if limit > maxJobPageSize {
+		limit = maxJobPageSize
+	}
+	return s.jobRepo.List(ctx, status, limit)
+}
+
+// RetryJob implements JobService.
+func (s *jobService) RetryJob(ctx context.Context, jobID uuid.UUID) (*model.Job, error) {
+	job, err := s.jobRepo.Requeue(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Service: Requeued %s job %s", job.Type, job.ID)
+	return job, nil
+}
@@ -2,24 +2,44 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	// Use your actual module path
 	kiteadapter "github.com/AMANSRI99/StockSaaS/internal/adapter/broker/kiteconnect"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
 	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
-	"github.com/AMANSRI99/StockSaaS/internal/common/encryptutil"
 	"github.com/AMANSRI99/StockSaaS/internal/config"
 
 	"github.com/google/uuid"
 )
 
+// ErrInvalidOAuthState is returned when a callback's state is unknown, expired or already used.
+var ErrInvalidOAuthState = errors.New("invalid, expired or already used oauth state")
+
+// oauthStateExpiry bounds how long the user can take on the Kite login page.
+const oauthStateExpiry = 10 * time.Minute
+
 // --- Interface Definition ---
 
 // KiteService defines the interface for Kite Connect related business logic.
 type KiteService interface {
-	// CompleteAuthentication exchanges the request token from the callback,
-	// encrypts the access token, and saves the broker credentials for the user.
+	// CreateOAuthState stores a single-use state for the user starting the connect flow
+	// and returns it (only its hash is stored).
+	CreateOAuthState(ctx context.Context, userID uuid.UUID) (string, error)
+
+	// ConsumeOAuthState validates a state from the callback and returns the user who created it.
+	// Each state works once; returns ErrInvalidOAuthState otherwise.
+	ConsumeOAuthState(ctx context.Context, state string) (uuid.UUID, error)
+
+	// CompleteAuthentication exchanges the request token from the callback
+	// and saves the broker credentials for the user (the repository encrypts the token).
 	CompleteAuthentication(ctx context.Context, userID uuid.UUID, requestToken string) error
 }
 
@@ -28,25 +48,62 @@ type KiteService interface {
 type kiteService struct {
 	kiteAdapter *kiteadapter.Adapter
 	brokerRepo  repository.BrokerRepository
-	cfg         config.AppConfig // Need APISecret and EncryptionKey
+	stateRepo   repository.OAuthStateRepository
+	cfg         config.AppConfig // Need APISecret
 }
 
 // NewKiteService creates a new KiteService instance.
-func NewKiteService(ka *kiteadapter.Adapter, br repository.BrokerRepository, cfg config.AppConfig) KiteService {
+func NewKiteService(ka *kiteadapter.Adapter, br repository.BrokerRepository, sr repository.OAuthStateRepository, cfg config.AppConfig) KiteService {
 	return &kiteService{
 		kiteAdapter: ka,
 		brokerRepo:  br,
+		stateRepo:   sr,
 		cfg:         cfg,
 	}
 }
 
+// CreateOAuthState implements KiteService.
+func (s *kiteService) CreateOAuthState(ctx context.Context, userID uuid.UUID) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	state := base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := s.stateRepo.Create(ctx, hashOAuthState(state), userID, time.Now().Add(oauthStateExpiry)); err != nil {
+		log.Printf("Service: Failed to store OAuth state for user %s: %v", userID, err)
+		return "", fmt.Errorf("failed to store oauth state")
+	}
+	return state, nil
+}
+
+// ConsumeOAuthState implements KiteService.
+func (s *kiteService) ConsumeOAuthState(ctx context.Context, state string) (uuid.UUID, error) {
+	if state == "" {
+		return uuid.Nil, ErrInvalidOAuthState
+	}
+	userID, err := s.stateRepo.Consume(ctx, hashOAuthState(state))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthStateNotFound) {
+			return uuid.Nil, ErrInvalidOAuthState
+		}
+		return uuid.Nil, fmt.Errorf("failed to check oauth state: %w", err)
+	}
+	return userID, nil
+}
+
+func hashOAuthState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
 // CompleteAuthentication handles the final step of the OAuth flow.
 func (s *kiteService) CompleteAuthentication(ctx context.Context, userID uuid.UUID, requestToken string) error {
 	log.Printf("Service: Completing Kite authentication for user %s", userID)
 
 	// 1. Exchange request_token for access_token using the adapter
 	log.Printf("Service: Exchanging request token for user %s", userID)
-	session, err := s.kiteAdapter.GenerateSession(requestToken, s.cfg.Kite.APISecret)
+	session, err := s.kiteAdapter.GenerateSession(ctx, requestToken, s.cfg.Kite.APISecret)
 	if err != nil {
 		log.Printf("Service: Failed to generate Kite session for user %s: %v", userID, err)
 		// Check for specific Kite errors if needed, otherwise wrap generally
@@ -62,23 +119,18 @@ func (s *kiteService) CompleteAuthentication(ctx context.Context, userID uuid.UU
 		return fmt.Errorf("incomplete session data received from broker")
 	}
 
-	// 2. Encrypt the received access token
-	accessTokenBytes := []byte(session.AccessToken)
-	encryptedAccessToken, err := encryptutil.Encrypt(accessTokenBytes, s.cfg.EncryptionKey)
-	if err != nil {
-		log.Printf("Service: Failed to encrypt access token for user %s: %v", userID, err)
-		// This is an internal error, don't expose details directly
-		return fmt.Errorf("internal security error processing credentials")
-	}
-
-	// 3. Save the credentials using the broker repository
-	log.Printf("Service: Saving broker credentials for user %s", userID)
+	// 2. Save the credentials using the broker repository.
+	// The repository is the only layer that encrypts the token, pass it in plain.
+	// Kite doesn't return an expiry; every token dies at the next daily cutoff.
+	expiresAt := model.KiteTokenExpiry(time.Now())
+	log.Printf("Service: Saving broker credentials for user %s (token expires %s)", userID, expiresAt.Format(time.RFC3339))
 	err = s.brokerRepo.SaveOrUpdateKiteCredentials(
 		ctx,
 		userID,
-		encryptedAccessToken, // Pass encrypted bytes
+		[]byte(session.AccessToken),
 		session.PublicToken,
 		session.UserID, // This is Kite's User ID
+		expiresAt,
 	)
 	if err != nil {
 		log.Printf("Service: Failed to save broker credentials for user %s: %v", userID, err)
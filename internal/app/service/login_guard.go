@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/config"
+)
+
+// Errors returned when login is refused because of too many failed attempts.
+// They are always wrapped in a *LoginBlockedError carrying the retry delay.
+var (
+	ErrLoginThrottled = errors.New("too many failed login attempts, try again later")
+	ErrAccountLocked  = errors.New("account temporarily locked due to too many failed login attempts")
+)
+
+// LoginBlockedError is returned by Login when the email or client IP is currently blocked.
+// Use errors.Is with ErrLoginThrottled / ErrAccountLocked to tell the two apart.
+type LoginBlockedError struct {
+	Err        error         // ErrLoginThrottled or ErrAccountLocked
+	RetryAfter time.Duration // How long until a new attempt is accepted
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Err
+}
+
+// loginGuard implements brute-force protection for login.
+//
+// Failures are counted per email and per client IP. For emails, every failure after
+// FreeAttempts blocks the next attempt for an exponentially growing delay, and reaching
+// LockoutThreshold locks the account for LockoutDuration. Client IPs are shared by many
+// users (offices, mobile carriers), so they only start backing off after LockoutThreshold
+// failures and are locked at IPLockoutThreshold.
+type loginGuard struct {
+	store repository.LoginAttemptStore
+	cfg   config.LoginProtectionConfig
+	now   func() time.Time
+}
+
+func newLoginGuard(store repository.LoginAttemptStore, cfg config.LoginProtectionConfig) *loginGuard {
+	return &loginGuard{
+		store: store,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+func emailAttemptKey(email string) string { return "email:" + strings.ToLower(email) }
+func ipAttemptKey(ip string) string       { return "ip:" + ip }
+
+// check returns a *LoginBlockedError if the email or the client IP is currently blocked.
+func (g *loginGuard) check(ctx context.Context, email, clientIP string) error {
+	now := g.now()
+	for _, key := range g.keys(email, clientIP) {
+		attempt, err := g.store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to check login attempts: %w", err)
+		}
+		if attempt.LockedUntil.After(now) {
+			log.Printf("Service: Login blocked for %s until %s (%d failures)", key, attempt.LockedUntil.Format(time.RFC3339), attempt.FailedCount)
+			return &LoginBlockedError{
+				Err:        g.blockReason(attempt),
+				RetryAfter: attempt.LockedUntil.Sub(now),
+			}
+		}
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt and applies backoff or lockout.
+// Errors are only logged: failing to count must not turn into a different login error.
+func (g *loginGuard) recordFailure(ctx context.Context, email, clientIP string) {
+	now := g.now()
+	for _, key := range g.keys(email, clientIP) {
+		attempt, err := g.store.RecordFailure(ctx, key, now, g.cfg.FailureWindow)
+		if err != nil {
+			log.Printf("Service: Failed to record login failure for %s: %v", key, err)
+			continue
+		}
+
+		delay := g.delayFor(key, attempt.FailedCount)
+		if delay <= 0 {
+			continue
+		}
+		if err := g.store.LockUntil(ctx, key, now.Add(delay)); err != nil {
+			log.Printf("Service: Failed to apply login backoff for %s: %v", key, err)
+			continue
+		}
+		log.Printf("Service: %s has %d failed logins, blocking for %s", key, attempt.FailedCount, delay)
+	}
+}
+
+// recordSuccess clears the failure counter of the email. The IP counter is left
+// to expire on its own, otherwise one valid account would reset an attacker's IP budget.
+func (g *loginGuard) recordSuccess(ctx context.Context, email string) {
+	if err := g.store.Reset(ctx, emailAttemptKey(email)); err != nil {
+		log.Printf("Service: Failed to reset login attempts for %s: %v", email, err)
+	}
+}
+
+// unlock clears failures and locks for the given email and/or IP.
+func (g *loginGuard) unlock(ctx context.Context, email, clientIP string) error {
+	for _, key := range g.keys(email, clientIP) {
+		if err := g.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delayFor returns how long key must wait after its n-th failure (0 = no wait).
+func (g *loginGuard) delayFor(key string, failures int) time.Duration {
+	freeAttempts, lockoutThreshold := g.cfg.FreeAttempts, g.cfg.LockoutThreshold
+	if strings.HasPrefix(key, "ip:") {
+		freeAttempts, lockoutThreshold = g.cfg.LockoutThreshold, g.cfg.IPLockoutThreshold
+	}
+
+	if failures >= lockoutThreshold {
+		return g.cfg.LockoutDuration
+	}
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	delay := g.cfg.BackoffBase
+	for i := freeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= g.cfg.BackoffMax {
+			return g.cfg.BackoffMax
+		}
+	}
+	return delay
+}
+
+// blockReason distinguishes an account lockout from backoff throttling.
+func (g *loginGuard) blockReason(attempt *model.LoginAttempt) error {
+	if strings.HasPrefix(attempt.Key, "email:") && attempt.FailedCount >= g.cfg.LockoutThreshold {
+		return ErrAccountLocked
+	}
+	return ErrLoginThrottled
+}
+
+// keys returns the attempt keys for a login, skipping empty values.
+func (g *loginGuard) keys(email, clientIP string) []string {
+	keys := make([]string, 0, 2)
+	if email != "" {
+		keys = append(keys, emailAttemptKey(email))
+	}
+	if clientIP != "" {
+		keys = append(keys, ipAttemptKey(clientIP))
+	}
+	return keys
+}
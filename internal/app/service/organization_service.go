@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the organization service (and by basket operations on organization baskets).
+var (
+	ErrOrgPermissionDenied     = errors.New("insufficient permission in organization")
+	ErrInvalidOrgPermission    = errors.New("invalid organization permission")
+	ErrLastOrgOwner            = errors.New("an organization must keep at least one owner")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+)
+
+// invitationLifetime is how long an invitation token can be accepted.
+const invitationLifetime = 7 * 24 * time.Hour
+
+// --- Interface Definition ---
+
+// OrganizationService defines team workspace operations. userID is always the acting user.
+// Organizations the user isn't a member of are reported as repository.ErrOrganizationNotFound.
+type OrganizationService interface {
+	CreateOrganization(ctx context.Context, name string, userID uuid.UUID) (*model.Organization, error)
+	ListOrganizations(ctx context.Context, userID uuid.UUID) ([]model.Organization, error)
+	GetOrganization(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*model.Organization, error)
+	// DeleteOrganization deletes the organization and all of its baskets (owners only).
+	DeleteOrganization(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error
+
+	ListMembers(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) ([]model.OrganizationMember, error)
+	UpdateMemberPermission(ctx context.Context, orgID uuid.UUID, memberID uuid.UUID, permission string, userID uuid.UUID) error
+	// RemoveMember removes a member (owners only), or lets a member leave when memberID == userID.
+	RemoveMember(ctx context.Context, orgID uuid.UUID, memberID uuid.UUID, userID uuid.UUID) error
+
+	// InviteMember creates an invitation for email. The returned token is only available here
+	// and must be passed to the invitee, who accepts it while logged in with that email.
+	InviteMember(ctx context.Context, orgID uuid.UUID, email string, permission string, userID uuid.UUID) (*model.OrganizationInvitation, string, error)
+	ListInvitations(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) ([]model.OrganizationInvitation, error)
+	RevokeInvitation(ctx context.Context, orgID uuid.UUID, invitationID uuid.UUID, userID uuid.UUID) error
+	AcceptInvitation(ctx context.Context, token string, userID uuid.UUID) (*model.OrganizationMember, error)
+}
+
+// --- Implementation ---
+
+type organizationService struct {
+	orgRepo  repository.OrganizationRepository
+	userRepo repository.UserRepository
+}
+
+// NewOrganizationService creates a new organization service instance.
+func NewOrganizationService(orgRepo repository.OrganizationRepository, userRepo repository.UserRepository) OrganizationService {
+	return &organizationService{
+		orgRepo:  orgRepo,
+		userRepo: userRepo,
+	}
+}
+
+// CreateOrganization creates an organization with the user as its owner.
+func (s *organizationService) CreateOrganization(ctx context.Context, name string, userID uuid.UUID) (*model.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("organization name cannot be empty")
+	}
+
+	now := time.Now().UTC()
+	org := &model.Organization{
+		ID:         uuid.New(),
+		Name:       name,
+		CreatedBy:  userID,
+		Permission: model.OrgPermissionOwner,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	log.Printf("Service: Creating organization %s for user %s", org.ID, userID)
+	if err := s.orgRepo.Create(ctx, org, userID); err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	return org, nil
+}
+
+// ListOrganizations lists the organizations the user belongs to.
+func (s *organizationService) ListOrganizations(ctx context.Context, userID uuid.UUID) ([]model.Organization, error) {
+	orgs, err := s.orgRepo.FindAllByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve organizations: %w", err)
+	}
+	return orgs, nil
+}
+
+// GetOrganization returns an organization the user is a member of.
+func (s *organizationService) GetOrganization(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*model.Organization, error) {
+	member, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionViewer)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.orgRepo.FindByID(ctx, orgID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to retrieve organization %s: %w", orgID, err)
+	}
+	org.Permission = member.Permission
+	return org, nil
+}
+
+// DeleteOrganization deletes an organization.
+func (s *organizationService) DeleteOrganization(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error {
+	if _, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionOwner); err != nil {
+		return err
+	}
+
+	log.Printf("Service: User %s deleting organization %s", userID, orgID)
+	if err := s.orgRepo.Delete(ctx, orgID); err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete organization %s: %w", orgID, err)
+	}
+	return nil
+}
+
+// ListMembers lists the members of an organization the user belongs to.
+func (s *organizationService) ListMembers(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) ([]model.OrganizationMember, error) {
+	if _, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionViewer); err != nil {
+		return nil, err
+	}
+	members, err := s.orgRepo.ListMembers(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve members of organization %s: %w", orgID, err)
+	}
+	return members, nil
+}
+
+// UpdateMemberPermission changes a member's permission (owners only).
+func (s *organizationService) UpdateMemberPermission(ctx context.Context, orgID uuid.UUID, memberID uuid.UUID, permission string, userID uuid.UUID) error {
+	if !model.IsValidOrgPermission(permission) {
+		return fmt.Errorf("%w: '%s'", ErrInvalidOrgPermission, permission)
+	}
+	if _, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionOwner); err != nil {
+		return err
+	}
+
+	target, err := s.orgRepo.GetMember(ctx, orgID, memberID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrgMemberNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to retrieve member %s: %w", memberID, err)
+	}
+	if target.Permission == model.OrgPermissionOwner && permission != model.OrgPermissionOwner {
+		if err := s.ensureAnotherOwner(ctx, orgID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Service: Setting permission '%s' for member %s of organization %s", permission, memberID, orgID)
+	if err := s.orgRepo.UpdateMemberPermission(ctx, orgID, memberID, permission); err != nil {
+		if errors.Is(err, repository.ErrOrgMemberNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update member %s: %w", memberID, err)
+	}
+	return nil
+}
+
+// RemoveMember removes a member or lets the user leave.
+func (s *organizationService) RemoveMember(ctx context.Context, orgID uuid.UUID, memberID uuid.UUID, userID uuid.UUID) error {
+	required := model.OrgPermissionOwner
+	if memberID == userID {
+		required = model.OrgPermissionViewer // Anyone can leave
+	}
+	actor, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, required)
+	if err != nil {
+		return err
+	}
+
+	target := actor
+	if memberID != userID {
+		target, err = s.orgRepo.GetMember(ctx, orgID, memberID)
+		if err != nil {
+			if errors.Is(err, repository.ErrOrgMemberNotFound) {
+				return err
+			}
+			return fmt.Errorf("failed to retrieve member %s: %w", memberID, err)
+		}
+	}
+	if target.Permission == model.OrgPermissionOwner {
+		if err := s.ensureAnotherOwner(ctx, orgID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Service: Removing member %s from organization %s (by %s)", memberID, orgID, userID)
+	if err := s.orgRepo.RemoveMember(ctx, orgID, memberID); err != nil {
+		if errors.Is(err, repository.ErrOrgMemberNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to remove member %s: %w", memberID, err)
+	}
+	return nil
+}
+
+// InviteMember creates an invitation (owners only).
+func (s *organizationService) InviteMember(ctx context.Context, orgID uuid.UUID, email string, permission string, userID uuid.UUID) (*model.OrganizationInvitation, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, "", fmt.Errorf("a valid email address is required")
+	}
+	if !model.IsValidOrgPermission(permission) {
+		return nil, "", fmt.Errorf("%w: '%s'", ErrInvalidOrgPermission, permission)
+	}
+	if _, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionOwner); err != nil {
+		return nil, "", err
+	}
+
+	// Don't invite people who are already in
+	if invitee, err := s.userRepo.FindByEmail(ctx, email); err == nil {
+		if _, err := s.orgRepo.GetMember(ctx, orgID, invitee.ID); err == nil {
+			return nil, "", repository.ErrOrgMemberExists
+		}
+	}
+
+	token, err := generateInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	inv := &model.OrganizationInvitation{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Email:          email,
+		Permission:     permission,
+		InvitedBy:      userID,
+		TokenHash:      hashInvitationToken(token),
+		ExpiresAt:      now.Add(invitationLifetime),
+		CreatedAt:      now,
+	}
+
+	log.Printf("Service: User %s inviting %s to organization %s as %s", userID, email, orgID, permission)
+	if err := s.orgRepo.CreateInvitation(ctx, inv); err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return inv, token, nil
+}
+
+// ListInvitations lists pending invitations (owners only).
+func (s *organizationService) ListInvitations(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) ([]model.OrganizationInvitation, error) {
+	if _, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionOwner); err != nil {
+		return nil, err
+	}
+	invitations, err := s.orgRepo.ListPendingInvitations(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation deletes an invitation (owners only).
+func (s *organizationService) RevokeInvitation(ctx context.Context, orgID uuid.UUID, invitationID uuid.UUID, userID uuid.UUID) error {
+	if _, err := requireOrgPermission(ctx, s.orgRepo, orgID, userID, model.OrgPermissionOwner); err != nil {
+		return err
+	}
+	if err := s.orgRepo.DeleteInvitation(ctx, orgID, invitationID); err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to revoke invitation %s: %w", invitationID, err)
+	}
+	return nil
+}
+
+// AcceptInvitation adds the user to the organization if the token is valid and was sent to their email.
+func (s *organizationService) AcceptInvitation(ctx context.Context, token string, userID uuid.UUID) (*model.OrganizationMember, error) {
+	inv, err := s.orgRepo.FindInvitationByTokenHash(ctx, hashInvitationToken(strings.TrimSpace(token)))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to look up invitation: %w", err)
+	}
+	now := time.Now().UTC()
+	if inv.AcceptedAt != nil || now.After(inv.ExpiresAt) {
+		return nil, repository.ErrInvitationNotFound
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	if !strings.EqualFold(user.Email, inv.Email) {
+		log.Printf("Service: User %s tried to accept invitation %s sent to another email", userID, inv.ID)
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	member := &model.OrganizationMember{
+		OrganizationID: inv.OrganizationID,
+		UserID:         userID,
+		Email:          user.Email,
+		Permission:     inv.Permission,
+		JoinedAt:       now,
+	}
+	if err := s.orgRepo.AcceptInvitation(ctx, inv.ID, member); err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) || errors.Is(err, repository.ErrOrgMemberExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	log.Printf("Service: User %s joined organization %s as %s", userID, inv.OrganizationID, inv.Permission)
+	return member, nil
+}
+
+// ensureAnotherOwner fails with ErrLastOrgOwner unless the organization has at least two owners.
+func (s *organizationService) ensureAnotherOwner(ctx context.Context, orgID uuid.UUID) error {
+	members, err := s.orgRepo.ListMembers(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve members of organization %s: %w", orgID, err)
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Permission == model.OrgPermissionOwner {
+			owners++
+		}
+	}
+	if owners < 2 {
+		return ErrLastOrgOwner
+	}
+	return nil
+}
+
+// requireOrgPermission returns the user's membership if it grants at least the required permission.
+// Non-members get repository.ErrOrganizationNotFound so organization IDs can't be probed.
+func requireOrgPermission(ctx context.Context, repo repository.OrganizationRepository, orgID uuid.UUID, userID uuid.UUID, required string) (*model.OrganizationMember, error) {
+	member, err := repo.GetMember(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrgMemberNotFound) {
+			return nil, repository.ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("failed to check membership in organization %s: %w", orgID, err)
+	}
+	if !model.OrgPermissionAllows(member.Permission, required) {
+		log.Printf("Service: User %s has '%s' in organization %s, '%s' required", userID, member.Permission, orgID, required)
+		return nil, ErrOrgPermissionDenied
+	}
+	return member, nil
+}
+
+// generateInvitationToken returns a random URL-safe token.
+func generateInvitationToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/market"
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the schedule service.
+var (
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrRunNotRetryable = errors.New("only missed or failed runs can be retried")
+	ErrMarketClosedNow = errors.New("the market is closed, retry during market hours")
+)
+
+// scheduleGracePeriod is how late a run may start before it counts as missed (e.g. the
+// server was down at its time). It must exceed the scheduler's poll interval.
+const scheduleGracePeriod = 10 * time.Minute
+
+// --- Interface Definition ---
+
+// ScheduleService manages recurring basket executions (SIPs) and runs them when due.
+// Schedules belong to the user who created them; their orders go to that user's broker account.
+type ScheduleService interface {
+	// CreateSchedule validates and stores a schedule for a basket the user can execute.
+	CreateSchedule(ctx context.Context, userID uuid.UUID, spec model.Schedule) (*model.Schedule, error)
+	ListSchedules(ctx context.Context, userID uuid.UUID) ([]model.Schedule, error)
+	GetSchedule(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) (*model.Schedule, error)
+	// UpdateSchedule replaces a schedule's timing, options and flags (not its basket).
+	UpdateSchedule(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID, spec model.Schedule) (*model.Schedule, error)
+	DeleteSchedule(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) error
+
+	// ListRuns returns a schedule's runs, newest first, optionally filtered by status (e.g. missed).
+	ListRuns(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID, status string) ([]model.ScheduleRun, error)
+	// RetryRun queues a missed or failed run for execution now. Only possible during market hours.
+	RetryRun(ctx context.Context, scheduleID uuid.UUID, runID uuid.UUID, userID uuid.UUID) (*model.ScheduleRun, error)
+
+	// RunDue queues the execution of every schedule due at now, or records it as missed. Called
+	// by the scheduler; safe to run on several instances at once.
+	RunDue(ctx context.Context, now time.Time) error
+}
+
+// --- Implementation ---
+
+type scheduleService struct {
+	scheduleRepo repository.ScheduleRepository
+	basketRepo   repository.BasketRepository
+	orgRepo      repository.OrganizationRepository
+	jobService   JobService
+	calendar     *market.Calendar
+}
+
+// NewScheduleService creates a new ScheduleService instance.
+func NewScheduleService(
+	sr repository.ScheduleRepository,
+	br repository.BasketRepository,
+	or repository.OrganizationRepository,
+	js JobService,
+	cal *market.Calendar,
+) ScheduleService {
+	return &scheduleService{
+		scheduleRepo: sr,
+		basketRepo:   br,
+		orgRepo:      or,
+		jobService:   js,
+		calendar:     cal,
+	}
+}
+
+// CreateSchedule implements ScheduleService.
+func (s *scheduleService) CreateSchedule(ctx context.Context, userID uuid.UUID, spec model.Schedule) (*model.Schedule, error) {
+	// 1. Validate
+	if err := s.validateSchedule(ctx, spec.BasketID, userID, &spec); err != nil {
+		return nil, err
+	}
+
+	// 2. Store with the first run
+	now := time.Now().UTC()
+	schedule := &model.Schedule{
+		ID:          uuid.New(),
+		BasketID:    spec.BasketID,
+		UserID:      userID,
+		Frequency:   spec.Frequency,
+		DayOfMonth:  spec.DayOfMonth,
+		DayOfWeek:   spec.DayOfWeek,
+		TimeOfDay:   spec.TimeOfDay,
+		Options:     spec.Options,
+		Enabled:     spec.Enabled,
+		RetryMissed: spec.RetryMissed,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if schedule.Enabled {
+		next := nextScheduleRun(s.calendar, schedule, now)
+		schedule.NextRunAt = &next
+	}
+	if err := s.scheduleRepo.Create(ctx, schedule); err != nil {
+		log.Printf("Service: Failed to create schedule for basket %s: %v", spec.BasketID, err)
+		return nil, fmt.Errorf("could not save schedule: %w", err)
+	}
+	log.Printf("Service: Created %s schedule %s for basket %s (user %s)", schedule.Frequency, schedule.ID, schedule.BasketID, userID)
+	return schedule, nil
+}
+
+// ListSchedules implements ScheduleService.
+func (s *scheduleService) ListSchedules(ctx context.Context, userID uuid.UUID) ([]model.Schedule, error) {
+	return s.scheduleRepo.ListByUser(ctx, userID)
+}
+
+// GetSchedule implements ScheduleService.
+func (s *scheduleService) GetSchedule(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) (*model.Schedule, error) {
+	return s.scheduleRepo.FindByID(ctx, scheduleID, userID)
+}
+
+// UpdateSchedule implements ScheduleService.
+func (s *scheduleService) UpdateSchedule(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID, spec model.Schedule) (*model.Schedule, error) {
+	// 1. Load and validate against the schedule's basket
+	schedule, err := s.scheduleRepo.FindByID(ctx, scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateSchedule(ctx, schedule.BasketID, userID, &spec); err != nil {
+		return nil, err
+	}
+
+	// 2. Apply; the next run follows the new timing
+	schedule.Frequency = spec.Frequency
+	schedule.DayOfMonth = spec.DayOfMonth
+	schedule.DayOfWeek = spec.DayOfWeek
+	schedule.TimeOfDay = spec.TimeOfDay
+	schedule.Options = spec.Options
+	schedule.Enabled = spec.Enabled
+	schedule.RetryMissed = spec.RetryMissed
+	schedule.NextRunAt = nil
+	schedule.UpdatedAt = time.Now().UTC()
+	if schedule.Enabled {
+		next := nextScheduleRun(s.calendar, schedule, schedule.UpdatedAt)
+		schedule.NextRunAt = &next
+	}
+	if err := s.scheduleRepo.Update(ctx, schedule); err != nil {
+		if !errors.Is(err, repository.ErrScheduleNotFound) {
+			log.Printf("Service: Failed to update schedule %s: %v", scheduleID, err)
+		}
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule implements ScheduleService.
+func (s *scheduleService) DeleteSchedule(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID) error {
+	if err := s.scheduleRepo.Delete(ctx, scheduleID, userID); err != nil {
+		return err
+	}
+	log.Printf("Service: Deleted schedule %s (user %s)", scheduleID, userID)
+	return nil
+}
+
+// ListRuns implements ScheduleService.
+func (s *scheduleService) ListRuns(ctx context.Context, scheduleID uuid.UUID, userID uuid.UUID, status string) ([]model.ScheduleRun, error) {
+	switch status {
+	case "", model.ScheduleRunRunning, model.ScheduleRunSucceeded, model.ScheduleRunFailed, model.ScheduleRunMissed:
+	default:
+		return nil, fmt.Errorf("%w: unknown run status '%s'", ErrInvalidSchedule, status)
+	}
+	if _, err := s.scheduleRepo.FindByID(ctx, scheduleID, userID); err != nil {
+		return nil, err
+	}
+
+	// Runs whose job finished get its outcome first, so the status filter sees it
+	running, err := s.scheduleRepo.ListRuns(ctx, scheduleID, model.ScheduleRunRunning)
+	if err != nil {
+		return nil, err
+	}
+	for i := range running {
+		s.settleRun(ctx, &running[i], userID)
+	}
+	return s.scheduleRepo.ListRuns(ctx, scheduleID, status)
+}
+
+// RetryRun implements ScheduleService.
+func (s *scheduleService) RetryRun(ctx context.Context, scheduleID uuid.UUID, runID uuid.UUID, userID uuid.UUID) (*model.ScheduleRun, error) {
+	// 1. Load the run of the user's schedule
+	schedule, err := s.scheduleRepo.FindByID(ctx, scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	run, err := s.scheduleRepo.FindRun(ctx, scheduleID, runID)
+	if err != nil {
+		return nil, err
+	}
+	s.settleRun(ctx, run, userID)
+	if run.Status != model.ScheduleRunMissed && run.Status != model.ScheduleRunFailed {
+		return nil, ErrRunNotRetryable
+	}
+	if !s.calendar.IsOpen(time.Now()) {
+		return nil, ErrMarketClosedNow
+	}
+
+	// 2. Claim it, so a double click can't execute the basket twice
+	claimed, err := s.scheduleRepo.ClaimRetry(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrRunNotRetryable
+	}
+	run.Status = model.ScheduleRunRunning
+	run.Attempts++
+
+	// 3. Queue the execution
+	log.Printf("Service: Retrying run %s of schedule %s (attempt %d)", run.ID, scheduleID, run.Attempts)
+	s.executeRun(ctx, schedule, run)
+	return run, nil
+}
+
+// RunDue implements ScheduleService.
+func (s *scheduleService) RunDue(ctx context.Context, now time.Time) error {
+	due, err := s.scheduleRepo.ListDue(ctx, now)
+	if err != nil {
+		return fmt.Errorf("could not list due schedules: %w", err)
+	}
+	for i := range due {
+		s.runSchedule(ctx, &due[i], now)
+	}
+	return nil
+}
+
+// runSchedule claims a due schedule's run and executes it, or records it as missed when it
+// is too late for it (or the market isn't open).
+func (s *scheduleService) runSchedule(ctx context.Context, schedule *model.Schedule, now time.Time) {
+	// 1. Claim the run by moving the schedule on. Occurrences that passed while nothing
+	// was running are skipped: only the latest one is recorded
+	dueAt := *schedule.NextRunAt
+	next := nextScheduleRun(s.calendar, schedule, now)
+	claimed, err := s.scheduleRepo.ClaimRun(ctx, schedule.ID, dueAt, &next)
+	if err != nil {
+		log.Printf("Service: Failed to claim run of schedule %s: %v", schedule.ID, err)
+		return
+	}
+	if !claimed {
+		return // Another instance has it
+	}
+
+	run := &model.ScheduleRun{
+		ID:           uuid.New(),
+		ScheduleID:   schedule.ID,
+		ScheduledFor: dueAt,
+		Status:       model.ScheduleRunRunning,
+		Attempts:     1,
+		CreatedAt:    now.UTC(),
+		UpdatedAt:    now.UTC(),
+	}
+
+	// 2. Too late, or the market closed (a holiday added after the run was planned)?
+	var missed string
+	late := now.Sub(dueAt) > scheduleGracePeriod
+	sameDay := dueAt.In(market.IST).Format("2006-01-02") == now.In(market.IST).Format("2006-01-02")
+	switch {
+	case !s.calendar.IsOpen(now):
+		missed = "the market was closed when the run was picked up"
+	case late && !(schedule.RetryMissed && sameDay):
+		missed = fmt.Sprintf("not run at its scheduled time (picked up %s late)", now.Sub(dueAt).Round(time.Minute))
+	}
+	if missed != "" {
+		run.Status = model.ScheduleRunMissed
+		run.Attempts = 0
+		run.ErrorMessage = &missed
+	}
+	if err := s.scheduleRepo.CreateRun(ctx, run); err != nil {
+		log.Printf("Service: Failed to record run of schedule %s due at %s: %v", schedule.ID, dueAt, err)
+		return
+	}
+	if missed != "" {
+		log.Printf("Service: Schedule %s missed its run due at %s: %s", schedule.ID, dueAt, missed)
+		return
+	}
+
+	// 3. Queue the execution
+	log.Printf("Service: Running schedule %s (basket %s, due at %s)", schedule.ID, schedule.BasketID, dueAt)
+	s.executeRun(ctx, schedule, run)
+}
+
+// executeRun queues the execution of a schedule's basket for a claimed run, on the job
+// queue like any other execution, and records the job on the run. The run stays running
+// until the job finishes (see settleRun). An expired broker session makes the run missed
+// (the user has to reconnect, then retry).
+func (s *scheduleService) executeRun(ctx context.Context, schedule *model.Schedule, run *model.ScheduleRun) {
+	job, err := s.jobService.EnqueueExecute(ctx, schedule.BasketID, schedule.UserID, schedule.Options)
+	switch {
+	case err == nil:
+		run.JobID = &job.ID
+		run.ExecutionID = queuedExecutionID(job)
+		run.ErrorMessage = nil
+	case errors.Is(err, ErrBrokerReauthRequired):
+		reason := "broker session expired: reconnect your broker account, then retry the run"
+		run.Status = model.ScheduleRunMissed
+		run.ErrorMessage = &reason
+	default:
+		reason := err.Error()
+		if errors.Is(err, repository.ErrBasketNotFound) {
+			reason = "the basket is no longer available to you"
+		}
+		run.Status = model.ScheduleRunFailed
+		run.ErrorMessage = &reason
+	}
+	if run.ErrorMessage != nil {
+		log.Printf("Service: Run %s of schedule %s %s: %s", run.ID, schedule.ID, run.Status, *run.ErrorMessage)
+	}
+
+	// The job is queued whatever happens to the request now
+	if err := s.scheduleRepo.UpdateRun(context.WithoutCancel(ctx), run); err != nil {
+		log.Printf("Service: Failed to record outcome of run %s of schedule %s: %v", run.ID, schedule.ID, err)
+	}
+}
+
+// settleRun records the outcome of a running run's job once the job has finished. A job
+// that failed or exhausted its attempts fails the run, which can then be retried.
+func (s *scheduleService) settleRun(ctx context.Context, run *model.ScheduleRun, userID uuid.UUID) {
+	if run.Status != model.ScheduleRunRunning || run.JobID == nil {
+		return
+	}
+	job, err := s.jobService.GetJob(ctx, *run.JobID, userID)
+	if err != nil {
+		log.Printf("Service: Failed to look up job %s of schedule run %s: %v", *run.JobID, run.ID, err)
+		return
+	}
+	switch job.Status {
+	case model.JobStatusSucceeded:
+		run.Status = model.ScheduleRunSucceeded
+	case model.JobStatusFailed, model.JobStatusDead:
+		reason := "the execution job failed"
+		if job.LastError != nil {
+			reason = *job.LastError
+		}
+		run.Status = model.ScheduleRunFailed
+		run.ErrorMessage = &reason
+	default:
+		return // Still queued or running
+	}
+	if err := s.scheduleRepo.UpdateRun(ctx, run); err != nil {
+		log.Printf("Service: Failed to record outcome of schedule run %s: %v", run.ID, err)
+	}
+}
+
+// queuedExecutionID returns the ID of the execution a basket job was queued with.
+func queuedExecutionID(job *model.Job) *uuid.UUID {
+	var payload model.BasketJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		log.Printf("Service: Failed to read the payload of job %s: %v", job.ID, err)
+		return nil
+	}
+	return &payload.ExecutionID
+}
+
+// validateSchedule checks a schedule's timing and options, and that the user may execute the basket.
+func (s *scheduleService) validateSchedule(ctx context.Context, basketID uuid.UUID, userID uuid.UUID, spec *model.Schedule) error {
+	// 1. Timing
+	switch spec.Frequency {
+	case model.ScheduleMonthly:
+		if spec.DayOfMonth == nil || *spec.DayOfMonth < 1 || *spec.DayOfMonth > 31 {
+			return fmt.Errorf("%w: monthly schedules need a dayOfMonth between 1 and 31", ErrInvalidSchedule)
+		}
+		spec.DayOfWeek = nil
+	case model.ScheduleWeekly:
+		if spec.DayOfWeek == nil || *spec.DayOfWeek < int(time.Monday) || *spec.DayOfWeek > int(time.Friday) {
+			return fmt.Errorf("%w: weekly schedules need a dayOfWeek from 1 (Monday) to 5 (Friday)", ErrInvalidSchedule)
+		}
+		spec.DayOfMonth = nil
+	default:
+		return fmt.Errorf("%w: frequency must be %s or %s", ErrInvalidSchedule, model.ScheduleMonthly, model.ScheduleWeekly)
+	}
+	clock, err := time.Parse("15:04", spec.TimeOfDay)
+	if err != nil {
+		return fmt.Errorf("%w: timeOfDay must be HH:MM (IST)", ErrInvalidSchedule)
+	}
+	if minute := clock.Hour()*60 + clock.Minute(); minute < market.RegularOpenMinute || minute >= market.RegularCloseMinute {
+		return fmt.Errorf("%w: timeOfDay must be within market hours (09:15 to 15:30 IST)", ErrInvalidSchedule)
+	}
+	spec.TimeOfDay = clock.Format("15:04")
+
+	// 2. The basket and options, as an execution would check them
+	basket, err := authorizeBasketAccess(ctx, s.basketRepo, s.orgRepo, basketID, userID, model.OrgPermissionExecutor)
+	if err != nil {
+		return err
+	}
+	if _, err := buildOrderPlan(basket.Stocks, model.TransactionBuy, spec.Options); err != nil {
+		return err
+	}
+	return nil
+}
+
+// nextScheduleRun returns the first occurrence of a schedule strictly after after: the
+// nominal date at the schedule's time, rolled forward to the next trading day if needed.
+func nextScheduleRun(cal *market.Calendar, schedule *model.Schedule, after time.Time) time.Time {
+	clock, _ := time.Parse("15:04", schedule.TimeOfDay) // Validated on save
+	local := after.In(market.IST)
+	roll := func(t time.Time) time.Time {
+		if cal.IsTradingDay(t) {
+			return t
+		}
+		return cal.NextTradingDay(t)
+	}
+
+	if schedule.Frequency == model.ScheduleMonthly {
+		for months := 0; ; months++ {
+			first := time.Date(local.Year(), local.Month()+time.Month(months), 1, clock.Hour(), clock.Minute(), 0, 0, market.IST)
+			lastDay := first.AddDate(0, 1, -1).Day()
+			day := min(*schedule.DayOfMonth, lastDay)
+			if run := roll(first.AddDate(0, 0, day-1)); run.After(after) {
+				return run
+			}
+		}
+	}
+
+	// Weekly: the first matching weekday from after's date on
+	candidate := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, market.IST)
+	for int(candidate.Weekday()) != *schedule.DayOfWeek {
+		candidate = candidate.AddDate(0, 0, 1)
+	}
+	for {
+		if run := roll(candidate); run.After(after) {
+			return run
+		}
+		candidate = candidate.AddDate(0, 0, 7)
+	}
+}
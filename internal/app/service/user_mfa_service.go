@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AMANSRI99/StockSaaS/internal/app/model"
+	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/common/jwtutil"
+	"github.com/AMANSRI99/StockSaaS/internal/common/totputil"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the two-factor authentication flows.
+var (
+	ErrInvalidMFACode      = errors.New("invalid two-factor authentication code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled     = errors.New("two-factor authentication is not set up")
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10 // Characters, excluding the separator
+	totpCodeLength     = 6
+	totpAllowedSkew    = 1 // Accept codes one time step (30s) before/after to tolerate clock drift
+)
+
+// recoveryCodeAlphabet is Crockford's base32 (no i, l, o, u). 32 symbols, so mapping
+// a random byte with % is unbiased.
+const recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// TOTPEnrollment is returned when a user starts setting up TOTP.
+// The ProvisioningURI is meant to be rendered as a QR code by the client.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// BeginTOTPEnrollment generates and stores a new pending TOTP secret.
+func (s *userService) BeginTOTPEnrollment(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error) {
+	log.Printf("Service: Starting TOTP enrollment for user %s", userID)
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totputil.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedSecret, err := s.keyring.Encrypt(ctx, []byte(secret), totpSecretAD(userID))
+	if err != nil {
+		log.Printf("Service: Failed to encrypt TOTP secret for user %s: %v", userID, err)
+		return nil, fmt.Errorf("internal security error processing credentials")
+	}
+
+	if err := s.userRepo.SetTOTPSecret(ctx, userID, encryptedSecret); err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	log.Printf("Service: Pending TOTP secret stored for user %s", userID)
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totputil.ProvisioningURI(secret, s.cfg.MFA.TOTPIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment verifies a code against the pending secret and turns TOTP on.
+func (s *userService) ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	log.Printf("Service: Confirming TOTP enrollment for user %s", userID)
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if len(user.TOTPSecretEncrypted) == 0 {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	// Recovery codes can't be used here: there are none yet.
+	if err := s.verifyTOTPCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.EnableTOTP(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to enable totp: %w", err)
+	}
+
+	log.Printf("Service: TOTP enabled for user %s", userID)
+	return codes, nil
+}
+
+// DisableTOTP turns TOTP off after verifying a TOTP or recovery code.
+func (s *userService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	log.Printf("Service: Disabling TOTP for user %s", userID)
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+	if err := s.userRepo.DisableTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("failed to disable totp: %w", err)
+	}
+
+	log.Printf("Service: TOTP disabled for user %s", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after verifying a TOTP code.
+func (s *userService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	// Require the authenticator itself, a leaked recovery code must not mint new ones.
+	if err := s.verifyTOTPCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	log.Printf("Service: Recovery codes regenerated for user %s", userID)
+	return codes, nil
+}
+
+// CompleteMFALogin exchanges a valid MFA challenge token and code for an access token.
+func (s *userService) CompleteMFALogin(ctx context.Context, mfaToken, code, clientIP string) (string, error) {
+	claims, err := jwtutil.ValidateMFAChallengeToken(mfaToken, s.cfg.JWT.SecretKey)
+	if err != nil {
+		log.Printf("Service: Invalid MFA challenge token: %v", err)
+		return "", ErrInvalidMFAChallenge
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return "", ErrInvalidMFAChallenge
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Printf("Service: Failed to load user %s for MFA login: %v", userID, err)
+		return "", ErrInvalidMFAChallenge
+	}
+	if !user.TOTPEnabled {
+		// TOTP was disabled between the two steps; the challenge is no longer meaningful.
+		return "", ErrInvalidMFAChallenge
+	}
+	if user.DisabledAt != nil {
+		return "", ErrAccountDisabled
+	}
+
+	// Codes are only 6 digits, so guessing them is subject to the same lockout as passwords
+	if err := s.loginGuard.check(ctx, user.Email, clientIP); err != nil {
+		return "", err
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		log.Printf("Service: MFA login failed for user %s: %v", userID, err)
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.loginGuard.recordFailure(ctx, user.Email, clientIP)
+		}
+		return "", err
+	}
+
+	s.loginGuard.recordSuccess(ctx, user.Email)
+	log.Printf("Service: MFA verified for user %s. Generating token.", userID)
+	return s.generateAccessToken(user)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+func (s *userService) verifySecondFactor(ctx context.Context, user *model.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totpCodeLength && isNumeric(code) {
+		return s.verifyTOTPCode(ctx, user, code)
+	}
+
+	err := s.userRepo.ConsumeRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+			return ErrInvalidMFACode
+		}
+		return fmt.Errorf("failed to verify recovery code: %w", err)
+	}
+	log.Printf("Service: Recovery code used for user %s", user.ID)
+	return nil
+}
+
+// verifyTOTPCode checks a code against the user's stored secret and records the
+// matched time step so the same code can't be replayed.
+func (s *userService) verifyTOTPCode(ctx context.Context, user *model.User, code string) error {
+	ad := totpSecretAD(user.ID)
+	secret, err := s.keyring.Decrypt(ctx, user.TOTPSecretEncrypted, ad)
+	if err != nil {
+		log.Printf("Service: Failed to decrypt TOTP secret for user %s: %v", user.ID, err)
+		return fmt.Errorf("internal security error processing credentials")
+	}
+	// Secrets stored before they were bound to their user decrypt without associated data,
+	// so one copied from another account would pass. Like broker tokens, they are only
+	// accepted while unbound credentials are allowed.
+	bound := s.keyring.IsBound(user.TOTPSecretEncrypted)
+	if !bound && !s.cfg.Encryption.AllowUnboundCredentials {
+		log.Printf("Service: TOTP secret of user %s is not bound to the user and unbound credentials are disabled", user.ID)
+		return fmt.Errorf("internal security error processing credentials")
+	}
+
+	step, ok, err := totputil.Validate(code, string(secret), time.Now(), totpAllowedSkew)
+	if err != nil {
+		return fmt.Errorf("failed to validate totp code: %w", err)
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	if err := s.userRepo.ConsumeTOTPStep(ctx, user.ID, step); err != nil {
+		if errors.Is(err, repository.ErrTOTPStepAlreadyConsumed) {
+			return ErrInvalidMFACode
+		}
+		return fmt.Errorf("failed to record totp usage: %w", err)
+	}
+
+	if !bound {
+		s.upgradeUnboundTOTPSecret(ctx, user.ID, user.TOTPSecretEncrypted, secret, ad)
+	}
+	return nil
+}
+
+// upgradeUnboundTOTPSecret rewrites a legacy TOTP secret bound to its user. Failures are
+// only logged: the code was valid, and the next login (or the re-encryption command) will
+// try again.
+func (s *userService) upgradeUnboundTOTPSecret(ctx context.Context, userID uuid.UUID, oldCiphertext, secret, ad []byte) {
+	bound, err := s.keyring.Encrypt(ctx, secret, ad)
+	if err != nil {
+		log.Printf("Service: Warning: failed to re-encrypt TOTP secret for user %s: %v", userID, err)
+		return
+	}
+	if _, err := s.userRepo.ReplaceTOTPSecret(ctx, userID, oldCiphertext, bound); err != nil {
+		log.Printf("Service: Warning: failed to upgrade TOTP secret encryption for user %s: %v", userID, err)
+		return
+	}
+	log.Printf("Service: Upgraded TOTP secret encryption for user %s", userID)
+}
+
+// ReencryptTOTPSecrets implements UserService.
+func (s *userService) ReencryptTOTPSecrets(ctx context.Context, batchSize int) (repository.RewriteStats, error) {
+	var stats repository.RewriteStats
+	if batchSize <= 0 {
+		return stats, fmt.Errorf("batch size must be positive")
+	}
+
+	lastID := uuid.Nil
+	for {
+		batch, err := s.userRepo.ListTOTPSecrets(ctx, lastID, batchSize)
+		if err != nil {
+			return stats, err
+		}
+		for _, row := range batch {
+			stats.Scanned++
+			lastID = row.UserID
+			if !s.keyring.NeedsReencryption(row.Ciphertext) && s.keyring.IsBound(row.Ciphertext) {
+				continue
+			}
+
+			ad := totpSecretAD(row.UserID)
+			secret, err := s.keyring.Decrypt(ctx, row.Ciphertext, ad)
+			if err != nil {
+				log.Printf("Service: Failed to decrypt TOTP secret of user %s: %v", row.UserID, err)
+				stats.Failed++
+				continue
+			}
+			encrypted, err := s.keyring.Encrypt(ctx, secret, ad)
+			if err != nil {
+				return stats, fmt.Errorf("failed to encrypt totp secret of user %s: %w", row.UserID, err)
+			}
+			// Only overwrite the secret we read: a user who re-enrolled meanwhile already has a new one
+			replaced, err := s.userRepo.ReplaceTOTPSecret(ctx, row.UserID, row.Ciphertext, encrypted)
+			if err != nil {
+				return stats, err
+			}
+			if !replaced {
+				stats.Skipped++
+				continue
+			}
+			stats.Rewritten++
+		}
+		log.Printf("Service: TOTP secret rewrite: %d scanned, %d rewritten so far", stats.Scanned, stats.Rewritten)
+
+		if len(batch) < batchSize {
+			return stats, nil
+		}
+	}
+}
+
+// totpSecretAD binds an encrypted TOTP secret to its user, so it can't be copied to another account.
+func totpSecretAD(userID uuid.UUID) []byte {
+	return []byte("users.totp_secret:" + userID.String())
+}
+
+// generateRecoveryCodes returns plain codes (for the user) and their hashes (for storage).
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	buf := make([]byte, recoveryCodeLength)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == recoveryCodeLength/2 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+		code := sb.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode normalizes and hashes a recovery code. Codes are random and
+// high-entropy, so a fast hash is sufficient (unlike passwords).
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.TrimSpace(code))
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// isNumeric reports whether s is a non-empty string of ASCII digits.
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
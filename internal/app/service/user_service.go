@@ -11,6 +11,7 @@ import (
 
 	"github.com/AMANSRI99/StockSaaS/internal/app/model"
 	"github.com/AMANSRI99/StockSaaS/internal/app/repository"
+	"github.com/AMANSRI99/StockSaaS/internal/common/encryptutil"
 	"github.com/AMANSRI99/StockSaaS/internal/common/jwtutil"
 	"github.com/AMANSRI99/StockSaaS/internal/config"
 
@@ -18,6 +19,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Errors returned for accounts an admin has acted on.
+var (
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrSessionRevoked  = errors.New("session has been revoked, please log in again")
+)
+
 // Basic email validation regex
 var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 
@@ -26,21 +33,58 @@ var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`
 // UserService defines the interface for user business logic.
 type UserService interface {
 	Signup(ctx context.Context, email, password string) (*model.User, error)
-	Login(ctx context.Context, email, password string) (string, error) // Add later
+	// Login verifies the password. If the user has TOTP enabled, the result carries
+	// an MFA challenge token instead of an access token.
+	// Returns a *LoginBlockedError if the email or client IP has too many recent failures.
+	Login(ctx context.Context, email, password, clientIP string) (*LoginResult, error)
+	// CompleteMFALogin exchanges an MFA challenge token plus a TOTP or recovery code for an access token.
+	CompleteMFALogin(ctx context.Context, mfaToken, code, clientIP string) (string, error)
+	// UnlockLogin clears failed-attempt counters and lockouts for an email and/or client IP (admin action).
+	UnlockLogin(ctx context.Context, email, clientIP string) error
+	// ValidateSession checks that a token issued at issuedAt may still be used:
+	// returns ErrAccountDisabled or ErrSessionRevoked otherwise.
+	ValidateSession(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error
+
+	// BeginTOTPEnrollment generates a new (pending) TOTP secret for the user.
+	BeginTOTPEnrollment(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error)
+	// ConfirmTOTPEnrollment verifies the first code from the authenticator app, enables TOTP
+	// and returns freshly generated recovery codes (shown to the user only once).
+	ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	// DisableTOTP turns two-factor authentication off. Requires a valid TOTP or recovery code.
+	DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error
+	// RegenerateRecoveryCodes replaces all recovery codes. Requires a valid TOTP code.
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+
+	// ReencryptTOTPSecrets rewrites every stored TOTP secret that isn't encrypted with the
+	// active key (or isn't bound to its user yet), batchSize users at a time. Like broker
+	// tokens, they must all be rewritten before an old key is dropped.
+	ReencryptTOTPSecrets(ctx context.Context, batchSize int) (repository.RewriteStats, error)
+}
+
+// LoginResult is returned by UserService.Login.
+// When MFARequired is true, Token is empty and MFAToken must be exchanged via CompleteMFALogin.
+type LoginResult struct {
+	Token       string
+	MFARequired bool
+	MFAToken    string
 }
 
 // --- Implementation ---
 
 type userService struct {
-	userRepo repository.UserRepository
-	cfg      config.AppConfig // Store app config for JWT secret/expiry later
+	userRepo   repository.UserRepository
+	loginGuard *loginGuard          // Brute-force protection for Login
+	keyring    *encryptutil.Keyring // Encrypts TOTP secrets
+	cfg        config.AppConfig     // Store app config for JWT secret/expiry later
 }
 
 // NewUserService creates a new user service instance.
-func NewUserService(repo repository.UserRepository, cfg config.AppConfig) UserService {
+func NewUserService(repo repository.UserRepository, attempts repository.LoginAttemptStore, keyring *encryptutil.Keyring, cfg config.AppConfig) UserService {
 	return &userService{
-		userRepo: repo,
-		cfg:      cfg, // Store config
+		userRepo:   repo,
+		loginGuard: newLoginGuard(attempts, cfg.LoginProtection),
+		keyring:    keyring,
+		cfg:        cfg, // Store config
 	}
 }
 
@@ -69,6 +113,7 @@ func (s *userService) Signup(ctx context.Context, email, password string) (*mode
 		ID:           uuid.New(),
 		Email:        email, // Use cleaned, lowercased email
 		PasswordHash: string(hashedPassword),
+		Role:         model.RoleUser, // Elevated roles are only granted by an admin
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
@@ -96,51 +141,123 @@ func isEmailValid(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
-// Login verifies credentials and returns a JWT token upon success.
-func (s *userService) Login(ctx context.Context, email, password string) (string, error) {
+// Login verifies credentials and returns a JWT token (or an MFA challenge) upon success.
+func (s *userService) Login(ctx context.Context, email, password, clientIP string) (*LoginResult, error) {
 	log.Printf("Service: Attempting login for email %s", email)
 	email = strings.ToLower(strings.TrimSpace(email))
 
 	// 1. Basic Validation
 	if !isEmailValid(email) {
-		return "", fmt.Errorf("invalid email format provided")
+		return nil, fmt.Errorf("invalid email format provided")
 	}
 	if password == "" {
-		return "", fmt.Errorf("password cannot be empty")
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+
+	// 2. Refuse early if this email or IP is backing off / locked.
+	// This happens before the password check so a locked account can't be used as an oracle.
+	if err := s.loginGuard.check(ctx, email, clientIP); err != nil {
+		return nil, err
 	}
 
-	// 2. Find user by email
+	// 3. Find user by email
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		// If user not found OR other DB error, return generic failure message
 		// DO NOT reveal whether the email exists or not for security.
 		if errors.Is(err, repository.ErrUserNotFound) {
 			log.Printf("Service: Login failed - user not found for email %s", email)
+			// Count unknown emails too, so attempts look the same whether the account exists or not
+			s.loginGuard.recordFailure(ctx, email, clientIP)
 		} else {
 			log.Printf("Service: DB error during login for email %s: %v", email, err)
 		}
-		return "", fmt.Errorf("invalid email or password") // Generic error
+		return nil, fmt.Errorf("invalid email or password") // Generic error
 	}
 
-	// 3. Compare the provided password with the stored hash
+	// 4. Compare the provided password with the stored hash
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
 		// If passwords don't match (or other bcrypt error)
 		log.Printf("Service: Login failed - password mismatch for email %s", email)
+		s.loginGuard.recordFailure(ctx, email, clientIP)
 		// Use the same generic error message
-		return "", fmt.Errorf("invalid email or password")
+		return nil, fmt.Errorf("invalid email or password")
 	}
 
-	// 4. Credentials are valid - Generate JWT
+	// Only tell the caller the account is disabled once they proved they own it
+	if user.DisabledAt != nil {
+		log.Printf("Service: Login refused - account disabled for email %s", email)
+		return nil, ErrAccountDisabled
+	}
+
+	// 5. If two-factor authentication is enabled, the password alone is not enough.
+	// Hand out a short-lived challenge token that must be exchanged with a TOTP code.
+	// Failure counters are only reset once the second factor is verified too.
+	if user.TOTPEnabled {
+		log.Printf("Service: Password valid for user %s (ID: %s), MFA required.", user.Email, user.ID)
+		mfaToken, err := jwtutil.GenerateMFAChallengeToken(user.ID, s.cfg.JWT.SecretKey, s.cfg.MFA.ChallengeExpiry)
+		if err != nil {
+			log.Printf("Service: Error generating MFA challenge for user %s: %v", user.Email, err)
+			return nil, fmt.Errorf("could not generate mfa challenge: %w", err)
+		}
+		return &LoginResult{MFARequired: true, MFAToken: mfaToken}, nil
+	}
+
+	// 6. Credentials are valid - Generate JWT
+	s.loginGuard.recordSuccess(ctx, email)
 	log.Printf("Service: Credentials valid for user %s (ID: %s). Generating token.", user.Email, user.ID)
-	token, err := jwtutil.GenerateToken(user.ID, user.Email, s.cfg.JWT.SecretKey, s.cfg.JWT.ExpiryDuration)
+	token, err := s.generateAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Service: Token generated successfully for user %s", user.Email)
+	// 7. Return the token string
+	return &LoginResult{Token: token}, nil
+}
+
+// generateAccessToken issues the regular JWT access token for an authenticated user.
+func (s *userService) generateAccessToken(user *model.User) (string, error) {
+	token, err := jwtutil.GenerateToken(user.ID, user.Email, user.Role, s.cfg.JWT.SecretKey, s.cfg.JWT.ExpiryDuration)
 	if err != nil {
 		log.Printf("Service: Error generating JWT for user %s: %v", user.Email, err)
 		// This is an internal server error
 		return "", fmt.Errorf("could not generate authentication token: %w", err)
 	}
-
-	log.Printf("Service: Token generated successfully for user %s", user.Email)
-	// 5. Return the token string
 	return token, nil
 }
+
+// UnlockLogin clears brute-force counters and lockouts. Either argument may be empty.
+func (s *userService) UnlockLogin(ctx context.Context, email, clientIP string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" && clientIP == "" {
+		return fmt.Errorf("email or client IP is required")
+	}
+
+	log.Printf("Service: Unlocking login for email '%s', IP '%s'", email, clientIP)
+	if err := s.loginGuard.unlock(ctx, email, clientIP); err != nil {
+		return fmt.Errorf("failed to unlock login: %w", err)
+	}
+	return nil
+}
+
+// ValidateSession is called by the auth middleware on every request.
+func (s *userService) ValidateSession(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrSessionRevoked // User was deleted
+		}
+		return fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	if user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	// JWT issued-at has second precision, so compare at second precision too. Otherwise a token
+	// issued right after a forced logout (same second) would look older than the revocation.
+	if user.SessionsRevokedAt != nil && issuedAt.Before(user.SessionsRevokedAt.Truncate(time.Second)) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
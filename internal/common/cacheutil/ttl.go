@@ -0,0 +1,66 @@
+package cacheutil
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneThreshold is the size at which Set sweeps out expired entries.
+const pruneThreshold = 10000
+
+// TTLCache is a small in-process cache whose entries expire after a fixed duration.
+// It is per instance: use it for data that's fine to be slightly stale, not for shared state.
+type TTLCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[K]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// NewTTLCache creates a cache whose entries live for ttl.
+func NewTTLCache[K comparable, V any](ttl time.Duration) *TTLCache[K, V] {
+	return &TTLCache[K, V]{
+		ttl:     ttl,
+		entries: make(map[K]ttlEntry[V]),
+	}
+}
+
+// Get returns the cached value for key, if present and not expired.
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Set stores value for key for the cache's TTL.
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= pruneThreshold {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Delete removes key from the cache.
+func (c *TTLCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -12,6 +12,13 @@ import (
 // The key must be 32 bytes for AES-256.
 // The returned byte slice prepends the nonce to the ciphertext.
 func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	return EncryptWithAD(plaintext, key, nil)
+}
+
+// EncryptWithAD is like Encrypt but also authenticates additionalData (not stored in
+// the output). The same additional data must be passed to DecryptWithAD, which lets
+// callers bind a ciphertext to its context, e.g. the row it belongs to.
+func EncryptWithAD(plaintext []byte, key []byte, additionalData []byte) ([]byte, error) {
 	if len(key) != 32 {
 		return nil, fmt.Errorf("invalid key size: must be 32 bytes for AES-256")
 	}
@@ -33,17 +40,22 @@ func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
 	}
 
 	// Seal encrypts and authenticates plaintext, authenticates the
-	// additional data (nil here), and appends the result to dst,
+	// additional data, and appends the result to dst,
 	// returning the updated slice. The nonce must be NonceSize()
 	// bytes long and unique for all time, for a given key.
 	// We prepend the nonce to the ciphertext.
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
 	return ciphertext, nil
 }
 
 // Decrypt decrypts ciphertext using AES-GCM.
 // The key must be 32 bytes. Expects ciphertext to have nonce prepended.
 func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	return DecryptWithAD(ciphertext, key, nil)
+}
+
+// DecryptWithAD decrypts a ciphertext produced by EncryptWithAD with the same additional data.
+func DecryptWithAD(ciphertext []byte, key []byte, additionalData []byte) ([]byte, error) {
 	if len(key) != 32 {
 		return nil, fmt.Errorf("invalid key size: must be 32 bytes for AES-256")
 	}
@@ -67,11 +79,11 @@ func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
 	nonce, actualCiphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 
 	// Open decrypts and authenticates ciphertext, authenticates the
-	// additional data (nil here) and, if successful, appends the
+	// additional data and, if successful, appends the
 	// resulting plaintext to dst, returning the updated slice. The nonce
 	// must be NonceSize() bytes long and match the nonce used to seal the
 	// ciphertext.
-	plaintext, err := gcm.Open(nil, nonce, actualCiphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, actualCiphertext, additionalData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt/authenticate ciphertext: %w", err)
 	}
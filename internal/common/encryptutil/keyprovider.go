@@ -0,0 +1,93 @@
+package encryptutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider wraps and unwraps per-record data keys with a key-encryption key (KEK)
+// that never leaves the provider (a local file, Vault transit, a cloud KMS).
+//
+// The keyring generates a fresh data key for every ciphertext, stores it wrapped
+// next to the data, and asks the provider to unwrap it on decrypt.
+type KeyProvider interface {
+	// KeyID identifies the KEK in stored ciphertexts. It must not change while
+	// ciphertexts written with it exist.
+	KeyID() string
+	// WrapKey encrypts a data key with the KEK.
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key previously returned by WrapKey.
+	UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error)
+}
+
+// LocalKeyProvider keeps the KEK in process memory, loaded from a file.
+// It needs no network access, so it also works for development and tests.
+type LocalKeyProvider struct {
+	keyID string
+	kek   []byte
+}
+
+// NewLocalKeyProvider creates a provider from a 32-byte KEK.
+func NewLocalKeyProvider(keyID string, kek []byte) (*LocalKeyProvider, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("key ID is required")
+	}
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("key-encryption key must be 32 bytes for AES-256, got %d bytes", len(kek))
+	}
+	return &LocalKeyProvider{keyID: keyID, kek: kek}, nil
+}
+
+// LoadLocalKeyProvider reads a base64-encoded 32-byte KEK from path (see WriteLocalKEKFile).
+func LoadLocalKeyProvider(keyID, path string) (*LocalKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key-encryption key file: %w", err)
+	}
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key-encryption key file %s is not valid base64: %w", path, err)
+	}
+	return NewLocalKeyProvider(keyID, kek)
+}
+
+// WriteLocalKEKFile generates a new random KEK and writes it to path, readable by the owner only.
+// It refuses to overwrite an existing file, which would make its ciphertexts unreadable.
+func WriteLocalKEKFile(path string) error {
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		return fmt.Errorf("failed to generate key-encryption key: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create key-encryption key file: %w", err)
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(kek) + "\n"); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write key-encryption key file: %w", err)
+	}
+	return f.Close()
+}
+
+// KeyID implements KeyProvider.
+func (p *LocalKeyProvider) KeyID() string {
+	return p.keyID
+}
+
+// WrapKey implements KeyProvider.
+func (p *LocalKeyProvider) WrapKey(_ context.Context, dataKey []byte) ([]byte, error) {
+	return EncryptWithAD(dataKey, p.kek, []byte("data-key:"+p.keyID))
+}
+
+// UnwrapKey implements KeyProvider.
+func (p *LocalKeyProvider) UnwrapKey(_ context.Context, wrappedKey []byte) ([]byte, error) {
+	dataKey, err := DecryptWithAD(wrappedKey, p.kek, []byte("data-key:"+p.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with '%s': %w", p.keyID, err)
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,114 @@
+package encryptutil
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalKeyProviderWrapUnwrap(t *testing.T) {
+	ctx := context.Background()
+	provider := testProvider(t, "kek1", 1)
+	dataKey := testKey(5)
+
+	wrapped, err := provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("wrapped key contains the data key")
+	}
+	got, err := provider.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Errorf("UnwrapKey = %x, want %x", got, dataKey)
+	}
+
+	// The wrapped key is bound to the key ID: the same KEK under another ID refuses it
+	renamed := testProvider(t, "kek2", 1)
+	if _, err := renamed.UnwrapKey(ctx, wrapped); err == nil {
+		t.Error("UnwrapKey accepted a key wrapped under another key ID")
+	}
+	otherKEK := testProvider(t, "kek1", 2)
+	if _, err := otherKEK.UnwrapKey(ctx, wrapped); err == nil {
+		t.Error("UnwrapKey accepted a key wrapped with another KEK")
+	}
+}
+
+func TestNewLocalKeyProviderValidation(t *testing.T) {
+	if _, err := NewLocalKeyProvider("", testKey(1)); err == nil {
+		t.Error("NewLocalKeyProvider accepted an empty key ID")
+	}
+	if _, err := NewLocalKeyProvider("kek1", testKey(1)[:16]); err == nil {
+		t.Error("NewLocalKeyProvider accepted a 16-byte KEK")
+	}
+}
+
+func TestWriteLocalKEKFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kek")
+
+	if err := WriteLocalKEKFile(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("KEK file mode = %o, want 600", perm)
+	}
+
+	provider, err := LoadLocalKeyProvider("kek1", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := NewKeyring(nil, "kek1", nil, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := ring.Encrypt(ctx, []byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the file again gives the same KEK
+	reloaded, err := LoadLocalKeyProvider("kek1", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, _ = NewKeyring(nil, "kek1", nil, reloaded)
+	got, err := ring.Decrypt(ctx, ciphertext, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "secret" {
+		t.Errorf("Decrypt = %q, want %q", got, "secret")
+	}
+
+	// An existing KEK file is never overwritten
+	before, _ := os.ReadFile(path)
+	if err := WriteLocalKEKFile(path); err == nil {
+		t.Error("WriteLocalKEKFile overwrote an existing file")
+	}
+	after, _ := os.ReadFile(path)
+	if !bytes.Equal(before, after) {
+		t.Error("KEK file changed")
+	}
+}
+
+func TestLoadLocalKeyProviderInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadLocalKeyProvider("kek1", filepath.Join(dir, "missing")); err == nil {
+		t.Error("LoadLocalKeyProvider accepted a missing file")
+	}
+	notBase64 := filepath.Join(dir, "not-base64")
+	os.WriteFile(notBase64, []byte("not base64!"), 0o600)
+	if _, err := LoadLocalKeyProvider("kek1", notBase64); err == nil {
+		t.Error("LoadLocalKeyProvider accepted a file that isn't base64")
+	}
+}
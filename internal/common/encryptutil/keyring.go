@@ -0,0 +1,289 @@
+package encryptutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Versioned ciphertext envelopes:
+//
+//	magic | key ID length (1 byte) | key ID | nonce | AES-GCM ciphertext
+//	"ENC3" | flags (1 byte) | key ID length (1 byte) | key ID | wrapped data key length (2 bytes) | wrapped data key | nonce | AES-GCM ciphertext
+//
+// The key ID lets us rotate keys: new data is always written with the active key,
+// while older keys stay in the keyring (decrypt-only) until everything is re-encrypted.
+// The magic of the first form tells whether associated data was authenticated ("ENC2")
+// or not ("ENC1"); those are encrypted directly with a key from the keyring.
+//
+// "ENC3" envelopes are written when the active key belongs to a KeyProvider: every
+// ciphertext gets its own random data key, stored wrapped by the provider's KEK.
+var (
+	envelopeMagic        = []byte("ENC1")
+	boundEnvelopeMagic   = []byte("ENC2")
+	wrappedEnvelopeMagic = []byte("ENC3")
+)
+
+const (
+	maxKeyIDLength      = 255
+	maxWrappedKeyLength = 65535
+
+	envelopeFlagBound byte = 1 << 0 // Associated data was authenticated
+)
+
+// ErrUnknownKeyID is returned when a ciphertext was written with a key that isn't in the keyring.
+var ErrUnknownKeyID = errors.New("ciphertext was encrypted with an unknown key")
+
+// Keyring holds the keys that can decrypt stored secrets and the active key used to encrypt new ones.
+// A key is either a raw key held by the keyring or a KeyProvider's key-encryption key.
+type Keyring struct {
+	activeKeyID string
+	keys        map[string][]byte
+	providers   map[string]KeyProvider
+	// legacyKey decrypts ciphertext written before versioning (plain nonce + ciphertext). Optional.
+	legacyKey []byte
+}
+
+// envelope is a parsed versioned ciphertext.
+type envelope struct {
+	keyID      string
+	wrappedKey []byte // Set for provider envelopes only
+	sealed     []byte // Nonce + AES-GCM ciphertext
+	bound      bool
+}
+
+// NewKeyring creates a keyring. activeKeyID must be one of keys or a provider's key ID;
+// legacyKey may be nil. All keys must be 32 bytes (AES-256).
+func NewKeyring(keys map[string][]byte, activeKeyID string, legacyKey []byte, providers ...KeyProvider) (*Keyring, error) {
+	ring := &Keyring{
+		activeKeyID: activeKeyID,
+		keys:        make(map[string][]byte, len(keys)),
+		providers:   make(map[string]KeyProvider, len(providers)),
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > maxKeyIDLength {
+			return nil, fmt.Errorf("key ID must be 1-%d bytes long, got '%s'", maxKeyIDLength, id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key '%s' must be 32 bytes for AES-256, got %d bytes", id, len(key))
+		}
+		ring.keys[id] = key
+	}
+	for _, provider := range providers {
+		id := provider.KeyID()
+		if id == "" || len(id) > maxKeyIDLength {
+			return nil, fmt.Errorf("key ID must be 1-%d bytes long, got '%s'", maxKeyIDLength, id)
+		}
+		if _, exists := ring.keys[id]; exists {
+			return nil, fmt.Errorf("key ID '%s' is used by both a key and a key provider", id)
+		}
+		if _, exists := ring.providers[id]; exists {
+			return nil, fmt.Errorf("key ID '%s' is used by two key providers", id)
+		}
+		ring.providers[id] = provider
+	}
+	_, isKey := ring.keys[activeKeyID]
+	_, isProvider := ring.providers[activeKeyID]
+	if !isKey && !isProvider {
+		return nil, fmt.Errorf("active key '%s' is not in the keyring", activeKeyID)
+	}
+	if legacyKey != nil {
+		if len(legacyKey) != 32 {
+			return nil, fmt.Errorf("legacy key must be 32 bytes for AES-256, got %d bytes", len(legacyKey))
+		}
+		ring.legacyKey = legacyKey
+	}
+	return ring, nil
+}
+
+// ActiveKeyID returns the ID of the key used for new ciphertexts.
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeKeyID
+}
+
+// Encrypt encrypts plaintext with the active key and wraps it in a versioned envelope.
+// A non-nil additionalData binds the ciphertext to it: Decrypt then needs the same value.
+func (k *Keyring) Encrypt(ctx context.Context, plaintext []byte, additionalData []byte) ([]byte, error) {
+	if provider, ok := k.providers[k.activeKeyID]; ok {
+		return k.encryptWithProvider(ctx, provider, plaintext, additionalData)
+	}
+
+	sealed, err := EncryptWithAD(plaintext, k.keys[k.activeKeyID], additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := envelopeMagic
+	if additionalData != nil {
+		magic = boundEnvelopeMagic
+	}
+	envelope := make([]byte, 0, len(magic)+1+len(k.activeKeyID)+len(sealed))
+	envelope = append(envelope, magic...)
+	envelope = append(envelope, byte(len(k.activeKeyID)))
+	envelope = append(envelope, k.activeKeyID...)
+	envelope = append(envelope, sealed...)
+	return envelope, nil
+}
+
+// encryptWithProvider encrypts plaintext with a fresh data key and stores that key wrapped by the provider.
+func (k *Keyring) encryptWithProvider(ctx context.Context, provider KeyProvider, plaintext, additionalData []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrappedKey, err := provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key with '%s': %w", k.activeKeyID, err)
+	}
+	if len(wrappedKey) > maxWrappedKeyLength {
+		return nil, fmt.Errorf("wrapped data key from '%s' is too long (%d bytes)", k.activeKeyID, len(wrappedKey))
+	}
+	sealed, err := EncryptWithAD(plaintext, dataKey, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags byte
+	if additionalData != nil {
+		flags |= envelopeFlagBound
+	}
+	envelope := make([]byte, 0, len(wrappedEnvelopeMagic)+2+len(k.activeKeyID)+2+len(wrappedKey)+len(sealed))
+	envelope = append(envelope, wrappedEnvelopeMagic...)
+	envelope = append(envelope, flags, byte(len(k.activeKeyID)))
+	envelope = append(envelope, k.activeKeyID...)
+	envelope = binary.BigEndian.AppendUint16(envelope, uint16(len(wrappedKey)))
+	envelope = append(envelope, wrappedKey...)
+	envelope = append(envelope, sealed...)
+	return envelope, nil
+}
+
+// Decrypt decrypts a versioned envelope with the key it names, or unversioned
+// ciphertext with the legacy key.
+//
+// additionalData is only checked for ciphertexts that were encrypted with it (see IsBound).
+// Older ciphertexts decrypt without it, so callers that require binding must check IsBound.
+func (k *Keyring) Decrypt(ctx context.Context, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	env, ok := parseEnvelope(ciphertext)
+	if ok {
+		var ad []byte
+		if env.bound {
+			ad = additionalData
+		}
+		key, known, err := k.envelopeKey(ctx, env)
+		if err != nil {
+			// The provider couldn't unwrap the data key (unreachable, permission denied, ...):
+			// this is not a legacy ciphertext that happens to look like an envelope.
+			return nil, err
+		}
+		if known {
+			plaintext, err := DecryptWithAD(env.sealed, key, ad)
+			if err == nil {
+				return plaintext, nil
+			}
+			if k.legacyKey == nil {
+				return nil, err
+			}
+		} else if k.legacyKey == nil {
+			return nil, fmt.Errorf("%w: '%s'", ErrUnknownKeyID, env.keyID)
+		}
+		// A legacy ciphertext's random nonce can start with the magic bytes by chance,
+		// so fall through to the legacy key before giving up.
+	}
+
+	if k.legacyKey == nil {
+		return nil, fmt.Errorf("ciphertext is not versioned and no legacy key is configured")
+	}
+	plaintext, err := Decrypt(ciphertext, k.legacyKey)
+	if err != nil {
+		if ok {
+			return nil, fmt.Errorf("failed to decrypt ciphertext with key '%s' or the legacy key: %w", env.keyID, err)
+		}
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// envelopeKey returns the key that decrypts env's payload: a keyring key, or the data key
+// unwrapped by the named provider. known is false if the keyring doesn't have that key.
+func (k *Keyring) envelopeKey(ctx context.Context, env envelope) ([]byte, bool, error) {
+	if env.wrappedKey == nil {
+		key, known := k.keys[env.keyID]
+		return key, known, nil
+	}
+	provider, known := k.providers[env.keyID]
+	if !known {
+		return nil, false, nil
+	}
+	dataKey, err := provider.UnwrapKey(ctx, env.wrappedKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return dataKey, true, nil
+}
+
+// IsBound reports whether ciphertext was encrypted with associated data.
+func (k *Keyring) IsBound(ciphertext []byte) bool {
+	env, ok := parseEnvelope(ciphertext)
+	return ok && env.bound
+}
+
+// NeedsReencryption reports whether ciphertext was not written with the active key
+// (unversioned, or encrypted with an older key).
+func (k *Keyring) NeedsReencryption(ciphertext []byte) bool {
+	env, ok := parseEnvelope(ciphertext)
+	return !ok || env.keyID != k.activeKeyID
+}
+
+// parseEnvelope splits a versioned envelope into its parts.
+func parseEnvelope(data []byte) (envelope, bool) {
+	var env envelope
+	switch {
+	case bytes.HasPrefix(data, envelopeMagic):
+	case bytes.HasPrefix(data, boundEnvelopeMagic):
+		env.bound = true
+	case bytes.HasPrefix(data, wrappedEnvelopeMagic):
+		return parseWrappedEnvelope(data)
+	default:
+		return envelope{}, false
+	}
+	if len(data) < len(envelopeMagic)+1 {
+		return envelope{}, false
+	}
+	idLen := int(data[len(envelopeMagic)])
+	start := len(envelopeMagic) + 1
+	if idLen == 0 || len(data) < start+idLen {
+		return envelope{}, false
+	}
+	env.keyID = string(data[start : start+idLen])
+	env.sealed = data[start+idLen:]
+	return env, true
+}
+
+// parseWrappedEnvelope parses an "ENC3" envelope (see the format above).
+func parseWrappedEnvelope(data []byte) (envelope, bool) {
+	pos := len(wrappedEnvelopeMagic)
+	if len(data) < pos+2 {
+		return envelope{}, false
+	}
+	flags, idLen := data[pos], int(data[pos+1])
+	pos += 2
+	if idLen == 0 || len(data) < pos+idLen+2 {
+		return envelope{}, false
+	}
+	keyID := string(data[pos : pos+idLen])
+	pos += idLen
+	wrappedLen := int(binary.BigEndian.Uint16(data[pos:]))
+	pos += 2
+	if wrappedLen == 0 || len(data) < pos+wrappedLen {
+		return envelope{}, false
+	}
+	return envelope{
+		keyID:      keyID,
+		wrappedKey: data[pos : pos+wrappedLen],
+		sealed:     data[pos+wrappedLen:],
+		bound:      flags&envelopeFlagBound != 0,
+	}, true
+}
@@ -0,0 +1,223 @@
+package encryptutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func testProvider(t *testing.T, keyID string, b byte) *LocalKeyProvider {
+	t.Helper()
+	provider, err := NewLocalKeyProvider(keyID, testKey(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	rawRing, err := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerRing, err := NewKeyring(nil, "kek1", nil, testProvider(t, "kek1", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		ring      *Keyring
+		ad        []byte
+		wantMagic string
+		wantBound bool
+	}{
+		{name: "ENC1 raw key unbound", ring: rawRing, ad: nil, wantMagic: "ENC1"},
+		{name: "ENC2 raw key bound", ring: rawRing, ad: []byte("user:1"), wantMagic: "ENC2", wantBound: true},
+		{name: "ENC2 empty associated data", ring: rawRing, ad: []byte{}, wantMagic: "ENC2", wantBound: true},
+		{name: "ENC3 provider unbound", ring: providerRing, ad: nil, wantMagic: "ENC3"},
+		{name: "ENC3 provider bound", ring: providerRing, ad: []byte("user:1"), wantMagic: "ENC3", wantBound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plaintext := []byte("access-token")
+			ciphertext, err := tt.ring.Encrypt(ctx, plaintext, tt.ad)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(ciphertext, []byte(tt.wantMagic)) {
+				t.Errorf("envelope starts with %q, want %q", ciphertext[:4], tt.wantMagic)
+			}
+			if bytes.Contains(ciphertext, plaintext) {
+				t.Error("ciphertext contains the plaintext")
+			}
+			if got := tt.ring.IsBound(ciphertext); got != tt.wantBound {
+				t.Errorf("IsBound = %v, want %v", got, tt.wantBound)
+			}
+			if tt.ring.NeedsReencryption(ciphertext) {
+				t.Error("NeedsReencryption = true for a ciphertext written with the active key")
+			}
+			got, err := tt.ring.Decrypt(ctx, ciphertext, tt.ad)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("Decrypt = %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestKeyringDecryptsOlderKeys(t *testing.T) {
+	ctx := context.Background()
+	provider := testProvider(t, "kek1", 3)
+	oldRaw, _ := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	oldProvider, _ := NewKeyring(nil, "kek1", nil, provider)
+	rotated, err := NewKeyring(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2", testKey(9), provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := Encrypt([]byte("legacy"), testKey(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromRaw, _ := oldRaw.Encrypt(ctx, []byte("raw"), []byte("ad"))
+	fromProvider, _ := oldProvider.Encrypt(ctx, []byte("provider"), []byte("ad"))
+
+	for _, tc := range []struct {
+		name       string
+		ciphertext []byte
+		want       string
+	}{
+		{"unversioned with legacy key", legacy, "legacy"},
+		{"older raw key", fromRaw, "raw"},
+		{"provider key", fromProvider, "provider"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if !rotated.NeedsReencryption(tc.ciphertext) {
+				t.Error("NeedsReencryption = false for a ciphertext not written with the active key")
+			}
+			got, err := rotated.Decrypt(ctx, tc.ciphertext, []byte("ad"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Decrypt = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyringRejectsTampering(t *testing.T) {
+	ctx := context.Background()
+	rawRing, _ := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", nil)
+	providerRing, _ := NewKeyring(nil, "kek1", nil, testProvider(t, "kek1", 2))
+
+	flipLast := func(b []byte) []byte {
+		out := bytes.Clone(b)
+		out[len(out)-1] ^= 0x01
+		return out
+	}
+
+	for _, ring := range []struct {
+		name string
+		ring *Keyring
+	}{{"raw key", rawRing}, {"provider", providerRing}} {
+		ciphertext, err := ring.ring.Encrypt(ctx, []byte("secret"), []byte("user:1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(ring.name+"/flipped ciphertext byte", func(t *testing.T) {
+			if _, err := ring.ring.Decrypt(ctx, flipLast(ciphertext), []byte("user:1")); err == nil {
+				t.Error("Decrypt accepted a modified ciphertext")
+			}
+		})
+		t.Run(ring.name+"/other associated data", func(t *testing.T) {
+			if _, err := ring.ring.Decrypt(ctx, ciphertext, []byte("user:2")); err == nil {
+				t.Error("Decrypt accepted a ciphertext bound to other associated data")
+			}
+		})
+		t.Run(ring.name+"/binding flag cleared", func(t *testing.T) {
+			// Downgrading a bound envelope must not make it decrypt without its associated data
+			downgraded := bytes.Clone(ciphertext)
+			if bytes.HasPrefix(downgraded, boundEnvelopeMagic) {
+				copy(downgraded, envelopeMagic)
+			} else {
+				downgraded[len(wrappedEnvelopeMagic)] &^= envelopeFlagBound
+			}
+			if ring.ring.IsBound(downgraded) {
+				t.Fatal("test setup: envelope still bound")
+			}
+			if _, err := ring.ring.Decrypt(ctx, downgraded, nil); err == nil {
+				t.Error("Decrypt accepted a bound ciphertext with its binding flag cleared")
+			}
+		})
+	}
+
+	t.Run("wrapped data key modified", func(t *testing.T) {
+		ciphertext, _ := providerRing.Encrypt(ctx, []byte("secret"), nil)
+		env, _ := parseEnvelope(ciphertext)
+		tampered := bytes.Clone(ciphertext)
+		pos := bytes.Index(tampered, env.wrappedKey)
+		tampered[pos] ^= 0x01
+		if _, err := providerRing.Decrypt(ctx, tampered, nil); err == nil {
+			t.Error("Decrypt accepted a modified wrapped data key")
+		}
+	})
+
+	t.Run("unknown key ID", func(t *testing.T) {
+		other, _ := NewKeyring(map[string][]byte{"k9": testKey(9)}, "k9", nil)
+		ciphertext, _ := other.Encrypt(ctx, []byte("secret"), nil)
+		_, err := rawRing.Decrypt(ctx, ciphertext, nil)
+		if !errors.Is(err, ErrUnknownKeyID) {
+			t.Errorf("Decrypt error = %v, want ErrUnknownKeyID", err)
+		}
+	})
+
+	t.Run("same key ID, different key", func(t *testing.T) {
+		impostor, _ := NewKeyring(map[string][]byte{"k1": testKey(7)}, "k1", nil)
+		ciphertext, _ := impostor.Encrypt(ctx, []byte("secret"), nil)
+		if _, err := rawRing.Decrypt(ctx, ciphertext, nil); err == nil {
+			t.Error("Decrypt accepted a ciphertext written with another key")
+		}
+	})
+
+	t.Run("unversioned without legacy key", func(t *testing.T) {
+		legacy, _ := Encrypt([]byte("secret"), testKey(1))
+		if _, err := rawRing.Decrypt(ctx, legacy, nil); err == nil {
+			t.Error("Decrypt accepted unversioned ciphertext without a legacy key")
+		}
+	})
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	provider := testProvider(t, "kek1", 2)
+	tests := []struct {
+		name      string
+		keys      map[string][]byte
+		active    string
+		legacy    []byte
+		providers []KeyProvider
+	}{
+		{name: "active key missing", keys: map[string][]byte{"k1": testKey(1)}, active: "k2"},
+		{name: "short key", keys: map[string][]byte{"k1": testKey(1)[:16]}, active: "k1"},
+		{name: "empty key ID", keys: map[string][]byte{"": testKey(1)}, active: ""},
+		{name: "short legacy key", keys: map[string][]byte{"k1": testKey(1)}, active: "k1", legacy: []byte("short")},
+		{name: "key ID used twice", keys: map[string][]byte{"kek1": testKey(1)}, active: "kek1", providers: []KeyProvider{provider}},
+		{name: "provider used twice", active: "kek1", providers: []KeyProvider{provider, provider}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.keys, tt.active, tt.legacy, tt.providers...); err == nil {
+				t.Error("NewKeyring accepted an invalid configuration")
+			}
+		})
+	}
+}
@@ -14,17 +14,25 @@ import (
 // CustomClaims defines the structure for our JWT claims.
 // We embed RegisteredClaims and add our own.
 type CustomClaims struct {
-	UserID string `json:"user_id"` // Using string for easier claim access
-	Email  string `json:"email"`   // Optional: include email if useful
+	UserID  string `json:"user_id"`           // Using string for easier claim access
+	Email   string `json:"email"`             // Optional: include email if useful
+	Role    string `json:"role,omitempty"`    // User role (user, support, admin) for authorization
+	Purpose string `json:"purpose,omitempty"` // Empty for access tokens, set for special-purpose tokens
 	jwt.RegisteredClaims
 }
 
+// PurposeMFAChallenge marks a token issued after a correct password for a user
+// with two-factor authentication enabled. It can only be exchanged for an
+// access token together with a valid one-time code; it is NOT an access token.
+const PurposeMFAChallenge = "mfa_challenge"
+
 // GenerateToken creates a new JWT access token.
-func GenerateToken(userID uuid.UUID, email string, secretKey string, expiryDuration time.Duration) (string, error) {
+func GenerateToken(userID uuid.UUID, email string, role string, secretKey string, expiryDuration time.Duration) (string, error) {
 	// Create the claims
 	claims := CustomClaims{
 		UserID: userID.String(), // Store user ID as string in claim
 		Email:  email,           // Optionally include email
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiryDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -77,3 +85,39 @@ func ValidateToken(tokenString string, secretKey string) (*CustomClaims, error)
 
 	return nil, fmt.Errorf("invalid token claims")
 }
+
+// GenerateMFAChallengeToken creates a short-lived token proving the password step
+// of login succeeded. It must be exchanged (with a TOTP or recovery code) for a real access token.
+func GenerateMFAChallengeToken(userID uuid.UUID, secretKey string, expiryDuration time.Duration) (string, error) {
+	claims := CustomClaims{
+		UserID:  userID.String(),
+		Purpose: PurposeMFAChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiryDuration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "stocksaas-api",
+			Subject:   userID.String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign mfa challenge token: %w", err)
+	}
+	return signedToken, nil
+}
+
+// ValidateMFAChallengeToken validates a token created by GenerateMFAChallengeToken.
+// Regular access tokens are rejected.
+func ValidateMFAChallengeToken(tokenString string, secretKey string) (*CustomClaims, error) {
+	claims, err := ValidateToken(tokenString, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeMFAChallenge {
+		return nil, fmt.Errorf("token is not an mfa challenge token")
+	}
+	return claims, nil
+}
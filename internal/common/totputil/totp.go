@@ -0,0 +1,120 @@
+package totputil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters used for every secret we issue. These are the defaults every
+// authenticator app (Google Authenticator, Authy, 1Password...) understands.
+const (
+	secretSize = 20               // 160-bit secret, as recommended by RFC 4226
+	digits     = 6                // Length of generated codes
+	period     = 30 * time.Second // Time step (RFC 6238 default)
+)
+
+// b32 is the base32 encoding used for secrets (no padding, as expected by authenticator apps).
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret creates a new random base32-encoded TOTP secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return b32.EncodeToString(secret), nil
+}
+
+// ProvisioningURI builds the otpauth:// URI that authenticator apps scan as a QR code.
+// See https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func ProvisioningURI(secret, issuer, accountName string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", digits))
+	params.Set("period", fmt.Sprintf("%d", int(period.Seconds())))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TimeStep returns the RFC 6238 time step counter for t.
+func TimeStep(t time.Time) int64 {
+	return t.Unix() / int64(period.Seconds())
+}
+
+// GenerateCode computes the code for the given secret at time t.
+func GenerateCode(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return codeForStep(key, TimeStep(t)), nil
+}
+
+// Validate checks code against the secret at time t, allowing `skew` time steps
+// of clock drift in either direction.
+// On success it returns the matched time step so callers can reject replays
+// of a code that has already been used.
+func Validate(code, secret string, t time.Time, skew int) (int64, bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != digits {
+		return 0, false, nil
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+
+	current := TimeStep(t)
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+		expected := codeForStep(key, step)
+		// Constant time comparison to avoid leaking how many digits matched
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// decodeSecret converts a base32 secret (as shown to the user) into raw key bytes.
+func decodeSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+	key, err := b32.DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret encoding: %w", err)
+	}
+	return key, nil
+}
+
+// codeForStep implements the HOTP truncation from RFC 4226 section 5.3.
+func codeForStep(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
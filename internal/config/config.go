@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/base64"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time" // Import time
 
 	"github.com/joho/godotenv"
@@ -25,9 +27,129 @@ type JWTConfig struct {
 	ExpiryDuration time.Duration // How long the access token is valid
 }
 
+// MFAConfig holds two-factor authentication settings.
+type MFAConfig struct {
+	TOTPIssuer      string        // Issuer name shown in authenticator apps
+	ChallengeExpiry time.Duration // How long the MFA challenge token from the password step is valid
+}
+
+// LoginProtectionConfig holds brute-force protection settings for login.
+type LoginProtectionConfig struct {
+	Store              string        // "postgres" (shared across instances) or "memory"
+	FreeAttempts       int           // Failures allowed before backoff kicks in
+	BackoffBase        time.Duration // First backoff delay, doubled on every further failure
+	BackoffMax         time.Duration // Upper bound for the backoff delay
+	LockoutThreshold   int           // Failures per email that trigger a lockout
+	IPLockoutThreshold int           // Failures per client IP that trigger a lockout
+	LockoutDuration    time.Duration // How long a lockout lasts
+	FailureWindow      time.Duration // Failures older than this no longer count
+}
+
+// EncryptionConfig holds the keys used to encrypt stored secrets (broker tokens, TOTP secrets).
+type EncryptionConfig struct {
+	Keys        map[string][]byte // Key ID -> 32-byte key; all of them can decrypt
+	ActiveKeyID string            // Key used for new ciphertexts (a key in Keys or the provider's key ID)
+	LegacyKey   []byte            // Decrypts data written before key versioning (ENCRYPTION_KEY), may be nil
+	// AllowUnboundCredentials accepts broker tokens and TOTP secrets encrypted before they
+	// were bound to their owner, and upgrades them when read. It is a migration window:
+	// run `admin reencrypt-credentials`, then set ENCRYPTION_ALLOW_UNBOUND_CREDENTIALS=false.
+	// The default is true for now so existing deployments keep working, and will become
+	// false in a later release; the API logs a warning at startup while it is on.
+	AllowUnboundCredentials bool
+	Provider                KeyProviderConfig
+}
+
+// KeyProviderConfig selects an external key-encryption key. With a provider, every
+// ciphertext gets its own data key, wrapped by the provider, instead of using a raw
+// key from the environment.
+type KeyProviderConfig struct {
+	Type    string        // "" (none), "local", "vault" or "awskms"
+	KeyID   string        // ID recorded in ciphertexts; never reuse it for a different KEK
+	Timeout time.Duration // Per request to Vault / KMS
+
+	LocalKEKFile string // local: file with a base64 32-byte KEK
+
+	VaultAddr         string // vault: e.g. https://vault.internal:8200
+	VaultToken        string
+	VaultTransitMount string // vault: transit secrets engine mount, usually "transit"
+	VaultTransitKey   string // vault: transit key name
+
+	AWSRegion          string // awskms
+	AWSKMSKeyID        string // awskms: key ID, ARN or alias
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string // Optional, for temporary credentials
+}
+
 type KiteConfig struct {
 	APIKey    string
 	APISecret string
+	// TokenSweepInterval is how often the scheduler flags access tokens past the daily cutoff.
+	TokenSweepInterval time.Duration
+	// OAuthStateMode is "cookie" (signed state in a cookie) or "table" (single-use state
+	// stored in oauth_states and passed through Kite's redirect_params).
+	OAuthStateMode string
+	// StateCookieSecure sets the Secure flag on the state cookie; turn off for plain-HTTP local development.
+	StateCookieSecure bool
+	RateLimit         KiteRateLimitConfig
+}
+
+// KiteRateLimitConfig budgets the requests sent to Kite per API key, so bursts (a large
+// basket) wait instead of being refused, and sets how transient failures are retried.
+type KiteRateLimitConfig struct {
+	OrdersPerSecond int // Placing, modifying and cancelling orders (Kite allows 10)
+	OrdersPerMinute int // (Kite allows 200)
+	QuotesPerSecond int // LTP and quotes (Kite allows 1)
+	OthersPerSecond int // Every other endpoint (Kite allows 10)
+	MaxRetries      int
+	// RetryBaseDelay is the backoff before the first retry, doubled for each further one
+	// up to RetryMaxDelay, with random jitter.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// ExecutionConfig controls basket execution.
+type ExecutionConfig struct {
+	// MarginPolicy decides what happens when the pre-trade margin check finds too little
+	// funds: "block" refuses to place any order, "warn" places them and reports the shortfall.
+	MarginPolicy string
+}
+
+// ChargesConfig controls the trade charges calculator.
+type ChargesConfig struct {
+	// RatesFile replaces the built-in versioned rates (brokerage, STT, exchange fees...)
+	// when set, e.g. to add a new version before a release ships it.
+	RatesFile string
+}
+
+// MarketConfig controls the market calendar.
+type MarketConfig struct {
+	// HolidaysFile replaces the built-in NSE holiday list and special sessions when set,
+	// e.g. to add next year's holidays before a release ships them.
+	HolidaysFile string
+}
+
+// ScheduleConfig controls recurring basket executions.
+type ScheduleConfig struct {
+	// PollInterval is how often the scheduler looks for due schedules. Runs picked up
+	// more than 10 minutes late count as missed, so keep it well below that.
+	PollInterval time.Duration
+}
+
+// JobQueueConfig controls the background job queue that runs basket executions.
+type JobQueueConfig struct {
+	Workers      int           // Jobs run at the same time by this instance
+	PollInterval time.Duration // How often an idle worker looks for a job
+	// VisibilityTimeout is how long a claimed job stays hidden from other workers. The worker
+	// extends it while the job runs; a job whose worker died is picked up again after it.
+	VisibilityTimeout time.Duration
+	MaxAttempts       int // Attempts before a failing job goes to the dead letters
+	// RetryBaseDelay is the wait before the first retry, doubled for each further one up to RetryMaxDelay.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// ShutdownTimeout is how long a shutdown waits for requests in flight and running jobs. A
+	// job still running when it runs out is picked up by another worker after its visibility timeout.
+	ShutdownTimeout time.Duration
 }
 
 // AppConfig holds the overall application configuration.
@@ -36,7 +158,17 @@ type AppConfig struct {
 	Database   DBConfig
 	JWT        JWTConfig
 	Kite       KiteConfig
-	EncryptionKey []byte
+	MFA        MFAConfig
+	LoginProtection LoginProtectionConfig
+	// TrustProxyHeaders makes the server take the client IP from X-Forwarded-For.
+	// Only enable behind a reverse proxy that sets the header, otherwise clients can spoof it.
+	TrustProxyHeaders bool
+	Encryption        EncryptionConfig
+	Execution         ExecutionConfig
+	Charges           ChargesConfig
+	Schedule          ScheduleConfig
+	Market            MarketConfig
+	Jobs              JobQueueConfig
 }
 
 // Load loads configuration from environment variables,
@@ -63,6 +195,14 @@ func Load() (*AppConfig, error) {
 	}
 	jwtExpiryDuration := time.Duration(jwtExpiryMinutes) * time.Minute
 
+	// Load MFA challenge expiry (in minutes). Keep this short: it only covers typing in the code.
+	mfaChallengeMinutesStr := getEnv("MFA_CHALLENGE_EXPIRY_MINUTES", "5")
+	mfaChallengeMinutes, err := strconv.Atoi(mfaChallengeMinutesStr)
+	if err != nil || mfaChallengeMinutes <= 0 {
+		log.Printf("Warning: Invalid MFA_CHALLENGE_EXPIRY_MINUTES '%s', using default 5. Error: %v", mfaChallengeMinutesStr, err)
+		mfaChallengeMinutes = 5
+	}
+
 	// Load JWT Secret - CRITICAL: Must be set in production!
 	jwtSecret := getEnv("JWT_SECRET", "") // No sensible default!
 	if jwtSecret == "" {
@@ -75,19 +215,9 @@ func Load() (*AppConfig, error) {
     if kiteAPIKey == "" { log.Fatal("FATAL: KITE_API_KEY environment variable is not set!") }
     if kiteAPISecret == "" { log.Fatal("FATAL: KITE_API_SECRET environment variable is not set!") }
 
-	 // --- Load Encryption Key ---
-	 encryptionKeyStr := getEnv("ENCRYPTION_KEY", "")
-	 if encryptionKeyStr == "" {
-		 log.Fatal("FATAL: ENCRYPTION_KEY environment variable is not set!")
-	 }
-	 // Ensure the key is the correct length (32 bytes for AES-256)
-    // You might base64 encode the key in the env var for easier handling
-    // For simplicity here, we assume it's a raw 32-byte string
-    encryptionKey := []byte(encryptionKeyStr)
-    if len(encryptionKey) != 32 {
-        log.Fatalf("FATAL: ENCRYPTION_KEY must be 32 bytes long for AES-256, got %d bytes", len(encryptionKey))
-    }
-    // --- End Encryption Key Loading ---
+	// --- Load Encryption Keys ---
+	encryption := loadEncryptionConfig()
+	// --- End Encryption Key Loading ---
 
 
 	cfg := &AppConfig{
@@ -107,13 +237,90 @@ func Load() (*AppConfig, error) {
 		Kite: KiteConfig{ // Populate Kite config
             APIKey:    kiteAPIKey,
             APISecret: kiteAPISecret,
+            TokenSweepInterval: time.Duration(getEnvInt("KITE_TOKEN_SWEEP_MINUTES", 5)) * time.Minute,
+            OAuthStateMode: getEnv("KITE_OAUTH_STATE_MODE", "cookie"),
+            StateCookieSecure: getEnv("KITE_STATE_COOKIE_SECURE", "true") == "true",
+            RateLimit: KiteRateLimitConfig{
+                OrdersPerSecond: getEnvInt("KITE_ORDERS_PER_SECOND", 8),
+                OrdersPerMinute: getEnvInt("KITE_ORDERS_PER_MINUTE", 180),
+                QuotesPerSecond: getEnvInt("KITE_QUOTES_PER_SECOND", 1),
+                OthersPerSecond: getEnvInt("KITE_REQUESTS_PER_SECOND", 8),
+                MaxRetries:      getEnvInt("KITE_MAX_RETRIES", 3),
+                RetryBaseDelay:  time.Duration(getEnvInt("KITE_RETRY_BASE_MS", 250)) * time.Millisecond,
+                RetryMaxDelay:   time.Duration(getEnvInt("KITE_RETRY_MAX_MS", 4000)) * time.Millisecond,
+            },
         },
-		EncryptionKey: encryptionKey,
+		MFA: MFAConfig{
+			TOTPIssuer:      getEnv("MFA_TOTP_ISSUER", "StockSaaS"),
+			ChallengeExpiry: time.Duration(mfaChallengeMinutes) * time.Minute,
+		},
+		LoginProtection: LoginProtectionConfig{
+			Store:              getEnv("LOGIN_ATTEMPT_STORE", "postgres"),
+			FreeAttempts:       getEnvInt("LOGIN_FREE_ATTEMPTS", 3),
+			BackoffBase:        time.Duration(getEnvInt("LOGIN_BACKOFF_BASE_SECONDS", 1)) * time.Second,
+			BackoffMax:         time.Duration(getEnvInt("LOGIN_BACKOFF_MAX_SECONDS", 300)) * time.Second,
+			LockoutThreshold:   getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+			IPLockoutThreshold: getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50),
+			LockoutDuration:    time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 30)) * time.Minute,
+			FailureWindow:      time.Duration(getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute,
+		},
+		TrustProxyHeaders: getEnv("TRUST_PROXY_HEADERS", "false") == "true",
+		Encryption:        encryption,
+		Execution: ExecutionConfig{
+			MarginPolicy: getEnv("EXECUTION_MARGIN_POLICY", "block"),
+		},
+		Charges: ChargesConfig{
+			RatesFile: getEnv("CHARGES_RATES_FILE", ""),
+		},
+		Schedule: ScheduleConfig{
+			PollInterval: time.Duration(getEnvInt("SCHEDULE_POLL_SECONDS", 60)) * time.Second,
+		},
+		Market: MarketConfig{
+			HolidaysFile: getEnv("MARKET_HOLIDAYS_FILE", ""),
+		},
+		Jobs: JobQueueConfig{
+			Workers:           getEnvInt("JOB_WORKERS", 4),
+			PollInterval:      time.Duration(getEnvInt("JOB_POLL_MS", 1000)) * time.Millisecond,
+			VisibilityTimeout: time.Duration(getEnvInt("JOB_VISIBILITY_TIMEOUT_SECONDS", 120)) * time.Second,
+			MaxAttempts:       getEnvInt("JOB_MAX_ATTEMPTS", 3),
+			RetryBaseDelay:    time.Duration(getEnvInt("JOB_RETRY_BASE_SECONDS", 10)) * time.Second,
+			RetryMaxDelay:     time.Duration(getEnvInt("JOB_RETRY_MAX_SECONDS", 300)) * time.Second,
+			ShutdownTimeout:   time.Duration(getEnvInt("JOB_SHUTDOWN_TIMEOUT_SECONDS", 60)) * time.Second,
+		},
 	}
 
 	if cfg.Database.User == "" || cfg.Database.DBName == "" {
 		log.Fatal("DB_USER and DB_NAME environment variables must be set")
 	}
+	if cfg.LoginProtection.Store != "postgres" && cfg.LoginProtection.Store != "memory" {
+		log.Fatalf("FATAL: LOGIN_ATTEMPT_STORE must be 'postgres' or 'memory', got '%s'", cfg.LoginProtection.Store)
+	}
+	if cfg.Kite.OAuthStateMode != "cookie" && cfg.Kite.OAuthStateMode != "table" {
+		log.Fatalf("FATAL: KITE_OAUTH_STATE_MODE must be 'cookie' or 'table', got '%s'", cfg.Kite.OAuthStateMode)
+	}
+	if cfg.Execution.MarginPolicy != "block" && cfg.Execution.MarginPolicy != "warn" {
+		log.Fatalf("FATAL: EXECUTION_MARGIN_POLICY must be 'block' or 'warn', got '%s'", cfg.Execution.MarginPolicy)
+	}
+	if cfg.Schedule.PollInterval > 5*time.Minute {
+		log.Fatalf("FATAL: SCHEDULE_POLL_SECONDS must be at most 300, got %d", int(cfg.Schedule.PollInterval.Seconds()))
+	}
+	if cfg.Jobs.Workers < 1 || cfg.Jobs.MaxAttempts < 1 {
+		log.Fatalf("FATAL: JOB_WORKERS and JOB_MAX_ATTEMPTS must be at least 1")
+	}
+	if cfg.Jobs.VisibilityTimeout < 10*time.Second {
+		log.Fatalf("FATAL: JOB_VISIBILITY_TIMEOUT_SECONDS must be at least 10, got %d", int(cfg.Jobs.VisibilityTimeout.Seconds()))
+	}
+	kiteLimits := cfg.Kite.RateLimit
+	// A rate of zero divides by zero or leaves a limiter with no burst, so every call would fail
+	if kiteLimits.OrdersPerSecond < 1 || kiteLimits.OrdersPerMinute < 1 || kiteLimits.QuotesPerSecond < 1 || kiteLimits.OthersPerSecond < 1 {
+		log.Fatalf("FATAL: KITE_ORDERS_PER_SECOND, KITE_ORDERS_PER_MINUTE, KITE_QUOTES_PER_SECOND and KITE_REQUESTS_PER_SECOND must be at least 1")
+	}
+	if kiteLimits.MaxRetries < 0 {
+		log.Fatalf("FATAL: KITE_MAX_RETRIES must not be negative, got %d", kiteLimits.MaxRetries)
+	}
+	if kiteLimits.RetryBaseDelay <= 0 || kiteLimits.RetryMaxDelay <= 0 {
+		log.Fatalf("FATAL: KITE_RETRY_BASE_MS and KITE_RETRY_MAX_MS must be at least 1")
+	}
 	if cfg.Database.Password == "" {
 		log.Println("Warning: DB_PASSWORD is not set.") // Might be ok for local dev with trusted connection
 	}
@@ -121,6 +328,122 @@ func Load() (*AppConfig, error) {
 	return cfg, nil
 }
 
+// loadEncryptionConfig reads the encryption keyring.
+//
+// ENCRYPTION_KEYS is a comma-separated list of "<id>:<base64 32-byte key>" entries and
+// ENCRYPTION_ACTIVE_KEY_ID picks the one used for new data (optional with a single key).
+// ENCRYPTION_KEY (a raw 32-byte string) is the pre-versioning key: it keeps decrypting
+// old data, and is the only key (ID "default") when ENCRYPTION_KEYS isn't set.
+//
+// ENCRYPTION_KEY_PROVIDER (local, vault or awskms) adds a key provider, which becomes the
+// active key unless ENCRYPTION_ACTIVE_KEY_ID says otherwise. Raw keys are then only
+// needed to decrypt data written before the provider was set up.
+//
+// To rotate: add a new key to ENCRYPTION_KEYS (or configure a provider), make it active,
+// deploy, run `admin reencrypt-credentials` (broker tokens and TOTP secrets), and drop the
+// old key once the command reports that nothing uses it any more.
+func loadEncryptionConfig() EncryptionConfig {
+	var legacyKey []byte
+	if legacyKeyStr := getEnv("ENCRYPTION_KEY", ""); legacyKeyStr != "" {
+		// For simplicity here, we assume it's a raw 32-byte string
+		legacyKey = []byte(legacyKeyStr)
+		if len(legacyKey) != 32 {
+			log.Fatalf("FATAL: ENCRYPTION_KEY must be 32 bytes long for AES-256, got %d bytes", len(legacyKey))
+		}
+	}
+
+	allowUnbound := getEnv("ENCRYPTION_ALLOW_UNBOUND_CREDENTIALS", "true") == "true"
+	provider := loadKeyProviderConfig()
+
+	keys := make(map[string][]byte)
+	var lastID string
+	keysStr := getEnv("ENCRYPTION_KEYS", "")
+	if keysStr != "" {
+		for _, entry := range strings.Split(keysStr, ",") {
+			id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+			if !found || id == "" {
+				log.Fatalf("FATAL: ENCRYPTION_KEYS entries must look like '<id>:<base64 key>'")
+			}
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(key) != 32 {
+				log.Fatalf("FATAL: Encryption key '%s' must be 32 bytes, base64 encoded", id)
+			}
+			keys[id] = key
+			lastID = id
+		}
+	} else if legacyKey != nil {
+		keys["default"] = legacyKey
+		lastID = "default"
+	}
+	if len(keys) == 0 && provider.Type == "" {
+		log.Fatal("FATAL: ENCRYPTION_KEYS, ENCRYPTION_KEY or ENCRYPTION_KEY_PROVIDER environment variable must be set!")
+	}
+
+	activeKeyID := getEnv("ENCRYPTION_ACTIVE_KEY_ID", "")
+	if activeKeyID == "" {
+		switch {
+		case provider.Type != "":
+			activeKeyID = provider.KeyID
+		case len(keys) > 1:
+			log.Fatal("FATAL: ENCRYPTION_ACTIVE_KEY_ID must be set when ENCRYPTION_KEYS has more than one key")
+		default:
+			activeKeyID = lastID
+		}
+	}
+	if _, ok := keys[activeKeyID]; !ok && (provider.Type == "" || activeKeyID != provider.KeyID) {
+		log.Fatalf("FATAL: ENCRYPTION_ACTIVE_KEY_ID '%s' is neither in ENCRYPTION_KEYS nor the key provider's ID", activeKeyID)
+	}
+
+	return EncryptionConfig{
+		Keys:                    keys,
+		ActiveKeyID:             activeKeyID,
+		LegacyKey:               legacyKey,
+		AllowUnboundCredentials: allowUnbound,
+		Provider:                provider,
+	}
+}
+
+// loadKeyProviderConfig reads the optional key provider settings.
+func loadKeyProviderConfig() KeyProviderConfig {
+	providerType := getEnv("ENCRYPTION_KEY_PROVIDER", "")
+	if providerType == "" {
+		return KeyProviderConfig{}
+	}
+
+	cfg := KeyProviderConfig{
+		Type:    providerType,
+		KeyID:   getEnv("ENCRYPTION_PROVIDER_KEY_ID", providerType),
+		Timeout: time.Duration(getEnvInt("ENCRYPTION_PROVIDER_TIMEOUT_SECONDS", 5)) * time.Second,
+	}
+	switch providerType {
+	case "local":
+		cfg.LocalKEKFile = getEnv("ENCRYPTION_LOCAL_KEK_FILE", "")
+		if cfg.LocalKEKFile == "" {
+			log.Fatal("FATAL: ENCRYPTION_LOCAL_KEK_FILE must be set for the local key provider")
+		}
+	case "vault":
+		cfg.VaultAddr = strings.TrimRight(getEnv("VAULT_ADDR", ""), "/")
+		cfg.VaultToken = getEnv("VAULT_TOKEN", "")
+		cfg.VaultTransitMount = getEnv("VAULT_TRANSIT_MOUNT", "transit")
+		cfg.VaultTransitKey = getEnv("VAULT_TRANSIT_KEY", "")
+		if cfg.VaultAddr == "" || cfg.VaultToken == "" || cfg.VaultTransitKey == "" {
+			log.Fatal("FATAL: VAULT_ADDR, VAULT_TOKEN and VAULT_TRANSIT_KEY must be set for the vault key provider")
+		}
+	case "awskms":
+		cfg.AWSRegion = getEnv("AWS_REGION", "")
+		cfg.AWSKMSKeyID = getEnv("AWS_KMS_KEY_ID", "")
+		cfg.AWSAccessKeyID = getEnv("AWS_ACCESS_KEY_ID", "")
+		cfg.AWSSecretAccessKey = getEnv("AWS_SECRET_ACCESS_KEY", "")
+		cfg.AWSSessionToken = getEnv("AWS_SESSION_TOKEN", "")
+		if cfg.AWSRegion == "" || cfg.AWSKMSKeyID == "" || cfg.AWSAccessKeyID == "" || cfg.AWSSecretAccessKey == "" {
+			log.Fatal("FATAL: AWS_REGION, AWS_KMS_KEY_ID, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for the awskms key provider")
+		}
+	default:
+		log.Fatalf("FATAL: ENCRYPTION_KEY_PROVIDER must be 'local', 'vault' or 'awskms', got '%s'", providerType)
+	}
+	return cfg
+}
+
 // Helper to get env var or default
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -134,3 +457,14 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// Helper to get a positive integer env var or default
+func getEnvInt(key string, fallback int) int {
+	valueStr := getEnv(key, strconv.Itoa(fallback))
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value <= 0 {
+		log.Printf("Warning: Invalid %s '%s', using default %d. Error: %v", key, valueStr, fallback, err)
+		return fallback
+	}
+	return value
+}
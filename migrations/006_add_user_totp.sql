@@ -0,0 +1,21 @@
+-- migrations/006_add_user_totp.sql
+
+-- TOTP (RFC 6238) two-factor authentication columns on users
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS totp_secret_encrypted BYTEA, -- Encrypted with ENCRYPTION_KEY, NULL when not enrolled
+ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE, -- Only TRUE after the user confirmed a code
+ADD COLUMN IF NOT EXISTS totp_confirmed_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS totp_last_used_step BIGINT NOT NULL DEFAULT 0; -- Last accepted time step, prevents code replay
+
+-- One-time recovery codes, stored hashed (SHA-256), never in plain text
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ, -- NULL while the code is still usable
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
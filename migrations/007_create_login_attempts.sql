@@ -0,0 +1,13 @@
+-- migrations/007_create_login_attempts.sql
+
+-- Failed login tracking for brute-force protection.
+-- Keys look like 'email:alice@example.com' or 'ip:203.0.113.7'.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failed_count INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ -- NULL when not locked
+);
+
+-- Index for cleaning up old entries later (optional)
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed_at ON login_attempts(last_failed_at);
@@ -0,0 +1,18 @@
+-- migrations/008_create_api_keys.sql
+
+-- Personal API keys for programmatic access
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    prefix TEXT NOT NULL UNIQUE, -- Visible part of the key, used for lookup
+    secret_hash TEXT NOT NULL, -- SHA-256 of the full key (hex), the key itself is never stored
+    scopes TEXT NOT NULL, -- Comma-separated list, e.g. 'baskets:read,baskets:write'
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ, -- NULL while the key is active
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for listing a user's keys
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
@@ -0,0 +1,10 @@
+-- migrations/009_add_user_roles.sql
+
+-- Roles, account disabling and forced logout
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'support', 'admin')),
+ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ, -- NULL while the account is active
+ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMPTZ; -- Tokens issued before this are rejected
+
+-- Index for admin filtering by role
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
@@ -0,0 +1,11 @@
+-- migrations/011_add_broker_token_issued_at.sql
+
+-- When the current access token was obtained. updated_at can't be used for this:
+-- re-encrypting a row (admin reencrypt-credentials) also bumps it.
+ALTER TABLE user_broker_credentials ADD COLUMN IF NOT EXISTS token_issued_at TIMESTAMPTZ;
+
+UPDATE user_broker_credentials SET token_issued_at = updated_at WHERE token_issued_at IS NULL;
+
+ALTER TABLE user_broker_credentials
+    ALTER COLUMN token_issued_at SET DEFAULT NOW(),
+    ALTER COLUMN token_issued_at SET NOT NULL;
@@ -0,0 +1,26 @@
+-- migrations/012_add_broker_token_expiry.sql
+
+-- Kite access tokens expire every morning at 6 AM IST. expires_at is set when a
+-- token is stored; status flips to 'expired' when Kite rejects the token or the
+-- scheduler sees expires_at pass, and back to 'active' when the user reconnects.
+ALTER TABLE user_broker_credentials
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'expired'));
+
+-- Backfill: the first 6 AM IST after the token was issued
+UPDATE user_broker_credentials
+SET expires_at = (
+    CASE WHEN (token_issued_at AT TIME ZONE 'Asia/Kolkata')::time < '06:00'
+        THEN date_trunc('day', token_issued_at AT TIME ZONE 'Asia/Kolkata') + INTERVAL '6 hours'
+        ELSE date_trunc('day', token_issued_at AT TIME ZONE 'Asia/Kolkata') + INTERVAL '30 hours'
+    END
+) AT TIME ZONE 'Asia/Kolkata'
+WHERE expires_at IS NULL;
+
+UPDATE user_broker_credentials SET status = 'expired' WHERE expires_at <= NOW();
+
+ALTER TABLE user_broker_credentials ALTER COLUMN expires_at SET NOT NULL;
+
+-- For the scheduler's sweep over active tokens
+CREATE INDEX IF NOT EXISTS idx_user_broker_credentials_active_expiry
+    ON user_broker_credentials(expires_at) WHERE status = 'active';
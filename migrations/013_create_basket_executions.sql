@@ -0,0 +1,47 @@
+-- migrations/013_create_basket_executions.sql
+
+-- One row per basket run. basket_id is kept nullable so the history survives
+-- deleting the basket.
+CREATE TABLE IF NOT EXISTS basket_executions (
+    id UUID PRIMARY KEY,
+    basket_id UUID REFERENCES baskets(id) ON DELETE SET NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    transaction_type TEXT NOT NULL CHECK (transaction_type IN ('BUY', 'SELL')),
+    status TEXT NOT NULL CHECK (status IN ('placing', 'completed', 'partially_failed', 'failed')),
+    margin_check JSONB, -- The pre-trade margin check the execution ran with
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_basket_executions_updated_at
+BEFORE UPDATE ON basket_executions
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_basket_executions_basket_id ON basket_executions(basket_id, created_at DESC);
+
+-- The orders sent to the broker for an execution
+CREATE TABLE IF NOT EXISTS execution_orders (
+    id UUID PRIMARY KEY,
+    execution_id UUID NOT NULL REFERENCES basket_executions(id) ON DELETE CASCADE,
+    symbol VARCHAR(50) NOT NULL,
+    exchange TEXT NOT NULL,
+    transaction_type TEXT NOT NULL CHECK (transaction_type IN ('BUY', 'SELL')),
+    order_type TEXT NOT NULL,
+    product TEXT NOT NULL,
+    variety TEXT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    price NUMERIC(12, 2), -- Limit price, NULL for market orders
+    status TEXT NOT NULL CHECK (status IN ('pending', 'placed', 'failed')),
+    broker_order_id TEXT, -- Kite's order_id once placed
+    error_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_execution_orders_updated_at
+BEFORE UPDATE ON execution_orders
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_execution_orders_execution_id ON execution_orders(execution_id);
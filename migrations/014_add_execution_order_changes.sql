@@ -0,0 +1,27 @@
+-- migrations/014_add_execution_order_changes.sql
+
+-- Stop-loss orders, cancelled orders, and a version for optimistic concurrency:
+-- every change is written with "WHERE version = <the version it was based on>".
+ALTER TABLE execution_orders
+    ADD COLUMN IF NOT EXISTS trigger_price NUMERIC(12, 2),
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE execution_orders DROP CONSTRAINT IF EXISTS execution_orders_status_check;
+ALTER TABLE execution_orders
+    ADD CONSTRAINT execution_orders_status_check CHECK (status IN ('pending', 'placed', 'failed', 'cancelled'));
+
+-- Audit trail: every attempt to modify or cancel an order, whether the broker accepted it or not
+CREATE TABLE IF NOT EXISTS execution_order_events (
+    id UUID PRIMARY KEY,
+    execution_id UUID NOT NULL REFERENCES basket_executions(id) ON DELETE CASCADE,
+    order_id UUID NOT NULL REFERENCES execution_orders(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('modify', 'cancel')),
+    outcome TEXT NOT NULL CHECK (outcome IN ('succeeded', 'failed', 'conflict')),
+    before_state JSONB NOT NULL,
+    after_state JSONB, -- Requested state, NULL for cancellations
+    error_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_execution_order_events_execution_id ON execution_order_events(execution_id, created_at);
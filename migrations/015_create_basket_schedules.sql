@@ -0,0 +1,52 @@
+-- migrations/015_create_basket_schedules.sql
+
+-- Recurring basket executions (SIPs): monthly on day_of_month, or weekly on day_of_week,
+-- at time_of_day IST. next_run_at is the next occurrence, already rolled forward to a
+-- trading day; the scheduler claims a run by moving it on with a conditional update.
+CREATE TABLE IF NOT EXISTS basket_schedules (
+    id UUID PRIMARY KEY,
+    basket_id UUID NOT NULL REFERENCES baskets(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    frequency TEXT NOT NULL CHECK (frequency IN ('monthly', 'weekly')),
+    day_of_month INT CHECK (day_of_month BETWEEN 1 AND 31), -- Monthly; short months use their last day
+    day_of_week INT CHECK (day_of_week BETWEEN 1 AND 5),    -- Weekly; 1 is Monday
+    time_of_day TEXT NOT NULL CHECK (time_of_day ~ '^[0-2][0-9]:[0-5][0-9]$'), -- HH:MM IST
+    options JSONB NOT NULL DEFAULT '{}', -- Execution options (order type, product, prices)
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    retry_missed BOOLEAN NOT NULL DEFAULT FALSE, -- Run late the same session instead of recording a miss
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((frequency = 'monthly' AND day_of_month IS NOT NULL) OR (frequency = 'weekly' AND day_of_week IS NOT NULL))
+);
+
+CREATE TRIGGER update_basket_schedules_updated_at
+BEFORE UPDATE ON basket_schedules
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_basket_schedules_user_id ON basket_schedules(user_id);
+CREATE INDEX IF NOT EXISTS idx_basket_schedules_due ON basket_schedules(next_run_at) WHERE enabled;
+
+-- One row per occurrence of a schedule: executed, failed, or missed (server down,
+-- broker session expired). Missed and failed runs can be retried.
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id UUID PRIMARY KEY,
+    schedule_id UUID NOT NULL REFERENCES basket_schedules(id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('running', 'succeeded', 'failed', 'missed')),
+    execution_id UUID REFERENCES basket_executions(id) ON DELETE SET NULL,
+    error_message TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (schedule_id, scheduled_for)
+);
+
+CREATE TRIGGER update_schedule_runs_updated_at
+BEFORE UPDATE ON schedule_runs
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id ON schedule_runs(schedule_id, scheduled_for DESC);
@@ -0,0 +1,10 @@
+-- migrations/016_add_amo_executions.sql
+
+-- After-market orders: execution_orders.variety is 'amo' for them, and an execution whose
+-- orders were all accepted as AMOs waits in 'queued_for_open' until the market opens.
+ALTER TABLE basket_executions DROP CONSTRAINT IF EXISTS basket_executions_status_check;
+ALTER TABLE basket_executions
+    ADD CONSTRAINT basket_executions_status_check
+    CHECK (status IN ('placing', 'completed', 'partially_failed', 'failed', 'queued_for_open'));
+
+CREATE INDEX IF NOT EXISTS idx_basket_executions_queued ON basket_executions(created_at) WHERE status = 'queued_for_open';
@@ -0,0 +1,30 @@
+-- migrations/017_create_gtt_triggers.sql
+
+-- GTT (Good Till Triggered) triggers placed at the broker, with the broker's trigger ID
+-- and the last known state. Linked to the basket or executed order they protect.
+CREATE TABLE IF NOT EXISTS gtt_triggers (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    basket_id UUID REFERENCES baskets(id) ON DELETE SET NULL,
+    execution_order_id UUID REFERENCES execution_orders(id) ON DELETE SET NULL,
+    broker_trigger_id BIGINT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('single', 'two-leg')),
+    symbol VARCHAR(50) NOT NULL,
+    exchange TEXT NOT NULL,
+    transaction_type TEXT NOT NULL CHECK (transaction_type IN ('BUY', 'SELL')),
+    product TEXT NOT NULL,
+    last_price NUMERIC(12, 2) NOT NULL,
+    legs JSONB NOT NULL, -- [{triggerPrice, limitPrice, quantity}], OCO: stop-loss then target
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, broker_trigger_id)
+);
+
+CREATE TRIGGER update_gtt_triggers_updated_at
+BEFORE UPDATE ON gtt_triggers
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_gtt_triggers_user_id ON gtt_triggers(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_gtt_triggers_basket_id ON gtt_triggers(basket_id);
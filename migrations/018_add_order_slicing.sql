@@ -0,0 +1,44 @@
+-- migrations/018_add_order_slicing.sql
+
+-- Instrument master: the largest quantity the exchange accepts in one order (NSE's
+-- "quantity freeze" list). Orders above it are split into child orders or sent as iceberg orders.
+CREATE TABLE IF NOT EXISTS instruments (
+    exchange TEXT NOT NULL,
+    symbol VARCHAR(50) NOT NULL,
+    freeze_quantity INT NOT NULL CHECK (freeze_quantity > 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (exchange, symbol)
+);
+
+CREATE TRIGGER update_instruments_updated_at
+BEFORE UPDATE ON instruments
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Iceberg parameters, and fills fetched from the broker (summed over child orders)
+ALTER TABLE execution_orders
+    ADD COLUMN IF NOT EXISTS iceberg_legs INT,
+    ADD COLUMN IF NOT EXISTS iceberg_quantity INT,
+    ADD COLUMN IF NOT EXISTS filled_quantity INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS average_price NUMERIC(12, 2);
+
+-- Child orders of an order split to stay within the freeze quantity
+CREATE TABLE IF NOT EXISTS execution_order_slices (
+    id UUID PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES execution_orders(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status TEXT NOT NULL CHECK (status IN ('pending', 'placed', 'failed', 'cancelled')),
+    broker_order_id TEXT,
+    error_message TEXT,
+    filled_quantity INT NOT NULL DEFAULT 0,
+    average_price NUMERIC(12, 2),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (order_id, seq)
+);
+
+CREATE TRIGGER update_execution_order_slices_updated_at
+BEFORE UPDATE ON execution_order_slices
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,34 @@
+-- migrations/019_create_jobs.sql
+
+-- Background jobs (basket executions and exits) run by the workers of every API instance.
+-- A worker claims a job with SELECT ... FOR UPDATE SKIP LOCKED, marks it running and hides
+-- it until locked_until (the visibility timeout), which it extends while the job runs.
+-- A running job past locked_until lost its worker (crash, restart) and is claimed again.
+-- Failures are retried at run_at until max_attempts; then the job is dead (dead letter).
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY,
+    type TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'dead')),
+    attempts INT NOT NULL DEFAULT 0, -- Claims so far, including the running one
+    max_attempts INT NOT NULL CHECK (max_attempts > 0),
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), -- Not claimed before (retry backoff)
+    locked_by TEXT,                            -- Worker running it
+    locked_until TIMESTAMPTZ,
+    result JSONB,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE TRIGGER update_jobs_updated_at
+BEFORE UPDATE ON jobs
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_jobs_queued ON jobs(run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, created_at DESC);
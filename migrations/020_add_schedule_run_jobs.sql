@@ -0,0 +1,9 @@
+-- migrations/020_add_schedule_run_jobs.sql
+
+-- Scheduled runs are executed through the job queue. A run records its job, and the
+-- execution ID the job was queued with, before a worker creates that execution, so
+-- execution_id can no longer reference basket_executions.
+ALTER TABLE schedule_runs DROP CONSTRAINT IF EXISTS schedule_runs_execution_id_fkey;
+
+ALTER TABLE schedule_runs
+    ADD COLUMN IF NOT EXISTS job_id UUID REFERENCES jobs(id) ON DELETE SET NULL;